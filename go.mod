@@ -1,18 +1,37 @@
 module github.com/awcullen/opcua
 
-go 1.16
+go 1.24.0
 
 require (
 	github.com/djherbis/buffer v1.2.0
+	github.com/eclipse/paho.mqtt.golang v1.5.1
 	github.com/gammazero/deque v0.1.0
 	github.com/gammazero/workerpool v1.1.2
 	github.com/google/uuid v1.3.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/iancoleman/strcase v0.3.0
 	github.com/pkg/errors v0.9.1
-	golang.org/x/crypto v0.0.0-20211202192323-5770296d904e
+	github.com/sirupsen/logrus v1.10.2
+	github.com/tidwall/gjson v1.19.0
+	golang.org/x/crypto v0.42.0
 	gotest.tools v2.2.0+incompatible
 )
 
 require (
-	github.com/google/go-cmp v0.5.6 // indirect
+	github.com/google/go-cmp v0.6.0 // indirect
+	github.com/stretchr/objx v0.5.3 // indirect
+	github.com/stretchr/testify v1.12.1 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.0 // indirect
+	github.com/yuin/goldmark v1.4.13 // indirect
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/mod v0.27.0 // indirect
+	golang.org/x/net v0.44.0 // indirect
+	golang.org/x/sync v0.17.0 // indirect
+	golang.org/x/sys v0.36.0 // indirect
+	golang.org/x/telemetry v0.0.0-20250807160809-1a19826ec488 // indirect
+	golang.org/x/term v0.35.0 // indirect
+	golang.org/x/text v0.29.0 // indirect
+	golang.org/x/tools v0.36.0 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
@@ -4,13 +4,94 @@ package server
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
 	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/afs/server/pkg/opcua/ua"
 )
 
+// createCertificate generates a self-signed application instance certificate and RSA key, and writes them in
+// PEM to the certFile and keyFile. Existing files are never overwritten. The certificate names the application uri, which clients and the
+// CreateSession service compare to the ApplicationDescription, and the host of the endpoint url and of the
+// local machine, which clients compare to the endpoint url.
+func createCertificate(applicationURI, applicationName, endpointURL, certFile, keyFile string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	uri, err := url.Parse(applicationURI)
+	if err != nil {
+		return ua.BadCertificateURIInvalid
+	}
+	var dnsNames []string
+	var ipAddresses []net.IP
+	if u, err := url.Parse(endpointURL); err == nil && u.Hostname() != "" {
+		if ip := net.ParseIP(u.Hostname()); ip != nil {
+			ipAddresses = append(ipAddresses, ip)
+		} else {
+			dnsNames = append(dnsNames, u.Hostname())
+		}
+	}
+	if host, err := os.Hostname(); err == nil && (len(dnsNames) == 0 || dnsNames[0] != host) {
+		dnsNames = append(dnsNames, host)
+	}
+	serialNumber, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	subjectKeyHash := sha1.New()
+	subjectKeyHash.Write(key.PublicKey.N.Bytes())
+	subjectKeyId := subjectKeyHash.Sum(nil)
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: applicationName},
+		SubjectKeyId:          subjectKeyId,
+		AuthorityKeyId:        subjectKeyId,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ipAddresses,
+		URIs:                  []*url.URL{uri},
+	}
+	rawcrt, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(keyFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, 0600); err != nil {
+		return err
+	}
+	return writePEM(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: rawcrt}, 0644)
+}
+
+// writePEM writes the block to a new file, creating its directory if needed. It fails if the file exists.
+func writePEM(file string, block *pem.Block, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(pem.EncodeToMemory(block)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 // validateClientCertificate validates the certificate of the client.
 func validateClientCertificate(certificate *x509.Certificate, trustedCertsFile string,
 	suppressCertificateTimeInvalid, suppressCertificateChainIncomplete bool) (bool, error) {
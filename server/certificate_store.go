@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// certificateThumbprint returns the thumbprint of the certificate, the hex encoded SHA1 hash of its DER encoding.
+func certificateThumbprint(cert []byte) string {
+	h := sha1.Sum(cert)
+	return strings.ToUpper(hex.EncodeToString(h[:]))
+}
+
+// validateRemoteCertificate validates the certificate of a client. If validation fails and the server has a
+// rejected certificate store, the certificate is saved there, so it may be inspected and trusted later.
+func (srv *UAServer) validateRemoteCertificate(cert *x509.Certificate) error {
+	srv.trustLock.RLock()
+	defer srv.trustLock.RUnlock()
+	valid, err := validateClientCertificate(cert, srv.trustedCertsPath, srv.suppressCertificateExpired, srv.suppressCertificateChainIncomplete)
+	if valid {
+		return nil
+	}
+	if srv.rejectedCertsPath != "" {
+		file := filepath.Join(srv.rejectedCertsPath, certificateThumbprint(cert.Raw)+".der")
+		if err := os.MkdirAll(srv.rejectedCertsPath, 0755); err == nil {
+			if err := ioutil.WriteFile(file, cert.Raw, 0644); err != nil {
+				srv.Logger().Errorf("Error saving rejected certificate. %s", err)
+			}
+		}
+	}
+	return err
+}
+
+// RejectedCertificates returns the thumbprints of the client certificates in the rejected certificate store.
+func (srv *UAServer) RejectedCertificates() ([]string, error) {
+	srv.trustLock.RLock()
+	defer srv.trustLock.RUnlock()
+	if srv.rejectedCertsPath == "" {
+		return nil, ua.BadConfigurationError
+	}
+	files, err := ioutil.ReadDir(srv.rejectedCertsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	thumbprints := []string{}
+	for _, f := range files {
+		if name := f.Name(); !f.IsDir() && filepath.Ext(name) == ".der" {
+			thumbprints = append(thumbprints, strings.TrimSuffix(name, ".der"))
+		}
+	}
+	sort.Strings(thumbprints)
+	return thumbprints, nil
+}
+
+// TrustCertificate moves the certificate with the thumbprint from the rejected certificate store to the trusted
+// certificates, so the client is accepted when it next connects.
+func (srv *UAServer) TrustCertificate(thumbprint string) error {
+	srv.trustLock.Lock()
+	defer srv.trustLock.Unlock()
+	if srv.rejectedCertsPath == "" || srv.trustedCertsPath == "" {
+		return ua.BadConfigurationError
+	}
+	file := filepath.Join(srv.rejectedCertsPath, strings.ToUpper(thumbprint)+".der")
+	if filepath.Dir(file) != filepath.Clean(srv.rejectedCertsPath) {
+		return ua.BadInvalidArgument
+	}
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ua.BadNotFound
+		}
+		return err
+	}
+	if _, err := x509.ParseCertificate(raw); err != nil {
+		return ua.BadCertificateInvalid
+	}
+	f, err := os.OpenFile(srv.trustedCertsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: raw}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestRejectedCertificateStore(t *testing.T) {
+	dir := t.TempDir()
+	srv := &UAServer{
+		logger:            nopLogger{},
+		trustedCertsPath:  filepath.Join(dir, "trusted.pem"),
+		rejectedCertsPath: filepath.Join(dir, "rejected"),
+	}
+	raw, _ := newTestCertificate(t, "localhost", "urn:localhost:client")
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbprint := certificateThumbprint(raw)
+
+	if err := srv.validateRemoteCertificate(cert); err != ua.BadSecurityChecksFailed {
+		t.Fatalf("expected %s for an untrusted certificate, got %v", ua.BadSecurityChecksFailed, err)
+	}
+	rejected, err := srv.RejectedCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejected) != 1 || rejected[0] != thumbprint {
+		t.Fatalf("expected the rejected certificate %s, got %v", thumbprint, rejected)
+	}
+
+	if err := srv.TrustCertificate("0000"); err != ua.BadNotFound {
+		t.Errorf("expected %s for an unknown thumbprint, got %v", ua.BadNotFound, err)
+	}
+	if err := srv.TrustCertificate("../trusted"); err != ua.BadInvalidArgument {
+		t.Errorf("expected %s for a path, got %v", ua.BadInvalidArgument, err)
+	}
+	if err := srv.TrustCertificate(thumbprint); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.validateRemoteCertificate(cert); err != nil {
+		t.Errorf("expected the trusted certificate to be accepted, got %v", err)
+	}
+	if rejected, _ := srv.RejectedCertificates(); len(rejected) != 0 {
+		t.Errorf("expected no rejected certificates, got %v", rejected)
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// Clock provides the current time to the server, for the timestamps of responses and values. Tests may use a
+// Clock that returns a fixed time.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock returns the current time in UTC.
+type realClock struct{}
+
+// The timestamps of responses and values are UTC, as the spec requires on the wire, whichever time zone the server
+// runs in.
+func (realClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Clock gets the Clock of the server.
+func (srv *UAServer) Clock() Clock {
+	if srv == nil || srv.clock == nil {
+		return realClock{}
+	}
+	return srv.clock
+}
+
+// now returns the current time of the Clock of the server, in UTC. All times of the server are read here, so an
+// injected Clock controls them.
+func (srv *UAServer) now() time.Time {
+	if srv == nil || srv.clock == nil {
+		return realClock{}.Now()
+	}
+	return srv.clock.Now().UTC()
+}
+
+// nowFromContext returns the current time of the Clock of the server of the context, in UTC.
+func nowFromContext(ctx context.Context) time.Time {
+	return serverFromContext(ctx).now()
+}
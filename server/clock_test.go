@@ -0,0 +1,148 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// fixedClock always returns the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestClock(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := WithClock(fixedClock(now))(srv); err != nil {
+		t.Fatal(err)
+	}
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	req := &ua.ReadRequest{
+		RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		NodesToRead:        []ua.ReadValueID{{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}},
+	}
+	if err := srv.handleRead(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	read, ok := res.(*ua.ReadResponse)
+	if !ok {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	if !read.ResponseHeader.Timestamp.Equal(now) {
+		t.Errorf("expected response timestamp %v, got %v", now, read.ResponseHeader.Timestamp)
+	}
+	if status := srv.ServerStatus(); !status.CurrentTime.Equal(now) {
+		t.Errorf("expected current time %v, got %v", now, status.CurrentTime)
+	}
+	if !session.timeCreated.Equal(now) || !session.LastAccess().Equal(now) {
+		t.Errorf("expected session times %v, got %v and %v", now, session.timeCreated, session.LastAccess())
+	}
+
+	// the values of the properties added by the server are stamped too.
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	if err := srv.NamespaceManager().SetEnumStrings(n, []ua.LocalizedText{ua.NewLocalizedText("Off", ""), ua.NewLocalizedText("On", "")}); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := srv.NamespaceManager().FindProperty(n, ua.NewQualifiedName(0, "EnumStrings")); !ok || !p.GetValue().ServerTimestamp.Equal(now) {
+		t.Errorf("expected EnumStrings stamped %v", now)
+	}
+
+	// the fault of a request without a session is stamped too.
+	srv.handleRead(ch.serverSecureChannel, 2, &ua.ReadRequest{})
+	res, _ = ch.WaitResponse(2, time.Second)
+	if fault, ok := res.(*ua.ServiceFault); !ok || !fault.ResponseHeader.Timestamp.Equal(now) {
+		t.Errorf("unexpected fault %+v", res)
+	}
+}
+
+func TestResponseTimestampsUTC(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	// the clock of the server may return local time.
+	if err := WithClock(fixedClock(time.Date(2021, 6, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*3600))))(srv); err != nil {
+		t.Fatal(err)
+	}
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	if err := srv.handleRead(ch.serverSecureChannel, 1, &ua.ReadRequest{
+		RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		NodesToRead:        []ua.ReadValueID{{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	read, ok := res.(*ua.ReadResponse)
+	if !ok {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	if loc := read.ResponseHeader.Timestamp.Location(); loc != time.UTC {
+		t.Errorf("expected read response timestamp in UTC, got %s", loc)
+	}
+
+	if err := srv.handleWrite(ch.serverSecureChannel, 2, &ua.WriteRequest{
+		RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		NodesToWrite:  []ua.WriteValue{{NodeID: testVariableID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(float64(43), 0, time.Time{}, 0, time.Time{}, 0)}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res, _ = ch.WaitResponse(2, time.Second)
+	write, ok := res.(*ua.WriteResponse)
+	if !ok || write.Results[0] != ua.Good {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	if loc := write.ResponseHeader.Timestamp.Location(); loc != time.UTC {
+		t.Errorf("expected write response timestamp in UTC, got %s", loc)
+	}
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	if loc := n.GetValue().SourceTimestamp.Location(); loc != time.UTC {
+		t.Errorf("expected written value timestamp in UTC, got %s", loc)
+	}
+}
+
+func TestMonitoredItemClock(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := WithClock(fixedClock(now))(srv); err != nil {
+		t.Fatal(err)
+	}
+	sub, ch := newTestSubscription(t, srv, ctx)
+	session := sub.session
+
+	req := &ua.CreateMonitoredItemsRequest{
+		RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		SubscriptionID:     sub.id,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{{
+			ItemToMonitor:       ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue},
+			MonitoringMode:      ua.MonitoringModeReporting,
+			RequestedParameters: ua.MonitoringParameters{SamplingInterval: 1000, QueueSize: 1},
+		}},
+	}
+	if err := srv.handleCreateMonitoredItems(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	r, ok := res.(*ua.CreateMonitoredItemsResponse)
+	if !ok || len(r.Results) != 1 || r.Results[0].StatusCode != ua.Good {
+		t.Fatalf("unexpected response %+v", res)
+	}
+
+	// the sampling of the item starts at the time of the clock.
+	sub.RLock()
+	mi := sub.items[r.Results[0].MonitoredItemID]
+	sub.RUnlock()
+	mi.Lock()
+	defer mi.Unlock()
+	if !mi.ts.Equal(now) {
+		t.Errorf("expected the sampling to start at %v, got %v", now, mi.ts)
+	}
+}
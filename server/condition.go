@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// condition is the state of a condition raised by the server. The last event is retained, so a client acknowledges
+// and confirms it with the Acknowledge and Confirm methods of the AcknowledgeableConditionType.
+type condition struct {
+	sync.Mutex
+	source *ObjectNode
+	last   ua.AlarmCondition
+}
+
+// addCondition returns the condition of the node, raising its events from the source object.
+func (m *NamespaceManager) addCondition(conditionID ua.NodeID, source *ObjectNode) *condition {
+	m.conditionsLock.Lock()
+	defer m.conditionsLock.Unlock()
+	// the condition is inactive, so there is nothing to acknowledge or confirm.
+	c := &condition{source: source, last: ua.AlarmCondition{AckedState: true, ConfirmedState: true}}
+	m.conditions[conditionID] = c
+	return c
+}
+
+// findCondition returns the condition of the node, if any.
+func (m *NamespaceManager) findCondition(conditionID ua.NodeID) (*condition, bool) {
+	m.conditionsLock.Lock()
+	defer m.conditionsLock.Unlock()
+	c, ok := m.conditions[conditionID]
+	return c, ok
+}
+
+// removeCondition removes the condition of the node, if any.
+func (m *NamespaceManager) removeCondition(conditionID ua.NodeID) {
+	m.conditionsLock.Lock()
+	defer m.conditionsLock.Unlock()
+	delete(m.conditions, conditionID)
+}
+
+// isConditionMethod returns true if the method is called with the ConditionId as the ObjectId.
+func isConditionMethod(methodID ua.NodeID) bool {
+	return methodID == ua.MethodIDAcknowledgeableConditionTypeAcknowledge || methodID == ua.MethodIDAcknowledgeableConditionTypeConfirm
+}
+
+// raise retains the event and raises it from the source object. A condition that becomes active must be
+// acknowledged and confirmed, otherwise the AckedState and ConfirmedState of the last event are kept. The event is
+// retained until the condition is inactive, acknowledged and confirmed.
+func (c *condition) raise(m *NamespaceManager, evt ua.AlarmCondition) {
+	c.Lock()
+	if evt.ActiveState && !c.last.ActiveState {
+		evt.AckedState, evt.ConfirmedState = false, false
+	} else {
+		evt.AckedState, evt.ConfirmedState = c.last.AckedState, c.last.ConfirmedState
+	}
+	evt.Retain = evt.ActiveState || !evt.AckedState || !evt.ConfirmedState
+	c.last = evt
+	c.Unlock()
+	m.OnEvent(c.source, &evt)
+}
+
+// initializeConditionMethods sets the handlers of the Acknowledge and Confirm methods of the
+// AcknowledgeableConditionType, called with the ConditionId as the ObjectId.
+func (srv *UAServer) initializeConditionMethods(nm *NamespaceManager) {
+	if n, ok := nm.FindMethod(ua.MethodIDAcknowledgeableConditionTypeAcknowledge); ok {
+		n.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+			return srv.updateCondition(ctx, req, ua.ObjectTypeIDAuditConditionAcknowledgeEventType)
+		})
+	}
+	if n, ok := nm.FindMethod(ua.MethodIDAcknowledgeableConditionTypeConfirm); ok {
+		n.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+			return srv.updateCondition(ctx, req, ua.ObjectTypeIDAuditConditionConfirmEventType)
+		})
+	}
+}
+
+// updateCondition acknowledges or confirms the retained event of the condition, then raises the changed condition
+// and an audit event of the auditEventType.
+func (srv *UAServer) updateCondition(ctx context.Context, req ua.CallMethodRequest, auditEventType ua.NodeID) ua.CallMethodResult {
+	m := srv.NamespaceManager()
+	c, ok := m.findCondition(req.ObjectID)
+	if !ok {
+		return ua.CallMethodResult{StatusCode: ua.BadNodeIDInvalid}
+	}
+	// the arguments are checked against the InputArguments of the method.
+	eventID, _ := req.InputArguments[0].(ua.ByteString)
+	comment, _ := req.InputArguments[1].(ua.LocalizedText)
+
+	c.Lock()
+	if !c.last.Retain || c.last.EventID != eventID {
+		c.Unlock()
+		return ua.CallMethodResult{StatusCode: ua.BadEventIDUnknown}
+	}
+	evt := c.last
+	var name string
+	switch auditEventType {
+	case ua.ObjectTypeIDAuditConditionAcknowledgeEventType:
+		if evt.AckedState {
+			c.Unlock()
+			return ua.CallMethodResult{StatusCode: ua.BadConditionBranchAlreadyAcked}
+		}
+		evt.AckedState = true
+		name = "Acknowledge"
+	default:
+		if evt.ConfirmedState {
+			c.Unlock()
+			return ua.CallMethodResult{StatusCode: ua.BadConditionBranchAlreadyConfirmed}
+		}
+		evt.ConfirmedState = true
+		name = "Confirm"
+	}
+	now := time.Now()
+	evt.EventID = newEventID()
+	evt.Time = now
+	evt.ReceiveTime = now
+	evt.Retain = evt.ActiveState || !evt.AckedState || !evt.ConfirmedState
+	c.last = evt
+	c.Unlock()
+
+	var clientUserID string
+	if session, ok := ctx.Value(SessionKey).(*Session); ok {
+		session.RLock()
+		clientUserID = session.clientUserIdOfSession
+		session.RUnlock()
+	}
+	m.OnEvent(c.source, &evt)
+	m.OnEvent(c.source, &ua.AuditConditionEvent{
+		EventID:          newEventID(),
+		EventType:        auditEventType,
+		SourceNode:       req.ObjectID,
+		SourceName:       "Method/" + name,
+		Time:             now,
+		ReceiveTime:      now,
+		Message:          comment,
+		Severity:         evt.Severity,
+		ActionTimeStamp:  now,
+		Status:           true,
+		ClientUserID:     clientUserID,
+		MethodID:         req.MethodID,
+		InputArguments:   req.InputArguments,
+		ConditionEventID: eventID,
+		Comment:          comment,
+	})
+	return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
+}
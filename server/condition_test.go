@@ -0,0 +1,148 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestAcknowledgeCondition(t *testing.T) {
+	permissions := ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeCall
+	srv, ctx := newTestServer(t, permissions)
+	srv.rolePermissions = []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: permissions}}
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	srv.initializeConditionMethods(nm)
+	level, source := newTestLimitAlarm(t, nm)
+	events := make(eventRecorder, 10)
+	source.AddEventListener(events)
+
+	level.SetValue(ua.NewDataValue(float64(55), 0, time.Now(), 0, time.Now(), 0))
+	active := (<-events).(*ua.AlarmCondition)
+
+	call := func(methodID ua.NodeID, eventID ua.ByteString) ua.StatusCode {
+		return srv.callMethod(ctx, ua.CallMethodRequest{
+			ObjectID:       level.GetNodeID(),
+			MethodID:       methodID,
+			InputArguments: []ua.Variant{eventID, ua.NewLocalizedText("Checked", "")},
+		}).StatusCode
+	}
+	if status := call(ua.MethodIDAcknowledgeableConditionTypeAcknowledge, ua.ByteString("unknown")); status != ua.BadEventIDUnknown {
+		t.Errorf("expected %s acknowledging an unknown event, got %s", ua.BadEventIDUnknown, status)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no event, got %+v", <-events)
+	}
+
+	if status := call(ua.MethodIDAcknowledgeableConditionTypeAcknowledge, active.EventID); status != ua.Good {
+		t.Fatalf("expected %s acknowledging the active event, got %s", ua.Good, status)
+	}
+	acked := (<-events).(*ua.AlarmCondition)
+	if !acked.AckedState || acked.ConfirmedState || !acked.ActiveState || !acked.Retain || acked.EventID == active.EventID {
+		t.Errorf("unexpected acknowledged condition %+v", acked)
+	}
+	audit := (<-events).(*ua.AuditConditionEvent)
+	if audit.EventType != ua.ObjectTypeIDAuditConditionAcknowledgeEventType || audit.SourceNode != level.GetNodeID() ||
+		audit.ConditionEventID != active.EventID || audit.Comment.Text != "Checked" {
+		t.Errorf("unexpected audit event %+v", audit)
+	}
+
+	// the previous event is no longer retained.
+	if status := call(ua.MethodIDAcknowledgeableConditionTypeAcknowledge, active.EventID); status != ua.BadEventIDUnknown {
+		t.Errorf("expected %s acknowledging a replaced event, got %s", ua.BadEventIDUnknown, status)
+	}
+	if status := call(ua.MethodIDAcknowledgeableConditionTypeAcknowledge, acked.EventID); status != ua.BadConditionBranchAlreadyAcked {
+		t.Errorf("expected %s acknowledging again, got %s", ua.BadConditionBranchAlreadyAcked, status)
+	}
+	if status := call(ua.MethodIDAcknowledgeableConditionTypeConfirm, acked.EventID); status != ua.Good {
+		t.Fatalf("expected %s confirming the acknowledged event, got %s", ua.Good, status)
+	}
+	if confirmed := (<-events).(*ua.AlarmCondition); !confirmed.ConfirmedState || !confirmed.Retain {
+		t.Errorf("unexpected confirmed condition %+v", confirmed)
+	}
+	if audit := (<-events).(*ua.AuditConditionEvent); audit.EventType != ua.ObjectTypeIDAuditConditionConfirmEventType {
+		t.Errorf("unexpected audit event %+v", audit)
+	}
+}
+
+func TestAcknowledgeConditionAfterReturnToNormal(t *testing.T) {
+	permissions := ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeCall
+	srv, ctx := newTestServer(t, permissions)
+	srv.rolePermissions = []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: permissions}}
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	srv.initializeConditionMethods(nm)
+	level, source := newTestLimitAlarm(t, nm)
+	events := make(eventRecorder, 10)
+	source.AddEventListener(events)
+
+	call := func(methodID ua.NodeID, eventID ua.ByteString) ua.StatusCode {
+		return srv.callMethod(ctx, ua.CallMethodRequest{
+			ObjectID:       level.GetNodeID(),
+			MethodID:       methodID,
+			InputArguments: []ua.Variant{eventID, ua.NewLocalizedText("Checked", "")},
+		}).StatusCode
+	}
+
+	// the alarm returns to normal before anyone acknowledges it.
+	level.SetValue(ua.NewDataValue(float64(55), 0, time.Now(), 0, time.Now(), 0))
+	<-events
+	level.SetValue(ua.NewDataValue(float64(20), 0, time.Now(), 0, time.Now(), 0))
+	normal := (<-events).(*ua.AlarmCondition)
+	if normal.ActiveState || normal.AckedState || normal.ConfirmedState || !normal.Retain {
+		t.Fatalf("expected an inactive, unacknowledged and retained condition, got %+v", normal)
+	}
+
+	if status := call(ua.MethodIDAcknowledgeableConditionTypeAcknowledge, normal.EventID); status != ua.Good {
+		t.Fatalf("expected %s acknowledging the inactive event, got %s", ua.Good, status)
+	}
+	acked := (<-events).(*ua.AlarmCondition)
+	if !acked.AckedState || acked.ActiveState || !acked.Retain {
+		t.Errorf("unexpected acknowledged condition %+v", acked)
+	}
+	<-events // audit
+	if status := call(ua.MethodIDAcknowledgeableConditionTypeConfirm, acked.EventID); status != ua.Good {
+		t.Fatalf("expected %s confirming the acknowledged event, got %s", ua.Good, status)
+	}
+	if confirmed := (<-events).(*ua.AlarmCondition); confirmed.Retain {
+		t.Errorf("expected the inactive, acknowledged and confirmed condition not to be retained, got %+v", confirmed)
+	}
+	<-events // audit
+
+	// the state is kept, and reset when the alarm becomes active again.
+	level.SetValue(ua.NewDataValue(float64(55), 0, time.Now(), 0, time.Now(), 0))
+	if active := (<-events).(*ua.AlarmCondition); active.AckedState || active.ConfirmedState || !active.Retain {
+		t.Errorf("expected an active, unacknowledged condition, got %+v", active)
+	}
+}
+
+func TestCallConditionMethodsOnly(t *testing.T) {
+	permissions := ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeCall
+	srv, ctx := newTestServer(t, permissions)
+	srv.rolePermissions = []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: permissions}}
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	srv.initializeConditionMethods(nm)
+	level, _ := newTestLimitAlarm(t, nm)
+
+	// other methods can't be called on the variable of the condition.
+	res := srv.callMethod(ctx, ua.CallMethodRequest{ObjectID: level.GetNodeID(), MethodID: testMethodID})
+	if res.StatusCode != ua.BadNodeClassInvalid {
+		t.Errorf("expected %s, got %s", ua.BadNodeClassInvalid, res.StatusCode)
+	}
+
+	// the condition is removed with its node.
+	if err := nm.DeleteNode(level, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nm.findCondition(level.GetNodeID()); ok {
+		t.Error("expected the condition to be removed with its node")
+	}
+}
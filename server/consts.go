@@ -29,6 +29,16 @@ const (
 
 	PropertyNameInternalId string = "_InternalId"
 	PropertyDescInternalId string = "InternalId"
+
+	// Entry Properties Name and Description
+	PropertyNamePollingInterval     string = "_PollingInterval"
+	PropertyDescPollingInterval     string = "Polling interval in milliseconds"
+	PropertyNameReconnectBackoff    string = "_ReconnectBackoff"
+	PropertyDescReconnectBackoff    string = "Initial delay in milliseconds before reconnecting after a failure"
+	PropertyNameStatus              string = "_Status"
+	PropertyDescStatus              string = "Connection status"
+	PropertyNameCommunicationStatus string = "_CommunicationStatus"
+	PropertyDescCommunicationStatus string = "Communication status of the device"
 )
 
 type ContextKey string
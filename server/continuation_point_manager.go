@@ -0,0 +1,101 @@
+package server
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sync"
+)
+
+// ContinuationPointKind is the service that issued a continuation point.
+type ContinuationPointKind int
+
+// The kinds of continuation point.
+const (
+	ContinuationPointBrowse ContinuationPointKind = iota
+	ContinuationPointHistory
+	ContinuationPointQuery
+)
+
+// ContinuationPointManager stores the continuation points of a session, with the data needed to continue the
+// service. Each kind of continuation point has its own limit. When the limit is reached, the oldest continuation
+// point of the kind is released to make room for the new one, and is then invalid.
+type ContinuationPointManager struct {
+	sync.Mutex
+	limits map[ContinuationPointKind]int
+	last   uint32
+	points map[uint32]*list.Element
+	order  map[ContinuationPointKind]*list.List
+}
+
+type continuationPoint struct {
+	id   uint32
+	kind ContinuationPointKind
+	data interface{}
+}
+
+// NewContinuationPointManager returns a ContinuationPointManager with the limit of each kind of continuation
+// point. A kind without a positive limit is unlimited.
+func NewContinuationPointManager(limits map[ContinuationPointKind]int) *ContinuationPointManager {
+	return &ContinuationPointManager{
+		limits: limits,
+		points: map[uint32]*list.Element{},
+		order:  map[ContinuationPointKind]*list.List{},
+	}
+}
+
+// Add stores the data and returns the continuation point.
+func (m *ContinuationPointManager) Add(kind ContinuationPointKind, data interface{}) []byte {
+	m.Lock()
+	defer m.Unlock()
+	order, ok := m.order[kind]
+	if !ok {
+		order = list.New()
+		m.order[kind] = order
+	}
+	if max := m.limits[kind]; max > 0 {
+		for order.Len() >= max {
+			delete(m.points, order.Remove(order.Front()).(*continuationPoint).id)
+		}
+	}
+	m.last++
+	m.points[m.last] = order.PushBack(&continuationPoint{id: m.last, kind: kind, data: data})
+	cp := make([]byte, 4)
+	binary.LittleEndian.PutUint32(cp, m.last)
+	return cp
+}
+
+// Remove releases the continuation point and returns its data. It returns false if the continuation point is
+// unknown, of another kind, or was already released.
+func (m *ContinuationPointManager) Remove(kind ContinuationPointKind, cp []byte) (interface{}, bool) {
+	if len(cp) != 4 {
+		return nil, false
+	}
+	m.Lock()
+	defer m.Unlock()
+	id := binary.LittleEndian.Uint32(cp)
+	e, ok := m.points[id]
+	if !ok || e.Value.(*continuationPoint).kind != kind {
+		return nil, false
+	}
+	delete(m.points, id)
+	m.order[kind].Remove(e)
+	return e.Value.(*continuationPoint).data, true
+}
+
+// Len returns the number of continuation points of the kind.
+func (m *ContinuationPointManager) Len(kind ContinuationPointKind) int {
+	m.Lock()
+	defer m.Unlock()
+	if order, ok := m.order[kind]; ok {
+		return order.Len()
+	}
+	return 0
+}
+
+// Clear releases all continuation points.
+func (m *ContinuationPointManager) Clear() {
+	m.Lock()
+	defer m.Unlock()
+	m.points = map[uint32]*list.Element{}
+	m.order = map[ContinuationPointKind]*list.List{}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestContinuationPointManager(t *testing.T) {
+	m := NewContinuationPointManager(map[ContinuationPointKind]int{ContinuationPointBrowse: 2})
+	first := m.Add(ContinuationPointBrowse, 1)
+	second := m.Add(ContinuationPointBrowse, 2)
+	// the history limit is not set, so these do not evict the browse continuation points.
+	history := m.Add(ContinuationPointHistory, 3)
+	m.Add(ContinuationPointHistory, 4)
+	m.Add(ContinuationPointHistory, 5)
+	if _, ok := m.Remove(ContinuationPointHistory, second); ok {
+		t.Error("expected a browse continuation point to be invalid for history")
+	}
+	third := m.Add(ContinuationPointBrowse, 6)
+	if n := m.Len(ContinuationPointBrowse); n != 2 {
+		t.Errorf("expected 2 browse continuation points, got %d", n)
+	}
+	if _, ok := m.Remove(ContinuationPointBrowse, first); ok {
+		t.Error("expected the oldest continuation point to be evicted")
+	}
+	for _, c := range []struct {
+		kind ContinuationPointKind
+		cp   []byte
+		data int
+	}{
+		{ContinuationPointBrowse, second, 2},
+		{ContinuationPointBrowse, third, 6},
+		{ContinuationPointHistory, history, 3},
+	} {
+		if data, ok := m.Remove(c.kind, c.cp); !ok || data != c.data {
+			t.Errorf("expected %d, got %v", c.data, data)
+		}
+		if _, ok := m.Remove(c.kind, c.cp); ok {
+			t.Errorf("expected continuation point of %d to be released", c.data)
+		}
+	}
+	m.Clear()
+	if n := m.Len(ContinuationPointHistory); n != 0 {
+		t.Errorf("expected no history continuation points, got %d", n)
+	}
+}
+
+func TestBrowseContinuationPointReuse(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	rds := []ua.ReferenceDescription{{NodeID: ua.NewExpandedNodeID(testVariableID)}, {NodeID: ua.NewExpandedNodeID(testMethodID)}}
+	max := int(srv.serverCapabilities.MaxBrowseContinuationPoints)
+	cps := make([][]byte, max+1)
+	for i := range cps {
+		cps[i] = session.addBrowseContinuationPoint(rds, 1)
+	}
+
+	req := &ua.BrowseNextRequest{
+		RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		ContinuationPoints: []ua.ByteString{ua.ByteString(cps[0]), ua.ByteString(cps[1])},
+	}
+	if err := srv.handleBrowseNext(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	next, ok := res.(*ua.BrowseNextResponse)
+	if !ok || len(next.Results) != 2 {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	if next.Results[0].StatusCode != ua.BadContinuationPointInvalid {
+		t.Errorf("expected evicted continuation point to be %s, got %s", ua.BadContinuationPointInvalid, next.Results[0].StatusCode)
+	}
+	if next.Results[1].StatusCode != ua.Good || len(next.Results[1].References) != 1 || len(next.Results[1].ContinuationPoint) == 0 {
+		t.Errorf("unexpected result %+v", next.Results[1])
+	}
+
+	req.ContinuationPoints = []ua.ByteString{ua.ByteString(cps[1])}
+	srv.handleBrowseNext(ch.serverSecureChannel, 2, req)
+	res, _ = ch.WaitResponse(2, time.Second)
+	if next, ok := res.(*ua.BrowseNextResponse); !ok || len(next.Results) != 1 || next.Results[0].StatusCode != ua.BadContinuationPointInvalid {
+		t.Errorf("expected reused continuation point to be %s, got %+v", ua.BadContinuationPointInvalid, res)
+	}
+
+	srv.SessionManager().Delete(session)
+	if n := session.continuationPoints.Len(ContinuationPointBrowse); n != 0 {
+		t.Errorf("expected closed session to release its continuation points, got %d", n)
+	}
+}
+
+func TestHistoryReadContinuationPointReuse(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeReadHistory)
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	h := &memoryHistorian{}
+	for i := 0; i < 5; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		h.values = append(h.values, ua.NewDataValue(float64(i), 0, ts, 0, ts, 0))
+	}
+	srv.historian = h
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	read := func(requestID int, cp ua.ByteString) ua.HistoryReadResult {
+		req := &ua.HistoryReadRequest{
+			RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+			HistoryReadDetails: ua.ReadRawModifiedDetails{
+				StartTime:        start,
+				EndTime:          start.Add(time.Hour),
+				NumValuesPerNode: 2,
+			},
+			TimestampsToReturn: ua.TimestampsToReturnSource,
+			NodesToRead:        []ua.HistoryReadValueID{{NodeID: testVariableID, ContinuationPoint: cp}},
+		}
+		if err := srv.handleHistoryRead(ch.serverSecureChannel, uint32(requestID), req); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := ch.WaitResponse(requestID, time.Second)
+		hr, ok := res.(*ua.HistoryReadResponse)
+		if !ok || len(hr.Results) != 1 {
+			t.Fatalf("unexpected response %+v", res)
+		}
+		return hr.Results[0]
+	}
+
+	first := read(1, "")
+	if len(first.HistoryData.(ua.HistoryData).DataValues) != 2 || len(first.ContinuationPoint) == 0 {
+		t.Fatalf("unexpected result %+v", first)
+	}
+	// the client only sees the continuation points of the session, not those of the historian.
+	if string(first.ContinuationPoint) == "2" {
+		t.Error("expected the historian continuation point to be replaced")
+	}
+	second := read(2, first.ContinuationPoint)
+	if second.StatusCode != ua.Good || len(second.HistoryData.(ua.HistoryData).DataValues) != 2 {
+		t.Fatalf("unexpected result %+v", second)
+	}
+	reads := h.reads
+	if replay := read(3, first.ContinuationPoint); replay.StatusCode != ua.BadContinuationPointInvalid {
+		t.Errorf("expected reused continuation point to be %s, got %s", ua.BadContinuationPointInvalid, replay.StatusCode)
+	}
+	if h.reads != reads {
+		t.Error("expected invalid continuation point not to reach the historian")
+	}
+	last := read(4, second.ContinuationPoint)
+	if len(last.HistoryData.(ua.HistoryData).DataValues) != 1 || len(last.ContinuationPoint) != 0 {
+		t.Errorf("unexpected result %+v", last)
+	}
+}
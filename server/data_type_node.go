@@ -116,9 +116,18 @@ func (n *DataTypeNode) IsAbstract() bool {
 
 // DataTypeDefinition returns the DataTypeDefinition attribute of this node.
 func (n *DataTypeNode) DataTypeDefinition() interface{} {
+	n.RLock()
+	defer n.RUnlock()
 	return n.dataTypeDefinition
 }
 
+// SetDataTypeDefinition sets the DataTypeDefinition attribute of this node.
+func (n *DataTypeNode) SetDataTypeDefinition(value interface{}) {
+	n.Lock()
+	n.dataTypeDefinition = value
+	n.Unlock()
+}
+
 // IsAttributeIDValid returns true if attributeId is supported for the node.
 func (n *DataTypeNode) IsAttributeIDValid(attributeID uint32) bool {
 	switch attributeID {
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/google/uuid"
+)
+
+// DefaultValueFor returns the zero value of the built-in DataType, e.g. int32(0) for Int32 and "" for String.
+// Arrays of one or more dimensions are empty slices of the type, e.g. []float64{} for Double. Abstract and
+// structured DataTypes, and arrays of more than one dimension, return nil.
+func DefaultValueFor(dataType ua.NodeID, rank int32) interface{} {
+	scalar := defaultScalarFor(dataType)
+	if scalar == nil {
+		return nil
+	}
+	switch rank {
+	case ua.ValueRankScalar, ua.ValueRankAny, ua.ValueRankScalarOrOneDimension:
+		return scalar
+	case ua.ValueRankOneDimension, ua.ValueRankOneOrMoreDimensions:
+		// the element type of a NodeId array is the interface, not the type of the null NodeId.
+		if _, ok := scalar.(ua.NodeID); ok {
+			return []ua.NodeID{}
+		}
+		return reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(scalar)), 0, 0).Interface()
+	default:
+		return nil
+	}
+}
+
+// defaultScalarFor returns the zero value of the built-in DataType, or nil if the DataType is not built-in.
+func defaultScalarFor(dataType ua.NodeID) interface{} {
+	switch dataType {
+	case ua.DataTypeIDBoolean:
+		return false
+	case ua.DataTypeIDSByte:
+		return int8(0)
+	case ua.DataTypeIDByte:
+		return byte(0)
+	case ua.DataTypeIDInt16:
+		return int16(0)
+	case ua.DataTypeIDUInt16:
+		return uint16(0)
+	case ua.DataTypeIDInt32, ua.DataTypeIDEnumeration:
+		return int32(0)
+	case ua.DataTypeIDUInt32:
+		return uint32(0)
+	case ua.DataTypeIDInt64:
+		return int64(0)
+	case ua.DataTypeIDUInt64:
+		return uint64(0)
+	case ua.DataTypeIDFloat:
+		return float32(0)
+	case ua.DataTypeIDDouble, ua.DataTypeIDDuration:
+		return float64(0)
+	case ua.DataTypeIDString, ua.DataTypeIDLocaleID:
+		return ""
+	case ua.DataTypeIDDateTime, ua.DataTypeIDUtcTime:
+		return time.Time{}
+	case ua.DataTypeIDGUID:
+		return uuid.UUID{}
+	case ua.DataTypeIDByteString:
+		return ua.ByteString("")
+	case ua.DataTypeIDXMLElement:
+		return ua.XMLElement("")
+	case ua.DataTypeIDNodeID:
+		return ua.NewNodeIDNumeric(0, 0)
+	case ua.DataTypeIDExpandedNodeID:
+		return ua.NilExpandedNodeID
+	case ua.DataTypeIDStatusCode:
+		return ua.Good
+	case ua.DataTypeIDQualifiedName:
+		return ua.QualifiedName{}
+	case ua.DataTypeIDLocalizedText:
+		return ua.LocalizedText{}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestDefaultValueFor(t *testing.T) {
+	cases := []struct {
+		dataType ua.NodeID
+		rank     int32
+		want     interface{}
+	}{
+		{ua.DataTypeIDBoolean, ua.ValueRankScalar, false},
+		{ua.DataTypeIDInt32, ua.ValueRankScalar, int32(0)},
+		{ua.DataTypeIDUInt16, ua.ValueRankAny, uint16(0)},
+		{ua.DataTypeIDDouble, ua.ValueRankScalarOrOneDimension, float64(0)},
+		{ua.DataTypeIDString, ua.ValueRankScalar, ""},
+		{ua.DataTypeIDDateTime, ua.ValueRankScalar, time.Time{}},
+		{ua.DataTypeIDNodeID, ua.ValueRankScalar, ua.NewNodeIDNumeric(0, 0)},
+		{ua.DataTypeIDDouble, ua.ValueRankOneDimension, []float64{}},
+		{ua.DataTypeIDString, ua.ValueRankOneOrMoreDimensions, []string{}},
+		{ua.DataTypeIDByteString, ua.ValueRankOneDimension, []ua.ByteString{}},
+		{ua.DataTypeIDNodeID, ua.ValueRankOneDimension, []ua.NodeID{}},
+		{ua.DataTypeIDInt32, 2, nil},
+		{ua.DataTypeIDBaseDataType, ua.ValueRankScalar, nil},
+		{ua.DataTypeIDStructure, ua.ValueRankScalar, nil},
+	}
+	for _, c := range cases {
+		if got := DefaultValueFor(c.dataType, c.rank); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("DefaultValueFor(%s, %d) = %#v, want %#v", c.dataType, c.rank, got, c.want)
+		}
+	}
+}
+
+func TestNewVariableNodeDefaultValue(t *testing.T) {
+	newNode := func(value ua.DataValue, dataType ua.NodeID, rank int32) *VariableNode {
+		return newTestVariable(ua.NewNodeIDString(1, "Tag"), ua.NewQualifiedName(1, "Tag"), dataType, rank, value, nil)
+	}
+	if v := newNode(ua.DataValue{}, ua.DataTypeIDInt32, ua.ValueRankScalar).GetValue().Value; v != int32(0) {
+		t.Errorf("expected int32(0), got %#v", v)
+	}
+	if v := newNode(ua.DataValue{}, ua.DataTypeIDFloat, ua.ValueRankOneDimension).GetValue().Value; !reflect.DeepEqual(v, []float32{}) {
+		t.Errorf("expected []float32{}, got %#v", v)
+	}
+	// an explicit value is kept.
+	if v := newNode(ua.NewDataValue(int32(7), 0, time.Now(), 0, time.Now(), 0), ua.DataTypeIDInt32, ua.ValueRankScalar).GetValue().Value; v != int32(7) {
+		t.Errorf("expected int32(7), got %#v", v)
+	}
+}
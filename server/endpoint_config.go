@@ -0,0 +1,94 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"sort"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// EndpointConfig configures an endpoint of the server with its own security policy, mode and accepted user tokens.
+type EndpointConfig struct {
+	// SecurityPolicyURI of the endpoint, e.g. ua.SecurityPolicyURIBasic256Sha256.
+	SecurityPolicyURI string
+	// SecurityMode of the endpoint.
+	SecurityMode ua.MessageSecurityMode
+	// UserTokenTypes accepted by the endpoint.
+	UserTokenTypes []ua.UserTokenType
+}
+
+// buildUserTokenPolicies returns the UserTokenPolicies for the token types accepted by the endpoint.
+func (c EndpointConfig) buildUserTokenPolicies() []ua.UserTokenPolicy {
+	// secrets must be encrypted, so endpoints without security use a policy for the token itself.
+	tokenSecurityPolicyURI := c.SecurityPolicyURI
+	if c.SecurityMode == ua.MessageSecurityModeNone {
+		tokenSecurityPolicyURI = ua.SecurityPolicyURIBasic256Sha256
+	}
+	toks := make([]ua.UserTokenPolicy, 0, len(c.UserTokenTypes))
+	for _, t := range c.UserTokenTypes {
+		switch t {
+		case ua.UserTokenTypeAnonymous:
+			toks = append(toks, ua.UserTokenPolicy{
+				PolicyID:          t.String(),
+				TokenType:         t,
+				SecurityPolicyURI: ua.SecurityPolicyURINone,
+			})
+		default:
+			toks = append(toks, ua.UserTokenPolicy{
+				PolicyID:          t.String(),
+				TokenType:         t,
+				SecurityPolicyURI: tokenSecurityPolicyURI,
+			})
+		}
+	}
+	return toks
+}
+
+// findEndpoint returns the endpoint matching the transport, security policy and mode negotiated by a secure channel.
+func (srv *UAServer) findEndpoint(transportProfileURI, securityPolicyURI string, securityMode ua.MessageSecurityMode) (ua.EndpointDescription, bool) {
+	for _, ep := range srv.Endpoints() {
+		if ep.TransportProfileURI == transportProfileURI && ep.SecurityPolicyURI == securityPolicyURI && ep.SecurityMode == securityMode {
+			return ep, true
+		}
+	}
+	return ua.EndpointDescription{}, false
+}
+
+// securityLevel returns a relative measure of the security strength of an endpoint. Clients use the
+// SecurityLevel to select the best endpoint, so stronger policies and modes rank higher.
+func securityLevel(securityPolicyURI string, securityMode ua.MessageSecurityMode) byte {
+	var policyRank byte
+	switch securityPolicyURI {
+	case ua.SecurityPolicyURIBasic128Rsa15:
+		policyRank = 1
+	case ua.SecurityPolicyURIBasic256:
+		policyRank = 2
+	case ua.SecurityPolicyURIBasic256Sha256:
+		policyRank = 3
+	case ua.SecurityPolicyURIAes128Sha256RsaOaep:
+		policyRank = 4
+	case ua.SecurityPolicyURIAes256Sha256RsaPss:
+		policyRank = 5
+	default:
+		return 0
+	}
+	var modeRank byte
+	switch securityMode {
+	case ua.MessageSecurityModeSign:
+		modeRank = 1
+	case ua.MessageSecurityModeSignAndEncrypt:
+		modeRank = 2
+	default:
+		return 0
+	}
+	return policyRank*4 + modeRank
+}
+
+// sortBySecurityLevel sorts the endpoints strongest first.
+func sortBySecurityLevel(eds []ua.EndpointDescription) []ua.EndpointDescription {
+	sort.SliceStable(eds, func(i, j int) bool {
+		return eds[i].SecurityLevel > eds[j].SecurityLevel
+	})
+	return eds
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestFindEndpointWithSecurityPolicyNone(t *testing.T) {
+	srv := &UAServer{
+		endpointURL: "opc.tcp://127.0.0.1:46010",
+		endpointConfigs: []EndpointConfig{
+			{
+				SecurityPolicyURI: ua.SecurityPolicyURINone,
+				SecurityMode:      ua.MessageSecurityModeNone,
+				UserTokenTypes:    []ua.UserTokenType{ua.UserTokenTypeAnonymous},
+			},
+			{
+				SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256,
+				SecurityMode:      ua.MessageSecurityModeSignAndEncrypt,
+				UserTokenTypes:    []ua.UserTokenType{ua.UserTokenTypeUserName, ua.UserTokenTypeCertificate},
+			},
+		},
+	}
+	if n := len(srv.Endpoints()); n != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", n)
+	}
+
+	ep, ok := srv.findEndpoint(ua.TransportProfileURIUaTcpTransport, ua.SecurityPolicyURINone, ua.MessageSecurityModeNone)
+	if !ok {
+		t.Fatal("expected endpoint with security policy None")
+	}
+	if len(ep.UserIdentityTokens) != 1 || ep.UserIdentityTokens[0].TokenType != ua.UserTokenTypeAnonymous {
+		t.Errorf("expected only anonymous token, got %+v", ep.UserIdentityTokens)
+	}
+
+	ep, ok = srv.findEndpoint(ua.TransportProfileURIUaTcpTransport, ua.SecurityPolicyURIBasic256Sha256, ua.MessageSecurityModeSignAndEncrypt)
+	if !ok {
+		t.Fatal("expected endpoint with security policy Basic256Sha256")
+	}
+	for _, tok := range ep.UserIdentityTokens {
+		if tok.TokenType == ua.UserTokenTypeAnonymous {
+			t.Errorf("unexpected anonymous token on secure endpoint")
+		}
+		if tok.SecurityPolicyURI != ua.SecurityPolicyURIBasic256Sha256 {
+			t.Errorf("expected token security policy %s, got %s", ua.SecurityPolicyURIBasic256Sha256, tok.SecurityPolicyURI)
+		}
+	}
+
+	if _, ok := srv.findEndpoint(ua.TransportProfileURIUaTcpTransport, ua.SecurityPolicyURIAes256Sha256RsaPss, ua.MessageSecurityModeSignAndEncrypt); ok {
+		t.Error("unexpected endpoint with security policy Aes256Sha256RsaPss")
+	}
+}
+
+func TestEndpointsOrderedBySecurityLevel(t *testing.T) {
+	srv := &UAServer{
+		endpointURL:             "opc.tcp://127.0.0.1:46010",
+		allowSecurityPolicyNone: true,
+		allowAnonymousIdentity:  true,
+	}
+	eps := srv.Endpoints()
+	var none, basic256Sha256 *ua.EndpointDescription
+	for i, ep := range eps {
+		if i > 0 && ep.SecurityLevel > eps[i-1].SecurityLevel {
+			t.Errorf("endpoints not sorted strongest first: %d > %d", ep.SecurityLevel, eps[i-1].SecurityLevel)
+		}
+		switch {
+		case ep.SecurityPolicyURI == ua.SecurityPolicyURINone && ep.SecurityMode == ua.MessageSecurityModeNone:
+			none = &eps[i]
+		case ep.SecurityPolicyURI == ua.SecurityPolicyURIBasic256Sha256 && ep.SecurityMode == ua.MessageSecurityModeSignAndEncrypt:
+			basic256Sha256 = &eps[i]
+		}
+	}
+	if none == nil || basic256Sha256 == nil {
+		t.Fatal("expected endpoints with security policy None and Basic256Sha256")
+	}
+	if basic256Sha256.SecurityLevel <= none.SecurityLevel {
+		t.Errorf("expected Basic256Sha256 SecurityLevel %d to be higher than None SecurityLevel %d", basic256Sha256.SecurityLevel, none.SecurityLevel)
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+const (
+	// DefaultPollingInterval is the polling interval of a new entry node, in milliseconds.
+	DefaultPollingInterval float64 = 1000
+	// DefaultReconnectBackoff is the initial reconnect backoff of a new entry node, in milliseconds.
+	DefaultReconnectBackoff float64 = 1000
+	// MaxReconnectBackoff is the longest delay between attempts to reconnect.
+	MaxReconnectBackoff = time.Minute
+
+	// The values of the Status property of an entry node.
+	EntryStatusStopped      string = "Stopped"
+	EntryStatusConnected    string = "Connected"
+	EntryStatusReconnecting string = "Reconnecting"
+
+	// The values of the CommunicationStatus property of an entry node.
+	CommunicationStatusGood       string = "Good"
+	CommunicationStatusBad        string = "Bad"
+	CommunicationStatusConnecting string = "Connecting"
+
+	// communicationFailedSeverity is the severity of the event raised when communication with a device fails.
+	communicationFailedSeverity uint16 = 700
+)
+
+// addEntryProperties creates the PollingInterval, ReconnectBackoff, Status and CommunicationStatus properties
+// of an entry node.
+func (n *ObjectNode) addEntryProperties(id string) {
+	for _, p := range []struct {
+		name, desc  string
+		value       interface{}
+		dataType    ua.NodeID
+		accessLevel byte
+	}{
+		{PropertyNamePollingInterval, PropertyDescPollingInterval, DefaultPollingInterval, ua.DataTypeIDDouble, ua.AccessLevelsCurrentRead | ua.AccessLevelsCurrentWrite},
+		{PropertyNameReconnectBackoff, PropertyDescReconnectBackoff, DefaultReconnectBackoff, ua.DataTypeIDDouble, ua.AccessLevelsCurrentRead | ua.AccessLevelsCurrentWrite},
+		{PropertyNameStatus, PropertyDescStatus, EntryStatusStopped, ua.DataTypeIDString, ua.AccessLevelsCurrentRead},
+		{PropertyNameCommunicationStatus, PropertyDescCommunicationStatus, CommunicationStatusConnecting, ua.DataTypeIDString, ua.AccessLevelsCurrentRead},
+	} {
+		prop := NewVariableNode(
+			ua.NewNodeIDString(DefaultNameSpace, id+PathSeparator+p.name),
+			ua.NewQualifiedName(DefaultNameSpace, p.name),
+			ua.NewLocalizedText(p.name, DefaultLocale),
+			ua.NewLocalizedText(p.desc, DefaultLocale),
+			nil,
+			[]ua.Reference{
+				ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)),
+				ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(n.NodeId)),
+			},
+			ua.NewDataValue(p.value, ua.Good, time.Now(), 0, time.Now(), 0),
+			p.dataType,
+			ua.ValueRankScalar,
+			[]uint32{},
+			p.accessLevel,
+			-1,
+			false,
+			nil,
+		)
+		prop.SetOwner(n)
+		n.properties[p.name] = prop
+	}
+}
+
+// PollingInterval returns the polling interval of this entry node.
+func (n *ObjectNode) PollingInterval() time.Duration {
+	return n.durationProperty(PropertyNamePollingInterval, DefaultPollingInterval)
+}
+
+// ReconnectBackoff returns the initial delay before reconnecting this entry node after a failure.
+func (n *ObjectNode) ReconnectBackoff() time.Duration {
+	return n.durationProperty(PropertyNameReconnectBackoff, DefaultReconnectBackoff)
+}
+
+// durationProperty returns the value in milliseconds of the property, or the default if the value is not positive.
+func (n *ObjectNode) durationProperty(name string, defaultValue float64) time.Duration {
+	ms := defaultValue
+	if prop, ok := n.GetProperty(name); ok {
+		if v, ok := prop.GetValue().Value.(float64); ok && v > 0 {
+			ms = v
+		}
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// SetEntryStatus sets the Status property of this entry node.
+func (n *ObjectNode) SetEntryStatus(status string) {
+	if prop, ok := n.GetProperty(PropertyNameStatus); ok {
+		prop.SetValue(ua.NewDataValue(status, ua.Good, time.Now(), 0, time.Now(), 0))
+	}
+}
+
+// CommunicationStatus returns the CommunicationStatus property of this entry node.
+func (n *ObjectNode) CommunicationStatus() string {
+	if prop, ok := n.GetProperty(PropertyNameCommunicationStatus); ok {
+		if v, ok := prop.GetValue().Value.(string); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// SetCommunicationStatus sets the CommunicationStatus property of this entry node. When the status changes to Bad,
+// an event is raised from the node with the reason as message.
+func (n *ObjectNode) SetCommunicationStatus(status string, reason error) {
+	prop, ok := n.GetProperty(PropertyNameCommunicationStatus)
+	if !ok || prop.GetValue().Value == status {
+		return
+	}
+	prop.SetValue(ua.NewDataValue(status, ua.Good, time.Now(), 0, time.Now(), 0))
+	if status != CommunicationStatusBad {
+		return
+	}
+	message := fmt.Sprintf("Communication with %s failed", n.BrowseName.Name)
+	if reason != nil {
+		message += ": " + reason.Error()
+	}
+	evt := &ua.BaseEvent{
+		EventID:     newEventID(),
+		EventType:   ua.ObjectTypeIDBaseEventType,
+		SourceNode:  n.NodeId,
+		SourceName:  n.BrowseName.Name,
+		Time:        time.Now(),
+		ReceiveTime: time.Now(),
+		Message:     ua.NewLocalizedText(message, DefaultLocale),
+		Severity:    communicationFailedSeverity,
+	}
+	if n.ctx != nil {
+		if m, ok := n.ctx.Value(CtxKeyNamespaceManager).(*NamespaceManager); ok {
+			m.OnEvent(n, evt)
+			return
+		}
+	}
+	n.OnEvent(evt)
+}
+
+// Backoff returns an exponentially increasing delay for repeated failures.
+type Backoff struct {
+	// Initial is the delay after the first failure.
+	Initial time.Duration
+	// Max is the longest delay.
+	Max      time.Duration
+	failures int
+}
+
+// Next records a failure and returns the delay before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	d := b.Initial
+	for i := 0; i < b.failures && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	b.failures++
+	return d
+}
+
+// Reset is called after a success, so the next failure is delayed by Initial.
+func (b *Backoff) Reset() {
+	b.failures = 0
+}
+
+// PollEntry calls poll every PollingInterval of the entry node, until the context is done. A plugin may call it
+// from Start, and cancel the context in Stop. When poll returns an error, the next call is delayed by an
+// exponential backoff beginning at the ReconnectBackoff of the node. The Status and CommunicationStatus properties
+// report the state.
+func PollEntry(ctx context.Context, node *ObjectNode, poll func(ctx context.Context) error) {
+	b := &Backoff{Max: MaxReconnectBackoff}
+	node.SetCommunicationStatus(CommunicationStatusConnecting, nil)
+	defer node.SetEntryStatus(EntryStatusStopped)
+	for {
+		delay := node.PollingInterval()
+		if err := poll(ctx); err != nil {
+			node.SetEntryStatus(EntryStatusReconnecting)
+			node.SetCommunicationStatus(CommunicationStatusBad, err)
+			b.Initial = node.ReconnectBackoff()
+			delay = b.Next()
+		} else {
+			node.SetEntryStatus(EntryStatusConnected)
+			node.SetCommunicationStatus(CommunicationStatusGood, nil)
+			b.Reset()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestBackoff(t *testing.T) {
+	b := &Backoff{Initial: time.Second, Max: 10 * time.Second}
+	for i, want := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		if d := b.Next(); d != want*time.Second {
+			t.Errorf("failure %d: expected %s, got %s", i+1, want*time.Second, d)
+		}
+	}
+	b.Reset()
+	if d := b.Next(); d != time.Second {
+		t.Errorf("expected %s after reset, got %s", time.Second, d)
+	}
+}
+
+// newTestEntryNode returns an entry node named Device, with the standard entry properties.
+func newTestEntryNode() *ObjectNode {
+	node := NewObjectNode(
+		ua.NewNodeIDString(DefaultNameSpace, "Device"),
+		ua.NewQualifiedName(DefaultNameSpace, "Device"),
+		ua.NewLocalizedText("Device", DefaultLocale),
+		ua.NewLocalizedText("", DefaultLocale),
+		nil,
+		[]ua.Reference{},
+		ua.EventNotifierSubscribeToEvents,
+	)
+	node.properties = map[string]*VariableNode{}
+	node.addEntryProperties("Device")
+	return node
+}
+
+func TestPollEntry(t *testing.T) {
+	node := newTestEntryNode()
+	if d := node.PollingInterval(); d != time.Second {
+		t.Errorf("expected default polling interval %s, got %s", time.Second, d)
+	}
+	node.MustGetProperty(PropertyNamePollingInterval).SetValue(ua.NewDataValue(float64(1), 0, time.Now(), 0, time.Now(), 0))
+	node.MustGetProperty(PropertyNameReconnectBackoff).SetValue(ua.NewDataValue(float64(1), 0, time.Now(), 0, time.Now(), 0))
+
+	status := func() string { return node.MustGetProperty(PropertyNameStatus).GetValue().Value.(string) }
+	ctx, cancel := context.WithCancel(context.Background())
+	polls := make(chan string)
+	done := make(chan struct{})
+	calls := 0
+	go func() {
+		PollEntry(ctx, node, func(ctx context.Context) error {
+			calls++
+			if calls > 1 {
+				// report the status set after the previous poll.
+				select {
+				case polls <- status():
+				case <-ctx.Done():
+				}
+			}
+			if calls <= 2 {
+				return errors.New("device not responding")
+			}
+			return nil
+		})
+		close(done)
+	}()
+	for _, want := range []string{EntryStatusReconnecting, EntryStatusReconnecting, EntryStatusConnected} {
+		if s := <-polls; s != want {
+			t.Errorf("expected status %s, got %s", want, s)
+		}
+	}
+	cancel()
+	<-done
+	if s := status(); s != EntryStatusStopped {
+		t.Errorf("expected status %s, got %s", EntryStatusStopped, s)
+	}
+}
+
+// eventRecorder is an EventListener that sends the received events to a channel.
+type eventRecorder chan ua.Event
+
+func (r eventRecorder) OnEvent(evt ua.Event) { r <- evt }
+
+func TestCommunicationStatus(t *testing.T) {
+	node := newTestEntryNode()
+	node.MustGetProperty(PropertyNamePollingInterval).SetValue(ua.NewDataValue(float64(1), 0, time.Now(), 0, time.Now(), 0))
+	node.MustGetProperty(PropertyNameReconnectBackoff).SetValue(ua.NewDataValue(float64(1), 0, time.Now(), 0, time.Now(), 0))
+	events := make(eventRecorder, 10)
+	node.AddEventListener(events)
+	if s := node.CommunicationStatus(); s != CommunicationStatusConnecting {
+		t.Errorf("expected status %s, got %s", CommunicationStatusConnecting, s)
+	}
+
+	// the device responds to the first polls, then goes offline.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	online := make(chan bool)
+	go PollEntry(ctx, node, func(ctx context.Context) error {
+		select {
+		case ok := <-online:
+			if ok {
+				return nil
+			}
+		case <-ctx.Done():
+		}
+		return errors.New("device not responding")
+	})
+	online <- true
+	online <- true
+	if s := node.CommunicationStatus(); s != CommunicationStatusGood {
+		t.Errorf("expected status %s, got %s", CommunicationStatusGood, s)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events while the device is online, got %d", len(events))
+	}
+	online <- false
+	online <- false
+	online <- false
+	if s := node.CommunicationStatus(); s != CommunicationStatusBad {
+		t.Errorf("expected status %s, got %s", CommunicationStatusBad, s)
+	}
+	select {
+	case evt := <-events:
+		e := evt.(*ua.BaseEvent)
+		if e.SourceNode != node.NodeId || e.Message.Text != "Communication with Device failed: device not responding" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected event when the device goes offline")
+	}
+	// the event is raised only on the transition.
+	if len(events) != 0 {
+		t.Errorf("expected 1 event, got %d more", len(events))
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// SetEnumStrings adds an EnumStrings property to the variable, with the label of each value from zero. Writes
+// of a value without a label are rejected with BadOutOfRange.
+func (m *NamespaceManager) SetEnumStrings(node *VariableNode, enumStrings []ua.LocalizedText) error {
+	return m.addEnumProperty(node, "EnumStrings", enumStrings, ua.DataTypeIDLocalizedText, len(enumStrings))
+}
+
+// SetEnumValues adds an EnumValues property to the variable, with the value and label of each value. Writes of a
+// value that is not defined are rejected with BadOutOfRange.
+func (m *NamespaceManager) SetEnumValues(node *VariableNode, enumValues []ua.EnumValueType) error {
+	list := make([]ua.ExtensionObject, len(enumValues))
+	for i, ev := range enumValues {
+		list[i] = ev
+	}
+	return m.addEnumProperty(node, "EnumValues", list, ua.DataTypeIDEnumValueType, len(list))
+}
+
+// addEnumProperty adds the property to the namespace, with the permissions of the variable.
+func (m *NamespaceManager) addEnumProperty(node *VariableNode, name string, value ua.Variant, dataType ua.NodeID, length int) error {
+	if _, ok := m.FindProperty(node, ua.NewQualifiedName(0, name)); ok {
+		return ua.BadNodeIDExists
+	}
+	nodeID := node.GetNodeID()
+	now := m.server.now()
+	prop := NewVariableNode(
+		ua.NewNodeIDString(nodeID.GetNamespaceIndex(), fmt.Sprintf("%v%s%s", nodeID.GetID(), PathSeparator, name)),
+		ua.NewQualifiedName(0, name),
+		ua.NewLocalizedText(name, ""),
+		ua.NewLocalizedText("", ""),
+		node.GetRolePermissions(),
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)),
+			ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(nodeID)),
+		},
+		ua.NewDataValue(value, 0, now, 0, now, 0),
+		dataType,
+		ua.ValueRankOneDimension,
+		[]uint32{uint32(length)},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	// the HasProperty reference from the variable is added with the property.
+	return m.AddNode(prop)
+}
+
+// checkEnumValue returns BadOutOfRange if the variable has an EnumStrings or EnumValues property, and the value is
+// an integer that is not defined by it.
+func (m *NamespaceManager) checkEnumValue(node *VariableNode, value ua.Variant) ua.StatusCode {
+	v, ok := toInt64(value)
+	if !ok {
+		return ua.Good
+	}
+	if prop, ok := m.FindProperty(node, ua.NewQualifiedName(0, "EnumStrings")); ok {
+		if enumStrings, ok := prop.GetValue().Value.([]ua.LocalizedText); ok && (v < 0 || v >= int64(len(enumStrings))) {
+			return ua.BadOutOfRange
+		}
+		return ua.Good
+	}
+	if prop, ok := m.FindProperty(node, ua.NewQualifiedName(0, "EnumValues")); ok {
+		if list, ok := prop.GetValue().Value.([]ua.ExtensionObject); ok {
+			for _, ev := range toEnumValues(list) {
+				if ev.Value == v {
+					return ua.Good
+				}
+			}
+			return ua.BadOutOfRange
+		}
+	}
+	return ua.Good
+}
+
+// toInt64 returns the value of an integer scalar as int64.
+func toInt64(value ua.Variant) (int64, bool) {
+	switch v := value.(type) {
+	case int8:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return math.MaxInt64, true
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
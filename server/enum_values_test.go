@@ -0,0 +1,64 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestEnumValues(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	nm := srv.NamespaceManager()
+	rp := []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeWrite}}
+	newEnum := func(name string) *VariableNode {
+		n := newTestVariable(ua.NewNodeIDString(1, name), ua.NewQualifiedName(1, name), ua.DataTypeIDInt32, ua.ValueRankScalar, ua.NewDataValue(int32(0), 0, time.Now(), 0, time.Now(), 0), rp)
+		if err := nm.AddNode(n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	write := func(n *VariableNode, value int32) ua.StatusCode {
+		return srv.writeValue(ctx, ua.WriteValue{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(value, 0, time.Time{}, 0, time.Time{}, 0)})
+	}
+
+	mode := newEnum("Mode")
+	labels := []ua.LocalizedText{ua.NewLocalizedText("Off", ""), ua.NewLocalizedText("Manual", ""), ua.NewLocalizedText("Auto", "")}
+	if err := nm.SetEnumStrings(mode, labels); err != nil {
+		t.Fatal(err)
+	}
+	if err := nm.SetEnumStrings(mode, labels); err == nil {
+		t.Error("expected EnumStrings to be added once")
+	}
+	v := srv.readValue(ctx, ua.ReadValueID{NodeID: ua.NewNodeIDString(1, "Mode/EnumStrings"), AttributeID: ua.AttributeIDValue})
+	if v.StatusCode != ua.Good || !reflect.DeepEqual(v.Value, labels) {
+		t.Errorf("unexpected EnumStrings %v (%s)", v.Value, v.StatusCode)
+	}
+	if status := write(mode, 2); status != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, status)
+	}
+	for _, value := range []int32{3, -1} {
+		if status := write(mode, value); status != ua.BadOutOfRange {
+			t.Errorf("%d: expected %s, got %s", value, ua.BadOutOfRange, status)
+		}
+	}
+	if v := mode.GetValue().Value; v != int32(2) {
+		t.Errorf("expected value 2, got %v", v)
+	}
+
+	state := newEnum("State")
+	if err := nm.SetEnumValues(state, []ua.EnumValueType{
+		{Value: 1, DisplayName: ua.NewLocalizedText("Stopped", "")},
+		{Value: 2, DisplayName: ua.NewLocalizedText("Running", "")},
+		{Value: 4, DisplayName: ua.NewLocalizedText("Faulted", "")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if status := write(state, 3); status != ua.BadOutOfRange {
+		t.Errorf("expected %s, got %s", ua.BadOutOfRange, status)
+	}
+	if status := write(state, 4); status != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, status)
+	}
+}
@@ -20,4 +20,6 @@ var (
 	ErrInvalidFormType     = eris.New(msg.InvalidFormType)
 	ErrParentNotFound      = eris.New(msg.ParentNotFound)
 	ErrProjectNotLoaded    = eris.New("Project was not ready yet")
+	ErrNodeIDExisted       = eris.New("NodeId was already taken")
+	ErrCyclicReference     = eris.New("Node cannot be a child of itself or its descendants")
 )
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// RangeCheck is the check of the values written to a variable against its EURange property.
+type RangeCheck byte
+
+const (
+	// RangeCheckNone writes values outside the EURange unchanged.
+	RangeCheckNone RangeCheck = iota
+	// RangeCheckReject rejects values outside the EURange with BadOutOfRange.
+	RangeCheckReject
+	// RangeCheckClamp clamps values outside the EURange to the range, and sets the limit bits of the value.
+	RangeCheckClamp
+)
+
+// SetRangeCheck sets the check of the values written to the variable against its EURange property. Variables
+// without an EURange are not checked. (default: RangeCheckNone)
+func (n *VariableNode) SetRangeCheck(check RangeCheck) {
+	n.Lock()
+	n.rangeCheck = check
+	n.Unlock()
+}
+
+// GetRangeCheck returns the check of the values written to the variable against its EURange property.
+func (n *VariableNode) GetRangeCheck() RangeCheck {
+	n.RLock()
+	res := n.rangeCheck
+	n.RUnlock()
+	return res
+}
+
+// checkRange returns the value, or for RangeCheckClamp a copy with the numbers outside the range clamped and
+// true. For RangeCheckReject, a number outside the range returns BadOutOfRange.
+func checkRange(check RangeCheck, r ua.Range, value ua.DataValue) (ua.DataValue, bool, ua.StatusCode) {
+	v := reflect.ValueOf(value.Value)
+	var clone reflect.Value
+	switch {
+	case v.Kind() == reflect.Slice && isNumberKind(v.Type().Elem().Kind()):
+		clone = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(clone, v)
+	case isNumberKind(v.Kind()):
+		clone = reflect.New(v.Type()).Elem()
+		clone.Set(v)
+	default:
+		return value, false, ua.Good
+	}
+	var low, high bool
+	elems := []reflect.Value{clone}
+	if clone.Kind() == reflect.Slice {
+		elems = make([]reflect.Value, clone.Len())
+		for i := range elems {
+			elems[i] = clone.Index(i)
+		}
+	}
+	for _, e := range elems {
+		var f float64
+		switch e.Kind() {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(e.Int())
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(e.Uint())
+		default:
+			f = e.Float()
+		}
+		switch {
+		case f < r.Low:
+			low = true
+			setNumber(e, r.Low, math.Ceil)
+		case f > r.High:
+			high = true
+			setNumber(e, r.High, math.Floor)
+		}
+	}
+	if !low && !high {
+		return value, false, ua.Good
+	}
+	if check == RangeCheckReject {
+		return value, false, ua.BadOutOfRange
+	}
+	limit := ua.LimitBitsLow
+	if high {
+		limit = ua.LimitBitsHigh
+	}
+	value.Value = clone.Interface()
+	value.StatusCode = ua.StatusCode(uint32(value.StatusCode)&^(ua.InfoTypeMask|ua.LimitBitsMask) | ua.InfoTypeDataValue | limit)
+	return value, true, ua.Good
+}
+
+// isNumberKind returns true if the kind is an integer or floating point number.
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setNumber sets the number to the limit, rounding the limit inside the range for integers.
+func setNumber(e reflect.Value, limit float64, round func(float64) float64) {
+	switch e.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.SetInt(int64(round(limit)))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		e.SetUint(uint64(math.Max(round(limit), 0)))
+	default:
+		e.SetFloat(limit)
+	}
+}
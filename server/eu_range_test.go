@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestWriteRangeCheck(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	euRange := newTestVariable(ua.NewNodeIDString(1, "Variable.EURange"), ua.NewQualifiedName(0, "EURange"), ua.DataTypeIDRange, ua.ValueRankScalar,
+		ua.NewDataValue(ua.Range{Low: 0, High: 100}, 0, time.Now(), 0, time.Now(), 0), nil,
+		ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(testVariableID)))
+	euRange.SetAccessLevel(ua.AccessLevelsCurrentRead)
+	if err := srv.NamespaceManager().AddNode(euRange); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	write := func(value float64) ua.StatusCode {
+		return srv.writeValue(ctx, ua.WriteValue{NodeID: testVariableID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(value, 0, time.Time{}, 0, time.Time{}, 0)})
+	}
+
+	// without a check, the value is written unchanged.
+	if result := write(150); result != ua.Good || n.GetValue().Value != float64(150) {
+		t.Errorf("expected 150 written, got %s, %v", result, n.GetValue().Value)
+	}
+
+	n.SetRangeCheck(RangeCheckReject)
+	if result := write(-1); result != ua.BadOutOfRange {
+		t.Errorf("expected %s, got %s", ua.BadOutOfRange, result)
+	}
+	if v := n.GetValue().Value; v != float64(150) {
+		t.Errorf("expected value unchanged, got %v", v)
+	}
+	if result := write(50); result != ua.Good || n.GetValue().Value != float64(50) {
+		t.Errorf("expected 50 written, got %s, %v", result, n.GetValue().Value)
+	}
+
+	n.SetRangeCheck(RangeCheckClamp)
+	if result := write(150); result != ua.GoodClamped {
+		t.Errorf("expected %s, got %s", ua.GoodClamped, result)
+	}
+	v := n.GetValue()
+	if v.Value != float64(100) {
+		t.Errorf("expected value clamped to 100, got %v", v.Value)
+	}
+	if uint32(v.StatusCode)&ua.InfoTypeMask != ua.InfoTypeDataValue || uint32(v.StatusCode)&ua.LimitBitsMask != ua.LimitBitsHigh {
+		t.Errorf("expected high limit bits, got %#x", uint32(v.StatusCode))
+	}
+	if result := write(25); result != ua.Good || n.GetValue().Value != float64(25) || n.GetValue().StatusCode != ua.Good {
+		t.Errorf("expected 25 written, got %s, %v", result, n.GetValue())
+	}
+}
+
+func TestCheckRangeArray(t *testing.T) {
+	value := ua.NewDataValue([]int32{-5, 50, 105}, 0, time.Time{}, 0, time.Time{}, 0)
+	clamped, ok, status := checkRange(RangeCheckClamp, ua.Range{Low: 0.5, High: 100}, value)
+	if status != ua.Good || !ok {
+		t.Fatalf("expected the array clamped, got %s", status)
+	}
+	if v := clamped.Value.([]int32); v[0] != 1 || v[1] != 50 || v[2] != 100 {
+		t.Errorf("unexpected array %v", v)
+	}
+	if v := value.Value.([]int32); v[0] != -5 {
+		t.Errorf("expected the written array unchanged, got %v", v)
+	}
+}
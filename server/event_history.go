@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// EventHistory stores the events raised by historized objects in memory, and reads them for HistoryRead
+// requests with ReadEventDetails. When full, the oldest events are discarded.
+type EventHistory struct {
+	sync.RWMutex
+	srv      *UAServer
+	capacity int
+	records  []eventRecord
+}
+
+type eventRecord struct {
+	nodeID ua.NodeID
+	time   time.Time
+	evt    ua.Event
+}
+
+// eventHistoryListener stores the events of one object.
+type eventHistoryListener struct {
+	h      *EventHistory
+	nodeID ua.NodeID
+}
+
+func (l *eventHistoryListener) OnEvent(evt ua.Event) {
+	l.h.Append(l.nodeID, evt)
+}
+
+// NewEventHistory returns an EventHistory that stores up to capacity events.
+func NewEventHistory(srv *UAServer, capacity int) *EventHistory {
+	return &EventHistory{srv: srv, capacity: capacity}
+}
+
+// Historize stores the events raised by the object, including those of its notifiers.
+func (h *EventHistory) Historize(node *ObjectNode) {
+	node.AddEventListener(&eventHistoryListener{h: h, nodeID: node.NodeId})
+}
+
+// Append stores the event of the object. Events are ordered by their Time field.
+func (h *EventHistory) Append(nodeID ua.NodeID, evt ua.Event) {
+	t, _ := evt.GetAttribute(ua.BaseEventSelectClauses[4]).(time.Time)
+	h.Lock()
+	defer h.Unlock()
+	i := sort.Search(len(h.records), func(i int) bool { return h.records[i].time.After(t) })
+	h.records = append(h.records, eventRecord{})
+	copy(h.records[i+1:], h.records[i:])
+	h.records[i] = eventRecord{nodeID: nodeID, time: t, evt: evt}
+	if h.capacity > 0 && len(h.records) > h.capacity {
+		h.records = append(h.records[:0], h.records[len(h.records)-h.capacity:]...)
+	}
+}
+
+// ReadEvent reads the stored events of each node that pass the where clause of the filter, and returns the
+// fields selected by the filter. The time range is interpreted as for ReadRawModified. A continuation point
+// is the offset of the next event in the range.
+func (h *EventHistory) ReadEvent(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadEventDetails,
+	timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode) {
+	results := make([]ua.HistoryReadResult, len(nodesToRead))
+	if releaseContinuationPoints {
+		return results, ua.Good
+	}
+	start, end := details.StartTime, details.EndTime
+	limited := start.IsZero() || end.IsZero()
+	if (start.IsZero() && end.IsZero()) || (limited && details.NumValuesPerNode == 0) {
+		for i := range results {
+			results[i] = ua.HistoryReadResult{StatusCode: ua.BadInvalidTimestampArgument}
+		}
+		return results, ua.Good
+	}
+	h.RLock()
+	defer h.RUnlock()
+	for i, n := range nodesToRead {
+		offset := 0
+		if len(n.ContinuationPoint) > 0 {
+			var err error
+			if offset, err = strconv.Atoi(string(n.ContinuationPoint)); err != nil || offset < 0 {
+				results[i] = ua.HistoryReadResult{StatusCode: ua.BadContinuationPointInvalid}
+				continue
+			}
+		}
+		events := h.query(n.NodeID, details)
+		if offset > len(events) {
+			offset = len(events)
+		}
+		events = events[offset:]
+		var cp ua.ByteString
+		if max := int(details.NumValuesPerNode); max > 0 && len(events) > max {
+			events = events[:max]
+			if !limited {
+				cp = ua.ByteString(strconv.Itoa(offset + max))
+			}
+		}
+		fields := make([]ua.HistoryEventFieldList, len(events))
+		for j, evt := range events {
+			fields[j] = ua.HistoryEventFieldList{EventFields: selectEventFields(details.Filter.SelectClauses, evt, timestampsToReturn)}
+		}
+		results[i] = ua.HistoryReadResult{ContinuationPoint: cp, HistoryData: ua.HistoryEvent{Events: fields}}
+	}
+	return results, ua.Good
+}
+
+// query returns the events of the node in the time range that pass the where clause, in the order of the range.
+func (h *EventHistory) query(nodeID ua.NodeID, details ua.ReadEventDetails) []ua.Event {
+	start, end := details.StartTime, details.EndTime
+	forward := !start.IsZero() && (end.IsZero() || !start.After(end))
+	from, to := start, end
+	if !forward && start.IsZero() {
+		from, to = end, time.Time{}
+	}
+	events := []ua.Event{}
+	add := func(r eventRecord) {
+		if r.nodeID != nodeID {
+			return
+		}
+		if res, ok := evaluateWhereClause(h.srv, details.Filter.WhereClause, r.evt, 0).(bool); ok && res {
+			events = append(events, r.evt)
+		}
+	}
+	if forward {
+		for i := sort.Search(len(h.records), func(i int) bool { return !h.records[i].time.Before(from) }); i < len(h.records) && (to.IsZero() || h.records[i].time.Before(to)); i++ {
+			add(h.records[i])
+		}
+		return events
+	}
+	for i := sort.Search(len(h.records), func(i int) bool { return h.records[i].time.After(from) }) - 1; i >= 0 && (to.IsZero() || h.records[i].time.After(to)); i-- {
+		add(h.records[i])
+	}
+	return events
+}
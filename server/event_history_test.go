@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestEventHistory(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeReadHistory)
+	srv.eventHistory = NewEventHistory(srv, 10)
+	source, _ := srv.NamespaceManager().FindObject(testObjectID)
+	srv.eventHistory.Historize(source)
+
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+	// events are raised out of order, and are read in the order of their time.
+	for _, e := range []struct {
+		minute   int
+		severity uint16
+	}{{1, 700}, {3, 700}, {2, 300}, {4, 700}, {5, 300}} {
+		source.OnEvent(&ua.BaseEvent{
+			EventType:  ua.ObjectTypeIDBaseEventType,
+			SourceNode: testObjectID,
+			Time:       at(e.minute),
+			Message:    ua.NewLocalizedText("Event", ""),
+			Severity:   e.severity,
+		})
+	}
+
+	eventTime, severity := ua.BaseEventSelectClauses[4], ua.BaseEventSelectClauses[7]
+	highSeverity := ua.EventFilter{
+		SelectClauses: []ua.SimpleAttributeOperand{eventTime, severity},
+		WhereClause: ua.ContentFilter{Elements: []ua.ContentFilterElement{{
+			FilterOperator: ua.FilterOperatorEquals,
+			FilterOperands: []ua.ExtensionObject{severity, ua.LiteralOperand{Value: uint16(700)}},
+		}}},
+	}
+	read := func(details ua.ReadEventDetails, cp ua.ByteString) ua.HistoryReadResult {
+		results, status := srv.eventHistory.ReadEvent(context.Background(), []ua.HistoryReadValueID{{NodeID: testObjectID, ContinuationPoint: cp}}, details, ua.TimestampsToReturnBoth, false)
+		if status != ua.Good || len(results) != 1 {
+			t.Fatalf("unexpected results %v (%s)", results, status)
+		}
+		return results[0]
+	}
+	times := func(r ua.HistoryReadResult) []time.Time {
+		ts := []time.Time{}
+		for _, e := range r.HistoryData.(ua.HistoryEvent).Events {
+			if e.EventFields[1] != uint16(700) {
+				t.Errorf("expected severity 700, got %v", e.EventFields[1])
+			}
+			ts = append(ts, e.EventFields[0].(time.Time))
+		}
+		return ts
+	}
+
+	first := read(ua.ReadEventDetails{StartTime: at(1), EndTime: at(5), NumValuesPerNode: 2, Filter: highSeverity}, "")
+	if ts := times(first); len(ts) != 2 || !ts[0].Equal(at(1)) || !ts[1].Equal(at(3)) || len(first.ContinuationPoint) == 0 {
+		t.Fatalf("unexpected first page %v", ts)
+	}
+	second := read(ua.ReadEventDetails{StartTime: at(1), EndTime: at(5), NumValuesPerNode: 2, Filter: highSeverity}, first.ContinuationPoint)
+	if ts := times(second); len(ts) != 1 || !ts[0].Equal(at(4)) || len(second.ContinuationPoint) != 0 {
+		t.Errorf("unexpected second page %v", ts)
+	}
+	if ts := times(read(ua.ReadEventDetails{StartTime: at(2), EndTime: at(4), Filter: highSeverity}, "")); len(ts) != 1 || !ts[0].Equal(at(3)) {
+		t.Errorf("unexpected window %v", ts)
+	}
+	if ts := times(read(ua.ReadEventDetails{EndTime: at(4), NumValuesPerNode: 2, Filter: highSeverity}, "")); len(ts) != 2 || !ts[0].Equal(at(4)) || !ts[1].Equal(at(3)) {
+		t.Errorf("expected events read backward from the end, got %v", ts)
+	}
+	if r := read(ua.ReadEventDetails{Filter: highSeverity}, ""); r.StatusCode != ua.BadInvalidTimestampArgument {
+		t.Errorf("expected %s, got %s", ua.BadInvalidTimestampArgument, r.StatusCode)
+	}
+
+	// the server reads events from the event history without a historian.
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	req := &ua.HistoryReadRequest{
+		RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		HistoryReadDetails: ua.ReadEventDetails{StartTime: at(0), EndTime: at(10), Filter: highSeverity},
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		NodesToRead:        []ua.HistoryReadValueID{{NodeID: testObjectID}},
+	}
+	if err := srv.handleHistoryRead(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	if hr, ok := res.(*ua.HistoryReadResponse); !ok || len(hr.Results) != 1 || len(times(hr.Results[0])) != 3 {
+		t.Errorf("unexpected response %+v", res)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	deque "github.com/gammazero/deque"
+)
+
+// eventReplay keeps the recent events of each event source, so a new event monitored item receives the events
+// raised shortly before it was created. Each source keeps up to capacity events, for up to window.
+type eventReplay struct {
+	sync.Mutex
+	window   time.Duration
+	capacity int
+	buffers  map[ua.NodeID]*deque.Deque
+}
+
+type replayRecord struct {
+	received time.Time
+	evt      ua.Event
+}
+
+func newEventReplay(window time.Duration, capacity int) *eventReplay {
+	return &eventReplay{window: window, capacity: capacity, buffers: map[ua.NodeID]*deque.Deque{}}
+}
+
+// append stores the event raised by the source, discarding the events older than the window and the oldest
+// events when full.
+func (r *eventReplay) append(source ua.NodeID, evt ua.Event) {
+	now := time.Now()
+	r.Lock()
+	defer r.Unlock()
+	q, ok := r.buffers[source]
+	if !ok {
+		q = deque.New(0, r.capacity)
+		r.buffers[source] = q
+	}
+	q.PushBack(replayRecord{received: now, evt: evt})
+	for q.Len() > r.capacity || now.Sub(q.Front().(replayRecord).received) > r.window {
+		q.PopFront()
+	}
+}
+
+// events returns the events raised by the source within the window, the oldest first.
+func (r *eventReplay) events(source ua.NodeID) []ua.Event {
+	now := time.Now()
+	r.Lock()
+	defer r.Unlock()
+	q, ok := r.buffers[source]
+	if !ok {
+		return nil
+	}
+	for q.Len() > 0 && now.Sub(q.Front().(replayRecord).received) > r.window {
+		q.PopFront()
+	}
+	if q.Len() == 0 {
+		delete(r.buffers, source)
+		return nil
+	}
+	events := make([]ua.Event, q.Len())
+	for i := range events {
+		events[i] = q.At(i).(replayRecord).evt
+	}
+	return events
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// maxEventSeverity is the highest severity of an event.
+const maxEventSeverity uint16 = 1000
+
+// VariableIDMinEventSeverity is the NodeID of the variable of the minimum severity of the events raised by the server,
+// a property of the VendorServerInfo object.
+var VariableIDMinEventSeverity = ua.NewNodeIDString(1, "Server.MinEventSeverity")
+
+// MinEventSeverity gets the minimum severity of the events raised by the server. Events of a lower severity are
+// dropped.
+func (srv *UAServer) MinEventSeverity() uint16 {
+	srv.RLock()
+	defer srv.RUnlock()
+	return srv.minEventSeverity
+}
+
+// SetMinEventSeverity sets the minimum severity of the events raised by the server, e.g. to suppress the low-severity
+// events during commissioning. Zero raises all events.
+func (srv *UAServer) SetMinEventSeverity(value uint16) error {
+	if value > maxEventSeverity {
+		return ua.BadOutOfRange
+	}
+	srv.Lock()
+	srv.minEventSeverity = value
+	srv.Unlock()
+	return nil
+}
+
+// suppressesEvent returns true if the severity of the event is below the minimum severity.
+func (srv *UAServer) suppressesEvent(evt ua.Event) bool {
+	min := srv.MinEventSeverity()
+	if min == 0 {
+		return false
+	}
+	severity, _ := evt.GetAttribute(ua.BaseEventSelectClauses[7]).(uint16)
+	return severity < min
+}
+
+// minEventSeverityRolePermissions let the administrators write the minimum event severity, since raising it
+// suppresses the alarms of every client.
+var minEventSeverityRolePermissions = []ua.RolePermissionType{
+	{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	{RoleID: ua.ObjectIDWellKnownRoleAuthenticatedUser, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	{RoleID: ua.ObjectIDWellKnownRoleOperator, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	{RoleID: ua.ObjectIDWellKnownRoleSupervisor, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	{RoleID: ua.ObjectIDWellKnownRoleConfigureAdmin, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeWrite},
+	{RoleID: ua.ObjectIDWellKnownRoleSecurityAdmin, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeWrite},
+}
+
+// initializeMinEventSeverity adds the variable of the minimum event severity to the VendorServerInfo object, so an
+// administrator adjusts it at runtime.
+func (srv *UAServer) initializeMinEventSeverity(nm *NamespaceManager) error {
+	n := NewVariableNode(
+		VariableIDMinEventSeverity,
+		ua.NewQualifiedName(1, "MinEventSeverity"),
+		ua.NewLocalizedText("MinEventSeverity", ""),
+		ua.NewLocalizedText("The minimum severity of the events raised by the server.", ""),
+		minEventSeverityRolePermissions,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)),
+			ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(ua.ObjectIDServerVendorServerInfo)),
+		},
+		ua.NewDataValue(srv.MinEventSeverity(), 0, srv.now(), 0, srv.now(), 0),
+		ua.DataTypeIDUInt16,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		-1,
+		false,
+		nil,
+	)
+	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		return ua.NewDataValue(srv.MinEventSeverity(), 0, srv.now(), 0, srv.now(), 0)
+	})
+	n.SetWriteValueHandler(func(ctx context.Context, req ua.WriteValue) (ua.DataValue, ua.StatusCode) {
+		value, ok := req.Value.Value.(uint16)
+		if !ok {
+			return req.Value, ua.BadTypeMismatch
+		}
+		if err := srv.SetMinEventSeverity(value); err != nil {
+			return req.Value, ua.BadOutOfRange
+		}
+		return ua.NewDataValue(value, 0, srv.now(), 0, srv.now(), 0), ua.Good
+	})
+	return nm.AddNode(n)
+}
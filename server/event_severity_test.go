@@ -0,0 +1,67 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestMinEventSeverity(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	srv.rolePermissions = []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeWrite}}
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.initializeMinEventSeverity(nm); err != nil {
+		t.Fatal(err)
+	}
+	source, _ := nm.FindObject(testObjectID)
+	events := make(eventRecorder, 10)
+	source.AddEventListener(events)
+	raise := func(severities ...uint16) []uint16 {
+		for _, severity := range severities {
+			nm.OnEvent(source, &ua.BaseEvent{EventID: newEventID(), EventType: ua.ObjectTypeIDBaseEventType, SourceNode: testObjectID, Time: time.Now(), Severity: severity})
+		}
+		var delivered []uint16
+		for len(events) > 0 {
+			delivered = append(delivered, (<-events).(*ua.BaseEvent).Severity)
+		}
+		return delivered
+	}
+
+	if delivered := raise(1, 500); len(delivered) != 2 {
+		t.Errorf("expected all events without a minimum severity, got %v", delivered)
+	}
+	if err := srv.SetMinEventSeverity(500); err != nil {
+		t.Fatal(err)
+	}
+	if delivered := raise(1, 499, 500, 900); len(delivered) != 2 || delivered[0] != 500 || delivered[1] != 900 {
+		t.Errorf("expected the events of severity 500 and 900, got %v", delivered)
+	}
+	if err := srv.SetMinEventSeverity(1001); err != ua.BadOutOfRange {
+		t.Errorf("expected %s, got %v", ua.BadOutOfRange, err)
+	}
+
+	// an operator may not adjust the minimum severity, an administrator adjusts it by writing the variable.
+	session := ctx.Value(SessionKey).(*Session)
+	session.userRoles = []ua.NodeID{ua.ObjectIDWellKnownRoleOperator}
+	wv := ua.WriteValue{NodeID: VariableIDMinEventSeverity, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(uint16(800), 0, time.Time{}, 0, time.Time{}, 0)}
+	if result := srv.writeValue(ctx, wv); result != ua.BadUserAccessDenied {
+		t.Fatalf("expected %s for an operator, got %s", ua.BadUserAccessDenied, result)
+	}
+	if min := srv.MinEventSeverity(); min != 500 {
+		t.Errorf("expected the minimum severity 500, got %d", min)
+	}
+	session.userRoles = []ua.NodeID{ua.ObjectIDWellKnownRoleConfigureAdmin}
+	if result := srv.writeValue(ctx, wv); result != ua.Good {
+		t.Fatalf("expected %s, got %s", ua.Good, result)
+	}
+	if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: VariableIDMinEventSeverity, AttributeID: ua.AttributeIDValue}); dv.Value != uint16(800) {
+		t.Errorf("expected the minimum severity 800, got %v", dv.Value)
+	}
+	if delivered := raise(500, 900); len(delivered) != 1 || delivered[0] != 900 {
+		t.Errorf("expected the event of severity 900, got %v", delivered)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// the number of values requested from the historian for each page of an export.
+const historyExportPageSize uint32 = 1000
+
+// ExportCSV writes the raw history of the node between start and end as CSV rows of timestamp, value and quality.
+// The first row is a header. Timestamps are in RFC3339 format and the quality is the hex StatusCode.
+// The history is read in pages using continuation points, so large ranges are not held in memory.
+func ExportCSV(ctx context.Context, h HistoryReader, nodeID ua.NodeID, start, end time.Time, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"timestamp", "value", "quality"}); err != nil {
+		return err
+	}
+	details := ua.ReadRawModifiedDetails{StartTime: start, EndTime: end, NumValuesPerNode: historyExportPageSize}
+	nodesToRead := []ua.HistoryReadValueID{{NodeID: nodeID}}
+	for {
+		results, status := h.ReadRawModified(ctx, nodesToRead, details, ua.TimestampsToReturnBoth, false)
+		if status.IsBad() {
+			return status
+		}
+		if len(results) != 1 {
+			return ua.BadUnexpectedError
+		}
+		result := results[0]
+		if result.StatusCode.IsBad() {
+			return result.StatusCode
+		}
+		for _, v := range historyDataValues(result.HistoryData) {
+			ts := v.SourceTimestamp
+			if ts.IsZero() {
+				ts = v.ServerTimestamp
+			}
+			if err := cw.Write([]string{ts.UTC().Format(time.RFC3339Nano), fmt.Sprint(v.Value), fmt.Sprintf("0x%08X", uint32(v.StatusCode))}); err != nil {
+				// release the continuation point.
+				if len(result.ContinuationPoint) > 0 {
+					nodesToRead[0].ContinuationPoint = result.ContinuationPoint
+					h.ReadRawModified(ctx, nodesToRead, details, ua.TimestampsToReturnBoth, true)
+				}
+				return err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if len(result.ContinuationPoint) == 0 {
+			return nil
+		}
+		nodesToRead[0].ContinuationPoint = result.ContinuationPoint
+	}
+}
+
+// historyDataValues returns the data values of the HistoryData of a HistoryReadResult.
+func historyDataValues(data ua.ExtensionObject) []ua.DataValue {
+	switch d := data.(type) {
+	case ua.HistoryData:
+		return d.DataValues
+	case *ua.HistoryData:
+		return d.DataValues
+	}
+	return nil
+}
+
+// ExportHistoryCSV writes the raw history of the node between start and end as CSV, using the historian of the server.
+func (srv *UAServer) ExportHistoryCSV(ctx context.Context, nodeID ua.NodeID, start, end time.Time, w io.Writer) error {
+	h := srv.Historian()
+	if h == nil {
+		return ua.BadHistoryOperationUnsupported
+	}
+	return ExportCSV(ctx, h, nodeID, start, end, w)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// memoryHistorian stores the raw history of one node in memory, and pages through it using continuation points.
+type memoryHistorian struct {
+	HistoryReadWriter
+	values []ua.DataValue
+	reads  int
+}
+
+func (h *memoryHistorian) ReadRawModified(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadRawModifiedDetails,
+	timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode) {
+	h.reads++
+	results := make([]ua.HistoryReadResult, len(nodesToRead))
+	for i, n := range nodesToRead {
+		offset := 0
+		if len(n.ContinuationPoint) > 0 {
+			var err error
+			if offset, err = strconv.Atoi(string(n.ContinuationPoint)); err != nil {
+				results[i] = ua.HistoryReadResult{StatusCode: ua.BadContinuationPointInvalid}
+				continue
+			}
+		}
+		if releaseContinuationPoints {
+			continue
+		}
+		page := []ua.DataValue{}
+		for ; offset < len(h.values) && uint32(len(page)) < details.NumValuesPerNode; offset++ {
+			v := h.values[offset]
+			if !v.SourceTimestamp.Before(details.StartTime) && v.SourceTimestamp.Before(details.EndTime) {
+				page = append(page, v)
+			}
+		}
+		results[i] = ua.HistoryReadResult{HistoryData: ua.HistoryData{DataValues: page}}
+		if offset < len(h.values) {
+			results[i].ContinuationPoint = ua.ByteString(strconv.Itoa(offset))
+		}
+	}
+	return results, ua.Good
+}
+
+func TestExportHistoryCSV(t *testing.T) {
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	h := &memoryHistorian{}
+	for ts := start; ts.Before(start.Add(24 * time.Hour)); ts = ts.Add(time.Minute) {
+		h.values = append(h.values, ua.NewDataValue(float64(ts.Minute()), 0, ts, 0, ts, 0))
+	}
+	h.values[10].StatusCode = ua.UncertainLastUsableValue
+	srv := &UAServer{historian: h}
+
+	var buf bytes.Buffer
+	if err := srv.ExportHistoryCSV(context.Background(), testVariableID, start, start.Add(24*time.Hour), &buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+24*60 {
+		t.Fatalf("expected %d rows, got %d", 1+24*60, len(rows))
+	}
+	if rows[0][0] != "timestamp" || rows[0][1] != "value" || rows[0][2] != "quality" {
+		t.Errorf("unexpected header %v", rows[0])
+	}
+	if rows[1][0] != "2021-06-01T00:00:00Z" || rows[1][1] != "0" || rows[1][2] != "0x00000000" {
+		t.Errorf("unexpected row %v", rows[1])
+	}
+	if rows[11][1] != "10" || rows[11][2] != "0x40900000" {
+		t.Errorf("unexpected row %v", rows[11])
+	}
+	if rows[len(rows)-1][0] != "2021-06-01T23:59:00Z" {
+		t.Errorf("unexpected row %v", rows[len(rows)-1])
+	}
+	if h.reads != 2 {
+		t.Errorf("expected 2 pages, got %d", h.reads)
+	}
+
+	if err := (&UAServer{}).ExportHistoryCSV(context.Background(), testVariableID, start, start, &buf); err != ua.BadHistoryOperationUnsupported {
+		t.Errorf("expected %s, got %v", ua.BadHistoryOperationUnsupported, err)
+	}
+}
@@ -4,6 +4,8 @@ package server
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"github.com/afs/server/pkg/opcua/ua"
 )
@@ -46,6 +48,7 @@ type HistoryReader interface {
 	// return desired choice of timestamps. Implementation must return ContinuationPoints if more results
 	// are available than can be returned in current call. Implementation must release ContinuationPoints
 	// if no further results are desired. See OPC UA Part 11 chapter 6.4.3.2 for Read Raw functionality.
+	// Implementation may use ReadRawValues to select the raw values of a node.
 	ReadRawModified(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadRawModifiedDetails,
 		timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode)
 
@@ -67,3 +70,65 @@ type HistoryReader interface {
 	ReadAtTime(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadAtTimeDetails,
 		timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode)
 }
+
+// ReadRawValues returns the raw values selected by the details, from values sorted by SourceTimestamp.
+// If only StartTime is set, up to NumValuesPerNode values are read forward from StartTime. If only EndTime is
+// set, up to NumValuesPerNode values are read backward from EndTime. If both are set, the values from StartTime
+// up to but excluding EndTime are returned, in reverse order if StartTime is after EndTime, and the caller
+// pages them by NumValuesPerNode. If ReturnBounds is set, the values just outside the interval are included
+// with the ExtraData bit set, or a value with status BadBoundNotFound if there is none.
+func ReadRawValues(values []ua.DataValue, details ua.ReadRawModifiedDetails) ([]ua.DataValue, ua.StatusCode) {
+	start, end := details.StartTime, details.EndTime
+	if start.IsZero() && end.IsZero() {
+		return nil, ua.BadInvalidTimestampArgument
+	}
+	limit := -1
+	if start.IsZero() || end.IsZero() {
+		if details.NumValuesPerNode == 0 {
+			return nil, ua.BadInvalidTimestampArgument
+		}
+		limit = int(details.NumValuesPerNode)
+	}
+	results := []ua.DataValue{}
+	if !start.IsZero() && (end.IsZero() || !start.After(end)) {
+		// read forward from the start.
+		i := sort.Search(len(values), func(i int) bool { return !values[i].SourceTimestamp.Before(start) })
+		if details.ReturnBounds && (i == len(values) || !values[i].SourceTimestamp.Equal(start)) {
+			results = append(results, boundValue(values, i-1, start))
+		}
+		for n := 0; i < len(values) && n != limit && (end.IsZero() || values[i].SourceTimestamp.Before(end)); i, n = i+1, n+1 {
+			results = append(results, values[i])
+		}
+		if details.ReturnBounds && !end.IsZero() {
+			results = append(results, boundValue(values, i, end))
+		}
+		return results, ua.Good
+	}
+	// read backward from the later time.
+	from, to := end, time.Time{}
+	if !start.IsZero() {
+		from, to = start, end
+	}
+	i := sort.Search(len(values), func(i int) bool { return values[i].SourceTimestamp.After(from) }) - 1
+	if details.ReturnBounds && (i < 0 || !values[i].SourceTimestamp.Equal(from)) {
+		results = append(results, boundValue(values, i+1, from))
+	}
+	for n := 0; i >= 0 && n != limit && (to.IsZero() || values[i].SourceTimestamp.After(to)); i, n = i-1, n+1 {
+		results = append(results, values[i])
+	}
+	if details.ReturnBounds && !to.IsZero() {
+		results = append(results, boundValue(values, i, to))
+	}
+	return results, ua.Good
+}
+
+// boundValue returns the value at index i marked as ExtraData, or a value with status BadBoundNotFound at the
+// time of the bound if the index is out of range.
+func boundValue(values []ua.DataValue, i int, t time.Time) ua.DataValue {
+	if i < 0 || i >= len(values) {
+		return ua.NewDataValue(nil, ua.BadBoundNotFound, t, 0, t, 0)
+	}
+	v := values[i]
+	v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.HistorianBitsExtraData)
+	return v
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestReadRawValues(t *testing.T) {
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time { return start.Add(time.Duration(minute) * time.Minute) }
+	values := []ua.DataValue{}
+	// values every minute from minute 1 to 5.
+	for i := 1; i <= 5; i++ {
+		values = append(values, ua.NewDataValue(float64(i), 0, at(i), 0, at(i), 0))
+	}
+	extra := ua.StatusCode(ua.InfoTypeDataValue | ua.HistorianBitsExtraData)
+	for _, c := range []struct {
+		name    string
+		details ua.ReadRawModifiedDetails
+		values  []interface{}
+		bounds  []ua.StatusCode
+		status  ua.StatusCode
+	}{
+		{"no times", ua.ReadRawModifiedDetails{NumValuesPerNode: 2}, nil, nil, ua.BadInvalidTimestampArgument},
+		{"start without count", ua.ReadRawModifiedDetails{StartTime: at(2)}, nil, nil, ua.BadInvalidTimestampArgument},
+		{"forward from start", ua.ReadRawModifiedDetails{StartTime: at(2), NumValuesPerNode: 2}, []interface{}{2.0, 3.0}, nil, ua.Good},
+		{"backward from end", ua.ReadRawModifiedDetails{EndTime: at(4), NumValuesPerNode: 2}, []interface{}{4.0, 3.0}, nil, ua.Good},
+		{"range", ua.ReadRawModifiedDetails{StartTime: at(2), EndTime: at(4)}, []interface{}{2.0, 3.0}, nil, ua.Good},
+		{"reverse range", ua.ReadRawModifiedDetails{StartTime: at(4), EndTime: at(2)}, []interface{}{4.0, 3.0}, nil, ua.Good},
+		{"range with bounds", ua.ReadRawModifiedDetails{StartTime: at(2).Add(time.Second), EndTime: at(4), ReturnBounds: true},
+			[]interface{}{2.0, 3.0, 4.0}, []ua.StatusCode{extra, 0, extra}, ua.Good},
+		// a value at the start time is its own bound.
+		{"range with value at start", ua.ReadRawModifiedDetails{StartTime: at(2), EndTime: at(3), ReturnBounds: true},
+			[]interface{}{2.0, 3.0}, []ua.StatusCode{0, extra}, ua.Good},
+		{"reverse range with bounds", ua.ReadRawModifiedDetails{StartTime: at(4).Add(time.Second), EndTime: at(3), ReturnBounds: true},
+			[]interface{}{5.0, 4.0, 3.0}, []ua.StatusCode{extra, 0, extra}, ua.Good},
+		{"forward with bound", ua.ReadRawModifiedDetails{StartTime: at(2).Add(time.Second), NumValuesPerNode: 1, ReturnBounds: true},
+			[]interface{}{2.0, 3.0}, []ua.StatusCode{extra, 0}, ua.Good},
+		{"backward with bound", ua.ReadRawModifiedDetails{EndTime: at(2).Add(time.Second), NumValuesPerNode: 1, ReturnBounds: true},
+			[]interface{}{3.0, 2.0}, []ua.StatusCode{extra, 0}, ua.Good},
+		{"bounds not found", ua.ReadRawModifiedDetails{StartTime: at(0), EndTime: at(6), ReturnBounds: true},
+			[]interface{}{nil, 1.0, 2.0, 3.0, 4.0, 5.0, nil}, []ua.StatusCode{ua.BadBoundNotFound, 0, 0, 0, 0, 0, ua.BadBoundNotFound}, ua.Good},
+	} {
+		results, status := ReadRawValues(values, c.details)
+		if status != c.status {
+			t.Errorf("%s: expected %s, got %s", c.name, c.status, status)
+			continue
+		}
+		if len(results) != len(c.values) {
+			t.Errorf("%s: expected %d values, got %v", c.name, len(c.values), results)
+			continue
+		}
+		for i, v := range results {
+			if v.Value != c.values[i] {
+				t.Errorf("%s: expected value %d to be %v, got %v", c.name, i, c.values[i], v.Value)
+			}
+			if c.bounds != nil && v.StatusCode != c.bounds[i] {
+				t.Errorf("%s: expected status of value %d to be %s, got %s", c.name, i, c.bounds[i], v.StatusCode)
+			}
+		}
+	}
+}
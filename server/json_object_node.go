@@ -2,9 +2,12 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 
 	"github.com/afs/server/pkg/eris"
 	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/karlseguin/jsonwriter"
 )
 
 /*
@@ -27,6 +30,12 @@ type JsonObjectNode struct {
 
 // ToObjectNode returns an equivalent ObjectNode which is OPC UA base object
 func (n *JsonObjectNode) ToObjectNode(ctx context.Context, parent *ObjectNode) (*ObjectNode, error) {
+	return n.toObjectNode(ctx, parent, true)
+}
+
+// toObjectNode returns an equivalent ObjectNode below the parent, and adds it to the childs of the parent if attach
+// is true. The childs of the node are always added to it.
+func (n *JsonObjectNode) toObjectNode(ctx context.Context, parent *ObjectNode, attach bool) (*ObjectNode, error) {
 	properties := []*VariableNode{}
 
 	var propNodeType *JsonVariableNode
@@ -42,7 +51,7 @@ func (n *JsonObjectNode) ToObjectNode(ctx context.Context, parent *ObjectNode) (
 			propNodeType = jsonPropNode
 		case PropertyNameInternalId:
 			propInternalID = jsonPropNode
-		case PropertyNameValue:
+		case PropertyNameValue, PropertyNameStatus, PropertyNameCommunicationStatus:
 			continue
 		default:
 			propNode, err := jsonPropNode.ToPropertyNode(ctx)
@@ -84,12 +93,12 @@ func (n *JsonObjectNode) ToObjectNode(ctx context.Context, parent *ObjectNode) (
 	}
 
 	node.AssignPluginProps()
-	if parent != nil {
+	if attach && parent != nil {
 		parent.AddChild(node)
 	}
 
 	for _, jsonChild := range n.Childs {
-		_, err := jsonChild.ToObjectNode(ctx, node)
+		_, err := jsonChild.toObjectNode(ctx, node, true)
 		if err != nil {
 			return nil, err
 		}
@@ -126,3 +135,79 @@ func NewJsonObjectNode(n *ObjectNode, depth bool) *JsonObjectNode {
 	}
 	return jsonNode
 }
+
+// jsonStream writes a project tree as JSON, a node at a time, in the format of JsonObjectNode. Each field is
+// marshaled on its own, so the whole document is never held in memory. The first error is kept.
+type jsonStream struct {
+	w      io.Writer
+	writer *jsonwriter.Writer
+	err    error
+}
+
+func newJsonStream(w io.Writer) *jsonStream {
+	s := &jsonStream{w: w}
+	s.writer = jsonwriter.New(s)
+	return s
+}
+
+// Write writes to the underlying writer, until it fails.
+func (s *jsonStream) Write(b []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.w.Write(b)
+	s.err = err
+	return n, err
+}
+
+// raw returns the value marshaled as JSON.
+func (s *jsonStream) raw(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		if s.err == nil {
+			s.err = err
+		}
+		return json.RawMessage("null")
+	}
+	return b
+}
+
+// writeObjectNode writes the fields of the node, its properties and its childs.
+func (s *jsonStream) writeObjectNode(n *ObjectNode) {
+	n.RLock()
+	nodeID := n.NodeId
+	nodeClass := n.NodeClass
+	browseName := n.BrowseName
+	displayName := n.DisplayName
+	description := n.Description
+	rolePermissions := n.RolePermissions
+	accessRestrictions := n.AccessRestrictions
+	references := n.References
+	properties := make([]*VariableNode, 0, len(n.properties))
+	for _, prop := range n.properties {
+		properties = append(properties, prop)
+	}
+	childs := n.childs.Values()
+	n.RUnlock()
+
+	s.writer.KeyValue("nodeId", s.raw(ua.NewExpandedNodeID(nodeID)))
+	s.writer.KeyValue("nodeClass", s.raw(nodeClass))
+	s.writer.KeyValue("browseName", s.raw(browseName))
+	s.writer.KeyValue("displayName", s.raw(displayName))
+	s.writer.KeyValue("description", s.raw(description))
+	s.writer.KeyValue("rolePermissions", s.raw(rolePermissions))
+	s.writer.KeyValue("accessRestrictions", s.raw(accessRestrictions))
+	s.writer.KeyValue("references", s.raw(references))
+	s.writer.Array("properties", func() {
+		for _, prop := range properties {
+			s.writer.Value(s.raw(NewJsonVariableNode(prop)))
+		}
+	})
+	s.writer.Array("childs", func() {
+		for _, child := range childs {
+			s.writer.ArrayObject(func() {
+				s.writeObjectNode(child.(*ObjectNode))
+			})
+		}
+	})
+}
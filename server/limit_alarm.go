@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/google/uuid"
+)
+
+// limitAlarmSeverity is the severity of the event raised when a variable crosses a limit.
+const limitAlarmSeverity uint16 = 700
+
+// the states of a limit alarm.
+const (
+	limitStateNormal = iota
+	limitStateHigh
+	limitStateLow
+)
+
+// SetLimitAlarmBehavior raises an ExclusiveLevelAlarmType event from the source object when the value of the
+// variable crosses its HighLimit or LowLimit property, and again when the value returns to normal. The optional
+// Hysteresis property is how far the value must return inside the limit before the alarm becomes inactive.
+func (m *NamespaceManager) SetLimitAlarmBehavior(node *VariableNode, source *ObjectNode) error {
+	highLimitNode, hasHighLimit := m.FindProperty(node, ua.ParseQualifiedName("0:HighLimit"))
+	lowLimitNode, hasLowLimit := m.FindProperty(node, ua.ParseQualifiedName("0:LowLimit"))
+	if !hasHighLimit && !hasLowLimit {
+		return ua.BadNodeIDUnknown
+	}
+	hysteresisNode, hasHysteresis := m.FindProperty(node, ua.ParseQualifiedName("0:Hysteresis"))
+	limit := func(n *VariableNode, ok bool) (float64, bool) {
+		if !ok {
+			return 0, false
+		}
+		return toFloat64(n.GetValue().Value)
+	}
+
+	var mu sync.Mutex
+	state := limitStateNormal
+	c := m.addCondition(node.GetNodeID(), source)
+	node.SetValueChangedHandler(func(value ua.DataValue) {
+		v, ok := toFloat64(value.Value)
+		if !ok || value.StatusCode.IsBad() {
+			return
+		}
+		highLimit, hasHigh := limit(highLimitNode, hasHighLimit)
+		lowLimit, hasLow := limit(lowLimitNode, hasLowLimit)
+		hysteresis, _ := limit(hysteresisNode, hasHysteresis)
+
+		mu.Lock()
+		prev := state
+		switch {
+		case hasHigh && (v > highLimit || prev == limitStateHigh && v > highLimit-hysteresis):
+			state = limitStateHigh
+		case hasLow && (v < lowLimit || prev == limitStateLow && v < lowLimit+hysteresis):
+			state = limitStateLow
+		default:
+			state = limitStateNormal
+		}
+		next := state
+		mu.Unlock()
+		if next == prev {
+			return
+		}
+
+		name := node.GetDisplayName().Text
+		var message string
+		switch next {
+		case limitStateHigh:
+			message = fmt.Sprintf("%s is above the high limit", name)
+		case limitStateLow:
+			message = fmt.Sprintf("%s is below the low limit", name)
+		default:
+			message = fmt.Sprintf("%s returned to normal", name)
+		}
+		active := next != limitStateNormal
+		// the condition sets the AckedState, ConfirmedState and Retain of the event, see raise.
+		c.raise(m, ua.AlarmCondition{
+			EventID:       newEventID(),
+			EventType:     ua.ObjectTypeIDExclusiveLevelAlarmType,
+			SourceNode:    source.GetNodeID(),
+			SourceName:    source.GetBrowseName().Name,
+			Time:          time.Now(),
+			ReceiveTime:   time.Now(),
+			Message:       ua.NewLocalizedText(message, DefaultLocale),
+			Severity:      limitAlarmSeverity,
+			ConditionID:   node.GetNodeID(),
+			ConditionName: node.GetBrowseName().Name,
+			ActiveState:   active,
+		})
+	})
+	return nil
+}
+
+// newEventID returns a unique EventId.
+func newEventID() ua.ByteString {
+	id := uuid.New()
+	return ua.ByteString(id[:])
+}
+
+// toFloat64 returns the value of a numeric scalar as float64.
+func toFloat64(value ua.Variant) (float64, bool) {
+	switch v := value.(type) {
+	case int8:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// newTestLimitAlarm adds the variable Level with a HighLimit of 50, a LowLimit of 10 and a Hysteresis of 2, raising
+// its alarm from the test object.
+func newTestLimitAlarm(t *testing.T, nm *NamespaceManager) (*VariableNode, *ObjectNode) {
+	levelID := ua.NewNodeIDString(1, "Level")
+	property := func(name string, value float64) *VariableNode {
+		return NewVariableNode(
+			ua.NewNodeIDString(1, "Level."+name),
+			ua.NewQualifiedName(0, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(levelID))},
+			ua.NewDataValue(value, 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			-1,
+			false,
+			nil,
+		)
+	}
+	level := NewVariableNode(
+		levelID,
+		ua.NewQualifiedName(1, "Level"),
+		ua.NewLocalizedText("Level", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasProperty, false, ua.NewExpandedNodeID(ua.NewNodeIDString(1, "Level.HighLimit"))),
+			ua.NewReference(ua.ReferenceTypeIDHasProperty, false, ua.NewExpandedNodeID(ua.NewNodeIDString(1, "Level.LowLimit"))),
+			ua.NewReference(ua.ReferenceTypeIDHasProperty, false, ua.NewExpandedNodeID(ua.NewNodeIDString(1, "Level.Hysteresis"))),
+		},
+		ua.NewDataValue(float64(30), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		-1,
+		false,
+		nil,
+	)
+	if err := nm.AddNodes(level, property("HighLimit", 50), property("LowLimit", 10), property("Hysteresis", 2)); err != nil {
+		t.Fatal(err)
+	}
+	source, _ := nm.FindObject(testObjectID)
+	if err := nm.SetLimitAlarmBehavior(level, source); err != nil {
+		t.Fatal(err)
+	}
+	return level, source
+}
+
+func TestLimitAlarm(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	levelID := ua.NewNodeIDString(1, "Level")
+	level, source := newTestLimitAlarm(t, srv.NamespaceManager())
+	events := make(eventRecorder, 10)
+	source.AddEventListener(events)
+
+	for _, c := range []struct {
+		value   float64
+		event   bool
+		active  bool
+		message string
+	}{
+		{45, false, false, ""},
+		{55, true, true, "Level is above the high limit"},
+		{60, false, false, ""},
+		// inside the hysteresis, the alarm remains active.
+		{49, false, false, ""},
+		{47, true, false, "Level returned to normal"},
+		{5, true, true, "Level is below the low limit"},
+		{11, false, false, ""},
+		{12.5, true, false, "Level returned to normal"},
+	} {
+		level.SetValue(ua.NewDataValue(c.value, 0, time.Now(), 0, time.Now(), 0))
+		if !c.event {
+			if len(events) != 0 {
+				t.Errorf("value %v: unexpected event %+v", c.value, <-events)
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("value %v: expected 1 event, got %d", c.value, len(events))
+		}
+		e := (<-events).(*ua.AlarmCondition)
+		if e.EventType != ua.ObjectTypeIDExclusiveLevelAlarmType || e.SourceNode != testObjectID || e.ConditionID != levelID {
+			t.Errorf("value %v: unexpected event %+v", c.value, e)
+		}
+		if e.ActiveState != c.active || e.Message.Text != c.message {
+			t.Errorf("value %v: expected active %t and message %q, got %t and %q", c.value, c.active, c.message, e.ActiveState, e.Message.Text)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// localizedTexts holds the translations of the DisplayName and Description of nodes, so that a Read returns
+// the text in the locale requested by the session.
+type localizedTexts struct {
+	sync.RWMutex
+	texts map[localizedTextKey][]ua.LocalizedText
+}
+
+// localizedTextKey identifies an attribute of a node.
+type localizedTextKey struct {
+	nodeID      ua.NodeID
+	attributeID uint32
+}
+
+// set replaces the translations of the attribute.
+func (t *localizedTexts) set(key localizedTextKey, texts []ua.LocalizedText) {
+	t.Lock()
+	if t.texts == nil {
+		t.texts = make(map[localizedTextKey][]ua.LocalizedText)
+	}
+	t.texts[key] = texts
+	t.Unlock()
+}
+
+// get returns the translations of the attribute.
+func (t *localizedTexts) get(key localizedTextKey) []ua.LocalizedText {
+	t.RLock()
+	res := t.texts[key]
+	t.RUnlock()
+	return res
+}
+
+// remove deletes the translations of every attribute of the node.
+func (t *localizedTexts) remove(id ua.NodeID) {
+	t.Lock()
+	delete(t.texts, localizedTextKey{id, ua.AttributeIDDisplayName})
+	delete(t.texts, localizedTextKey{id, ua.AttributeIDDescription})
+	t.Unlock()
+}
+
+// move moves the translations of every attribute of the node to its new NodeID.
+func (t *localizedTexts) move(from, to ua.NodeID) {
+	t.Lock()
+	for _, attributeID := range []uint32{ua.AttributeIDDisplayName, ua.AttributeIDDescription} {
+		if texts, ok := t.texts[localizedTextKey{from, attributeID}]; ok {
+			delete(t.texts, localizedTextKey{from, attributeID})
+			t.texts[localizedTextKey{to, attributeID}] = texts
+		}
+	}
+	t.Unlock()
+}
+
+// SetLocalizedTexts sets the translations of the DisplayName or Description of the node, one per locale.
+// The value of the attribute itself remains the text returned when no translation matches.
+func (m *NamespaceManager) SetLocalizedTexts(node Node, attributeID uint32, texts ...ua.LocalizedText) error {
+	if attributeID != ua.AttributeIDDisplayName && attributeID != ua.AttributeIDDescription {
+		return ua.BadAttributeIDInvalid
+	}
+	if _, ok := m.FindNode(node.GetNodeID()); !ok {
+		return ua.BadNodeIDUnknown
+	}
+	m.translations.set(localizedTextKey{node.GetNodeID(), attributeID}, append([]ua.LocalizedText(nil), texts...))
+	return nil
+}
+
+// localize returns the translation of the attribute that best matches the locales of the session, then the
+// default locale of the server. If none matches, the value of the attribute is returned.
+func (srv *UAServer) localize(ctx context.Context, n Node, attributeID uint32, value ua.LocalizedText) ua.LocalizedText {
+	texts := srv.NamespaceManager().translations.get(localizedTextKey{n.GetNodeID(), attributeID})
+	if len(texts) == 0 {
+		return value
+	}
+	texts = append([]ua.LocalizedText{value}, texts...)
+	var localeIds []string
+	if session, ok := ctx.Value(SessionKey).(*Session); ok {
+		localeIds = session.LocaleIDs()
+	}
+	for _, locale := range localeIds {
+		if lt, ok := matchLocale(texts, locale); ok {
+			return lt
+		}
+	}
+	if lt, ok := matchLocale(texts, srv.defaultLocale); ok {
+		return lt
+	}
+	return value
+}
+
+// matchLocale returns the text of the locale, else the first text of the same language, e.g. "de" matches
+// "de-AT" and "de-DE" matches "de".
+func matchLocale(texts []ua.LocalizedText, locale string) (ua.LocalizedText, bool) {
+	if locale == "" {
+		return ua.LocalizedText{}, false
+	}
+	for _, lt := range texts {
+		if strings.EqualFold(lt.Locale, locale) {
+			return lt, true
+		}
+	}
+	language := localeLanguage(locale)
+	for _, lt := range texts {
+		if lt.Locale != "" && strings.EqualFold(localeLanguage(lt.Locale), language) {
+			return lt, true
+		}
+	}
+	return ua.LocalizedText{}, false
+}
+
+// localeLanguage returns the language of the locale, e.g. "en" for "en-US".
+func localeLanguage(locale string) string {
+	if i := strings.IndexByte(locale, '-'); i >= 0 {
+		return locale[:i]
+	}
+	return locale
+}
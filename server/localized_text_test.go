@@ -0,0 +1,90 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestLocalizedText(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	srv.defaultLocale = "en"
+	nm := srv.NamespaceManager()
+	object, _ := nm.FindNode(testObjectID)
+	if err := nm.SetLocalizedTexts(object, ua.AttributeIDDisplayName,
+		ua.NewLocalizedText("Pump", "en"),
+		ua.NewLocalizedText("Pumpe", "de-DE"),
+		ua.NewLocalizedText("Pompe", "fr"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := nm.SetLocalizedTexts(object, ua.AttributeIDBrowseName); err != ua.BadAttributeIDInvalid {
+		t.Errorf("expected %s, got %v", ua.BadAttributeIDInvalid, err)
+	}
+	session := ctx.Value(SessionKey).(*Session)
+
+	for _, tc := range []struct {
+		localeIds []string
+		want      ua.LocalizedText
+	}{
+		{[]string{"de-DE"}, ua.NewLocalizedText("Pumpe", "de-DE")},
+		{[]string{"de-AT"}, ua.NewLocalizedText("Pumpe", "de-DE")},
+		{[]string{"it", "FR-ca"}, ua.NewLocalizedText("Pompe", "fr")},
+		{[]string{"ja"}, ua.NewLocalizedText("Pump", "en")},
+		{nil, ua.NewLocalizedText("Pump", "en")},
+	} {
+		session.SetLocaleIDs(tc.localeIds)
+		v := srv.readValue(ctx, ua.ReadValueID{NodeID: testObjectID, AttributeID: ua.AttributeIDDisplayName})
+		if v.StatusCode != ua.Good || v.Value != tc.want {
+			t.Errorf("%v: expected %v, got %v (%s)", tc.localeIds, tc.want, v.Value, v.StatusCode)
+		}
+	}
+
+	// without a match in the default locale, the attribute itself is returned.
+	srv.defaultLocale = "es"
+	session.SetLocaleIDs([]string{"ja"})
+	v := srv.readValue(ctx, ua.ReadValueID{NodeID: testObjectID, AttributeID: ua.AttributeIDDisplayName})
+	if want := ua.NewLocalizedText("Object", ""); v.Value != want {
+		t.Errorf("expected %v, got %v", want, v.Value)
+	}
+
+	// the translations are removed with the node.
+	if err := nm.DeleteNode(object, false); err != nil {
+		t.Fatal(err)
+	}
+	if texts := nm.translations.get(localizedTextKey{testObjectID, ua.AttributeIDDisplayName}); len(texts) != 0 {
+		t.Errorf("expected no translations, got %v", texts)
+	}
+}
+
+func TestLocalizedTextRename(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	nm := srv.NamespaceManager()
+	variable, _ := nm.FindNode(testVariableID)
+	if err := nm.SetLocalizedTexts(variable, ua.AttributeIDDisplayName, ua.NewLocalizedText("Pumpe", "de-DE")); err != nil {
+		t.Fatal(err)
+	}
+	if err := nm.SetLocalizedTexts(variable, ua.AttributeIDDescription, ua.NewLocalizedText("Eine Pumpe", "de-DE")); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Value(SessionKey).(*Session).SetLocaleIDs([]string{"de-DE"})
+
+	// the translations move with the node to its new NodeID.
+	renamedID := ua.NewNodeIDString(DefaultNameSpace, "Renamed")
+	nm.UpdateNodeID(variable, renamedID)
+	if texts := nm.translations.get(localizedTextKey{testVariableID, ua.AttributeIDDisplayName}); len(texts) != 0 {
+		t.Errorf("expected no translations of the old NodeID, got %v", texts)
+	}
+	for _, tc := range []struct {
+		attributeID uint32
+		want        ua.LocalizedText
+	}{
+		{ua.AttributeIDDisplayName, ua.NewLocalizedText("Pumpe", "de-DE")},
+		{ua.AttributeIDDescription, ua.NewLocalizedText("Eine Pumpe", "de-DE")},
+	} {
+		v := srv.readValue(ctx, ua.ReadValueID{NodeID: renamedID, AttributeID: tc.attributeID})
+		if v.StatusCode != ua.Good || v.Value != tc.want {
+			t.Errorf("attribute %d: expected %v, got %v (%s)", tc.attributeID, tc.want, v.Value, v.StatusCode)
+		}
+	}
+}
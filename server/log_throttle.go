@@ -0,0 +1,57 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"sync"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+const (
+	// the default number of identical warnings counted for each one that is logged.
+	defaultLogThrottleInterval uint32 = 100
+	// the limit on the number of keys counted, to bound the memory used by the clients.
+	maxLogThrottleKeys = 1024
+)
+
+// logThrottle counts repeated warnings by key, so only the first of every interval occurrences is logged.
+type logThrottle struct {
+	sync.Mutex
+	interval uint32
+	counts   map[interface{}]uint32
+}
+
+// newLogThrottle returns a logThrottle that logs one of every interval occurrences of a key.
+func newLogThrottle(interval uint32) *logThrottle {
+	return &logThrottle{interval: interval, counts: make(map[interface{}]uint32)}
+}
+
+// allow counts an occurrence of the key and reports whether it should be logged, with the number of occurrences
+// since the key was last logged. A nil logThrottle allows all occurrences.
+func (t *logThrottle) allow(key interface{}) (bool, uint32) {
+	if t == nil || t.interval <= 1 {
+		return true, 1
+	}
+	t.Lock()
+	defer t.Unlock()
+	n, ok := t.counts[key]
+	if !ok && len(t.counts) >= maxLogThrottleKeys {
+		t.counts = make(map[interface{}]uint32)
+	}
+	if !ok || n >= t.interval {
+		t.counts[key] = 1
+		if !ok {
+			return true, 1
+		}
+		return true, n
+	}
+	t.counts[key] = n + 1
+	return false, 0
+}
+
+// faultLogKey identifies the faults of a channel with the same status code.
+type faultLogKey struct {
+	channelID uint32
+	status    ua.StatusCode
+}
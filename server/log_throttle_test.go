@@ -0,0 +1,58 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// warningRecorder records the warnings that are logged.
+type warningRecorder struct {
+	nopLogger
+	sync.Mutex
+	warnings []string
+}
+
+func (r *warningRecorder) Warnf(format string, args ...interface{}) {
+	r.Lock()
+	defer r.Unlock()
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestFaultLogThrottle(t *testing.T) {
+	logger := &warningRecorder{}
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	srv.logger = logger
+	srv.faultLogThrottle = newLogThrottle(10)
+	ch := &serverSecureChannel{
+		srv:            srv,
+		channelID:      1,
+		responseWriter: func(ua.ServiceResponse, uint32) error { return nil },
+	}
+
+	for i := uint32(0); i < 25; i++ {
+		if err := ch.WriteServiceFault(i, ua.BadNodeIDUnknown, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(logger.warnings) != 3 {
+		t.Fatalf("expected 3 warnings for 25 faults, got %d: %v", len(logger.warnings), logger.warnings)
+	}
+	want := "request handle: 10, occurrences since last logged: 10"
+	if !strings.HasSuffix(logger.warnings[1], want) {
+		t.Errorf("expected the warning to end with %q, got %q", want, logger.warnings[1])
+	}
+
+	// a fault with another status code is counted separately.
+	if err := ch.WriteServiceFault(25, ua.BadUserAccessDenied, 25); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.warnings) != 4 {
+		t.Fatalf("expected the first fault with another status code to be logged, got %v", logger.warnings)
+	}
+}
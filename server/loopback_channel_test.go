@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// loopbackChannel is a secure channel that is not connected to a remote endpoint. It captures the responses
+// written by the service handlers, so the handlers may be exercised without a transport.
+type loopbackChannel struct {
+	*serverSecureChannel
+	mu        sync.Mutex
+	responses []ua.ServiceResponse
+	written   chan struct{}
+}
+
+// newLoopbackChannel returns a loopback channel for the server using the given endpoint.
+func newLoopbackChannel(srv *UAServer, localEndpoint ua.EndpointDescription) *loopbackChannel {
+	lc := &loopbackChannel{written: make(chan struct{}, 1)}
+	localCertificate, localPrivateKey := srv.localKeyPair()
+	lc.serverSecureChannel = &serverSecureChannel{
+		srv:               srv,
+		channelID:         getNextServerChannelID(),
+		securityPolicyURI: localEndpoint.SecurityPolicyURI,
+		securityPolicy:    new(ua.SecurityPolicyNone),
+		securityMode:      localEndpoint.SecurityMode,
+		localEndpoint:     localEndpoint,
+		localCertificate:  localCertificate,
+		localPrivateKey:   localPrivateKey,
+		responseWriter:    lc.write,
+	}
+	return lc
+}
+
+func (lc *loopbackChannel) write(res ua.ServiceResponse, id uint32) error {
+	lc.mu.Lock()
+	lc.responses = append(lc.responses, res)
+	lc.mu.Unlock()
+	select {
+	case lc.written <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Responses returns the responses written to the channel.
+func (lc *loopbackChannel) Responses() []ua.ServiceResponse {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return append([]ua.ServiceResponse(nil), lc.responses...)
+}
+
+// WaitResponse waits until the channel has received n responses, and returns the nth response.
+// Handlers may write their responses from another goroutine.
+func (lc *loopbackChannel) WaitResponse(n int, timeout time.Duration) (ua.ServiceResponse, bool) {
+	deadline := time.After(timeout)
+	for {
+		lc.mu.Lock()
+		if len(lc.responses) >= n {
+			res := lc.responses[n-1]
+			lc.mu.Unlock()
+			return res, true
+		}
+		lc.mu.Unlock()
+		select {
+		case <-lc.written:
+		case <-deadline:
+			return nil, false
+		}
+	}
+}
+
+// newTestSession adds an activated session on the channel to the server, in the role of the session in ctx.
+func newTestSession(t *testing.T, srv *UAServer, ctx context.Context, ch *loopbackChannel) *Session {
+	session := NewSession(srv, ua.NewNodeIDNumeric(1, 1), "test", ua.NewNodeIDNumeric(1, 2), "", time.Minute, ua.ApplicationDescription{}, "", "", 0)
+	session.SetSecureChannelId(ch.ChannelID())
+	session.userRoles = ctx.Value(SessionKey).(*Session).UserRoles()
+	if err := srv.SessionManager().Add(session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestLoopbackChannelRead(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	req := &ua.ReadRequest{
+		RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken(), RequestHandle: 42},
+		TimestampsToReturn: ua.TimestampsToReturnNeither,
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: testVariableID, AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.NewNodeIDString(1, "Unknown"), AttributeID: ua.AttributeIDValue},
+		},
+	}
+	if err := srv.handleRead(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, ok := ch.WaitResponse(1, time.Second)
+	if !ok {
+		t.Fatal("expected a response")
+	}
+	read, ok := res.(*ua.ReadResponse)
+	if !ok {
+		t.Fatalf("expected ReadResponse, got %T", res)
+	}
+	if read.ResponseHeader.RequestHandle != 42 || len(read.Results) != 2 {
+		t.Fatalf("unexpected response %+v", read)
+	}
+	if read.Results[0].Value != float64(42) || !read.Results[0].ServerTimestamp.IsZero() {
+		t.Errorf("unexpected result %+v", read.Results[0])
+	}
+	if read.Results[1].StatusCode != ua.BadNodeIDUnknown {
+		t.Errorf("expected %s, got %s", ua.BadNodeIDUnknown, read.Results[1].StatusCode)
+	}
+
+	req.NodesToRead = nil
+	srv.handleRead(ch.serverSecureChannel, 2, req)
+	res, _ = ch.WaitResponse(2, time.Second)
+	if fault, ok := res.(*ua.ServiceFault); !ok || fault.ResponseHeader.ServiceResult != ua.BadNothingToDo {
+		t.Errorf("expected ServiceFault %s, got %+v", ua.BadNothingToDo, res)
+	}
+}
+
+func TestWriteServiceFault(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	// a handler writes a ServiceFault with the request handle, status and time of the fault, and nothing else.
+	before := time.Now()
+	req := &ua.BrowseRequest{RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken(), RequestHandle: 42}}
+	if err := srv.handleBrowse(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	fault, ok := res.(*ua.ServiceFault)
+	if !ok {
+		t.Fatalf("expected ServiceFault, got %+v", res)
+	}
+	want := ua.ResponseHeader{Timestamp: fault.ResponseHeader.Timestamp, RequestHandle: 42, ServiceResult: ua.BadNothingToDo}
+	if !reflect.DeepEqual(fault.ResponseHeader, want) {
+		t.Errorf("expected %+v, got %+v", want, fault.ResponseHeader)
+	}
+	if fault.ResponseHeader.Timestamp.Before(before) {
+		t.Errorf("expected the time of the fault, got %s", fault.ResponseHeader.Timestamp)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/google/uuid"
+)
+
+var (
+	variantType         = reflect.TypeOf((*ua.Variant)(nil)).Elem()
+	extensionObjectType = reflect.TypeOf((*ua.ExtensionObject)(nil)).Elem()
+	nodeIDType          = reflect.TypeOf((*ua.NodeID)(nil)).Elem()
+)
+
+// validateInputArguments checks the input arguments of a call against the InputArguments property of the method.
+// Methods without an InputArguments property are left to validate their own arguments.
+func (srv *UAServer) validateInputArguments(n *MethodNode, inputs []ua.Variant) (ua.StatusCode, []ua.StatusCode) {
+	prop, ok := srv.NamespaceManager().FindProperty(n, ua.ParseQualifiedName("0:InputArguments"))
+	if !ok {
+		return ua.Good, nil
+	}
+	list, _ := prop.GetValue().Value.([]ua.ExtensionObject)
+	if len(inputs) < len(list) {
+		return ua.BadArgumentsMissing, nil
+	}
+	if len(inputs) > len(list) {
+		return ua.BadTooManyArguments, nil
+	}
+	status := ua.Good
+	results := make([]ua.StatusCode, len(list))
+	for i, item := range list {
+		arg, ok := item.(ua.Argument)
+		if !ok {
+			continue
+		}
+		if results[i] = srv.validateArgument(arg, inputs[i]); results[i] != ua.Good {
+			status = ua.BadInvalidArgument
+		}
+	}
+	if status == ua.Good {
+		return ua.Good, nil
+	}
+	return status, results
+}
+
+// coerceOutputArguments checks the output arguments of a call result against the OutputArguments property of the
+// method. Numbers of another type are converted to the type of the argument, if they may be converted without loss.
+// Arguments that cannot be converted result in BadInternalError. Methods without an OutputArguments property are
+// left to return their own arguments.
+func (srv *UAServer) coerceOutputArguments(n *MethodNode, result ua.CallMethodResult) ua.CallMethodResult {
+	if result.StatusCode.IsBad() {
+		return result
+	}
+	prop, ok := srv.NamespaceManager().FindProperty(n, ua.ParseQualifiedName("0:OutputArguments"))
+	if !ok {
+		return result
+	}
+	list, _ := prop.GetValue().Value.([]ua.ExtensionObject)
+	if len(result.OutputArguments) != len(list) {
+		return ua.CallMethodResult{StatusCode: ua.BadInternalError}
+	}
+	outputs := make([]ua.Variant, len(list))
+	for i, item := range list {
+		outputs[i] = result.OutputArguments[i]
+		arg, ok := item.(ua.Argument)
+		if !ok || srv.validateArgument(arg, outputs[i]) == ua.Good {
+			continue
+		}
+		v, ok := coerceNumber(outputs[i], srv.NamespaceManager().FindVariantType(arg.DataType))
+		if !ok || srv.validateArgument(arg, v) != ua.Good {
+			return ua.CallMethodResult{StatusCode: ua.BadInternalError}
+		}
+		outputs[i] = v
+	}
+	result.OutputArguments = outputs
+	return result
+}
+
+// numberTypes maps the VariantType of the numeric built-in types to their Go type.
+var numberTypes = map[byte]reflect.Type{
+	ua.VariantTypeSByte:  reflect.TypeOf(int8(0)),
+	ua.VariantTypeByte:   reflect.TypeOf(uint8(0)),
+	ua.VariantTypeInt16:  reflect.TypeOf(int16(0)),
+	ua.VariantTypeUInt16: reflect.TypeOf(uint16(0)),
+	ua.VariantTypeInt32:  reflect.TypeOf(int32(0)),
+	ua.VariantTypeUInt32: reflect.TypeOf(uint32(0)),
+	ua.VariantTypeInt64:  reflect.TypeOf(int64(0)),
+	ua.VariantTypeUInt64: reflect.TypeOf(uint64(0)),
+	ua.VariantTypeFloat:  reflect.TypeOf(float32(0)),
+	ua.VariantTypeDouble: reflect.TypeOf(float64(0)),
+}
+
+// coerceNumber converts the number, or slice of numbers, to the numeric type. It returns false if the value is not
+// a number, or if the conversion would change its value.
+func coerceNumber(value ua.Variant, destType byte) (ua.Variant, bool) {
+	t, ok := numberTypes[destType]
+	if !ok || value == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		res, ok := convertNumber(v, t)
+		if !ok {
+			return nil, false
+		}
+		return res.Interface(), true
+	}
+	res := reflect.MakeSlice(reflect.SliceOf(t), v.Len(), v.Len())
+	for i := 0; i < v.Len(); i++ {
+		e, ok := convertNumber(v.Index(i), t)
+		if !ok {
+			return nil, false
+		}
+		res.Index(i).Set(e)
+	}
+	return res.Interface(), true
+}
+
+// convertNumber converts the number to the type. Integers must be representable exactly, and floats must be in
+// range, though they may lose precision.
+func convertNumber(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Float32, reflect.Float64:
+		if t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64 {
+			res := v.Convert(t)
+			if math.IsInf(res.Float(), 0) && !math.IsInf(v.Float(), 0) {
+				return reflect.Value{}, false
+			}
+			return res, true
+		}
+	default:
+		return reflect.Value{}, false
+	}
+	res := v.Convert(t)
+	if res.Convert(v.Type()).Interface() != v.Interface() {
+		return reflect.Value{}, false
+	}
+	// the sign is lost converting between signed and unsigned integers, without changing the value back.
+	if isNegative(v) != isNegative(res) {
+		return reflect.Value{}, false
+	}
+	return res, true
+}
+
+// isNegative returns true if the number is less than zero.
+func isNegative(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() < 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() < 0
+	default:
+		return false
+	}
+}
+
+// validateArgument checks the data type and value rank of the value against the argument definition.
+func (srv *UAServer) validateArgument(arg ua.Argument, value ua.Variant) ua.StatusCode {
+	destType := srv.NamespaceManager().FindVariantType(arg.DataType)
+	if destType == ua.VariantTypeVariant {
+		return ua.Good
+	}
+	srcType, srcRank := variantTypeOf(value)
+	// special case accept bytestring for byte array, and byte array for bytestring
+	if destType == ua.VariantTypeByte && srcType == ua.VariantTypeByteString && srcRank == ua.ValueRankScalar {
+		srcType, srcRank = ua.VariantTypeByte, ua.ValueRankOneDimension
+	}
+	if destType == ua.VariantTypeByteString && srcType == ua.VariantTypeByte && srcRank == ua.ValueRankOneDimension && arg.ValueRank == ua.ValueRankScalar {
+		srcType, srcRank = ua.VariantTypeByteString, ua.ValueRankScalar
+	}
+	if srcType != destType {
+		return ua.BadTypeMismatch
+	}
+	switch arg.ValueRank {
+	case ua.ValueRankScalar:
+		if srcRank != ua.ValueRankScalar {
+			return ua.BadTypeMismatch
+		}
+	case ua.ValueRankOneDimension, ua.ValueRankOneOrMoreDimensions:
+		if srcRank != ua.ValueRankOneDimension {
+			return ua.BadTypeMismatch
+		}
+	}
+	return ua.Good
+}
+
+// variantTypeOf returns the VariantType and ValueRank of the value.
+func variantTypeOf(value ua.Variant) (byte, int32) {
+	switch value.(type) {
+	case nil:
+		return ua.VariantTypeNull, ua.ValueRankScalar
+	case bool:
+		return ua.VariantTypeBoolean, ua.ValueRankScalar
+	case int8:
+		return ua.VariantTypeSByte, ua.ValueRankScalar
+	case uint8:
+		return ua.VariantTypeByte, ua.ValueRankScalar
+	case int16:
+		return ua.VariantTypeInt16, ua.ValueRankScalar
+	case uint16:
+		return ua.VariantTypeUInt16, ua.ValueRankScalar
+	case int32:
+		return ua.VariantTypeInt32, ua.ValueRankScalar
+	case uint32:
+		return ua.VariantTypeUInt32, ua.ValueRankScalar
+	case int64:
+		return ua.VariantTypeInt64, ua.ValueRankScalar
+	case uint64:
+		return ua.VariantTypeUInt64, ua.ValueRankScalar
+	case float32:
+		return ua.VariantTypeFloat, ua.ValueRankScalar
+	case float64:
+		return ua.VariantTypeDouble, ua.ValueRankScalar
+	case string:
+		return ua.VariantTypeString, ua.ValueRankScalar
+	case time.Time:
+		return ua.VariantTypeDateTime, ua.ValueRankScalar
+	case uuid.UUID:
+		return ua.VariantTypeGUID, ua.ValueRankScalar
+	case ua.ByteString:
+		return ua.VariantTypeByteString, ua.ValueRankScalar
+	case ua.XMLElement:
+		return ua.VariantTypeXMLElement, ua.ValueRankScalar
+	case ua.NodeID:
+		return ua.VariantTypeNodeID, ua.ValueRankScalar
+	case ua.ExpandedNodeID:
+		return ua.VariantTypeExpandedNodeID, ua.ValueRankScalar
+	case ua.StatusCode:
+		return ua.VariantTypeStatusCode, ua.ValueRankScalar
+	case ua.QualifiedName:
+		return ua.VariantTypeQualifiedName, ua.ValueRankScalar
+	case ua.LocalizedText:
+		return ua.VariantTypeLocalizedText, ua.ValueRankScalar
+	case ua.DataValue:
+		return ua.VariantTypeDataValue, ua.ValueRankScalar
+	case ua.DiagnosticInfo:
+		return ua.VariantTypeDiagnosticInfo, ua.ValueRankScalar
+	}
+	t := reflect.TypeOf(value)
+	if t.Kind() == reflect.Slice {
+		switch t.Elem() {
+		case variantType:
+			return ua.VariantTypeVariant, ua.ValueRankOneDimension
+		case extensionObjectType:
+			return ua.VariantTypeExtensionObject, ua.ValueRankOneDimension
+		case nodeIDType:
+			return ua.VariantTypeNodeID, ua.ValueRankOneDimension
+		}
+		elemType, _ := variantTypeOf(reflect.Zero(t.Elem()).Interface())
+		return elemType, ua.ValueRankOneDimension
+	}
+	return ua.VariantTypeExtensionObject, ua.ValueRankScalar
+}
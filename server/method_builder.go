@@ -0,0 +1,228 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// MethodBuilder defines a method with typed arguments. The handler is a func taking a context.Context
+// followed by one parameter per input argument, and returning one result per output argument followed by an error.
+//
+//	b := NewMethod("SetSetpoint").
+//		Input("setpoint", ua.DataTypeIDDouble).
+//		Output("ok", ua.DataTypeIDBoolean).
+//		Handler(func(ctx context.Context, setpoint float64) (bool, error) {
+//			return setpoint >= 0, nil
+//		})
+//	method, err := nm.AddMethod(parent, b)
+//
+// If the handler returns a ua.StatusCode as error, it is returned to the client, otherwise BadInternalError.
+type MethodBuilder struct {
+	name        string
+	description string
+	inputs      []ua.Argument
+	outputs     []ua.Argument
+	handler     interface{}
+}
+
+// NewMethod returns a builder for a method with the given name.
+func NewMethod(name string) *MethodBuilder {
+	return &MethodBuilder{name: name}
+}
+
+// Description sets the description of the method.
+func (b *MethodBuilder) Description(text string) *MethodBuilder {
+	b.description = text
+	return b
+}
+
+// Input appends an input argument. The value rank is taken from the corresponding handler parameter.
+func (b *MethodBuilder) Input(name string, dataType ua.NodeID) *MethodBuilder {
+	b.inputs = append(b.inputs, ua.Argument{Name: name, DataType: dataType, ValueRank: ua.ValueRankScalar, ArrayDimensions: []uint32{}})
+	return b
+}
+
+// Output appends an output argument. The value rank is taken from the corresponding handler result.
+func (b *MethodBuilder) Output(name string, dataType ua.NodeID) *MethodBuilder {
+	b.outputs = append(b.outputs, ua.Argument{Name: name, DataType: dataType, ValueRank: ua.ValueRankScalar, ArrayDimensions: []uint32{}})
+	return b
+}
+
+// Handler sets the func called when a client calls the method.
+func (b *MethodBuilder) Handler(f interface{}) *MethodBuilder {
+	b.handler = f
+	return b
+}
+
+// AddMethod adds the method defined by the builder, with its InputArguments and OutputArguments properties,
+// as a component of the parent node.
+func (m *NamespaceManager) AddMethod(parent Node, b *MethodBuilder) (*MethodNode, error) {
+	f := reflect.ValueOf(b.handler)
+	if f.Kind() != reflect.Func {
+		return nil, ua.BadInvalidArgument
+	}
+	t := f.Type()
+	if t.NumIn() != len(b.inputs)+1 || t.In(0) != contextType {
+		return nil, ua.BadInvalidArgument
+	}
+	if t.NumOut() != len(b.outputs)+1 || t.Out(len(b.outputs)) != errorType {
+		return nil, ua.BadInvalidArgument
+	}
+	inputs := make([]ua.Argument, len(b.inputs))
+	for i, arg := range b.inputs {
+		rank, err := m.argumentValueRank(arg, t.In(i+1))
+		if err != nil {
+			return nil, err
+		}
+		arg.ValueRank = rank
+		inputs[i] = arg
+	}
+	outputs := make([]ua.Argument, len(b.outputs))
+	for i, arg := range b.outputs {
+		rank, err := m.argumentValueRank(arg, t.Out(i))
+		if err != nil {
+			return nil, err
+		}
+		arg.ValueRank = rank
+		outputs[i] = arg
+	}
+
+	parentID := parent.GetNodeID()
+	ns := parentID.GetNamespaceIndex()
+	id := fmt.Sprintf("%v%s%s", parentID.GetID(), PathSeparator, b.name)
+	method := NewMethodNode(
+		ua.NewNodeIDString(ns, id),
+		ua.NewQualifiedName(ns, b.name),
+		ua.NewLocalizedText(b.name, ""),
+		ua.NewLocalizedText(b.description, ""),
+		nil,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(parentID))},
+		true,
+	)
+	method.SetCallMethodHandler(methodHandler(f))
+	nodes := []Node{method}
+	if len(inputs) > 0 {
+		nodes = append(nodes, newArgumentsProperty(method, "InputArguments", inputs))
+	}
+	if len(outputs) > 0 {
+		nodes = append(nodes, newArgumentsProperty(method, "OutputArguments", outputs))
+	}
+	if err := m.AddNodes(nodes...); err != nil {
+		return nil, err
+	}
+	return method, nil
+}
+
+// argumentValueRank returns the value rank of the argument, after checking the Go type matches its data type.
+func (m *NamespaceManager) argumentValueRank(arg ua.Argument, t reflect.Type) (int32, error) {
+	if t.Kind() == reflect.Interface {
+		return ua.ValueRankAny, nil
+	}
+	vt, rank := variantTypeOf(reflect.Zero(t).Interface())
+	if destType := m.FindVariantType(arg.DataType); destType != ua.VariantTypeVariant && destType != vt {
+		return 0, ua.BadTypeMismatch
+	}
+	return rank, nil
+}
+
+// newArgumentsProperty returns an InputArguments or OutputArguments property of the method.
+func newArgumentsProperty(method *MethodNode, name string, args []ua.Argument) *VariableNode {
+	methodID := method.GetNodeID()
+	list := make([]ua.ExtensionObject, len(args))
+	for i, arg := range args {
+		list[i] = arg
+	}
+	return NewVariableNode(
+		ua.NewNodeIDString(methodID.GetNamespaceIndex(), fmt.Sprintf("%v%s%s", methodID.GetID(), PathSeparator, name)),
+		ua.NewQualifiedName(0, name),
+		ua.NewLocalizedText(name, ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)),
+			ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(methodID)),
+		},
+		ua.NewDataValue(list, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDArgument,
+		ua.ValueRankOneDimension,
+		[]uint32{uint32(len(list))},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+}
+
+// methodHandler returns a CallMethodHandler converting the input arguments to the parameters of the func,
+// and the results of the func to the output arguments.
+func methodHandler(f reflect.Value) func(context.Context, ua.CallMethodRequest) ua.CallMethodResult {
+	t := f.Type()
+	return func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+		if len(req.InputArguments) < t.NumIn()-1 {
+			return ua.CallMethodResult{StatusCode: ua.BadArgumentsMissing}
+		}
+		if len(req.InputArguments) > t.NumIn()-1 {
+			return ua.CallMethodResult{StatusCode: ua.BadTooManyArguments}
+		}
+		statusCode := ua.Good
+		inputArgumentResults := make([]ua.StatusCode, len(req.InputArguments))
+		in := make([]reflect.Value, t.NumIn())
+		in[0] = reflect.ValueOf(ctx)
+		for i, arg := range req.InputArguments {
+			v, ok := toReflectValue(arg, t.In(i+1))
+			if !ok {
+				statusCode = ua.BadInvalidArgument
+				inputArgumentResults[i] = ua.BadTypeMismatch
+				continue
+			}
+			in[i+1] = v
+		}
+		if statusCode == ua.BadInvalidArgument {
+			return ua.CallMethodResult{StatusCode: statusCode, InputArgumentResults: inputArgumentResults}
+		}
+		out := f.Call(in)
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			if sc, ok := err.(ua.StatusCode); ok {
+				return ua.CallMethodResult{StatusCode: sc}
+			}
+			return ua.CallMethodResult{StatusCode: ua.BadInternalError}
+		}
+		outputArguments := make([]ua.Variant, len(out)-1)
+		for i := range outputArguments {
+			outputArguments[i] = out[i].Interface()
+		}
+		return ua.CallMethodResult{OutputArguments: outputArguments}
+	}
+}
+
+// toReflectValue converts the value to the type t.
+func toReflectValue(value ua.Variant, t reflect.Type) (reflect.Value, bool) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return reflect.Zero(t), t.Kind() == reflect.Interface
+	}
+	if v.Type().AssignableTo(t) {
+		return v, true
+	}
+	if v.Type().ConvertibleTo(t) && v.Kind() == t.Kind() {
+		return v.Convert(t), true
+	}
+	if v.Kind() == reflect.String && t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return v.Convert(t), true // bytestring to byte array
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.String {
+		return v.Convert(t), true // byte array to bytestring
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func ExampleNewMethod() {
+	srv, err := New(ua.ApplicationDescription{}, "./pki/server.crt", "./pki/server.key", "opc.tcp://127.0.0.1:46010")
+	if err != nil {
+		return
+	}
+	nm := srv.NamespaceManager()
+	if parent, ok := nm.FindObject(ua.ObjectIDObjectsFolder); ok {
+		nm.AddMethod(parent, NewMethod("SetSetpoint").
+			Input("setpoint", ua.DataTypeIDDouble).
+			Output("accepted", ua.DataTypeIDBoolean).
+			Handler(func(ctx context.Context, setpoint float64) (bool, error) {
+				if setpoint < 0 {
+					return false, ua.BadOutOfRange
+				}
+				return true, nil
+			}))
+	}
+}
+
+func TestMethodBuilder(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeCall)
+	nm := srv.NamespaceManager()
+	parent, _ := nm.FindObject(testObjectID)
+	method, err := nm.AddMethod(parent, NewMethod("Scale").
+		Input("values", ua.DataTypeIDDouble).
+		Input("factor", ua.DataTypeIDDouble).
+		Output("result", ua.DataTypeIDDouble).
+		Output("count", ua.DataTypeIDInt32).
+		Handler(func(ctx context.Context, values []float64, factor float64) ([]float64, int32, error) {
+			if factor == 0 {
+				return nil, 0, ua.BadOutOfRange
+			}
+			result := make([]float64, len(values))
+			for i, v := range values {
+				result[i] = v * factor
+			}
+			return result, int32(len(result)), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method.GetNodeID() != ua.NewNodeIDString(1, "Object.Scale") {
+		t.Errorf("unexpected NodeID %s", method.GetNodeID())
+	}
+	prop, ok := nm.FindProperty(method, ua.ParseQualifiedName("0:InputArguments"))
+	if !ok {
+		t.Fatal("expected InputArguments property")
+	}
+	if args := prop.GetValue().Value.([]ua.ExtensionObject); len(args) != 2 || args[0].(ua.Argument).ValueRank != ua.ValueRankOneDimension || args[1].(ua.Argument).ValueRank != ua.ValueRankScalar {
+		t.Errorf("unexpected InputArguments %v", args)
+	}
+	if _, ok := nm.FindProperty(method, ua.ParseQualifiedName("0:OutputArguments")); !ok {
+		t.Fatal("expected OutputArguments property")
+	}
+
+	call := func(args ...ua.Variant) ua.CallMethodResult {
+		return srv.callMethod(ctx, ua.CallMethodRequest{ObjectID: testObjectID, MethodID: method.GetNodeID(), InputArguments: args})
+	}
+	result := call([]float64{1, 2}, float64(2))
+	if result.StatusCode != ua.Good {
+		t.Fatalf("expected %s, got %s", ua.Good, result.StatusCode)
+	}
+	if values, ok := result.OutputArguments[0].([]float64); !ok || len(values) != 2 || values[1] != 4 || result.OutputArguments[1] != int32(2) {
+		t.Errorf("unexpected OutputArguments %v", result.OutputArguments)
+	}
+	if result := call([]float64{1, 2}, "2"); result.StatusCode != ua.BadInvalidArgument {
+		t.Errorf("expected %s, got %s", ua.BadInvalidArgument, result.StatusCode)
+	}
+	if result := call([]float64{1, 2}, float64(0)); result.StatusCode != ua.BadOutOfRange {
+		t.Errorf("expected %s, got %s", ua.BadOutOfRange, result.StatusCode)
+	}
+}
+
+func TestMethodBuilderRejectsMismatchedHandler(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeCall)
+	nm := srv.NamespaceManager()
+	parent, _ := nm.FindObject(testObjectID)
+	for name, b := range map[string]*MethodBuilder{
+		"missing handler": NewMethod("A").Input("x", ua.DataTypeIDDouble),
+		"missing context": NewMethod("B").Input("x", ua.DataTypeIDDouble).Handler(func(x float64) error { return nil }),
+		"missing error":   NewMethod("C").Input("x", ua.DataTypeIDDouble).Handler(func(ctx context.Context, x float64) {}),
+		"wrong type":      NewMethod("D").Input("x", ua.DataTypeIDDouble).Handler(func(ctx context.Context, x string) error { return nil }),
+	} {
+		if _, err := nm.AddMethod(parent, b); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
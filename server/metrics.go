@@ -0,0 +1,162 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	sessionsDesc = prometheus.NewDesc(
+		"opcua_server_sessions",
+		"Number of active sessions.",
+		nil, nil,
+	)
+	subscriptionsDesc = prometheus.NewDesc(
+		"opcua_server_subscriptions",
+		"Number of active subscriptions.",
+		nil, nil,
+	)
+	monitoredItemsDesc = prometheus.NewDesc(
+		"opcua_server_monitored_items",
+		"Number of monitored items of the active subscriptions.",
+		nil, nil,
+	)
+	workerQueueDepthDesc = prometheus.NewDesc(
+		"opcua_server_worker_queue_depth",
+		"Number of tasks waiting for a worker.",
+		nil, nil,
+	)
+	requestsDesc = prometheus.NewDesc(
+		"opcua_server_requests_total",
+		"Number of service requests received, by service.",
+		[]string{"service"}, nil,
+	)
+	requestErrorsDesc = prometheus.NewDesc(
+		"opcua_server_request_errors_total",
+		"Number of service requests that returned an error, by service.",
+		[]string{"service"}, nil,
+	)
+)
+
+// MetricsCollector returns a prometheus.Collector exposing the activity of the server.
+// The embedding application registers the collector with its prometheus registry.
+func (srv *UAServer) MetricsCollector() prometheus.Collector {
+	return &metricsCollector{srv: srv}
+}
+
+// metricsCollector collects the metrics of the server from the counters of its sessions and subscriptions.
+type metricsCollector struct {
+	srv *UAServer
+}
+
+// Describe sends the descriptors of the metrics.
+func (c *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sessionsDesc
+	ch <- subscriptionsDesc
+	ch <- monitoredItemsDesc
+	ch <- workerQueueDepthDesc
+	ch <- requestsDesc
+	ch <- requestErrorsDesc
+}
+
+// Collect sends the current values of the metrics.
+func (c *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	srv := c.srv
+
+	// sum the counters of the active sessions and the sessions already closed.
+	counters := srv.closedSessionCounters()
+	sm := srv.SessionManager()
+	sm.RLock()
+	sessionCount := len(sm.sessionsByToken)
+	for _, s := range sm.sessionsByToken {
+		addServiceCounters(counters, s.serviceCounters())
+	}
+	sm.RUnlock()
+
+	subscriptionCount := 0
+	monitoredItemCount := 0
+	if m := srv.SubscriptionManager(); m != nil {
+		m.RLock()
+		subscriptionCount = len(m.subscriptionsByID)
+		for _, s := range m.subscriptionsByID {
+			s.RLock()
+			monitoredItemCount += len(s.items)
+			s.RUnlock()
+		}
+		m.RUnlock()
+	}
+
+	ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, float64(sessionCount))
+	ch <- prometheus.MustNewConstMetric(subscriptionsDesc, prometheus.GaugeValue, float64(subscriptionCount))
+	ch <- prometheus.MustNewConstMetric(monitoredItemsDesc, prometheus.GaugeValue, float64(monitoredItemCount))
+	ch <- prometheus.MustNewConstMetric(workerQueueDepthDesc, prometheus.GaugeValue, float64(srv.WorkerPool().WaitingQueueSize()))
+	for service, counter := range counters {
+		ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.CounterValue, float64(counter.TotalCount), service)
+		ch <- prometheus.MustNewConstMetric(requestErrorsDesc, prometheus.CounterValue, float64(counter.ErrorCount), service)
+	}
+}
+
+// serviceCounters returns the request and error counts of the session, by service.
+func (s *Session) serviceCounters() map[string]ua.ServiceCounterDataType {
+	return map[string]ua.ServiceCounterDataType{
+		"Read":                          {TotalCount: s.readCount, ErrorCount: s.readErrorCount},
+		"HistoryRead":                   {TotalCount: s.historyReadCount, ErrorCount: s.historyReadErrorCount},
+		"Write":                         {TotalCount: s.writeCount, ErrorCount: s.writeErrorCount},
+		"HistoryUpdate":                 {TotalCount: s.historyUpdateCount, ErrorCount: s.historyUpdateErrorCount},
+		"Call":                          {TotalCount: s.callCount, ErrorCount: s.callErrorCount},
+		"CreateMonitoredItems":          {TotalCount: s.createMonitoredItemsCount, ErrorCount: s.createMonitoredItemsErrorCount},
+		"ModifyMonitoredItems":          {TotalCount: s.modifyMonitoredItemsCount, ErrorCount: s.modifyMonitoredItemsErrorCount},
+		"SetMonitoringMode":             {TotalCount: s.setMonitoringModeCount, ErrorCount: s.setMonitoringModeErrorCount},
+		"SetTriggering":                 {TotalCount: s.setTriggeringCount, ErrorCount: s.setTriggeringErrorCount},
+		"DeleteMonitoredItems":          {TotalCount: s.deleteMonitoredItemsCount, ErrorCount: s.deleteMonitoredItemsErrorCount},
+		"CreateSubscription":            {TotalCount: s.createSubscriptionCount, ErrorCount: s.createSubscriptionErrorCount},
+		"ModifySubscription":            {TotalCount: s.modifySubscriptionCount, ErrorCount: s.modifySubscriptionErrorCount},
+		"SetPublishingMode":             {TotalCount: s.setPublishingModeCount, ErrorCount: s.setPublishingModeErrorCount},
+		"Publish":                       {TotalCount: s.publishCount, ErrorCount: s.publishErrorCount},
+		"Republish":                     {TotalCount: s.republishCount, ErrorCount: s.republishErrorCount},
+		"TransferSubscriptions":         {TotalCount: s.transferSubscriptionsCount, ErrorCount: s.transferSubscriptionsErrorCount},
+		"DeleteSubscriptions":           {TotalCount: s.deleteSubscriptionsCount, ErrorCount: s.deleteSubscriptionsErrorCount},
+		"AddNodes":                      {TotalCount: s.addNodesCount, ErrorCount: s.addNodesErrorCount},
+		"AddReferences":                 {TotalCount: s.addReferencesCount, ErrorCount: s.addReferencesErrorCount},
+		"DeleteNodes":                   {TotalCount: s.deleteNodesCount, ErrorCount: s.deleteNodesErrorCount},
+		"DeleteReferences":              {TotalCount: s.deleteReferencesCount, ErrorCount: s.deleteReferencesErrorCount},
+		"Browse":                        {TotalCount: s.browseCount, ErrorCount: s.browseErrorCount},
+		"BrowseNext":                    {TotalCount: s.browseNextCount, ErrorCount: s.browseNextErrorCount},
+		"TranslateBrowsePathsToNodeIds": {TotalCount: s.translateBrowsePathsToNodeIdsCount, ErrorCount: s.translateBrowsePathsToNodeIdsErrorCount},
+		"QueryFirst":                    {TotalCount: s.queryFirstCount, ErrorCount: s.queryFirstErrorCount},
+		"QueryNext":                     {TotalCount: s.queryNextCount, ErrorCount: s.queryNextErrorCount},
+		"RegisterNodes":                 {TotalCount: s.registerNodesCount, ErrorCount: s.registerNodesErrorCount},
+		"UnregisterNodes":               {TotalCount: s.unregisterNodesCount, ErrorCount: s.unregisterNodesErrorCount},
+	}
+}
+
+// addServiceCounters adds the counters of src to dst.
+func addServiceCounters(dst, src map[string]ua.ServiceCounterDataType) {
+	for service, counter := range src {
+		c := dst[service]
+		c.TotalCount += counter.TotalCount
+		c.ErrorCount += counter.ErrorCount
+		dst[service] = c
+	}
+}
+
+// retireSessionCounters keeps the counters of a closed session, so the request counters never decrease.
+func (srv *UAServer) retireSessionCounters(s *Session) {
+	srv.Lock()
+	defer srv.Unlock()
+	if srv.retiredServiceCounters == nil {
+		srv.retiredServiceCounters = make(map[string]ua.ServiceCounterDataType)
+	}
+	addServiceCounters(srv.retiredServiceCounters, s.serviceCounters())
+}
+
+// closedSessionCounters returns a copy of the counters of the closed sessions.
+func (srv *UAServer) closedSessionCounters() map[string]ua.ServiceCounterDataType {
+	srv.RLock()
+	defer srv.RUnlock()
+	counters := make(map[string]ua.ServiceCounterDataType, len(srv.retiredServiceCounters))
+	addServiceCounters(counters, srv.retiredServiceCounters)
+	return counters
+}
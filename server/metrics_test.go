@@ -0,0 +1,80 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	req := &ua.ReadRequest{
+		RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		NodesToRead:   []ua.ReadValueID{{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}},
+	}
+	srv.handleRead(ch.serverSecureChannel, 1, req)
+	srv.handleRead(ch.serverSecureChannel, 2, req)
+	req.NodesToRead = nil
+	srv.handleRead(ch.serverSecureChannel, 3, req)
+	if _, ok := ch.WaitResponse(3, time.Second); !ok {
+		t.Fatal("expected 3 responses")
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(srv.MetricsCollector()); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := findMetric(families, "opcua_server_sessions", ""); v == nil || v.GetGauge().GetValue() != 1 {
+		t.Errorf("expected 1 session, got %v", v)
+	}
+	if v := findMetric(families, "opcua_server_requests_total", "Read"); v == nil || v.GetCounter().GetValue() != 3 {
+		t.Errorf("expected 3 Read requests, got %v", v)
+	}
+	if v := findMetric(families, "opcua_server_request_errors_total", "Read"); v == nil || v.GetCounter().GetValue() != 1 {
+		t.Errorf("expected 1 Read error, got %v", v)
+	}
+
+	// counters of closed sessions are kept, once when the session is deleted twice.
+	srv.SessionManager().Delete(session)
+	srv.SessionManager().Delete(session)
+	families, err = reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := findMetric(families, "opcua_server_sessions", ""); v == nil || v.GetGauge().GetValue() != 0 {
+		t.Errorf("expected 0 sessions, got %v", v)
+	}
+	if v := findMetric(families, "opcua_server_requests_total", "Read"); v == nil || v.GetCounter().GetValue() != 3 {
+		t.Errorf("expected 3 Read requests after session closed, got %v", v)
+	}
+}
+
+// findMetric returns the metric of the family with the given service label, or nil if not found.
+func findMetric(families []*dto.MetricFamily, name, service string) *dto.Metric {
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if service == "" {
+				return m
+			}
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "service" && l.GetValue() == service {
+					return m
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// modelChangeEventSeverity is the severity of the event raised when the address space changes.
+const modelChangeEventSeverity uint16 = 100
+
+// raiseModelChange raises a GeneralModelChangeEvent from the Server object, so that clients may update their
+// copy of the address space.
+func (m *NamespaceManager) raiseModelChange(changes ...ua.ModelChangeStructureDataType) {
+	server, ok := m.FindObject(ua.ObjectIDServer)
+	if !ok || len(changes) == 0 {
+		return
+	}
+	now := time.Now()
+	if m.server != nil {
+		now = m.server.now()
+	}
+	server.OnEvent(&ua.GeneralModelChangeEvent{
+		EventID:     newEventID(),
+		EventType:   ua.ObjectTypeIDGeneralModelChangeEventType,
+		SourceNode:  ua.ObjectIDServer,
+		SourceName:  "Server",
+		Time:        now,
+		ReceiveTime: now,
+		Message:     ua.NewLocalizedText("The address space has changed.", DefaultLocale),
+		Severity:    modelChangeEventSeverity,
+		Changes:     changes,
+	})
+}
+
+// modelChange returns the change of the node.
+func modelChange(n Node, id ua.NodeID, verb ua.ModelChangeStructureVerbMask) ua.ModelChangeStructureDataType {
+	return ua.ModelChangeStructureDataType{Affected: id, AffectedType: typeDefinition(n), Verb: uint8(verb)}
+}
+
+// typeDefinition returns the target of the HasTypeDefinition reference of the node, or nil.
+func typeDefinition(n Node) ua.NodeID {
+	for _, r := range n.GetReferences() {
+		if !r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasTypeDefinition {
+			return r.TargetID.NodeID
+		}
+	}
+	return nil
+}
@@ -5,7 +5,6 @@ package server
 import (
 	"context"
 	"math"
-	"reflect"
 	"sync/atomic"
 	"time"
 
@@ -48,7 +47,8 @@ type MonitoredItem struct {
 	ti                  time.Duration
 	cachedCtx           context.Context
 	triggeredItems      []*MonitoredItem
-	triggered           bool
+	triggered           uint32
+	replayed            map[ua.ByteString]struct{}
 }
 
 // NewMonitoredItem constructs a new MonitoredItem.
@@ -73,6 +73,7 @@ func NewMonitoredItem(ctx context.Context, sub *Subscription, node Node, itemToM
 	mi.setFilter(parameters.Filter)
 	mi.Lock()
 	mi.startMonitoring(ctx)
+	mi.replayEvents()
 	mi.Unlock()
 	return mi
 }
@@ -84,6 +85,10 @@ func (mi *MonitoredItem) Modify(ctx context.Context, req ua.MonitoredItemModifyR
 	mi.stopMonitoring()
 	mi.clientHandle = req.RequestedParameters.ClientHandle
 	mi.discardOldest = req.RequestedParameters.DiscardOldest
+	if mi.itemToMonitor.AttributeID != ua.AttributeIDEventNotifier {
+		// the server minimum may have changed since the item was created.
+		mi.minSamplingInterval = mi.srv.ServerCapabilities().MinSupportedSampleRate
+	}
 	mi.setQueueSize(req.RequestedParameters.QueueSize)
 	mi.setSamplingInterval(req.RequestedParameters.SamplingInterval)
 	mi.setFilter(req.RequestedParameters.Filter)
@@ -102,6 +107,7 @@ func (mi *MonitoredItem) Delete() {
 	mi.sub = nil
 	mi.prequeue.Clear()
 	mi.triggeredItems = nil
+	mi.replayed = nil
 }
 
 // SetMonitoringMode sets the MonitoringMode of the MonitoredItem.
@@ -112,14 +118,18 @@ func (mi *MonitoredItem) SetMonitoringMode(ctx context.Context, mode ua.Monitori
 		return
 	}
 	mi.stopMonitoring()
-	mi.monitoringMode = mode
-	if mode == ua.MonitoringModeDisabled {
+	switch {
+	case mode == ua.MonitoringModeDisabled:
+		// stop sampling and discard the queue, so the current value is reported once when enabled again.
 		mi.queue.Clear()
+		mi.prequeue.Clear()
 		mi.previousQueuedValue = ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Time{}, 0, time.Time{}, 0)
+		atomic.StoreUint32(&mi.triggered, 0)
 		mi.sub.disabledMonitoredItemCount++
-	} else {
+	case mi.monitoringMode == ua.MonitoringModeDisabled:
 		mi.sub.disabledMonitoredItemCount--
 	}
+	mi.monitoringMode = mode
 	mi.startMonitoring(ctx)
 }
 
@@ -144,22 +154,16 @@ func (mi *MonitoredItem) setQueueSize(queueSize uint32) {
 			mi.queue.PopFront()
 			overflow = true
 		}
-		if overflow && mi.queue.Len() > 1 {
-			// set overflow bit of statuscode
-			if v, ok := mi.queue.Front().(ua.DataValue); ok {
-				v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
-			}
+		if overflow && mi.queueSize > 1 {
+			mi.setOverflow(0)
 		}
 	} else {
 		for mi.queue.Len() > int(mi.queueSize) {
 			mi.queue.PopBack()
 			overflow = true
 		}
-		if overflow && mi.queue.Len() > 1 {
-			// set overflow bit of statuscode
-			if v, ok := mi.queue.Back().(ua.DataValue); ok {
-				v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
-			}
+		if overflow && mi.queueSize > 1 {
+			mi.setOverflow(mi.queue.Len() - 1)
 		}
 	}
 }
@@ -222,7 +226,7 @@ func (mi *MonitoredItem) setFilter(filter interface{}) {
 
 func (mi *MonitoredItem) startMonitoring(ctx context.Context) {
 	mi.cachedCtx = ctx
-	mi.ts = time.Now()
+	mi.ts = mi.srv.now()
 	if mi.monitoringMode == ua.MonitoringModeDisabled {
 		return
 	}
@@ -244,21 +248,67 @@ func (mi *MonitoredItem) startMonitoring(ctx context.Context) {
 
 func (mi *MonitoredItem) OnEvent(evt ua.Event) {
 	mi.Lock()
+	if id, ok := evt.GetAttribute(attributeOperandEventID).(ua.ByteString); ok {
+		// the event raised while the item was created was replayed already.
+		if _, ok := mi.replayed[id]; ok {
+			delete(mi.replayed, id)
+			mi.Unlock()
+			return
+		}
+	}
 	if res, ok := mi.whereClause(evt, 0).(bool); ok && res {
 		mi.enqueue(mi.selectFields(evt))
+		mi.triggerItems()
 	}
 	mi.Unlock()
 }
 
+// replayEvents enqueues the recent events of the node passing the WhereClause, if the server keeps them. The
+// EventIds of the replayed events are kept, so the events raised after the listener was added are not enqueued twice.
+func (mi *MonitoredItem) replayEvents() {
+	r := mi.srv.eventReplay
+	if r == nil || mi.itemToMonitor.AttributeID != ua.AttributeIDEventNotifier || mi.monitoringMode == ua.MonitoringModeDisabled {
+		return
+	}
+	n2, ok := mi.node.(*ObjectNode)
+	if !ok {
+		return
+	}
+	events := r.events(n2.GetNodeID())
+	if len(events) == 0 {
+		return
+	}
+	mi.replayed = make(map[ua.ByteString]struct{}, len(events))
+	triggered := false
+	for _, evt := range events {
+		if id, ok := evt.GetAttribute(attributeOperandEventID).(ua.ByteString); ok {
+			mi.replayed[id] = struct{}{}
+		}
+		if res, ok := mi.whereClause(evt, 0).(bool); ok && res {
+			mi.enqueue(mi.selectFields(evt))
+			triggered = true
+		}
+	}
+	if triggered {
+		mi.triggerItems()
+	}
+}
+
 var (
 	attributeOperandEventType = ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDBaseEventType, BrowsePath: ua.ParseBrowsePath("EventType"), AttributeID: ua.AttributeIDValue}
+	attributeOperandEventID   = ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDBaseEventType, BrowsePath: ua.ParseBrowsePath("EventId"), AttributeID: ua.AttributeIDValue}
 )
 
 func (mi *MonitoredItem) whereClause(evt ua.Event, idx int) interface{} {
-	if idx >= len(mi.eventFilter.WhereClause.Elements) {
+	return evaluateWhereClause(mi.srv, mi.eventFilter.WhereClause, evt, idx)
+}
+
+// evaluateWhereClause returns the result of the element of the where clause at idx for the event.
+func evaluateWhereClause(srv *UAServer, where ua.ContentFilter, evt ua.Event, idx int) interface{} {
+	if idx >= len(where.Elements) {
 		return true
 	}
-	element := mi.eventFilter.WhereClause.Elements[idx]
+	element := where.Elements[idx]
 	switch element.FilterOperator {
 
 	case ua.FilterOperatorEquals:
@@ -269,7 +319,7 @@ func (mi *MonitoredItem) whereClause(evt ua.Event, idx int) interface{} {
 		case ua.SimpleAttributeOperand:
 			a = evt.GetAttribute(c)
 		case ua.ElementOperand:
-			a = mi.whereClause(evt, int(c.Index))
+			a = evaluateWhereClause(srv, where, evt, int(c.Index))
 		default:
 			return false
 		}
@@ -279,7 +329,7 @@ func (mi *MonitoredItem) whereClause(evt ua.Event, idx int) interface{} {
 		case ua.SimpleAttributeOperand:
 			b = evt.GetAttribute(c)
 		case ua.ElementOperand:
-			b = mi.whereClause(evt, int(c.Index))
+			b = evaluateWhereClause(srv, where, evt, int(c.Index))
 		default:
 			return false
 		}
@@ -289,7 +339,7 @@ func (mi *MonitoredItem) whereClause(evt ua.Event, idx int) interface{} {
 		if a, ok := element.FilterOperands[0].(ua.LiteralOperand); ok {
 			if b, ok := a.Value.(ua.NodeID); ok {
 				if c, ok := evt.GetAttribute(attributeOperandEventType).(ua.NodeID); ok {
-					if c == b || mi.srv.namespaceManager.IsSubtype(c, b) {
+					if c == b || srv.namespaceManager.IsSubtype(c, b) {
 						return true
 					}
 				}
@@ -303,14 +353,37 @@ func (mi *MonitoredItem) whereClause(evt ua.Event, idx int) interface{} {
 }
 
 func (mi *MonitoredItem) selectFields(evt ua.Event) []ua.Variant {
-	clauses := mi.eventFilter.SelectClauses
+	return selectEventFields(mi.eventFilter.SelectClauses, evt, mi.timestampsToReturn)
+}
+
+// selectEventFields returns the fields of the event selected by the clauses.
+func selectEventFields(clauses []ua.SimpleAttributeOperand, evt ua.Event, timestampsToReturn ua.TimestampsToReturn) []ua.Variant {
 	ret := make([]ua.Variant, len(clauses))
 	for i, clause := range clauses {
-		ret[i] = evt.GetAttribute(clause)
+		ret[i] = withEventTimestamps(clause, evt.GetAttribute(clause), timestampsToReturn)
 	}
 	return ret
 }
 
+// withEventTimestamps returns the event field with only the selected timestamps. The Time field of an event
+// is treated as its source timestamp, and the ReceiveTime field as its server timestamp.
+func withEventTimestamps(clause ua.SimpleAttributeOperand, field ua.Variant, timestampsToReturn ua.TimestampsToReturn) ua.Variant {
+	if v, ok := field.(ua.DataValue); ok {
+		return withTimestamps(v, timestampsToReturn)
+	}
+	switch {
+	case ua.EqualSimpleAttributeOperand(clause, ua.BaseEventSelectClauses[4]):
+		if timestampsToReturn == ua.TimestampsToReturnServer || timestampsToReturn == ua.TimestampsToReturnNeither {
+			return nil
+		}
+	case ua.EqualSimpleAttributeOperand(clause, ua.BaseEventSelectClauses[5]):
+		if timestampsToReturn == ua.TimestampsToReturnSource || timestampsToReturn == ua.TimestampsToReturnNeither {
+			return nil
+		}
+	}
+	return field
+}
+
 func (mi *MonitoredItem) stopMonitoring() {
 	switch mi.itemToMonitor.AttributeID {
 	case ua.AttributeIDEventNotifier:
@@ -326,10 +399,11 @@ func (mi *MonitoredItem) stopMonitoring() {
 	mi.cachedCtx = nil
 }
 
-// Poll reads the value of the itemToMonitor.
+// Poll samples the attribute of the itemToMonitor. Attributes other than the Value, such as the DisplayName, are
+// sampled the same way, so clients are notified when the metadata of a node changes.
 func (mi *MonitoredItem) Poll() {
 	mi.Lock()
-	if n := mi.node; n != nil {
+	if n := mi.node; n != nil && mi.monitoringMode != ua.MonitoringModeDisabled {
 		v := mi.srv.readValue(mi.cachedCtx, mi.itemToMonitor)
 		mi.prequeue.PushBack(v)
 	}
@@ -361,7 +435,38 @@ func (mi *MonitoredItem) removeTriggeredItem(item *MonitoredItem) bool {
 	return ret
 }
 
+// triggerItems triggers the items linked to this item, so items in sampling mode report their queued values
+// in the same notification as this item.
+func (mi *MonitoredItem) triggerItems() {
+	for _, item := range mi.triggeredItems {
+		atomic.StoreUint32(&item.triggered, 1)
+	}
+}
+
+// isTriggered returns true if the item was triggered since its queue was last emptied.
+func (mi *MonitoredItem) isTriggered() bool {
+	return atomic.LoadUint32(&mi.triggered) == 1
+}
+
+// isReporting returns true if the item reports its notifications, either because of its monitoring mode or
+// because it was triggered.
+func (mi *MonitoredItem) isReporting() bool {
+	return mi.monitoringMode == ua.MonitoringModeReporting || (mi.monitoringMode == ua.MonitoringModeSampling && mi.isTriggered())
+}
+
+// triggeredNotificationsAvailable returns true if the item was triggered and has queued notifications.
+func (mi *MonitoredItem) triggeredNotificationsAvailable() bool {
+	mi.RLock()
+	defer mi.RUnlock()
+	return mi.queue.Len() > 0 && mi.isReporting()
+}
+
 func (mi *MonitoredItem) enqueue(item interface{}) {
+	// a trigger only reports the notifications queued when it occurred, so a trigger received while the
+	// queue was empty does not report the values queued after it.
+	if mi.queue.Len() == 0 {
+		atomic.StoreUint32(&mi.triggered, 0)
+	}
 	overflow := false
 	if mi.discardOldest {
 		for mi.queue.Len() >= int(mi.queueSize) {
@@ -370,10 +475,7 @@ func (mi *MonitoredItem) enqueue(item interface{}) {
 		}
 		mi.queue.PushBack(item)
 		if overflow && mi.queueSize > 1 {
-			// set overflow bit of statuscode
-			if v, ok := mi.queue.Front().(ua.DataValue); ok {
-				v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
-			}
+			mi.setOverflow(0)
 			mi.sub.monitoringQueueOverflowCount++
 		}
 	} else {
@@ -383,15 +485,21 @@ func (mi *MonitoredItem) enqueue(item interface{}) {
 		}
 		mi.queue.PushBack(item)
 		if overflow && mi.queueSize > 1 {
-			// set overflow bit of statuscode
-			if v, ok := mi.queue.Back().(ua.DataValue); ok {
-				v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
-			}
+			mi.setOverflow(mi.queue.Len() - 1)
 			mi.sub.monitoringQueueOverflowCount++
 		}
 	}
 }
 
+// setOverflow sets the overflow bit of the data value at the index of the queue: the oldest value kept if the
+// item discards the oldest values, else the newest value, which replaced the last value of the queue.
+func (mi *MonitoredItem) setOverflow(i int) {
+	if v, ok := mi.queue.At(i).(ua.DataValue); ok {
+		v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
+		mi.queue.Set(i, v)
+	}
+}
+
 func (mi *MonitoredItem) notifications(max int) (notifications []interface{}, more bool) {
 	mi.Lock()
 	defer mi.Unlock()
@@ -404,9 +512,8 @@ func (mi *MonitoredItem) notifications(max int) (notifications []interface{}, mo
 		}
 	}
 	more = mi.queue.Len() > 0
-	if mi.triggered && !more {
-		mi.triggered = false
-		// log.Printf("Reset triggered %d", mi.id)
+	if !more {
+		atomic.StoreUint32(&mi.triggered, 0)
 	}
 	return notifications, more
 }
@@ -451,12 +558,7 @@ func (mi *MonitoredItem) notificationsAvailable(tn time.Time, late bool, resend
 				if mi.isDataChange(v, mi.previousQueuedValue) {
 					mi.enqueue(withTimestamps(v, mi.timestampsToReturn))
 					mi.previousQueuedValue = v
-					if mi.triggeredItems != nil {
-						for _, item := range mi.triggeredItems {
-							item.triggered = true
-							// log.Printf("Item %d triggered %d", mi.id, item.id)
-						}
-					}
+					mi.triggerItems()
 				}
 			}
 		} else {
@@ -466,12 +568,7 @@ func (mi *MonitoredItem) notificationsAvailable(tn time.Time, late bool, resend
 				if mi.isDataChange(v, mi.previousQueuedValue) {
 					mi.enqueue(withTimestamps(v, mi.timestampsToReturn))
 					mi.previousQueuedValue = v
-					if mi.triggeredItems != nil {
-						for _, item := range mi.triggeredItems {
-							item.triggered = true
-							// log.Printf("Item %d triggered %d", mi.id, item.id)
-						}
-					}
+					mi.triggerItems()
 				}
 			}
 		}
@@ -483,7 +580,7 @@ func (mi *MonitoredItem) notificationsAvailable(tn time.Time, late bool, resend
 			}
 		}
 	}
-	return mi.queue.Len() > 0 && (mi.monitoringMode == ua.MonitoringModeReporting || mi.triggered)
+	return mi.queue.Len() > 0 && mi.isReporting()
 }
 
 func (mi *MonitoredItem) isDataChange(current, previous ua.DataValue) bool {
@@ -497,11 +594,11 @@ func (mi *MonitoredItem) isDataChange(current, previous ua.DataValue) bool {
 		}
 		switch ua.DeadbandType(dcf.DeadbandType) {
 		case ua.DeadbandTypeNone:
-			return !reflect.DeepEqual(current.Value, previous.Value)
+			return !equalVariant(current.Value, previous.Value)
 		case ua.DeadbandTypeAbsolute:
 			return !equalDeadbandAbsolute(current.Value, previous.Value, dcf.DeadbandValue)
 		case ua.DeadbandTypePercent:
-			return true
+			return !mi.equalDeadbandPercent(current.Value, previous.Value, dcf.DeadbandValue)
 		}
 	case ua.DataChangeTriggerStatusValueTimestamp:
 		if current.StatusCode&0xFFFFF000 != previous.StatusCode&0xFFFFF000 {
@@ -512,16 +609,40 @@ func (mi *MonitoredItem) isDataChange(current, previous ua.DataValue) bool {
 		}
 		switch ua.DeadbandType(dcf.DeadbandType) {
 		case ua.DeadbandTypeNone:
-			return !reflect.DeepEqual(current.Value, previous.Value)
+			return !equalVariant(current.Value, previous.Value)
 		case ua.DeadbandTypeAbsolute:
 			return !equalDeadbandAbsolute(current.Value, previous.Value, dcf.DeadbandValue)
 		case ua.DeadbandTypePercent:
-			return true
+			return !mi.equalDeadbandPercent(current.Value, previous.Value, dcf.DeadbandValue)
 		}
 	}
 	return true
 }
 
+// equalDeadbandPercent returns true if the values differ by no more than the percentage of the EURange of the
+// variable. Values are always different if the variable has no EURange.
+func (mi *MonitoredItem) equalDeadbandPercent(current, previous ua.Variant, deadband float64) bool {
+	n, ok := mi.node.(*VariableNode)
+	if !ok {
+		return false
+	}
+	r, ok := mi.srv.euRange(n)
+	if !ok {
+		return false
+	}
+	return equalDeadbandAbsolute(current, previous, deadband/100*math.Abs(r.High-r.Low))
+}
+
+// euRange returns the EURange property of the variable.
+func (srv *UAServer) euRange(n *VariableNode) (ua.Range, bool) {
+	prop, ok := srv.NamespaceManager().FindProperty(n, ua.ParseQualifiedName("0:EURange"))
+	if !ok {
+		return ua.Range{}, false
+	}
+	r, ok := prop.GetValue().Value.(ua.Range)
+	return r, ok
+}
+
 func equalDeadbandAbsolute(current, previous ua.Variant, deadband float64) bool {
 	switch c := current.(type) {
 	case nil:
@@ -0,0 +1,554 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestEventTimestampsToReturn(t *testing.T) {
+	evt := &ua.BaseEvent{
+		EventID:     ua.ByteString("1"),
+		EventType:   ua.ObjectTypeIDBaseEventType,
+		SourceName:  "Source",
+		Time:        time.Now(),
+		ReceiveTime: time.Now(),
+		Message:     ua.NewLocalizedText("Temperature is high.", ""),
+		Severity:    500,
+	}
+	for _, c := range []struct {
+		timestampsToReturn ua.TimestampsToReturn
+		time, receiveTime  bool
+	}{
+		{ua.TimestampsToReturnBoth, true, true},
+		{ua.TimestampsToReturnSource, true, false},
+		{ua.TimestampsToReturnServer, false, true},
+		{ua.TimestampsToReturnNeither, false, false},
+	} {
+		mi := &MonitoredItem{
+			itemToMonitor:      ua.ReadValueID{AttributeID: ua.AttributeIDEventNotifier},
+			queueSize:          maxQueueSize,
+			timestampsToReturn: c.timestampsToReturn,
+			eventFilter:        ua.EventFilter{SelectClauses: ua.BaseEventSelectClauses},
+		}
+		mi.OnEvent(evt)
+		if mi.queue.Len() != 1 {
+			t.Fatalf("expected 1 notification, got %d", mi.queue.Len())
+		}
+		fields := mi.queue.PopFront().([]ua.Variant)
+		if (fields[4] != nil) != c.time {
+			t.Errorf("%s: unexpected Time %v", c.timestampsToReturn, fields[4])
+		}
+		if (fields[5] != nil) != c.receiveTime {
+			t.Errorf("%s: unexpected ReceiveTime %v", c.timestampsToReturn, fields[5])
+		}
+		if fields[3] != "Source" || fields[7] != uint16(500) {
+			t.Errorf("%s: unexpected fields %v", c.timestampsToReturn, fields)
+		}
+	}
+}
+
+func newTestDataChangeItem(mode ua.MonitoringMode) *MonitoredItem {
+	return &MonitoredItem{
+		itemToMonitor:       ua.ReadValueID{AttributeID: ua.AttributeIDValue},
+		monitoringMode:      mode,
+		queueSize:           10,
+		discardOldest:       true,
+		dataChangeFilter:    ua.DataChangeFilter{Trigger: ua.DataChangeTriggerStatusValue},
+		previousQueuedValue: ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Time{}, 0, time.Time{}, 0),
+	}
+}
+
+func TestTriggeredItemReportsWithTriggeringItem(t *testing.T) {
+	trigger := newTestDataChangeItem(ua.MonitoringModeReporting)
+	triggered := newTestDataChangeItem(ua.MonitoringModeSampling)
+	trigger.addTriggeredItem(triggered)
+
+	now := time.Now()
+	triggered.prequeue.PushBack(ua.NewDataValue(float64(1), 0, now, 0, now, 0))
+	triggered.prequeue.PushBack(ua.NewDataValue(float64(2), 0, now, 0, now, 0))
+	if triggered.notificationsAvailable(now, false, false) {
+		t.Fatal("expected sampling item not to report on its own")
+	}
+
+	trigger.prequeue.PushBack(ua.NewDataValue(true, 0, now, 0, now, 0))
+	if !trigger.notificationsAvailable(now, false, false) {
+		t.Fatal("expected triggering item to report")
+	}
+	if !triggered.triggeredNotificationsAvailable() {
+		t.Fatal("expected triggered item to report")
+	}
+	notifications, more := triggered.notifications(10)
+	if len(notifications) != 2 || more {
+		t.Fatalf("expected burst of 2 notifications, got %d", len(notifications))
+	}
+	if notifications[0].(ua.DataValue).Value != float64(1) || notifications[1].(ua.DataValue).Value != float64(2) {
+		t.Errorf("unexpected notifications %v", notifications)
+	}
+
+	triggered.prequeue.PushBack(ua.NewDataValue(float64(3), 0, now, 0, now, 0))
+	if triggered.notificationsAvailable(now, false, false) || triggered.triggeredNotificationsAvailable() {
+		t.Error("expected sampling item not to report after its queue was emptied")
+	}
+	triggered.notifications(10)
+
+	// a trigger received while the queue is empty does not report the values sampled after it.
+	trigger.prequeue.PushBack(ua.NewDataValue(false, 0, now, 0, now, 0))
+	if !trigger.notificationsAvailable(now, false, false) {
+		t.Fatal("expected triggering item to report")
+	}
+	trigger.notifications(10)
+	triggered.prequeue.PushBack(ua.NewDataValue(float64(4), 0, now, 0, now, 0))
+	if triggered.notificationsAvailable(now, false, false) || triggered.triggeredNotificationsAvailable() {
+		t.Error("expected sampling item not to report a value sampled after the trigger")
+	}
+}
+
+func TestMonitoringModeDisabled(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	newTestScheduler(srv)
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+
+	sub := &Subscription{}
+	mi := newTestDataChangeItem(ua.MonitoringModeReporting)
+	mi.srv = srv
+	mi.sub = sub
+	mi.node = n
+	mi.itemToMonitor.NodeID = testVariableID
+	mi.Lock()
+	mi.startMonitoring(ctx)
+	mi.Unlock()
+	if !mi.notificationsAvailable(time.Now(), false, false) {
+		t.Fatal("expected initial value to be reported")
+	}
+	mi.notifications(10)
+
+	mi.SetMonitoringMode(ctx, ua.MonitoringModeDisabled)
+	if sub.disabledMonitoredItemCount != 1 {
+		t.Errorf("expected 1 disabled item, got %d", sub.disabledMonitoredItemCount)
+	}
+	n.SetValue(ua.NewDataValue(float64(43), 0, time.Now(), 0, time.Now(), 0))
+	mi.Poll()
+	if mi.notificationsAvailable(time.Now(), false, false) || mi.prequeue.Len() > 0 {
+		t.Fatal("expected no sampling or notifications while disabled")
+	}
+
+	mi.SetMonitoringMode(ctx, ua.MonitoringModeReporting)
+	if sub.disabledMonitoredItemCount != 0 {
+		t.Errorf("expected 0 disabled items, got %d", sub.disabledMonitoredItemCount)
+	}
+	if !mi.notificationsAvailable(time.Now(), false, false) {
+		t.Fatal("expected current value to be reported when enabled")
+	}
+	notifications, _ := mi.notifications(10)
+	if len(notifications) != 1 || notifications[0].(ua.DataValue).Value != float64(43) {
+		t.Errorf("expected one notification with value 43, got %v", notifications)
+	}
+
+	mi.SetMonitoringMode(ctx, ua.MonitoringModeSampling)
+	mi.SetMonitoringMode(ctx, ua.MonitoringModeReporting)
+	if sub.disabledMonitoredItemCount != 0 {
+		t.Errorf("expected 0 disabled items, got %d", sub.disabledMonitoredItemCount)
+	}
+}
+
+func TestModifyRevisedSamplingInterval(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	newTestScheduler(srv)
+	srv.serverCapabilities.MinSupportedSampleRate = 100
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+
+	mi := newTestDataChangeItem(ua.MonitoringModeReporting)
+	mi.srv = srv
+	mi.sub = &Subscription{publishingInterval: 1000}
+	mi.node = n
+	mi.itemToMonitor.NodeID = testVariableID
+	mi.Lock()
+	mi.setSamplingInterval(1000)
+	mi.startMonitoring(ctx)
+	mi.Unlock()
+
+	modify := func(samplingInterval float64, queueSize uint32) ua.MonitoredItemModifyResult {
+		return mi.Modify(ctx, ua.MonitoredItemModifyRequest{
+			MonitoredItemID:     mi.id,
+			RequestedParameters: ua.MonitoringParameters{SamplingInterval: samplingInterval, QueueSize: queueSize, DiscardOldest: true},
+		})
+	}
+	if res := modify(10, 5000); res.RevisedSamplingInterval != 100 || res.RevisedQueueSize != maxQueueSize {
+		t.Errorf("expected revised interval 100 and queue size %d, got %+v", maxQueueSize, res)
+	}
+	if res := modify(-1, 0); res.RevisedSamplingInterval != 1000 || res.RevisedQueueSize != 1 {
+		t.Errorf("expected publishing interval and queue size 1, got %+v", res)
+	}
+	n.MinimumSamplingInterval = 250
+	if res := modify(10, 5); res.RevisedSamplingInterval != 250 || res.RevisedQueueSize != 5 {
+		t.Errorf("expected revised interval 250 of the node, got %+v", res)
+	}
+	if mi.SamplingInterval() != 250 {
+		t.Errorf("expected item to sample every 250ms, got %v", mi.SamplingInterval())
+	}
+}
+
+func TestMonitorDisplayName(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	newTestScheduler(srv)
+	n, _ := srv.NamespaceManager().FindObject(testObjectID)
+
+	mi := newTestDataChangeItem(ua.MonitoringModeReporting)
+	mi.srv = srv
+	mi.sub = &Subscription{}
+	mi.node = n
+	mi.itemToMonitor = ua.ReadValueID{NodeID: testObjectID, AttributeID: ua.AttributeIDDisplayName}
+	mi.Lock()
+	mi.startMonitoring(ctx)
+	mi.Unlock()
+	if !mi.notificationsAvailable(time.Now(), false, false) {
+		t.Fatal("expected initial DisplayName to be reported")
+	}
+	mi.notifications(10)
+
+	mi.Poll()
+	if mi.notificationsAvailable(time.Now(), false, false) {
+		t.Fatal("expected no notification while the DisplayName is unchanged")
+	}
+	n.SetDisplayName("Renamed")
+	mi.Poll()
+	if !mi.notificationsAvailable(time.Now(), false, false) {
+		t.Fatal("expected the changed DisplayName to be reported")
+	}
+	notifications, _ := mi.notifications(10)
+	if len(notifications) != 1 || notifications[0].(ua.DataValue).Value != ua.NewLocalizedText("Renamed", "") {
+		t.Errorf("expected one notification with the new DisplayName, got %v", notifications)
+	}
+}
+
+func TestPercentDeadbandRequiresEURange(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	sub, ch := newTestSubscription(t, srv, ctx)
+	session := sub.session
+
+	create := func(requestID int, deadbandType ua.DeadbandType) ua.MonitoredItemCreateResult {
+		req := &ua.CreateMonitoredItemsRequest{
+			RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+			SubscriptionID:     sub.id,
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+			ItemsToCreate: []ua.MonitoredItemCreateRequest{{
+				ItemToMonitor:  ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					SamplingInterval: 1000,
+					QueueSize:        1,
+					Filter:           ua.DataChangeFilter{Trigger: ua.DataChangeTriggerStatusValue, DeadbandType: uint32(deadbandType), DeadbandValue: 10},
+				},
+			}},
+		}
+		if err := srv.handleCreateMonitoredItems(ch.serverSecureChannel, uint32(requestID), req); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := ch.WaitResponse(requestID, time.Second)
+		r, ok := res.(*ua.CreateMonitoredItemsResponse)
+		if !ok || len(r.Results) != 1 {
+			t.Fatalf("unexpected response %+v", res)
+		}
+		return r.Results[0]
+	}
+	if r := create(1, ua.DeadbandTypePercent); r.StatusCode != ua.BadFilterNotAllowed {
+		t.Errorf("expected %s without EURange, got %s", ua.BadFilterNotAllowed, r.StatusCode)
+	}
+	// modifying an item to a percent deadband is also rejected without EURange.
+	created := create(2, ua.DeadbandTypeNone)
+	if created.StatusCode != ua.Good {
+		t.Fatalf("expected %s without deadband, got %s", ua.Good, created.StatusCode)
+	}
+	modify := &ua.ModifyMonitoredItemsRequest{
+		RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		SubscriptionID:     sub.id,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToModify: []ua.MonitoredItemModifyRequest{{
+			MonitoredItemID: created.MonitoredItemID,
+			RequestedParameters: ua.MonitoringParameters{
+				SamplingInterval: 1000,
+				QueueSize:        1,
+				Filter:           ua.DataChangeFilter{Trigger: ua.DataChangeTriggerStatusValue, DeadbandType: uint32(ua.DeadbandTypePercent), DeadbandValue: 10},
+			},
+		}},
+	}
+	if err := srv.handleModifyMonitoredItems(ch.serverSecureChannel, 3, modify); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(3, time.Second)
+	if r, ok := res.(*ua.ModifyMonitoredItemsResponse); !ok || len(r.Results) != 1 || r.Results[0].StatusCode != ua.BadFilterNotAllowed {
+		t.Errorf("expected %s when modifying without EURange, got %+v", ua.BadFilterNotAllowed, res)
+	}
+
+	if err := srv.NamespaceManager().AddNode(NewVariableNode(
+		ua.NewNodeIDString(1, "Variable.EURange"),
+		ua.NewQualifiedName(0, "EURange"),
+		ua.NewLocalizedText("EURange", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(testVariableID))},
+		ua.NewDataValue(ua.Range{Low: 0, High: 200}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDRange,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		-1,
+		false,
+		nil,
+	)); err != nil {
+		t.Fatal(err)
+	}
+	r := create(4, ua.DeadbandTypePercent)
+	if r.StatusCode != ua.Good {
+		t.Fatalf("expected %s with EURange, got %s", ua.Good, r.StatusCode)
+	}
+	// 10 percent of the EURange is a deadband of 20.
+	mi := sub.items[r.MonitoredItemID]
+	previous := ua.NewDataValue(float64(100), 0, time.Now(), 0, time.Now(), 0)
+	if mi.isDataChange(ua.NewDataValue(float64(120), 0, time.Now(), 0, time.Now(), 0), previous) {
+		t.Error("expected a change within the deadband to be ignored")
+	}
+	if !mi.isDataChange(ua.NewDataValue(float64(121), 0, time.Now(), 0, time.Now(), 0), previous) {
+		t.Error("expected a change beyond the deadband to be reported")
+	}
+}
+
+func TestSetMonitoringModeBatch(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	srv.serverCapabilities.MinSupportedSampleRate = 0
+	sub, ch := newTestSubscription(t, srv, ctx)
+	session := sub.session
+
+	const n = 50
+	items := make([]ua.MonitoredItemCreateRequest, n)
+	for i := range items {
+		items[i] = ua.MonitoredItemCreateRequest{
+			ItemToMonitor:       ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue},
+			MonitoringMode:      ua.MonitoringModeDisabled,
+			RequestedParameters: ua.MonitoringParameters{ClientHandle: uint32(i), QueueSize: 1},
+		}
+	}
+	if err := srv.handleCreateMonitoredItems(ch.serverSecureChannel, 1, &ua.CreateMonitoredItemsRequest{
+		RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		SubscriptionID:     sub.id,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate:      items,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	created, ok := res.(*ua.CreateMonitoredItemsResponse)
+	if !ok || len(created.Results) != n {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	ids := make([]uint32, n)
+	for i, r := range created.Results {
+		ids[i] = r.MonitoredItemID
+	}
+	for i := 0; i < 2; i++ {
+		session.addPublishRequest(ch.serverSecureChannel, uint32(10+i), &ua.PublishRequest{RequestHeader: ua.RequestHeader{Timestamp: time.Now(), TimeoutHint: 60000}}, nil)
+	}
+
+	// a publishing interval elapsing while the items are enabled is deferred until all are enabled. The change of
+	// the handler overlaps this change, and ends first.
+	sub.beginMonitoringModeChange()
+	sub.publish(time.Now())
+	if err := srv.handleSetMonitoringMode(ch.serverSecureChannel, 2, &ua.SetMonitoringModeRequest{
+		RequestHeader:    ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		SubscriptionID:   sub.id,
+		MonitoringMode:   ua.MonitoringModeReporting,
+		MonitoredItemIDs: ids,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := ch.WaitResponse(2, time.Second); res == nil {
+		t.Fatal("expected SetMonitoringModeResponse")
+	} else if r, ok := res.(*ua.SetMonitoringModeResponse); !ok || len(r.Results) != n {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	if len(ch.Responses()) != 2 {
+		t.Fatal("expected publishing to be deferred")
+	}
+	sub.endMonitoringModeChange()
+
+	res, _ = ch.WaitResponse(3, time.Second)
+	pub, ok := res.(*ua.PublishResponse)
+	if !ok || len(pub.NotificationMessage.NotificationData) != 1 {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	if dcn, ok := pub.NotificationMessage.NotificationData[0].(ua.DataChangeNotification); !ok || len(dcn.MonitoredItems) != n {
+		t.Errorf("expected one notification of %d items, got %+v", n, pub.NotificationMessage.NotificationData[0])
+	}
+	sub.publish(time.Now())
+	if len(ch.Responses()) != 3 {
+		t.Errorf("expected a single notification, got %d responses", len(ch.Responses()))
+	}
+}
+
+func TestDeleteTriggeredItem(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	sub, _ := newTestSubscription(t, srv, ctx)
+
+	trigger := newTestDataChangeItem(ua.MonitoringModeReporting)
+	triggered := newTestDataChangeItem(ua.MonitoringModeSampling)
+	other := newTestDataChangeItem(ua.MonitoringModeSampling)
+	for i, mi := range []*MonitoredItem{trigger, triggered, other} {
+		mi.id = uint32(i + 1)
+		mi.srv = srv
+		mi.sub = sub
+		sub.AppendItem(mi)
+	}
+	trigger.addTriggeredItem(triggered)
+	trigger.addTriggeredItem(other)
+
+	if !sub.DeleteItem(ctx, triggered.id) {
+		t.Fatal("expected the item to be deleted")
+	}
+	if len(trigger.triggeredItems) != 1 || trigger.triggeredItems[0] != other {
+		t.Errorf("expected the trigger to link only the remaining item, got %v", trigger.triggeredItems)
+	}
+	if sub.DeleteItem(ctx, triggered.id) {
+		t.Error("expected the item to be deleted once")
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	for _, c := range []struct {
+		discardOldest bool
+		values        []float64
+		overflow      float64
+	}{
+		{true, []float64{7, 8, 9, 10}, 7},
+		{false, []float64{1, 2, 3, 10}, 10},
+	} {
+		mi := newTestDataChangeItem(ua.MonitoringModeReporting)
+		mi.sub = &Subscription{}
+		mi.queueSize = 4
+		mi.discardOldest = c.discardOldest
+		now := time.Now()
+		for i := 1; i <= 10; i++ {
+			mi.prequeue.PushBack(ua.NewDataValue(float64(i), 0, now, 0, now, 0))
+		}
+		if !mi.notificationsAvailable(now, false, false) {
+			t.Fatal("expected notifications")
+		}
+		notifications, _ := mi.notifications(10)
+		if len(notifications) != len(c.values) {
+			t.Fatalf("discardOldest %t: expected %d notifications, got %d", c.discardOldest, len(c.values), len(notifications))
+		}
+		for i, n := range notifications {
+			v := n.(ua.DataValue)
+			if v.Value != c.values[i] {
+				t.Errorf("discardOldest %t: expected value %v at %d, got %v", c.discardOldest, c.values[i], i, v.Value)
+			}
+			if overflow := v.StatusCode.IsOverflow(); overflow != (v.Value == c.overflow) {
+				t.Errorf("discardOldest %t: unexpected overflow bit %t on value %v", c.discardOldest, overflow, v.Value)
+			}
+		}
+		if mi.sub.monitoringQueueOverflowCount != 6 {
+			t.Errorf("discardOldest %t: expected 6 overflows, got %d", c.discardOldest, mi.sub.monitoringQueueOverflowCount)
+		}
+	}
+}
+
+func TestEventReplay(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeReceiveEvents)
+	srv.subscriptionManager = NewSubscriptionManager(srv)
+	srv.eventReplay = newEventReplay(time.Minute, 2)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	sub := NewSubscription(srv.subscriptionManager, session, 1000, 30, 10, 0, true, 0)
+	source, _ := srv.NamespaceManager().FindObject(testObjectID)
+
+	for i, name := range []string{"A", "A", "B", "A"} {
+		srv.NamespaceManager().OnEvent(source, &ua.BaseEvent{
+			EventID:    ua.ByteString(fmt.Sprint(i)),
+			EventType:  ua.ObjectTypeIDBaseEventType,
+			SourceNode: testObjectID,
+			SourceName: name,
+			Time:       time.Now(),
+			Severity:   uint16(100 * (i + 1)),
+		})
+	}
+
+	create := func() *MonitoredItem {
+		return NewMonitoredItem(ctx, sub, source,
+			ua.ReadValueID{NodeID: testObjectID, AttributeID: ua.AttributeIDEventNotifier},
+			ua.MonitoringModeReporting,
+			ua.MonitoringParameters{Filter: ua.EventFilter{
+				SelectClauses: ua.BaseEventSelectClauses,
+				WhereClause: ua.ContentFilter{Elements: []ua.ContentFilterElement{{
+					FilterOperator: ua.FilterOperatorEquals,
+					FilterOperands: []ua.ExtensionObject{ua.BaseEventSelectClauses[3], ua.LiteralOperand{Value: "A"}},
+				}}},
+			}},
+			ua.TimestampsToReturnBoth, 0)
+	}
+
+	// the buffer keeps the last 2 events, of which 1 passes the WhereClause.
+	mi := create()
+	defer mi.Delete()
+	if mi.queue.Len() != 1 {
+		t.Fatalf("expected 1 replayed event, got %d", mi.queue.Len())
+	}
+	if fields := mi.queue.Front().([]ua.Variant); fields[3] != "A" || fields[7] != uint16(400) {
+		t.Errorf("unexpected replayed event %v", fields)
+	}
+
+	// the replayed event, when delivered to the listener added before the replay, is not enqueued twice.
+	last := &ua.BaseEvent{
+		EventID:    ua.ByteString(fmt.Sprint(3)),
+		EventType:  ua.ObjectTypeIDBaseEventType,
+		SourceNode: testObjectID,
+		SourceName: "A",
+		Severity:   400,
+	}
+	mi.OnEvent(last)
+	if mi.queue.Len() != 1 {
+		t.Errorf("expected the replayed event once, got %d", mi.queue.Len())
+	}
+	last.EventID = ua.ByteString(fmt.Sprint(4))
+	mi.OnEvent(last)
+	if mi.queue.Len() != 2 {
+		t.Errorf("expected the new event, got %d", mi.queue.Len())
+	}
+
+	srv.eventReplay = nil
+	mi2 := create()
+	defer mi2.Delete()
+	if mi2.queue.Len() != 0 {
+		t.Errorf("expected no replayed events when disabled, got %d", mi2.queue.Len())
+	}
+}
+
+func TestSelectConditionID(t *testing.T) {
+	conditionID := ua.NewNodeIDString(1, "Level")
+	evt := &ua.AlarmCondition{
+		EventID:     ua.ByteString("1"),
+		EventType:   ua.ObjectTypeIDExclusiveLevelAlarmType,
+		SourceNode:  testObjectID,
+		SourceName:  "Source",
+		ConditionID: conditionID,
+	}
+	clauses := []ua.SimpleAttributeOperand{
+		{TypeDefinitionID: ua.ObjectTypeIDConditionType, BrowsePath: ua.ParseBrowsePath(""), AttributeID: ua.AttributeIDNodeID},
+		{TypeDefinitionID: ua.ObjectTypeIDExclusiveLevelAlarmType, AttributeID: ua.AttributeIDNodeID},
+		ua.BaseEventSelectClauses[2],
+		// the NodeId of a type that is not a condition type is not the ConditionId.
+		{TypeDefinitionID: ua.ObjectTypeIDBaseEventType, AttributeID: ua.AttributeIDNodeID},
+	}
+	fields := selectEventFields(clauses, evt, ua.TimestampsToReturnBoth)
+	for i, want := range []ua.Variant{conditionID, conditionID, testObjectID, nil} {
+		if fields[i] != want {
+			t.Errorf("clause %d: expected %v, got %v", i, want, fields[i])
+		}
+	}
+
+	// an event that is not a condition has no ConditionId.
+	if fields := selectEventFields(clauses[:1], &ua.BaseEvent{SourceNode: testObjectID}, ua.TimestampsToReturnBoth); fields[0] != nil {
+		t.Errorf("expected no ConditionId of a BaseEvent, got %v", fields[0])
+	}
+}
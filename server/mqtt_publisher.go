@@ -0,0 +1,301 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// the default delay before reconnecting to the broker, doubled after each failed attempt.
+	defaultMQTTReconnectDelay = 1 * time.Second
+	// the limit on the delay before reconnecting to the broker.
+	maxMQTTReconnectDelay = 30 * time.Second
+)
+
+// MQTTConfig configures a MQTTPublisher.
+type MQTTConfig struct {
+	// BrokerURL of the MQTT broker, in the form tcp://[host]:[port]
+	BrokerURL string
+	// ClientID presented to the broker.
+	ClientID string
+	// QoS of the published messages.
+	QoS byte
+	// TopicPrefix is prepended to the browse path of the node, e.g. "plant1" publishes to "plant1/Boiler/Temperature".
+	TopicPrefix string
+	// NodeIDs of the variables to publish.
+	NodeIDs []ua.NodeID
+	// ReconnectDelay before reconnecting to the broker, doubled after each failed attempt. (default: 1 sec)
+	ReconnectDelay time.Duration
+}
+
+// MQTTClient is a connection to a MQTT broker.
+type MQTTClient interface {
+	// Connect to the broker.
+	Connect() error
+	// Publish the payload to the topic.
+	Publish(topic string, qos byte, payload []byte) error
+	// Disconnect from the broker.
+	Disconnect()
+}
+
+// MQTTPublisher publishes each change of the value of a set of variables to a MQTT topic.
+type MQTTPublisher struct {
+	sync.Mutex
+	srv       *UAServer
+	client    MQTTClient
+	config    MQTTConfig
+	topics    map[*VariableNode]string
+	pending   []mqttMessage
+	connected bool
+	notifyCh  chan struct{}
+	closeCh   chan struct{}
+	closed    sync.Once
+}
+
+// mqttMessage is a payload queued for a topic.
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+// mqttPayload is the JSON payload of a published value.
+type mqttPayload struct {
+	Value     interface{}   `json:"value"`
+	Quality   ua.StatusCode `json:"quality"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// NewMQTTPublisher starts publishing the values of the variables to the broker, until the server or publisher is closed.
+// The publisher reconnects when the connection to the broker is lost, and then publishes the latest value of each variable.
+func NewMQTTPublisher(srv *UAServer, config MQTTConfig) (*MQTTPublisher, error) {
+	opts := mqtt.NewClientOptions().AddBroker(config.BrokerURL).SetClientID(config.ClientID).SetAutoReconnect(false)
+	return newMQTTPublisher(srv, config, &pahoClient{mqtt.NewClient(opts)})
+}
+
+func newMQTTPublisher(srv *UAServer, config MQTTConfig, client MQTTClient) (*MQTTPublisher, error) {
+	if config.ReconnectDelay <= 0 {
+		config.ReconnectDelay = defaultMQTTReconnectDelay
+	}
+	p := &MQTTPublisher{
+		srv:      srv,
+		client:   client,
+		config:   config,
+		topics:   make(map[*VariableNode]string),
+		notifyCh: make(chan struct{}, 1),
+		closeCh:  make(chan struct{}),
+	}
+	nm := srv.NamespaceManager()
+	for _, id := range config.NodeIDs {
+		n, ok := nm.FindVariable(id)
+		if !ok {
+			return nil, ua.BadNodeIDUnknown
+		}
+		p.topics[n] = p.topic(n)
+	}
+	// the current values are published first, then each change.
+	for n := range p.topics {
+		n.AddValueChangedListener(p)
+		p.OnValueChanged(n, n.GetValue())
+	}
+	go p.run()
+	return p, nil
+}
+
+// Close stops publishing and disconnects from the broker.
+func (p *MQTTPublisher) Close() {
+	p.closed.Do(func() {
+		for n := range p.topics {
+			n.RemoveValueChangedListener(p)
+		}
+		close(p.closeCh)
+	})
+}
+
+// OnValueChanged queues the value of the variable. While the broker is not connected, only the latest value of
+// each variable is kept.
+func (p *MQTTPublisher) OnValueChanged(n *VariableNode, v ua.DataValue) {
+	topic, ok := p.topics[n]
+	if !ok {
+		return
+	}
+	ts := v.SourceTimestamp
+	if ts.IsZero() {
+		ts = v.ServerTimestamp
+	}
+	payload, err := json.Marshal(mqttPayload{Value: v.Value, Quality: v.StatusCode, Timestamp: ts})
+	if err != nil {
+		p.srv.Logger().Warnf("Error encoding value of '%s' for MQTT. %s", n.GetNodeID(), err)
+		return
+	}
+	p.Lock()
+	if p.connected {
+		p.pending = append(p.pending, mqttMessage{topic, payload})
+	} else {
+		p.pending = latestMessages(p.pending, mqttMessage{topic, payload})
+	}
+	p.Unlock()
+	select {
+	case p.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// latestMessages returns the messages with the latest payload of each topic, in the order of the topics.
+func latestMessages(messages []mqttMessage, newer ...mqttMessage) []mqttMessage {
+	var result []mqttMessage
+	index := make(map[string]int)
+	for _, m := range append(messages, newer...) {
+		if i, ok := index[m.topic]; ok {
+			result[i] = m
+			continue
+		}
+		index[m.topic] = len(result)
+		result = append(result, m)
+	}
+	return result
+}
+
+// run maintains the connection to the broker and publishes the queued values, waiting with a backoff when the
+// broker rejects the connection or the values.
+func (p *MQTTPublisher) run() {
+	var delay time.Duration
+	connected := false
+	for {
+		var err error
+		if !connected {
+			if err = p.client.Connect(); err != nil {
+				p.srv.Logger().Warnf("Error connecting to MQTT broker '%s'. %s", p.config.BrokerURL, err)
+			} else {
+				connected = true
+				p.Lock()
+				p.connected = true
+				p.Unlock()
+			}
+		}
+		if connected {
+			if err = p.publishPending(); err != nil {
+				p.srv.Logger().Warnf("Error publishing to MQTT broker '%s'. %s", p.config.BrokerURL, err)
+				p.client.Disconnect()
+				connected = false
+			} else {
+				delay = 0
+			}
+		}
+		if err != nil {
+			if delay == 0 {
+				delay = p.config.ReconnectDelay
+			} else {
+				delay *= 2
+			}
+			if delay > maxMQTTReconnectDelay {
+				delay = maxMQTTReconnectDelay
+			}
+			select {
+			case <-p.closeCh:
+				return
+			case <-p.srv.closing:
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+		select {
+		case <-p.closeCh:
+			p.client.Disconnect()
+			return
+		case <-p.srv.closing:
+			p.client.Disconnect()
+			return
+		case <-p.notifyCh:
+		}
+	}
+}
+
+// publishPending publishes the queued values in order. When the broker rejects a value, the values not published
+// are queued again, keeping the latest value of each variable.
+func (p *MQTTPublisher) publishPending() error {
+	p.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.Unlock()
+	for i, m := range pending {
+		if err := p.client.Publish(m.topic, p.config.QoS, m.payload); err != nil {
+			p.Lock()
+			p.connected = false
+			p.pending = latestMessages(pending[i:], p.pending...)
+			p.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// topic returns the topic of the variable, from the TopicPrefix and the browse names of the path from the Objects folder.
+func (p *MQTTPublisher) topic(n Node) string {
+	path := p.srv.NamespaceManager().browseNames(n)
+	if p.config.TopicPrefix != "" {
+		path = append([]string{p.config.TopicPrefix}, path...)
+	}
+	return strings.Join(path, "/")
+}
+
+// browseNames returns the browse names of the nodes from the Objects folder to the node, following the inverse hierarchical references.
+func (m *NamespaceManager) browseNames(n Node) []string {
+	names := []string{n.GetBrowseName().Name}
+	visited := map[string]struct{}{n.GetNodeID().String(): {}}
+	for {
+		parent, ok := m.parentOf(n)
+		if !ok || parent.GetNodeID() == ua.ObjectIDObjectsFolder {
+			break
+		}
+		if _, ok := visited[parent.GetNodeID().String()]; ok {
+			break
+		}
+		visited[parent.GetNodeID().String()] = struct{}{}
+		names = append([]string{parent.GetBrowseName().Name}, names...)
+		n = parent
+	}
+	return names
+}
+
+// parentOf returns the target of the first inverse HasComponent, HasProperty or Organizes reference of the node.
+func (m *NamespaceManager) parentOf(n Node) (Node, bool) {
+	for _, r := range n.GetReferences() {
+		if !r.IsInverse {
+			continue
+		}
+		switch r.ReferenceTypeID {
+		case ua.ReferenceTypeIDHasComponent, ua.ReferenceTypeIDHasProperty, ua.ReferenceTypeIDOrganizes:
+			return m.FindNode(ua.ToNodeID(r.TargetID, m.NamespaceUris()))
+		}
+	}
+	return nil, false
+}
+
+// pahoClient adapts the Eclipse Paho client to a MQTTClient.
+type pahoClient struct {
+	client mqtt.Client
+}
+
+func (c *pahoClient) Connect() error {
+	t := c.client.Connect()
+	t.Wait()
+	return t.Error()
+}
+
+func (c *pahoClient) Publish(topic string, qos byte, payload []byte) error {
+	t := c.client.Publish(topic, qos, false, payload)
+	t.Wait()
+	return t.Error()
+}
+
+func (c *pahoClient) Disconnect() {
+	c.client.Disconnect(250)
+}
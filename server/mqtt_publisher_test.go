@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// mockBroker is an in-process MQTT broker, connected to by a single client. Each rejected connect or publish is
+// sent to failures.
+type mockBroker struct {
+	sync.Mutex
+	up        bool
+	rejects   bool
+	connected bool
+	connects  []time.Time
+	messages  chan mockMessage
+	failures  chan error
+}
+
+type mockMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (b *mockBroker) Connect() error {
+	b.Lock()
+	defer b.Unlock()
+	if !b.up {
+		return b.fail(errors.New("connection refused"))
+	}
+	b.connected = true
+	b.connects = append(b.connects, time.Now())
+	return nil
+}
+
+func (b *mockBroker) Publish(topic string, qos byte, payload []byte) error {
+	b.Lock()
+	defer b.Unlock()
+	if !b.up || !b.connected {
+		b.connected = false
+		return b.fail(errors.New("connection lost"))
+	}
+	if b.rejects {
+		return b.fail(errors.New("not authorized"))
+	}
+	b.messages <- mockMessage{topic, payload}
+	return nil
+}
+
+func (b *mockBroker) Disconnect() {
+	b.Lock()
+	b.connected = false
+	b.Unlock()
+}
+
+func (b *mockBroker) fail(err error) error {
+	select {
+	case b.failures <- err:
+	default:
+	}
+	return err
+}
+
+func (b *mockBroker) setUp(up bool) {
+	b.Lock()
+	b.up = up
+	b.Unlock()
+}
+
+func (b *mockBroker) receive(t *testing.T) (string, mqttPayload) {
+	t.Helper()
+	select {
+	case m := <-b.messages:
+		var p mqttPayload
+		if err := json.Unmarshal(m.payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		return m.topic, p
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a message")
+		return "", mqttPayload{}
+	}
+}
+
+func (b *mockBroker) waitFailure(t *testing.T) {
+	t.Helper()
+	select {
+	case <-b.failures:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a failure")
+	}
+}
+
+func (b *mockBroker) connectTimes() []time.Time {
+	b.Lock()
+	defer b.Unlock()
+	return append([]time.Time(nil), b.connects...)
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	temperatureID := ua.NewNodeIDString(1, "Temperature")
+	n := NewVariableNode(
+		temperatureID,
+		ua.NewQualifiedName(1, "Temperature"),
+		ua.NewLocalizedText("Temperature", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(testObjectID))},
+		ua.NewDataValue(float64(20.5), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		-1,
+		false,
+		nil,
+	)
+	if err := srv.NamespaceManager().AddNode(n); err != nil {
+		t.Fatal(err)
+	}
+
+	broker := &mockBroker{up: true, messages: make(chan mockMessage, 16), failures: make(chan error, 16)}
+	pub, err := newMQTTPublisher(srv, MQTTConfig{
+		TopicPrefix:    "plant",
+		QoS:            1,
+		NodeIDs:        []ua.NodeID{temperatureID},
+		ReconnectDelay: 10 * time.Millisecond,
+	}, broker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+
+	topic, p := broker.receive(t)
+	if topic != "plant/Object/Temperature" {
+		t.Errorf("expected topic plant/Object/Temperature, got %s", topic)
+	}
+	if p.Value != 20.5 || p.Quality != ua.Good || p.Timestamp.IsZero() {
+		t.Errorf("unexpected payload %+v", p)
+	}
+
+	// unchanged values are not published again.
+	n.SetValue(n.GetValue())
+	pub.Lock()
+	pending := len(pub.pending)
+	pub.Unlock()
+	if pending != 0 {
+		t.Fatalf("expected no queued values, got %d", pending)
+	}
+
+	// the publisher reconnects after the broker is lost, and publishes the latest value.
+	broker.setUp(false)
+	n.SetValue(ua.NewDataValue(float64(21.5), 0, time.Now(), 0, time.Now(), 0))
+	broker.waitFailure(t)
+	n.SetValue(ua.NewDataValue(float64(22.5), ua.UncertainLastUsableValue, time.Now(), 0, time.Now(), 0))
+	broker.setUp(true)
+	_, p = broker.receive(t)
+	if p.Value != 22.5 || p.Quality != ua.UncertainLastUsableValue {
+		t.Errorf("unexpected payload %+v", p)
+	}
+	if connects := len(broker.connectTimes()); connects != 2 {
+		t.Errorf("expected 2 connects, got %d", connects)
+	}
+
+	// each change is published, also when the value changes twice before the first change is published.
+	n.SetValue(ua.NewDataValue(float64(30), 0, time.Now(), 0, time.Now(), 0))
+	n.SetValue(ua.NewDataValue(float64(31), 0, time.Now(), 0, time.Now(), 0))
+	for _, want := range []float64{30, 31} {
+		if _, p := broker.receive(t); p.Value != want {
+			t.Errorf("expected value %v, got %+v", want, p)
+		}
+	}
+
+	// the publisher backs off when the broker accepts the connection but rejects the values.
+	for len(broker.failures) > 0 {
+		<-broker.failures
+	}
+	broker.Lock()
+	broker.rejects = true
+	broker.Unlock()
+	n.SetValue(ua.NewDataValue(float64(23.5), 0, time.Now(), 0, time.Now(), 0))
+	for i := 0; i < 3; i++ {
+		broker.waitFailure(t)
+	}
+	connects := broker.connectTimes()
+	if len(connects) < 4 {
+		t.Fatalf("expected the publisher to reconnect, got %d connects", len(connects))
+	}
+	if d := connects[3].Sub(connects[2]); d < 20*time.Millisecond {
+		t.Errorf("expected the publisher to wait at least 20ms before reconnecting, waited %s", d)
+	}
+
+	if _, err := newMQTTPublisher(srv, MQTTConfig{NodeIDs: []ua.NodeID{ua.NewNodeIDString(1, "Unknown")}}, broker); err != ua.BadNodeIDUnknown {
+		t.Errorf("expected %s, got %v", ua.BadNodeIDUnknown, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -26,10 +27,23 @@ var (
 // NamespaceManager manages the namespaces for a server.
 type NamespaceManager struct {
 	sync.RWMutex
-	server         *UAServer
-	namespaces     []string
-	nodes          map[ua.NodeID]Node
-	variantTypeMap map[ua.NodeID]byte
+	server            *UAServer
+	namespaces        []string
+	nodes             map[ua.NodeID]Node
+	variantTypeMap    map[ua.NodeID]byte
+	subtypesLock      sync.RWMutex
+	subtypes          map[subtypePair]bool
+	subtypesGen       uint64
+	translations      localizedTexts
+	conditionsLock    sync.Mutex
+	conditions        map[ua.NodeID]*condition
+	registrationsLock sync.Mutex
+	registrations     map[*registeredNodes]struct{}
+}
+
+// subtypePair is the key of the cache of IsSubtype results.
+type subtypePair struct {
+	subtype, supertype ua.NodeID
 }
 
 // NewNamespaceManager instantiates a new NamespaceManager.
@@ -39,6 +53,9 @@ func NewNamespaceManager(server *UAServer) *NamespaceManager {
 		namespaces:     []string{"http://opcfoundation.org/UA/", server.LocalDescription().ApplicationURI},
 		nodes:          make(map[ua.NodeID]Node, 4096),
 		variantTypeMap: make(map[ua.NodeID]byte, 32),
+		subtypes:       make(map[subtypePair]bool, 256),
+		conditions:     make(map[ua.NodeID]*condition),
+		registrations:  make(map[*registeredNodes]struct{}),
 	}
 }
 
@@ -70,6 +87,24 @@ func (m *NamespaceManager) NamespaceUris() []string {
 	return m.namespaces
 }
 
+// ParseNodeID returns the NodeID of the string form returned by NodeID.String, e.g. "ns=2;s=Demo",
+// "ns=2;g=5ce9dbce-5d79-434c-9ac3-1cfba9a6e92c" or "ns=2;b=YWJjZA==". The namespace may also be given by its
+// URI from the namespace table, e.g. "nsu=http://opcfoundation.org/UA/;i=85".
+func (m *NamespaceManager) ParseNodeID(s string) (ua.NodeID, error) {
+	if strings.HasPrefix(s, "nsu=") {
+		id := ua.ToNodeID(ua.ParseExpandedNodeID(s), m.NamespaceUris())
+		if id == nil {
+			return nil, ua.BadNodeIDInvalid
+		}
+		return id, nil
+	}
+	id := ua.ParseNodeIDString(s)
+	if id == nil {
+		return nil, ua.BadNodeIDInvalid
+	}
+	return id, nil
+}
+
 // FindNode returns the node with the given NodeID from the namespace.
 func (m *NamespaceManager) FindNode(id ua.NodeID) (node Node, ok bool) {
 	m.RLock()
@@ -116,6 +151,44 @@ func (m *NamespaceManager) FindProperty(startNode Node, browseName ua.QualifiedN
 	return
 }
 
+// ResolveBrowsePath returns the node found by following hierarchical references from the start node, matching
+// each BrowseName of the path, e.g. ResolveBrowsePath(ua.ObjectIDServer, "0:ServerStatus/0:State").
+func (m *NamespaceManager) ResolveBrowsePath(start ua.NodeID, path string) (ua.NodeID, bool) {
+	names := ua.ParseBrowsePath(path)
+	if len(names) == 0 {
+		return nil, false
+	}
+	elements := make([]ua.RelativePathElement, len(names))
+	for i, name := range names {
+		elements[i] = ua.RelativePathElement{ReferenceTypeID: ua.ReferenceTypeIDHierarchicalReferences, IncludeSubtypes: true, TargetName: name}
+	}
+	targets, err := m.server.follow(start, elements)
+	if err != nil || len(targets) == 0 || targets[0].RemainingPathIndex != math.MaxUint32 {
+		return nil, false
+	}
+	return ua.ToNodeID(targets[0].TargetID, m.NamespaceUris()), true
+}
+
+// ViewMembers returns the nodes of the view, which are the targets of the forward Organizes and HasComponent
+// references of the view.
+func (m *NamespaceManager) ViewMembers(view ua.NodeID) map[ua.NodeID]struct{} {
+	members := map[ua.NodeID]struct{}{}
+	n, ok := m.FindNode(view)
+	if !ok {
+		return members
+	}
+	for _, r := range n.GetReferences() {
+		if r.IsInverse {
+			continue
+		}
+		if r.ReferenceTypeID == ua.ReferenceTypeIDOrganizes || r.ReferenceTypeID == ua.ReferenceTypeIDHasComponent ||
+			m.IsSubtype(r.ReferenceTypeID, ua.ReferenceTypeIDOrganizes) || m.IsSubtype(r.ReferenceTypeID, ua.ReferenceTypeIDHasComponent) {
+			members[ua.ToNodeID(r.TargetID, m.NamespaceUris())] = struct{}{}
+		}
+	}
+	return members
+}
+
 // FindComponent returns the component with the given browseName from the namespace.
 func (m *NamespaceManager) FindComponent(startNode Node, browseName ua.QualifiedName) (node Node, ok bool) {
 	m.RLock()
@@ -145,7 +218,41 @@ func (m *NamespaceManager) FindMethod(id ua.NodeID) (node *MethodNode, ok bool)
 }
 
 // IsSubtype returns whether the subtype is derived from the given supertype in the namespace.
+// The results are cached until a type node is added or deleted.
 func (m *NamespaceManager) IsSubtype(subtype, supertype ua.NodeID) bool {
+	key := subtypePair{subtype, supertype}
+	m.subtypesLock.RLock()
+	result, ok := m.subtypes[key]
+	gen := m.subtypesGen
+	m.subtypesLock.RUnlock()
+	if ok {
+		return result
+	}
+	result = m.isSubtype(subtype, supertype)
+	m.subtypesLock.Lock()
+	// don't cache a result computed while the type hierarchy changed.
+	if gen == m.subtypesGen {
+		m.subtypes[key] = result
+	}
+	m.subtypesLock.Unlock()
+	return result
+}
+
+// invalidateSubtypes clears the cache of IsSubtype results, if the node is a type node.
+func (m *NamespaceManager) invalidateSubtypes(node Node) {
+	switch node.GetNodeClass() {
+	case ua.NodeClassReferenceType, ua.NodeClassObjectType, ua.NodeClassVariableType, ua.NodeClassDataType:
+		m.subtypesLock.Lock()
+		if len(m.subtypes) > 0 {
+			m.subtypes = make(map[subtypePair]bool, 256)
+		}
+		m.subtypesGen++
+		m.subtypesLock.Unlock()
+	}
+}
+
+// isSubtype walks the HasSubtype references from the subtype up to the supertype.
+func (m *NamespaceManager) isSubtype(subtype, supertype ua.NodeID) bool {
 	id := subtype
 	i := 0
 loop:
@@ -328,8 +435,9 @@ func (m *NamespaceManager) SetMultiStateValueDiscreteTypeBehavior(node *Variable
 		enumValues := toEnumValues(enumValuesNode.GetValue().Value.([]ua.ExtensionObject))
 		for _, ev := range enumValues {
 			if ev.Value == value {
-				node.SetValue(ua.NewDataValue(req.Value.Value, req.Value.StatusCode, time.Now(), 0, time.Now(), 0))
-				valueAsTextNode.SetValue(ua.NewDataValue(ev.DisplayName, 0, time.Now(), 0, time.Now(), 0))
+				now := m.server.now()
+				node.SetValue(ua.NewDataValue(req.Value.Value, req.Value.StatusCode, now, 0, now, 0))
+				valueAsTextNode.SetValue(ua.NewDataValue(ev.DisplayName, 0, now, 0, now, 0))
 				break
 			}
 		}
@@ -349,6 +457,7 @@ func toEnumValues(v []ua.ExtensionObject) []ua.EnumValueType {
 func (m *NamespaceManager) addNodes(nodes []Node) error {
 	for _, node := range nodes {
 		m.nodes[node.GetNodeID()] = node
+		m.invalidateSubtypes(node)
 	}
 	// add inverse refs of added nodes
 	for _, node := range nodes {
@@ -379,6 +488,13 @@ func (m *NamespaceManager) addNodes(nodes []Node) error {
 			}
 		}
 	}
+	for _, node := range nodes {
+		if view, ok := node.(*ViewNode); ok {
+			if err := m.addViewVersionProperty(view); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -440,6 +556,10 @@ func (m *NamespaceManager) deleteNodeandInverseReferences(node Node, uris []stri
 	}
 	// delete node from namespace.
 	delete(m.nodes, id)
+	m.invalidateRegistrations(id)
+	m.translations.remove(id)
+	m.removeCondition(id)
+	m.invalidateSubtypes(node)
 	return nil
 }
 
@@ -505,6 +625,7 @@ func (m *NamespaceManager) UpdateNodeID(node Node, newNodeID ua.NodeID) {
 
 	for _, child := range nodes {
 		delete(m.nodes, child.GetNodeID())
+		m.invalidateRegistrations(child.GetNodeID())
 		refs := []ua.Reference{}
 		for _, r := range child.GetReferences() {
 			if r.ReferenceTypeID == ua.ReferenceTypeIDHasProperty && !r.IsInverse {
@@ -527,15 +648,21 @@ func (m *NamespaceManager) UpdateNodeID(node Node, newNodeID ua.NodeID) {
 		}
 
 		child.SetReferences(refs)
+		childID := child.GetNodeID()
 		child.(HasNodeID).ReplaceNodeIDPrefix(oldID, prefix)
+		m.translations.move(childID, child.GetNodeID())
 	}
 	m.addNodes(nodes)
 }
 
 // OnEvent raises the event, starting from the target node, follows HasNotifier references until the Server node.
+// The event is dropped if its severity is below the minimum severity of the server.
 func (m *NamespaceManager) OnEvent(target *ObjectNode, evt ua.Event) error {
+	if m.server.suppressesEvent(evt) {
+		return nil
+	}
 	for target.NodeId != ua.ObjectIDServer {
-		target.OnEvent(evt)
+		m.raiseEvent(target, evt)
 		found := false
 		for _, r := range target.GetReferences() {
 			if r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasNotifier {
@@ -551,10 +678,18 @@ func (m *NamespaceManager) OnEvent(target *ObjectNode, evt ua.Event) error {
 			return nil
 		}
 	}
-	target.OnEvent(evt)
+	m.raiseEvent(target, evt)
 	return nil
 }
 
+// raiseEvent raises the event from the target node, after keeping it for replay if enabled.
+func (m *NamespaceManager) raiseEvent(target *ObjectNode, evt ua.Event) {
+	if r := m.server.eventReplay; r != nil {
+		r.append(target.NodeId, evt)
+	}
+	target.OnEvent(evt)
+}
+
 // Any returns true if the given function returns true for any of the given nodes.
 func Any(nodes []ua.NodeID, f func(n ua.NodeID) bool) bool {
 	for _, n := range nodes {
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestResolveBrowsePath(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		start ua.NodeID
+		path  string
+		id    ua.NodeID
+	}{
+		{ua.ObjectIDServer, "0:ServerStatus/0:State", ua.VariableIDServerServerStatusState},
+		{ua.ObjectIDRootFolder, "0:Objects/0:Server/0:NamespaceArray", ua.VariableIDServerNamespaceArray},
+		{testObjectID, "1:Method", testMethodID},
+	} {
+		if id, ok := nm.ResolveBrowsePath(c.start, c.path); !ok || id != c.id {
+			t.Errorf("%s: expected %s, got %v", c.path, c.id, id)
+		}
+	}
+	for _, c := range []struct {
+		start ua.NodeID
+		path  string
+	}{
+		{ua.ObjectIDServer, "0:ServerStatus/0:Missing"},
+		{ua.ObjectIDServer, "0:Missing/0:State"},
+		{ua.ObjectIDServer, "1:ServerStatus"},
+		{ua.ObjectIDServer, ""},
+		{ua.NewNodeIDString(1, "Missing"), "0:ServerStatus"},
+	} {
+		if id, ok := nm.ResolveBrowsePath(c.start, c.path); ok {
+			t.Errorf("%q: expected no match, got %s", c.path, id)
+		}
+	}
+}
+
+// addReferenceTypeChain adds a chain of reference types, each a subtype of the previous, starting from the
+// supertype, and returns the deepest type.
+func addReferenceTypeChain(nm *NamespaceManager, supertype ua.NodeID, depth int) ua.NodeID {
+	for i := 1; i <= depth; i++ {
+		id := ua.NewNodeIDNumeric(1, uint32(1000+i))
+		nm.AddNode(NewReferenceTypeNode(
+			id,
+			ua.NewQualifiedName(1, "RefType"),
+			ua.NewLocalizedText("RefType", ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasSubtype, true, ua.NewExpandedNodeID(supertype))},
+			false,
+			false,
+			ua.NewLocalizedText("", ""),
+		))
+		supertype = id
+	}
+	return supertype
+}
+
+func TestIsSubtypeCacheInvalidated(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	id := ua.NewNodeIDNumeric(1, 1001)
+	if nm.IsSubtype(id, ua.ReferenceTypeIDHierarchicalReferences) {
+		t.Error("expected unknown type not to be a subtype")
+	}
+	addReferenceTypeChain(nm, ua.ReferenceTypeIDHasComponent, 1)
+	if !nm.IsSubtype(id, ua.ReferenceTypeIDHierarchicalReferences) {
+		t.Error("expected added type to be a subtype")
+	}
+	n, _ := nm.FindNode(id)
+	nm.DeleteNode(n, false)
+	if nm.IsSubtype(id, ua.ReferenceTypeIDHierarchicalReferences) {
+		t.Error("expected deleted type not to be a subtype")
+	}
+}
+
+// BenchmarkBrowseIncludeSubtypes compares filtering the references of a node by HierarchicalReferences, where
+// each reference is of a type deep in the reference type hierarchy, with and without the subtype cache.
+func BenchmarkBrowseIncludeSubtypes(b *testing.B) {
+	srv := &UAServer{}
+	nm := NewNamespaceManager(srv)
+	srv.namespaceManager = nm
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		b.Fatal(err)
+	}
+	refType := addReferenceTypeChain(nm, ua.ReferenceTypeIDHasComponent, 20)
+	refs := make([]ua.Reference, 1000)
+	for i := range refs {
+		refs[i] = ua.NewReference(refType, false, ua.NewExpandedNodeID(ua.NewNodeIDNumeric(1, uint32(2000+i))))
+	}
+	node := NewObjectNode(ua.NewNodeIDString(1, "Parent"), ua.NewQualifiedName(1, "Parent"), ua.NewLocalizedText("Parent", ""), ua.NewLocalizedText("", ""), nil, refs, 0)
+	for _, c := range []struct {
+		name      string
+		isSubtype func(subtype, supertype ua.NodeID) bool
+	}{
+		{"Uncached", nm.isSubtype},
+		{"Cached", nm.IsSubtype},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, r := range node.GetReferences() {
+					if !c.isSubtype(r.ReferenceTypeID, ua.ReferenceTypeIDHierarchicalReferences) {
+						b.Fatal("expected subtype")
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseNodeID(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	nm := srv.NamespaceManager()
+	uris := nm.NamespaceUris()
+	for _, c := range []struct {
+		in   string
+		want ua.NodeID
+	}{
+		{"i=85", ua.ObjectIDObjectsFolder},
+		{"nsu=" + uris[0] + ";i=85", ua.ObjectIDObjectsFolder},
+		{"nsu=" + uris[len(uris)-1] + ";s=Demo", ua.NewNodeIDString(uint16(len(uris)-1), "Demo")},
+		{"ns=2;b=YWJjZA==", ua.NewNodeIDOpaque(2, ua.ByteString("abcd"))},
+		{"nsu=urn:unknown;i=1", nil},
+		{"ns=2;g=", nil},
+		{"", nil},
+	} {
+		got, err := nm.ParseNodeID(c.in)
+		if got != c.want {
+			t.Errorf("ParseNodeID(%q) = %v, want %v", c.in, got, c.want)
+		}
+		if (c.want == nil) != (err == ua.BadNodeIDInvalid) {
+			t.Errorf("ParseNodeID(%q): unexpected error %v", c.in, err)
+		}
+	}
+}
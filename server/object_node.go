@@ -201,6 +201,10 @@ func NewDefaultObjectNode(
 	)
 	propEntry.SetOwner(n)
 	n.properties[PropertyNameEntry] = propEntry
+	if n.entry {
+		n.addEntryProperties(id)
+		n.eventNotifier = ua.EventNotifierSubscribeToEvents
+	}
 
 	if n.nodeType == NodeTypeTag {
 		// create Value property
@@ -241,11 +245,20 @@ func NewObjectNodeWithProperties(
 	fm.NormalizeFieldName()
 	fieldErrors := map[string]error{}
 	name, err := fm.GetString(PropertyNameBrowseName)
+	if err == nil {
+		err = IsValidName(strings.Trim(name, " "))
+	}
+	if err == nil {
+		err = CheckNameLength(strings.Trim(name, " "), serverFromContext(ctx).MaxBrowseNameLength())
+	}
 	if err != nil {
 		fieldErrors["PropertyNameBrowseName"] = err
 	}
 
 	displayName, err := fm.GetString(PropertyNameDisplayName)
+	if err == nil {
+		err = CheckNameLength(displayName, serverFromContext(ctx).MaxDisplayNameLength())
+	}
 	if err != nil {
 		fieldErrors["PropertyNameDisplayName"] = err
 	}
@@ -339,12 +352,18 @@ func (n *ObjectNode) GetBrowseName() ua.QualifiedName {
 
 // DisplayName returns the DisplayName attribute of this node.
 func (n *ObjectNode) GetDisplayName() ua.LocalizedText {
-	return n.DisplayName
+	n.RLock()
+	res := n.DisplayName
+	n.RUnlock()
+	return res
 }
 
 // Description returns the Description attribute of this node.
 func (n *ObjectNode) GetDescription() ua.LocalizedText {
-	return n.Description
+	n.RLock()
+	res := n.Description
+	n.RUnlock()
+	return res
 }
 
 // RolePermissions returns the RolePermissions attribute of this node.
@@ -435,8 +454,86 @@ func (n *ObjectNode) IsAttributeIDValid(attributeID uint32) bool {
 // ObjectNodeExtend implements
 // ===========================================================
 
-// SetBrowseName set BrowseName attribute of this node
+// Clone returns a copy of the node and its descendants, named newName below the same parent, e.g. to use a
+// configured device as a template. The copies have new InternalIds, their NodeIds begin with the NodeId of the
+// clone instead of the node, and their references to the node and its descendants refer to the copies. The clone
+// is not added to the parent.
+func (n *ObjectNode) Clone(newName string) (*ObjectNode, error) {
+	n.RLock()
+	parent := n.parent
+	n.RUnlock()
+	if parent == nil {
+		return nil, ErrParentNotFound
+	}
+	if err := IsValidName(newName); err != nil {
+		return nil, err
+	}
+	if err := CheckNameLength(newName, serverFromContext(n.ctx).MaxBrowseNameLength()); err != nil {
+		return nil, err
+	}
+
+	jsonNode := NewJsonObjectNode(n, true)
+	jsonNode.BrowseName.Name = newName
+	jsonNode.DisplayName.Text = newName
+	var renew func(jsonNode *JsonObjectNode)
+	renew = func(jsonNode *JsonObjectNode) {
+		for _, prop := range jsonNode.Properties {
+			if prop.BrowseName.Name == PropertyNameInternalId {
+				prop.Value = ua.NewDataValue(uuid.New(), ua.Good, time.Now(), 0, time.Now(), 0)
+			}
+		}
+		for _, child := range jsonNode.Childs {
+			renew(child)
+		}
+	}
+	renew(jsonNode)
+
+	clone, err := jsonNode.toObjectNode(n.ctx, parent, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// the NodeIds of the copies are derived from their names, but the properties keep the NodeIds of the originals.
+	oldPrefix := n.GetNodeID().GetID().(string)
+	newPrefix := clone.GetNodeID().GetID().(string)
+	replaceID := func(id ua.NodeID) (ua.NodeID, bool) {
+		s, ok := id.(ua.NodeIDString)
+		if !ok || s.NamespaceIndex != DefaultNameSpace {
+			return id, false
+		}
+		if s.ID == oldPrefix || strings.HasPrefix(s.ID, oldPrefix+PathSeparator) {
+			return ua.NewNodeIDString(DefaultNameSpace, newPrefix+s.ID[len(oldPrefix):]), true
+		}
+		return id, false
+	}
+	replaceReferences := func(node Node) {
+		refs := make([]ua.Reference, 0, len(node.GetReferences()))
+		for _, r := range node.GetReferences() {
+			if id, ok := replaceID(r.TargetID.NodeID); ok {
+				r.TargetID = ua.NewExpandedNodeID(id)
+			}
+			refs = append(refs, r)
+		}
+		node.SetReferences(refs)
+	}
+	clone.ForEachSelfDepth(func(node *ObjectNode) {
+		replaceReferences(node)
+		for _, prop := range node.GetProperties() {
+			replaceReferences(prop)
+			if id, ok := replaceID(prop.GetNodeID()); ok {
+				prop.SetNodeID(id)
+			}
+		}
+	})
+	return clone, nil
+}
+
+// SetBrowseName set BrowseName attribute of this node, it returns an error if the name contains one of the
+// reserved characters of the node paths
 func (n *ObjectNode) SetBrowseName(value string) error {
+	if err := IsValidName(value); err != nil {
+		return err
+	}
 	n.Lock()
 	defer n.Unlock()
 	if n.BrowseName.Name != value {
@@ -449,8 +546,14 @@ func (n *ObjectNode) SetBrowseName(value string) error {
 			id = n.parent.NodeId.GetID().(string) + PathSeparator + n.BrowseName.Name
 		}
 		newNodeID := ua.NewNodeIDString(DefaultNameSpace, id)
+		oldNodeID := n.NodeId
 		n.Unlock()
 		namespaceManager.UpdateNodeID(n, newNodeID)
+		// a client sees the node under its old NodeId deleted, and added under the new one.
+		namespaceManager.raiseModelChange(
+			modelChange(n, oldNodeID, ua.ModelChangeStructureVerbMaskNodeDeleted),
+			modelChange(n, newNodeID, ua.ModelChangeStructureVerbMaskNodeAdded),
+		)
 		n.Lock()
 	}
 	return nil
@@ -519,7 +622,7 @@ func (n *ObjectNode) AssignPluginProps() {
 
 // GetInternalId returns an internal id of this ObjectNode
 func (n *ObjectNode) GetInternalId() uuid.UUID {
-	return n.MustGetProperty(PropertyNameInternalId).Value.Value.(uuid.UUID)
+	return n.MustGetProperty(PropertyNameInternalId).GetValue().Value.(uuid.UUID)
 }
 
 // GetProperty returns an property of this ObjectNode by specified property name
@@ -590,11 +693,24 @@ func (n *ObjectNode) CanAddChild(nodeType NodeType) bool {
 	return n.plugin.CanAddNodeType(n, nodeType)
 }
 
+// isAncestor returns true if the node is this node or one of its ancestors.
+func (n *ObjectNode) isAncestor(node *ObjectNode) bool {
+	for a := n; a != nil; a = a.parent {
+		if a == node {
+			return true
+		}
+	}
+	return false
+}
+
 // AddChild add an node into childs
 func (n *ObjectNode) AddChild(child *ObjectNode) error {
 	n.Lock()
 	defer n.Unlock()
 
+	if n.isAncestor(child) {
+		return ErrCyclicReference
+	}
 	childType := child.GetNodeType()
 	if !n.CanAddChild(childType) {
 		return ErrNodeTypeNotAccepted
@@ -609,6 +725,9 @@ func (n *ObjectNode) InsertChild(index int, child *ObjectNode) error {
 	n.Lock()
 	defer n.Unlock()
 
+	if n.isAncestor(child) {
+		return ErrCyclicReference
+	}
 	propNodeType := child.MustGetProperty(PropertyNameNodeType)
 	childType := NodeType(propNodeType.GetValue().Value.(int64))
 	if !n.CanAddChild(childType) {
@@ -734,10 +853,11 @@ func (n *ObjectNode) Update(fm FieldMap) map[string]error {
 			case PropertyNameDescription:
 				n.SetDescription((v.(string)))
 			default:
+				now := nowFromContext(n.ctx)
 				if !hasChanged {
-					hasChanged = n.properties[k].SetValue(ua.NewDataValue(v, ua.Good, time.Now(), 0, time.Now(), 0))
+					hasChanged = n.properties[k].SetValue(ua.NewDataValue(v, ua.Good, now, 0, now, 0))
 				} else {
-					n.properties[k].SetValue(ua.NewDataValue(v, ua.Good, time.Now(), 0, time.Now(), 0))
+					n.properties[k].SetValue(ua.NewDataValue(v, ua.Good, now, 0, now, 0))
 				}
 
 			}
@@ -894,8 +1014,23 @@ func (n *ObjectNode) Context() context.Context {
 }
 
 func (n *ObjectNode) MarshalJSON() ([]byte, error) {
-	n.Lock()
-	defer n.Unlock()
+	// take a snapshot, so the lock is not held while the properties are marshaled, each with its own lock
+	n.RLock()
+	nodeID := n.NodeId
+	parent := n.parent
+	nodeType := n.nodeType
+	browseName := n.BrowseName
+	displayName := n.DisplayName
+	description := n.Description
+	properties := make(map[string]*VariableNode, len(n.properties))
+	for name, prop := range n.properties {
+		properties[name] = prop
+	}
+	rolePermissions := n.RolePermissions
+	accessRestrictions := n.AccessRestrictions
+	references := n.References
+	n.RUnlock()
+
 	buffer := new(bytes.Buffer)
 	writer := jsonwriter.New(buffer)
 	writer.RootObject(func() {
@@ -913,25 +1048,25 @@ func (n *ObjectNode) MarshalJSON() ([]byte, error) {
 		// writer.KeyValue("accessRestrictions", n.AccessRestrictions)
 		// writer.ArrayValues("references", n.References)
 
-		writer.KeyValue("nodeId", n.NodeId.GetID())
-		writer.KeyValue("internalId", fmt.Sprintf("%s", n.MustGetProperty(PropertyNameInternalId).GetValue().Value))
-		if n.parent != nil {
-			writer.KeyValue("parentId", fmt.Sprintf("%s", n.parent.MustGetProperty(PropertyNameInternalId).GetValue().Value))
+		writer.KeyValue("nodeId", nodeID.GetID())
+		writer.KeyValue("internalId", fmt.Sprintf("%s", properties[PropertyNameInternalId].GetValue().Value))
+		if parent != nil {
+			writer.KeyValue("parentId", fmt.Sprintf("%s", parent.MustGetProperty(PropertyNameInternalId).GetValue().Value))
 		}
-		writer.KeyValue("pluginId", n.MustGetProperty(PropertyNamePluginId).GetValue().Value)
-		writer.KeyValue("nodeType", n.nodeType)
-		writer.KeyValue("browseName", n.BrowseName.Name)
-		writer.KeyValue("displayName", n.DisplayName.Text)
-		writer.KeyValue("description", n.Description.Text)
+		writer.KeyValue("pluginId", properties[PropertyNamePluginId].GetValue().Value)
+		writer.KeyValue("nodeType", nodeType)
+		writer.KeyValue("browseName", browseName.Name)
+		writer.KeyValue("displayName", displayName.Text)
+		writer.KeyValue("description", description.Text)
 		writer.Object("properties", func() {
-			for _, prop := range n.properties {
-				writer.KeyValue(prop.BrowseName.Name, prop)
+			for _, prop := range properties {
+				writer.KeyValue(prop.GetBrowseName().Name, prop)
 			}
 		})
-		writer.ArrayValues("rolePermissions", n.RolePermissions)
+		writer.ArrayValues("rolePermissions", rolePermissions)
 		writer.Separator()
-		writer.KeyValue("accessRestrictions", n.AccessRestrictions)
-		writer.ArrayValues("references", n.References)
+		writer.KeyValue("accessRestrictions", accessRestrictions)
+		writer.ArrayValues("references", references)
 	})
 	return buffer.Bytes(), nil
 }
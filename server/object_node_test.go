@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/google/uuid"
+)
+
+// TestMarshalJSONWhileUpdating is run with -race to check the node is serialized safely while it is updated.
+func TestMarshalJSONWhileUpdating(t *testing.T) {
+	p := newTestProjectManager(t)
+	node := p.rootNode
+	prop := node.MustGetProperty(PropertyNameEntry)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			prop.SetValue(ua.NewDataValue(i%2 == 0, ua.Good, time.Now(), 0, time.Now(), 0))
+			node.SetReferences(append([]ua.Reference{}, node.GetReferences()...))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		b, err := json.Marshal(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v map[string]interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Fatalf("invalid json %s: %v", b, err)
+		}
+		if _, err := json.Marshal(prop); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// newTestObjectNode returns a Connectivity category node below the parent.
+func newTestObjectNode(p *ProjectManager, parent *ObjectNode, name string) *ObjectNode {
+	return NewDefaultObjectNode(
+		parent,
+		ua.NewQualifiedName(DefaultNameSpace, name),
+		ua.NewLocalizedText(name, DefaultLocale),
+		ua.NewLocalizedText("", DefaultLocale),
+		ua.NewDataValue(NodeTypeCategoryConnectivity.Int(), ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(PluginIDCore, ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(uuid.New(), ua.Good, time.Now(), 0, time.Now(), 0),
+		p.ctx,
+	)
+}
+
+func TestAddChildCyclicReference(t *testing.T) {
+	p := newTestProjectManager(t)
+	parent := newTestObjectNode(p, p.rootNode, "Parent")
+	child := newTestObjectNode(p, parent, "Child")
+	for _, n := range []struct{ parent, child *ObjectNode }{{p.rootNode, parent}, {parent, child}} {
+		if err := n.parent.AddChild(n.child); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := child.AddChild(p.rootNode); err != ErrCyclicReference {
+		t.Errorf("expected %v adding the grandparent, got %v", ErrCyclicReference, err)
+	}
+	if err := child.InsertChild(0, parent); err != ErrCyclicReference {
+		t.Errorf("expected %v inserting the parent, got %v", ErrCyclicReference, err)
+	}
+	if err := child.AddChild(child); err != ErrCyclicReference {
+		t.Errorf("expected %v adding the node itself, got %v", ErrCyclicReference, err)
+	}
+	if n := child.GetChilds().Size(); n != 0 {
+		t.Errorf("expected no children, got %d", n)
+	}
+}
+
+func TestClone(t *testing.T) {
+	p := newTestProjectManager(t)
+	device := newTestObjectNode(p, p.rootNode, "Device")
+	if err := p.AddNode(p.rootNode, device); err != nil {
+		t.Fatal(err)
+	}
+	tag, errs := NewObjectNodeWithProperties(
+		device,
+		ua.NewDataValue(NodeTypeTag.Int(), ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(PluginIDCore, ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(uuid.New(), ua.Good, time.Now(), 0, time.Now(), 0),
+		FieldMap{"BrowseName": "Tag", "DisplayName": "Tag", "Description": "", "Address": "40001"},
+		p.ctx,
+	)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if err := p.AddNode(device, tag); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := device.Clone("Device2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := device.Clone("Device2/"); err == nil {
+		t.Error("expected an invalid name to be rejected")
+	}
+	prefix := p.rootNode.GetNodeID().GetID().(string) + PathSeparator + "Device2"
+	if id := clone.GetNodeID(); id != ua.NewNodeIDString(DefaultNameSpace, prefix) || clone.GetBrowseName().Name != "Device2" {
+		t.Errorf("unexpected clone %s", id)
+	}
+	if clone.GetInternalId() == device.GetInternalId() {
+		t.Error("expected a new InternalId")
+	}
+	if n := clone.GetChilds().Size(); n != 1 {
+		t.Fatalf("expected 1 child, got %d", n)
+	}
+	tagClone := clone.GetChilds().Values()[0].(*ObjectNode)
+	if tagClone == tag || tagClone.GetNodeID() != ua.NewNodeIDString(DefaultNameSpace, prefix+PathSeparator+"Tag") || tagClone.GetInternalId() == tag.GetInternalId() {
+		t.Errorf("unexpected cloned tag %s", tagClone.GetNodeID())
+	}
+	address := tagClone.MustGetProperty("Address")
+	if address.GetNodeID() != ua.NewNodeIDString(DefaultNameSpace, prefix+PathSeparator+"Tag"+PathSeparator+"Address") || address.GetValue().Value != "40001" {
+		t.Errorf("unexpected property %s = %v", address.GetNodeID(), address.GetValue().Value)
+	}
+	for _, r := range address.GetReferences() {
+		if r.ReferenceTypeID == ua.ReferenceTypeIDHasProperty && r.TargetID.NodeID != tagClone.GetNodeID() {
+			t.Errorf("expected reference to the cloned tag, got %s", r.TargetID)
+		}
+	}
+
+	// the clone is independent of the source.
+	address.SetValue(ua.NewDataValue("40002", ua.Good, time.Now(), 0, time.Now(), 0))
+	if v := tag.MustGetProperty("Address").GetValue().Value; v != "40001" {
+		t.Errorf("expected source to be unchanged, got %v", v)
+	}
+	if n := p.rootNode.GetChilds().Size(); n != 1 {
+		t.Errorf("expected the clone not to be added to the parent, got %d children", n)
+	}
+}
+
+func TestNameLengthLimits(t *testing.T) {
+	p := newTestProjectManager(t)
+	device := newTestObjectNode(p, p.rootNode, "Device")
+	if err := p.AddNode(p.rootNode, device); err != nil {
+		t.Fatal(err)
+	}
+	srv := p.namespaceManager.server
+	maxBrowseNameLength, maxDisplayNameLength := srv.MaxBrowseNameLength(), srv.MaxDisplayNameLength()
+	atBrowseName, overBrowseName := strings.Repeat("ä", maxBrowseNameLength), strings.Repeat("a", maxBrowseNameLength+1)
+	atDisplayName, overDisplayName := strings.Repeat("ä", maxDisplayNameLength), strings.Repeat("a", maxDisplayNameLength+1)
+
+	for _, c := range []struct {
+		property string
+		value    string
+		wantErr  bool
+	}{
+		{PropertyNameBrowseName, atBrowseName, false},
+		{PropertyNameBrowseName, overBrowseName, true},
+		{PropertyNameDisplayName, atDisplayName, false},
+		{PropertyNameDisplayName, overDisplayName, true},
+	} {
+		if _, _, err := device.CheckPropertyValue(c.property, c.value); (err != nil) != c.wantErr {
+			t.Errorf("%s of %d characters: expected error %v, got %v", c.property, len([]rune(c.value)), c.wantErr, err)
+		}
+	}
+
+	for _, c := range []struct {
+		browseName, displayName string
+		wantErrs                []string
+	}{
+		{atBrowseName, atDisplayName, nil},
+		{overBrowseName, "Tag", []string{"PropertyNameBrowseName"}},
+		{"Tag", overDisplayName, []string{"PropertyNameDisplayName"}},
+	} {
+		_, errs := NewObjectNodeWithProperties(
+			device,
+			ua.NewDataValue(NodeTypeTag.Int(), ua.Good, time.Now(), 0, time.Now(), 0),
+			ua.NewDataValue(PluginIDCore, ua.Good, time.Now(), 0, time.Now(), 0),
+			ua.NewDataValue(uuid.New(), ua.Good, time.Now(), 0, time.Now(), 0),
+			FieldMap{"BrowseName": c.browseName, "DisplayName": c.displayName, "Description": "", "Address": "40001"},
+			p.ctx,
+		)
+		if len(errs) != len(c.wantErrs) {
+			t.Errorf("expected field errors %v, got %v", c.wantErrs, errs)
+		}
+		for _, k := range c.wantErrs {
+			if errs[k] == nil {
+				t.Errorf("expected a field error for %s, got %v", k, errs)
+			}
+		}
+	}
+
+	// the limits are options of the server.
+	if err := WithMaxBrowseNameLength(4)(srv); err != nil {
+		t.Fatal(err)
+	}
+	if err := WithMaxDisplayNameLength(0)(srv); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := device.CheckPropertyValue(PropertyNameBrowseName, "Tag12"); err == nil {
+		t.Error("expected an error for a BrowseName longer than the configured limit")
+	}
+	if _, _, err := device.CheckPropertyValue(PropertyNameDisplayName, overDisplayName); err != nil {
+		t.Errorf("expected an unlimited DisplayName, got %v", err)
+	}
+	if err := WithMaxBrowseNameLength(-1)(srv); err != ua.BadInvalidArgument {
+		t.Errorf("expected %s for a negative limit, got %v", ua.BadInvalidArgument, err)
+	}
+}
+
+func TestReservedNameChars(t *testing.T) {
+	p := newTestProjectManager(t)
+	device := newTestObjectNode(p, p.rootNode, "Device")
+	if err := p.AddNode(p.rootNode, device); err != nil {
+		t.Fatal(err)
+	}
+	name := "Tag" + PathSeparator + "1"
+
+	_, errs := NewObjectNodeWithProperties(
+		device,
+		ua.NewDataValue(NodeTypeTag.Int(), ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(PluginIDCore, ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(uuid.New(), ua.Good, time.Now(), 0, time.Now(), 0),
+		FieldMap{"BrowseName": name, "DisplayName": name, "Description": "", "Address": "40001"},
+		p.ctx,
+	)
+	if errs["PropertyNameBrowseName"] == nil {
+		t.Errorf("expected a field error for the BrowseName %q, got %v", name, errs)
+	}
+
+	for _, c := range reservedNameChars {
+		if _, _, err := device.CheckPropertyValue(PropertyNameBrowseName, "Device"+c+"1"); err == nil {
+			t.Errorf("expected an error for a BrowseName containing %q", c)
+		}
+	}
+
+	if err := device.SetBrowseName(name); err == nil {
+		t.Errorf("expected an error setting the BrowseName %q", name)
+	}
+	if _, err := device.Clone(name); err == nil {
+		t.Errorf("expected an error cloning to the BrowseName %q", name)
+	}
+	if _, err := device.Clone(strings.Repeat("x", p.namespaceManager.server.MaxBrowseNameLength()+1)); err == nil {
+		t.Error("expected an error cloning to a BrowseName longer than the limit")
+	}
+	if got := device.GetBrowseName().Name; got != "Device" {
+		t.Errorf("expected the BrowseName to stay Device, got %s", got)
+	}
+	if node := p.rootNode.GetChildByPath("Device"); node != device {
+		t.Errorf("expected the node at the path Device, got %v", node)
+	}
+}
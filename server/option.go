@@ -2,7 +2,13 @@
 
 package server
 
-import "github.com/afs/server/pkg/opcua/ua"
+import (
+	"crypto/tls"
+	"net/url"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
 
 // Option is a functional option to be applied to a server during initialization.
 type Option func(*UAServer) error
@@ -15,6 +21,19 @@ func WithSessionTimeout(value float64) Option {
 	}
 }
 
+// WithIdleTimeout sets the duration that a connection may be idle before being closed by the server, e.g. a client
+// that opens a secure channel but never creates a session. Set it longer than the session timeout, so the connections
+// of the sessions are not closed first. Zero is no timeout. (default: no timeout)
+func WithIdleTimeout(value time.Duration) Option {
+	return func(srv *UAServer) error {
+		if value < 0 {
+			return ua.BadInvalidArgument
+		}
+		srv.idleTimeout = value
+		return nil
+	}
+}
+
 // WithMaxSessionCount sets the number of sessions that may be active. (default: no limit)
 func WithMaxSessionCount(value uint32) Option {
 	return func(srv *UAServer) error {
@@ -31,6 +50,18 @@ func WithMaxSubscriptionCount(value uint32) Option {
 	}
 }
 
+// WithMaxPublishRequestsPerSession sets the number of Publish requests that may be queued for a session. When
+// exceeded, the oldest request is answered with BadTooManyPublishRequests. (default: 64)
+func WithMaxPublishRequestsPerSession(value uint32) Option {
+	return func(srv *UAServer) error {
+		if value == 0 {
+			return ua.BadInvalidArgument
+		}
+		srv.maxPublishRequestsPerSession = value
+		return nil
+	}
+}
+
 // WithServerCapabilities sets the number of subscription that may be active. (default: no limit)
 func WithServerCapabilities(value *ua.ServerCapabilities) Option {
 	return func(srv *UAServer) error {
@@ -47,6 +78,32 @@ func WithBuildInfo(value ua.BuildInfo) Option {
 	}
 }
 
+// WithProjectManager sets the ProjectManager whose state is reported by ServerStatus. (default: none)
+func WithProjectManager(p *ProjectManager) Option {
+	return func(srv *UAServer) error {
+		srv.projectManager = p
+		return nil
+	}
+}
+
+// WithClock sets the Clock that provides the timestamps of responses and values. (default: local time)
+func WithClock(clock Clock) Option {
+	return func(srv *UAServer) error {
+		srv.clock = clock
+		return nil
+	}
+}
+
+// WithGenerateCertificate sets whether a self-signed certificate for the application is generated on start,
+// and saved to the certPath and keyPath, if neither a certificate is found at the certPath nor a key at the keyPath.
+// Existing files are never overwritten. (default: true)
+func WithGenerateCertificate(value bool) Option {
+	return func(srv *UAServer) error {
+		srv.generateCertificate = value
+		return nil
+	}
+}
+
 // WithInsecureSkipVerify skips verification of client certificate. Skips checking HostName, Expiration, and Authority.
 func WithInsecureSkipVerify() Option {
 	return func(srv *UAServer) error {
@@ -56,6 +113,24 @@ func WithInsecureSkipVerify() Option {
 	}
 }
 
+// WithTrustedCertificates sets the file of PEM encoded certificates of the trusted clients, and of their
+// issuers. (default: "")
+func WithTrustedCertificates(path string) Option {
+	return func(srv *UAServer) error {
+		srv.trustedCertsPath = path
+		return nil
+	}
+}
+
+// WithRejectedCertificateStore sets the directory where client certificates that fail validation are saved,
+// named by thumbprint, so an administrator may trust them with TrustCertificate. (default: "", not saved)
+func WithRejectedCertificateStore(path string) Option {
+	return func(srv *UAServer) error {
+		srv.rejectedCertsPath = path
+		return nil
+	}
+}
+
 // WithTransportLimits ...
 func WithTransportLimits(receiveBufferSize, sendBufferSize, maxMessageSize, maxChunkCount uint32) Option {
 	return func(srv *UAServer) error {
@@ -107,6 +182,25 @@ func WithSecurityPolicyNone(value bool) Option {
 	}
 }
 
+// WithDiscoveryEndpoint sets whether to accept secure channels with security policy None for discovery only,
+// when none of the endpoints uses security policy None. Such channels answer FindServers and GetEndpoints,
+// and refuse all other services with BadSecurityPolicyRejected. (default: true)
+func WithDiscoveryEndpoint(value bool) Option {
+	return func(srv *UAServer) error {
+		srv.discoveryEndpoint = value
+		return nil
+	}
+}
+
+// WithEndpoints sets the endpoints of the server, each with its own security policy, mode and accepted user tokens.
+// When set, this replaces the endpoints derived from WithSecurityPolicyNone and WithAnonymousIdentity.
+func WithEndpoints(configs ...EndpointConfig) Option {
+	return func(srv *UAServer) error {
+		srv.endpointConfigs = configs
+		return nil
+	}
+}
+
 // WithUserNameIdentityAuthenticator sets the authenticator for UserNameIdentity.
 func WithUserNameIdentityAuthenticator(authenticator UserNameIdentityAuthenticator) Option {
 	return func(srv *UAServer) error {
@@ -155,6 +249,27 @@ func WithRolePermissions(permissions []ua.RolePermissionType) Option {
 	}
 }
 
+// WithLogger sets the Logger. Pass nil to disable logging. (default: logrus.StandardLogger())
+func WithLogger(logger Logger) Option {
+	return func(srv *UAServer) error {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		srv.logger = logger
+		return nil
+	}
+}
+
+// WithFaultLogInterval sets the number of identical service faults of a channel that are counted for each one that
+// is logged, so a client that repeats a failing request can't flood the log. The logged warning reports the number of
+// faults since the last one logged. Zero or one logs every fault. (default: 100)
+func WithFaultLogInterval(value uint32) Option {
+	return func(srv *UAServer) error {
+		srv.faultLogThrottle = newLogThrottle(value)
+		return nil
+	}
+}
+
 // WithHistorian sets the HistoryReadWriter.
 func WithHistorian(historian HistoryReadWriter) Option {
 	return func(srv *UAServer) error {
@@ -162,3 +277,162 @@ func WithHistorian(historian HistoryReadWriter) Option {
 		return nil
 	}
 }
+
+// WithEventHistory stores up to capacity events of historized objects in memory, and reads them for HistoryRead
+// requests with ReadEventDetails in place of the historian. Use EventHistory().Historize to select the objects.
+// (default: none)
+func WithEventHistory(capacity int) Option {
+	return func(srv *UAServer) error {
+		srv.eventHistory = NewEventHistory(srv, capacity)
+		return nil
+	}
+}
+
+// WithEventReplay keeps up to capacity events of each event source for the window, and delivers those passing the
+// WhereClause to a new event monitored item of the source, so a client doesn't miss the events raised just before it
+// subscribed. (default: none)
+func WithEventReplay(window time.Duration, capacity int) Option {
+	return func(srv *UAServer) error {
+		if window <= 0 || capacity <= 0 {
+			return ua.BadInvalidArgument
+		}
+		srv.eventReplay = newEventReplay(window, capacity)
+		return nil
+	}
+}
+
+// WithMinEventSeverity drops the events raised with a lower severity, before they reach any monitored item or the
+// event history. The severity may be changed at runtime with SetMinEventSeverity, or by writing the MinEventSeverity
+// variable of the VendorServerInfo object. (default: 0)
+func WithMinEventSeverity(value uint16) Option {
+	return func(srv *UAServer) error {
+		if value > maxEventSeverity {
+			return ua.BadInvalidArgument
+		}
+		srv.minEventSeverity = value
+		return nil
+	}
+}
+
+// WithSamplingPhases spreads the sampling of the monitored items of the same interval over a number of phases of the
+// interval, so the items are not all sampled at the same tick. Each item is still sampled once every interval, and
+// the notifications are still sent together in the Publish responses. (default: 1)
+func WithSamplingPhases(value int) Option {
+	return func(srv *UAServer) error {
+		if value < 1 {
+			return ua.BadInvalidArgument
+		}
+		srv.samplingPhases = value
+		return nil
+	}
+}
+
+// WithMaxNestingDepth sets the maximum depth of nested Variant, DataValue and ExtensionObject values that may be
+// decoded from a request, e.g. the value of a Write. Deeper requests are rejected with BadDecodingError.
+// (default: 100)
+func WithMaxNestingDepth(value int) Option {
+	return func(srv *UAServer) error {
+		if value < 1 {
+			return ua.BadInvalidArgument
+		}
+		srv.maxNestingDepth = value
+		return nil
+	}
+}
+
+// WithWebSocketEndpoint adds an endpoint using the WebSocket transport with UA binary encoding. The endpointURL is in
+// the form opc.wss://[host]:[port]/[path]. If tlsConfig is nil, the listener accepts plain WebSocket connections,
+// e.g. when a proxy terminates TLS. (default: none)
+func WithWebSocketEndpoint(endpointURL string, tlsConfig *tls.Config) Option {
+	return func(srv *UAServer) error {
+		if _, err := url.Parse(endpointURL); err != nil {
+			return ua.BadTCPEndpointURLInvalid
+		}
+		srv.webSocketEndpointURL = endpointURL
+		srv.webSocketTLSConfig = tlsConfig
+		return nil
+	}
+}
+
+// WithAPIKeys sets the API keys accepted by the REST gateway, mapped to user names. The roles of the user
+// are selected by the RolesProvider, as for a UserNameIdentity. (default: none)
+func WithAPIKeys(keys map[string]string) Option {
+	return func(srv *UAServer) error {
+		srv.apiKeys = keys
+		return nil
+	}
+}
+
+// WithRetainedValues sets the file where the values of variables are saved when the server closes, and restored
+// from after the project is loaded. (default: none)
+func WithRetainedValues(path string) Option {
+	return func(srv *UAServer) error {
+		srv.retainedValuesPath = path
+		return nil
+	}
+}
+
+// WithWriteConfirmation sets whether the writes that the WriteValueHandler of a variable of a device plugin sends
+// to the device wait for the plugin to confirm the write. If true, the value is only updated when the device reports success, and the Write service returns
+// the status of the device. The plugin must implement WriteConfirmer. (default: false)
+func WithWriteConfirmation(enabled bool) Option {
+	return func(srv *UAServer) error {
+		srv.writeConfirmation = enabled
+		return nil
+	}
+}
+
+// WithMaxReferencesPerNode sets the number of references returned for a node by Browse, with a continuation
+// point for the rest, even when the client requests no limit. Zero is no limit. (default: 1000)
+func WithMaxReferencesPerNode(value uint32) Option {
+	return func(srv *UAServer) error {
+		srv.maxReferencesPerNode = value
+		return nil
+	}
+}
+
+// WithMaxBrowseNameLength sets the longest BrowseName, in characters, accepted for an ObjectNode. The BrowseName
+// is a part of the NodeID path of the node and of all its descendants. Zero is unlimited. (default: 128)
+func WithMaxBrowseNameLength(value int) Option {
+	return func(srv *UAServer) error {
+		if value < 0 {
+			return ua.BadInvalidArgument
+		}
+		srv.maxBrowseNameLength = value
+		return nil
+	}
+}
+
+// WithMaxDisplayNameLength sets the longest DisplayName, in characters, accepted for an ObjectNode. Zero is
+// unlimited. (default: 256)
+func WithMaxDisplayNameLength(value int) Option {
+	return func(srv *UAServer) error {
+		if value < 0 {
+			return ua.BadInvalidArgument
+		}
+		srv.maxDisplayNameLength = value
+		return nil
+	}
+}
+
+// WithPasswordLength sets the accepted length in bytes of the password of a UserNameIdentityToken.
+// (default: 0, 64)
+func WithPasswordLength(min, max uint32) Option {
+	return func(srv *UAServer) error {
+		if min > max {
+			return ua.BadInvalidArgument
+		}
+		srv.minPasswordLength = min
+		srv.maxPasswordLength = max
+		return nil
+	}
+}
+
+// WithDefaultLocale sets the locale of the DisplayName and Description returned to a session when none of
+// its requested locales is available. (default: "en")
+func WithDefaultLocale(locale string) Option {
+	return func(srv *UAServer) error {
+		srv.defaultLocale = locale
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// userPermissionCacheKey stores the userPermissionCache of the current request in context.
+const userPermissionCacheKey key = "opcua-user-permission-cache"
+
+// userPermissionCache caches the permissions granted to the roles of a session, for the duration of one
+// request. Nodes that share the same RolePermissions slice share the result, so a Read of many nodes with the
+// same permissions filters the permissions once.
+type userPermissionCache struct {
+	sync.Mutex
+	roles    []ua.NodeID
+	defaults []ua.RolePermissionType
+	entries  map[rolePermissionsKey][]ua.RolePermissionType
+}
+
+// rolePermissionsKey identifies a RolePermissions slice by its first element and length.
+type rolePermissionsKey struct {
+	first *ua.RolePermissionType
+	len   int
+}
+
+func newUserPermissionCache(session *Session) *userPermissionCache {
+	return &userPermissionCache{
+		roles:    session.UserRoles(),
+		defaults: session.Server().RolePermissions(),
+		entries:  make(map[rolePermissionsKey][]ua.RolePermissionType),
+	}
+}
+
+// get returns the RolePermissions of the node for the roles of the session, as GetUserRolePermissions.
+func (c *userPermissionCache) get(n Node) []ua.RolePermissionType {
+	rolePermissions := n.GetRolePermissions()
+	if rolePermissions == nil {
+		rolePermissions = c.defaults
+	}
+	if len(rolePermissions) == 0 {
+		return []ua.RolePermissionType{}
+	}
+	k := rolePermissionsKey{first: &rolePermissions[0], len: len(rolePermissions)}
+	c.Lock()
+	defer c.Unlock()
+	if res, ok := c.entries[k]; ok {
+		return res
+	}
+	res := []ua.RolePermissionType{}
+	for _, role := range c.roles {
+		for _, rp := range rolePermissions {
+			if rp.RoleID == role {
+				res = append(res, rp)
+			}
+		}
+	}
+	c.entries[k] = res
+	return res
+}
+
+// userRolePermissions returns the RolePermissions of the node for the current user, using the cache of the
+// request if there is one.
+func userRolePermissions(ctx context.Context, n Node) []ua.RolePermissionType {
+	if c, ok := ctx.Value(userPermissionCacheKey).(*userPermissionCache); ok {
+		return c.get(n)
+	}
+	return n.GetUserRolePermissions(ctx)
+}
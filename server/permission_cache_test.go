@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestUserPermissionCache(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	// a variable with distinct permissions, which do not include Read.
+	id := ua.NewNodeIDString(1, "Variable.Browse")
+	if err := srv.NamespaceManager().AddNode(NewVariableNode(
+		id,
+		ua.NewQualifiedName(1, "Browse"),
+		ua.NewLocalizedText("Browse", ""),
+		ua.NewLocalizedText("", ""),
+		[]ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeBrowse}},
+		[]ua.Reference{},
+		ua.NewDataValue(float64(1), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		-1,
+		false,
+		nil,
+	)); err != nil {
+		t.Fatal(err)
+	}
+	session := ctx.Value(SessionKey).(*Session)
+	ctx = context.WithValue(ctx, userPermissionCacheKey, newUserPermissionCache(session))
+	for _, c := range []struct {
+		id     ua.NodeID
+		status ua.StatusCode
+	}{
+		{testVariableID, ua.Good},
+		{id, ua.BadUserAccessDenied},
+		{testVariableID, ua.Good},
+	} {
+		if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: c.id, AttributeID: ua.AttributeIDValue}); dv.StatusCode != c.status {
+			t.Errorf("%s: expected %s, got %s", c.id, c.status, dv.StatusCode)
+		}
+	}
+}
+
+func BenchmarkReadSamePermissions(b *testing.B) {
+	srv, ctx := newTestServer(b, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	rp := []ua.RolePermissionType{
+		{RoleID: ua.ObjectIDWellKnownRoleAuthenticatedUser, Permissions: ua.PermissionTypeBrowse},
+		{RoleID: ua.ObjectIDWellKnownRoleOperator, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeWrite},
+		{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	}
+	nodesToRead := make([]ua.ReadValueID, 1000)
+	for i := range nodesToRead {
+		id := ua.NewNodeIDString(1, fmt.Sprintf("Variable%d", i))
+		srv.NamespaceManager().AddNode(NewVariableNode(
+			id,
+			ua.NewQualifiedName(1, fmt.Sprintf("Variable%d", i)),
+			ua.NewLocalizedText("", ""),
+			ua.NewLocalizedText("", ""),
+			rp,
+			[]ua.Reference{},
+			ua.NewDataValue(float64(i), 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			-1,
+			false,
+			nil,
+		))
+		nodesToRead[i] = ua.ReadValueID{NodeID: id, AttributeID: ua.AttributeIDValue}
+	}
+	session := ctx.Value(SessionKey).(*Session)
+	session.userRoles = []ua.NodeID{ua.ObjectIDWellKnownRoleAuthenticatedUser, ua.ObjectIDWellKnownRoleObserver}
+	read := func(ctx context.Context) {
+		for _, n := range nodesToRead {
+			srv.readValue(ctx, n)
+		}
+	}
+	b.Run("Uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			read(ctx)
+		}
+	})
+	b.Run("Cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			read(context.WithValue(ctx, userPermissionCacheKey, newUserPermissionCache(session)))
+		}
+	})
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/afs/server/pkg/opcua/ua"
 	"gopkg.in/guregu/null.v4"
 )
 
@@ -137,6 +140,30 @@ type Plugin interface {
 	GetEntryState(node *ObjectNode) *EntryState
 }
 
+// WriteConfirmer is implemented by a plugin that confirms writes to the device backing its variables.
+// It is used when the server is created with WithWriteConfirmation, for the variables with a WriteValueHandler.
+type WriteConfirmer interface {
+	// ConfirmWrite blocks until the device responds to the value sent by the WriteValueHandler of the variable, so
+	// the value is written to the device once. It returns Good if the device accepted the value, otherwise the
+	// status reported by the device, e.g. BadCommunicationError.
+	ConfirmWrite(ctx context.Context, node *VariableNode, value ua.DataValue) ua.StatusCode
+}
+
+// BatchReader is implemented by a plugin that reads the values of many variables in one transaction with the
+// device. It is used by Read when the whole Value attributes of variables owned by the plugin, without a
+// ReadValueHandler, are the only nodes to read.
+type BatchReader interface {
+	// ReadValues returns the values of the variables, in the order of the ids.
+	ReadValues(ctx context.Context, ids []ua.ReadValueID) []ua.DataValue
+}
+
+// Heartbeater is implemented by a plugin whose entry nodes report they are alive. The watchdog of the
+// ProjectManager restarts an entry node that has not reported within the watchdog interval.
+type Heartbeater interface {
+	// LastHeartbeat returns the time the process of the entry node last reported it is alive.
+	LastHeartbeat(entryNode *ObjectNode) time.Time
+}
+
 // IsPropertyNameValid returns true if property name is valid for specified node type and plugin
 func IsPropertyNameValid(propName string, nodeType NodeType, plugin Plugin) bool {
 	return plugin.GetPluginConfig().GetFieldDef(propName, nodeType) != nil
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	log "github.com/sirupsen/logrus"
+)
+
+// The operations of the plugin of an entry node that may fail.
+const (
+	PluginOperationStart string = "start"
+	PluginOperationStop  string = "stop"
+)
+
+// PluginError is a failure of the plugin of an entry node to start or stop.
+type PluginError struct {
+	// NodeID is the id of the entry node.
+	NodeID ua.NodeID
+	// Operation is PluginOperationStart or PluginOperationStop.
+	Operation string
+	// Err is the error returned by the plugin.
+	Err error
+	// Timestamp is the time of the failure.
+	Timestamp time.Time
+}
+
+func (e *PluginError) Error() string {
+	return fmt.Sprintf("plugin of node '%s' failed to %s: %s", e.NodeID, e.Operation, e.Err)
+}
+
+// Unwrap returns the error returned by the plugin.
+func (e *PluginError) Unwrap() error {
+	return e.Err
+}
+
+// SetPluginErrorHandler sets the function called when the plugin of an entry node fails to start or stop.
+func (p *ProjectManager) SetPluginErrorHandler(handler func(*PluginError)) {
+	p.pluginLock.Lock()
+	defer p.pluginLock.Unlock()
+	p.pluginErrorHandler = handler
+}
+
+// PluginErrors returns the last failure of each entry node whose plugin failed to start or stop, and has not
+// succeeded since. They are the warnings of the loaded project.
+func (p *ProjectManager) PluginErrors() []*PluginError {
+	p.pluginLock.Lock()
+	defer p.pluginLock.Unlock()
+	res := make([]*PluginError, 0, len(p.pluginErrors))
+	for _, e := range p.pluginErrors {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].NodeID.String() < res[j].NodeID.String() })
+	return res
+}
+
+// SetPluginStartLimit sets the number of plugins of entry nodes starting at the same time. The other plugins
+// wait until a start returns. Zero is unlimited. (default: 0)
+func (p *ProjectManager) SetPluginStartLimit(limit int) {
+	p.pluginLock.Lock()
+	defer p.pluginLock.Unlock()
+	if limit > 0 {
+		p.startSemaphore = make(chan struct{}, limit)
+	} else {
+		p.startSemaphore = nil
+	}
+}
+
+// startPlugin starts the plugin of the entry node in a new goroutine.
+func (p *ProjectManager) startPlugin(node *ObjectNode) {
+	p.pluginLock.Lock()
+	h := p.health(node.GetNodeID())
+	h.running = true
+	h.started = time.Now()
+	semaphore := p.startSemaphore
+	p.pluginLock.Unlock()
+	go func() {
+		if semaphore != nil {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+		}
+		p.reportPlugin(node, PluginOperationStart, node.GetPlugin().Start(node))
+	}()
+}
+
+// stopPlugin stops the plugin of the entry node in a new goroutine.
+func (p *ProjectManager) stopPlugin(node *ObjectNode) {
+	p.pluginLock.Lock()
+	p.health(node.GetNodeID()).running = false
+	p.pluginLock.Unlock()
+	go func() {
+		p.reportPlugin(node, PluginOperationStop, node.GetPlugin().Stop(node))
+	}()
+}
+
+// reportPlugin records the result of starting or stopping the plugin of the entry node. A failure is logged,
+// sets the CommunicationStatus of the node to Bad, and is passed to the plugin error handler.
+func (p *ProjectManager) reportPlugin(node *ObjectNode, operation string, err error) {
+	p.pluginLock.Lock()
+	if err == nil {
+		delete(p.pluginErrors, node.GetNodeID())
+		p.pluginLock.Unlock()
+		return
+	}
+	e := &PluginError{NodeID: node.GetNodeID(), Operation: operation, Err: err, Timestamp: time.Now()}
+	if p.pluginErrors == nil {
+		p.pluginErrors = make(map[ua.NodeID]*PluginError)
+	}
+	p.pluginErrors[e.NodeID] = e
+	handler := p.pluginErrorHandler
+	p.pluginLock.Unlock()
+
+	log.Errorf("%s", e)
+	node.SetCommunicationStatus(CommunicationStatusBad, err)
+	if handler != nil {
+		handler(e)
+	}
+}
+
+// pluginHealth is the state of the plugin of an entry node, as seen by the watchdog.
+type pluginHealth struct {
+	// running is true from the start of the plugin until it is stopped.
+	running bool
+	// started is the time the plugin was last started.
+	started time.Time
+	// restarting is true while the watchdog restarts the plugin.
+	restarting bool
+	// restarts is the number of times the watchdog restarted the plugin.
+	restarts uint32
+}
+
+// health returns the state of the plugin of the entry node. The caller holds the pluginLock.
+func (p *ProjectManager) health(id ua.NodeID) *pluginHealth {
+	if p.pluginHealth == nil {
+		p.pluginHealth = make(map[ua.NodeID]*pluginHealth)
+	}
+	h, ok := p.pluginHealth[id]
+	if !ok {
+		h = &pluginHealth{}
+		p.pluginHealth[id] = h
+	}
+	return h
+}
+
+// SetWatchdogInterval sets the longest time the plugin of an entry node may not heartbeat before the watchdog
+// restarts it. Only plugins implementing Heartbeater are watched. Zero stops the watchdog. (default: 0)
+func (p *ProjectManager) SetWatchdogInterval(interval time.Duration) {
+	p.pluginLock.Lock()
+	defer p.pluginLock.Unlock()
+	if p.watchdogStop != nil {
+		close(p.watchdogStop)
+		p.watchdogStop = nil
+	}
+	p.watchdogInterval = interval
+	if interval > 0 {
+		p.watchdogStop = make(chan struct{})
+		go p.runWatchdog(interval, p.watchdogStop)
+	}
+}
+
+// PluginRestarts returns the number of times the watchdog restarted the plugin of each entry node.
+func (p *ProjectManager) PluginRestarts() map[ua.NodeID]uint32 {
+	p.pluginLock.Lock()
+	defer p.pluginLock.Unlock()
+	res := make(map[ua.NodeID]uint32, len(p.pluginHealth))
+	for id, h := range p.pluginHealth {
+		res[id] = h.restarts
+	}
+	return res
+}
+
+// runWatchdog checks the heartbeat of the plugins every interval, until stop is closed.
+func (p *ProjectManager) runWatchdog(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.checkPlugins(interval)
+		}
+	}
+}
+
+// checkPlugins restarts the running plugins that have not heartbeat within the interval, neither since they
+// were started.
+func (p *ProjectManager) checkPlugins(interval time.Duration) {
+	p.RLock()
+	entries := p.entryNodes.Values()
+	p.RUnlock()
+	for _, item := range entries {
+		node := item.(*ObjectNode)
+		hb, ok := node.GetPlugin().(Heartbeater)
+		if !ok {
+			continue
+		}
+		last := hb.LastHeartbeat(node)
+		p.pluginLock.Lock()
+		h := p.health(node.GetNodeID())
+		if !h.running || h.restarting {
+			p.pluginLock.Unlock()
+			continue
+		}
+		if h.started.After(last) {
+			last = h.started
+		}
+		if time.Since(last) <= interval {
+			p.pluginLock.Unlock()
+			continue
+		}
+		h.restarting = true
+		h.restarts++
+		p.pluginLock.Unlock()
+
+		log.Warnf("plugin of node '%s' has not heartbeat since %s, restarting", node.GetNodeID(), last.Format(time.RFC3339))
+		go p.restartPlugin(node)
+	}
+}
+
+// restartPlugin stops the plugin of the entry node, then starts it again unless the plugins were stopped
+// meanwhile.
+func (p *ProjectManager) restartPlugin(node *ObjectNode) {
+	p.reportPlugin(node, PluginOperationStop, node.GetPlugin().Stop(node))
+	p.pluginLock.Lock()
+	h := p.health(node.GetNodeID())
+	h.restarting = false
+	running := h.running
+	if running {
+		// the plugin has a full interval to heartbeat after the restart.
+		h.started = time.Now()
+	}
+	p.pluginLock.Unlock()
+	if running {
+		p.startPlugin(node)
+	}
+}
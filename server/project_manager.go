@@ -2,10 +2,16 @@ package server
 
 import (
 	"context"
+	"encoding/csv"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/afs/server/config"
+	"github.com/afs/server/pkg/eris"
 	"github.com/afs/server/pkg/opcua/ua"
 	"github.com/emirpasic/gods/lists/arraylist"
 	"github.com/google/uuid"
@@ -85,6 +91,27 @@ type ProjectManager struct {
 
 	// state is the object that manage the workflows of this *ProjectManager
 	state *stateless.StateMachine
+
+	// pluginLock guards the plugin errors, which are reported from the goroutines starting and stopping plugins
+	pluginLock sync.Mutex
+
+	// pluginErrors is the last failure of the plugin of each entry node
+	pluginErrors map[ua.NodeID]*PluginError
+
+	// pluginErrorHandler is called when the plugin of an entry node fails to start or stop
+	pluginErrorHandler func(*PluginError)
+
+	// pluginHealth is the state of the plugin of each entry node, as seen by the watchdog
+	pluginHealth map[ua.NodeID]*pluginHealth
+
+	// watchdogInterval is the longest time a plugin may not heartbeat before it is restarted, zero disables the watchdog
+	watchdogInterval time.Duration
+
+	// watchdogStop stops the goroutine of the watchdog
+	watchdogStop chan struct{}
+
+	// startSemaphore limits the number of plugins starting at the same time, nil if unlimited
+	startSemaphore chan struct{}
 }
 
 // NewProjectManager returns new instance of ProjectManager
@@ -305,9 +332,13 @@ func (p *ProjectManager) AddNode(parent, node *ObjectNode) error {
 	// if node is an entry node then start it
 	if node.IsEntry() {
 		p.entryNodes.Add(node)
-		go node.GetPlugin().Start(node)
+		p.startPlugin(node)
 	}
 
+	p.namespaceManager.raiseModelChange(
+		modelChange(node, node.GetNodeID(), ua.ModelChangeStructureVerbMaskNodeAdded),
+		modelChange(parent, parent.GetNodeID(), ua.ModelChangeStructureVerbMaskReferenceAdded),
+	)
 	return nil
 }
 
@@ -325,17 +356,20 @@ func (p *ProjectManager) RemoveNode(node *ObjectNode) error {
 		return ErrParentNotFound
 	}
 
-	err = node.parent.RemoveChild(node)
+	parent := node.parent
+	err = parent.RemoveChild(node)
 	if err != nil {
 		return err
 	}
 
 	// loop into child and it self node
 	// to check if any node is entry node then stop it
+	changes := []ua.ModelChangeStructureDataType{modelChange(parent, parent.GetNodeID(), ua.ModelChangeStructureVerbMaskReferenceDeleted)}
 	node.ForEachSelfDepth(func(child *ObjectNode) {
+		changes = append(changes, modelChange(child, child.GetNodeID(), ua.ModelChangeStructureVerbMaskNodeDeleted))
 		if child.IsEntry() {
 			p.entryNodes.Remove(p.entryNodes.IndexOf(child))
-			go node.GetPlugin().Stop(node)
+			p.stopPlugin(child)
 		}
 	})
 
@@ -344,6 +378,7 @@ func (p *ProjectManager) RemoveNode(node *ObjectNode) error {
 	if err != nil {
 		return err
 	}
+	p.namespaceManager.raiseModelChange(changes...)
 	return nil
 }
 
@@ -371,6 +406,26 @@ func (p *ProjectManager) Save() error {
 	return nil
 }
 
+// WriteJSON writes the current loaded project to w in the format of Save. The tree is written a node at a time,
+// so a large project is not held in memory as a whole.
+func (p *ProjectManager) WriteJSON(w io.Writer) error {
+	p.Lock()
+	defer p.Unlock()
+
+	err := p.checkState()
+	if err != nil {
+		return err
+	}
+
+	s := newJsonStream(w)
+	s.writer.RootObject(func() {
+		s.writer.Object("root", func() {
+			s.writeObjectNode(p.rootNode)
+		})
+	})
+	return s.err
+}
+
 // GetProject returns the current loaded project
 func (p *ProjectManager) GetProject() (*JsonProject, error) {
 	p.Lock()
@@ -452,7 +507,11 @@ func (p *ProjectManager) GetNode(id string) (*ObjectNode, error) {
 	if err == nil {
 		return p.GetNodeByInternalId(internalId)
 	}
-	return p.GetNodeByNodeId(ua.ParseNodeIDString(id))
+	nodeID, err := p.namespaceManager.ParseNodeID(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return p.GetNodeByNodeId(nodeID)
 }
 
 func (p *ProjectManager) ReplaceNodeID(oldId, newId ua.NodeID) {
@@ -464,6 +523,187 @@ func (p *ProjectManager) ReplaceNodeID(oldId, newId ua.NodeID) {
 	}
 }
 
+// ImportWithPrefix adds the nodes of a project, e.g. exported from another server, below the root node of the
+// loaded project. The NodeIds of the imported nodes begin with the prefix instead of the NodeId of the root node of
+// the project, and the references between the imported nodes are updated to match, so they do not collide with the
+// existing nodes. The imported nodes are given new InternalIds, so the same project may be imported more than once.
+func (p *ProjectManager) ImportWithPrefix(project *JsonProject, prefix string) error {
+	root, err := project.Validate(p.ctx)
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return ErrInvalidRootNode
+	}
+	parent := p.Root()
+	if parent == nil {
+		return ErrProjectNotLoaded
+	}
+
+	// the imported root is replaced by the root of the loaded project, other nodes are renamed.
+	oldPrefix := root.GetNodeID().GetID().(string)
+	replaceID := func(id ua.NodeID) (ua.NodeID, bool) {
+		s, ok := id.(ua.NodeIDString)
+		if !ok || s.NamespaceIndex != DefaultNameSpace {
+			return id, false
+		}
+		if s.ID == oldPrefix {
+			return parent.GetNodeID(), true
+		}
+		if strings.HasPrefix(s.ID, oldPrefix+PathSeparator) {
+			return ua.NewNodeIDString(DefaultNameSpace, prefix+s.ID[len(oldPrefix):]), true
+		}
+		return id, false
+	}
+	replaceReferences := func(node Node) {
+		refs := make([]ua.Reference, 0, len(node.GetReferences()))
+		for _, r := range node.GetReferences() {
+			if id, ok := replaceID(r.TargetID.NodeID); ok {
+				r.TargetID = ua.NewExpandedNodeID(id)
+			}
+			refs = append(refs, r)
+		}
+		node.SetReferences(refs)
+	}
+
+	nodes := []*ObjectNode{}
+	root.ForEachDepth(func(child *ObjectNode) {
+		nodes = append(nodes, child)
+	})
+	for _, node := range nodes {
+		replaceReferences(node)
+		for _, prop := range node.GetProperties() {
+			replaceReferences(prop)
+			if id, ok := replaceID(prop.GetNodeID()); ok {
+				prop.SetNodeID(id)
+			}
+		}
+		node.ReplaceNodeIDPrefix(oldPrefix, prefix)
+		node.MustGetProperty(PropertyNameInternalId).SetValue(ua.NewDataValue(uuid.New(), ua.Good, time.Now(), 0, time.Now(), 0))
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	err = p.checkState()
+	if err != nil {
+		return err
+	}
+
+	// check the whole project before adding any node
+	for _, node := range nodes {
+		if _, found := p.namespaceManager.FindNode(node.GetNodeID()); found {
+			return ErrNodeIDExisted
+		}
+		for _, prop := range node.GetProperties() {
+			if _, found := p.namespaceManager.FindNode(prop.GetNodeID()); found {
+				return ErrNodeIDExisted
+			}
+		}
+	}
+	for _, child := range root.GetChilds().Values() {
+		if !p.rootNode.CanAddChild(child.(*ObjectNode).GetNodeType()) {
+			return ErrNodeTypeNotAccepted
+		}
+	}
+
+	for _, child := range root.GetChilds().Values() {
+		child.(*ObjectNode).parent = p.rootNode
+		p.rootNode.AddChild(child.(*ObjectNode))
+	}
+	for _, node := range nodes {
+		p.namespaceManager.AddNode(node)
+		for _, prop := range node.GetProperties() {
+			p.namespaceManager.AddNode(prop)
+		}
+		p.nodeIdToNodeMapper[node.GetNodeID()] = node
+		p.internalIdToNodeMapper[node.MustGetProperty(PropertyNameInternalId).GetValue().Value.(uuid.UUID)] = node
+		if node.IsEntry() {
+			p.entryNodes.Add(node)
+			p.startPlugin(node)
+		}
+	}
+	return nil
+}
+
+// ImportTagsCSV adds a tag below the parent for each row of a CSV tag list. The first row is the header, which
+// names the field of each column, e.g. Name, Address, DataType and Scaling. The Name column is the BrowseName of the
+// tag, and also its DisplayName unless there is a DisplayName column. The other columns are the fields of the tag,
+// as defined by the plugin of the parent. It returns the number of tags created, and the errors of the rows that
+// were not imported by the line of the row, where the header is line 1.
+func (p *ProjectManager) ImportTagsCSV(parent *ObjectNode, r io.Reader) (created int, errs map[string]error) {
+	errs = map[string]error{}
+	if !parent.CanAddChild(NodeTypeTag) {
+		errs["parent"] = ErrNodeTypeNotAccepted
+		return 0, errs
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		errs["line 1"] = err
+		return 0, errs
+	}
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		key := "line " + strconv.Itoa(line)
+		if err != nil {
+			errs[key] = err
+			// the reader continues after a malformed row, but not after an error of r.
+			if _, ok := err.(*csv.ParseError); ok {
+				continue
+			}
+			break
+		}
+
+		fm := FieldMap{}
+		for i, value := range record {
+			fm[header[i]] = strings.TrimSpace(value)
+		}
+		fm.NormalizeFieldName()
+		if name, ok := fm["Name"]; ok {
+			delete(fm, "Name")
+			fm[PropertyNameBrowseName] = name
+			if _, ok := fm[PropertyNameDisplayName]; !ok {
+				fm[PropertyNameDisplayName] = name
+			}
+		}
+		if _, ok := fm[PropertyNameDescription]; !ok {
+			fm[PropertyNameDescription] = ""
+		}
+
+		node, fieldErrors := NewObjectNodeWithProperties(
+			parent,
+			ua.NewDataValue(NodeTypeTag.Int(), ua.Good, time.Now(), 0, time.Now(), 0),
+			ua.NewDataValue(parent.GetPlugin().GetId(), ua.Good, time.Now(), 0, time.Now(), 0),
+			ua.NewDataValue(uuid.New(), ua.Good, time.Now(), 0, time.Now(), 0),
+			fm,
+			p.ctx,
+		)
+		if len(fieldErrors) == 0 {
+			fieldErrors = node.Validate()
+		}
+		if len(fieldErrors) > 0 {
+			errs[key] = eris.Fields(fieldErrors)
+			continue
+		}
+		if err := p.AddNode(parent, node); err != nil {
+			errs[key] = err
+			continue
+		}
+		created++
+	}
+	return created, errs
+}
+
 // onLoading handler of state PROJECT_STATE_LOADING
 func (p *ProjectManager) onLoading(ctx context.Context, args ...interface{}) error {
 	// check the runtime project file is existed
@@ -507,6 +747,13 @@ func (p *ProjectManager) onLoading(ctx context.Context, args ...interface{}) err
 		}
 	})
 
+	// re-apply the retained values before the plugins start
+	if srv, ok := p.ctx.Value(CtxKeyUAServer).(*UAServer); ok {
+		if err := srv.RestoreValues(); err != nil {
+			log.Warnf("restore retained values failed: %s", err)
+		}
+	}
+
 	p.onLoadPlugins(ctx, args)
 	return nil
 }
@@ -515,7 +762,7 @@ func (p *ProjectManager) onLoading(ctx context.Context, args ...interface{}) err
 func (p *ProjectManager) onLoadPlugins(ctx context.Context, args ...interface{}) error {
 	// start nodes that was marked entry = true
 	for _, item := range p.entryNodes.Values() {
-		go item.(*ObjectNode).GetPlugin().Start(item.(*ObjectNode))
+		p.startPlugin(item.(*ObjectNode))
 	}
 	return nil
 }
@@ -538,7 +785,7 @@ func (p *ProjectManager) onUnloadPlugins(ctx context.Context, args ...interface{
 	log.Traceln("*ProjectManager << onUnloadPlugins")
 	// stop nodes that was marked entry = true
 	for _, item := range p.entryNodes.Values() {
-		go item.(*ObjectNode).GetPlugin().Stop(item.(*ObjectNode))
+		p.stopPlugin(item.(*ObjectNode))
 	}
 	return nil
 }
@@ -562,6 +809,10 @@ func (p *ProjectManager) onReloadPlugins(ctx context.Context, args ...interface{
 func (p *ProjectManager) cleanup() {
 	log.Traceln("*ProjectManager << cleanup")
 	p.entryNodes.Clear()
+	p.pluginLock.Lock()
+	p.pluginErrors = nil
+	p.pluginHealth = nil
+	p.pluginLock.Unlock()
 	for key := range p.nodeIdToNodeMapper {
 		delete(p.nodeIdToNodeMapper, key)
 	}
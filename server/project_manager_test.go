@@ -0,0 +1,416 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/google/uuid"
+	"github.com/qmuntal/stateless"
+)
+
+// corePlugin accepts every node, so project trees can be built without the plugins of the application.
+type corePlugin struct {
+	Plugin
+}
+
+func (corePlugin) GetId() int16                                       { return PluginIDCore }
+func (corePlugin) IsPluginEntry(node *ObjectNode) bool                { return false }
+func (corePlugin) GetPluginProps(node *ObjectNode) PluginProps        { return nil }
+func (corePlugin) Validate(node *ObjectNode) map[string]error         { return nil }
+func (corePlugin) CanAddNodeType(parent *ObjectNode, t NodeType) bool { return true }
+func (corePlugin) AddNode(parent *ObjectNode, child *ObjectNode) error {
+	return nil
+}
+func (corePlugin) RemoveNode(parent *ObjectNode, child *ObjectNode) error {
+	return nil
+}
+func (corePlugin) CheckPropertyValue(node *ObjectNode, name string, value interface{}) (bool, interface{}, error) {
+	return true, value, nil
+}
+func (corePlugin) CheckUpdateValid(node *ObjectNode, m FieldMap) (map[string]error, FieldMap) {
+	return nil, m
+}
+func (corePlugin) GetPluginConfig() *PluginConfig {
+	return &PluginConfig{NodeConfigs: map[string]*NodeConfig{
+		NodeTypeTag.String(): {FieldDefs: []*FieldDef{
+			{Name: "Address", Type: "string"},
+			{Name: "DataType", Type: "string"},
+			{Name: "Scaling", Type: "string"},
+		}},
+	}}
+}
+
+type corePluginProvider struct{}
+
+func (corePluginProvider) GetPlugin(id int16) Plugin    { return corePlugin{} }
+func (corePluginProvider) SupportPlugins() []PluginInfo { return []PluginInfo{{Id: PluginIDCore}} }
+
+// newTestProjectManager returns a ProjectManager with a loaded project of only the root node.
+func newTestProjectManager(t *testing.T) *ProjectManager {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	p := &ProjectManager{
+		entryNodes:             arraylist.New(),
+		nodeIdToNodeMapper:     map[ua.NodeID]*ObjectNode{},
+		internalIdToNodeMapper: map[uuid.UUID]*ObjectNode{},
+		namespaceManager:       srv.NamespaceManager(),
+		state:                  stateless.NewStateMachine(PROJECT_STATE_LOADED),
+	}
+	ctx := context.WithValue(context.Background(), CtxKeyPluginManager, &PluginManager{pluginProvider: corePluginProvider{}})
+	p.ctx = context.WithValue(ctx, CtxKeyProjectManager, p)
+	p.rootNode = NewRootNode(p.ctx, false)
+	p.nodeIdToNodeMapper[p.rootNode.GetNodeID()] = p.rootNode
+	p.namespaceManager.AddNode(p.rootNode)
+	return p
+}
+
+func TestImportWithPrefix(t *testing.T) {
+	p := newTestProjectManager(t)
+	project := NewDefaultJsonProject(p.ctx)
+	for _, prefix := range []string{"Site1", "Site2"} {
+		if err := p.ImportWithPrefix(project, prefix); err != nil {
+			t.Fatalf("%s: %v", prefix, err)
+		}
+	}
+
+	internalIds := map[uuid.UUID]bool{}
+	for _, prefix := range []string{"Site1", "Site2"} {
+		id := ua.NewNodeIDString(DefaultNameSpace, prefix+PathSeparator+NodeTypeCategoryConnectivity.String())
+		node, err := p.GetNodeByNodeId(id)
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		if _, found := p.namespaceManager.FindNode(id); !found {
+			t.Errorf("%s: expected node in namespace", id)
+		}
+		found := false
+		for _, r := range node.GetReferences() {
+			if r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasComponent {
+				found = r.TargetID.NodeID == p.rootNode.GetNodeID()
+			}
+		}
+		if !found {
+			t.Errorf("%s: expected reference to the root node", id)
+		}
+		prop := node.MustGetProperty(PropertyNameInternalId)
+		if prop.GetNodeID() != ua.NewNodeIDString(DefaultNameSpace, id.ID+PathSeparator+PropertyNameInternalId) {
+			t.Errorf("%s: unexpected property id %s", id, prop.GetNodeID())
+		}
+		internalIds[prop.GetValue().Value.(uuid.UUID)] = true
+	}
+	if len(internalIds) != 2 {
+		t.Errorf("expected different InternalIds, got %v", internalIds)
+	}
+
+	if err := p.ImportWithPrefix(project, "Site1"); err != ErrNodeIDExisted {
+		t.Errorf("expected %v, got %v", ErrNodeIDExisted, err)
+	}
+	if n := p.rootNode.GetChilds().Size(); n != 6 {
+		t.Errorf("expected 6 children of the root node, got %d", n)
+	}
+}
+
+func TestModelChangeEvent(t *testing.T) {
+	p := newTestProjectManager(t)
+	server := NewObjectNode(
+		ua.ObjectIDServer,
+		ua.NewQualifiedName(0, "Server"),
+		ua.NewLocalizedText("Server", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{},
+		ua.EventNotifierSubscribeToEvents,
+	)
+	if err := p.namespaceManager.AddNode(server); err != nil {
+		t.Fatal(err)
+	}
+	mi := &MonitoredItem{
+		itemToMonitor:      ua.ReadValueID{NodeID: ua.ObjectIDServer, AttributeID: ua.AttributeIDEventNotifier},
+		queueSize:          maxQueueSize,
+		timestampsToReturn: ua.TimestampsToReturnBoth,
+		eventFilter:        ua.EventFilter{SelectClauses: ua.GeneralModelChangeEventSelectClauses},
+	}
+	server.AddEventListener(mi)
+
+	node := NewDefaultObjectNode(
+		p.rootNode,
+		ua.NewQualifiedName(DefaultNameSpace, NodeTypeCategoryConnectivity.String()),
+		ua.NewLocalizedText(NodeTypeCategoryConnectivity.String(), DefaultLocale),
+		ua.NewLocalizedText("", DefaultLocale),
+		ua.NewDataValue(NodeTypeCategoryConnectivity.Int(), ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(PluginIDCore, ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(uuid.New(), ua.Good, time.Now(), 0, time.Now(), 0),
+		p.ctx,
+	)
+	changes := func() []ua.ModelChangeStructureDataType {
+		if mi.queue.Len() != 1 {
+			t.Fatalf("expected 1 event, got %d", mi.queue.Len())
+		}
+		fields := mi.queue.PopFront().([]ua.Variant)
+		if fields[1] != ua.ObjectTypeIDGeneralModelChangeEventType {
+			t.Errorf("unexpected event type %v", fields[1])
+		}
+		res := []ua.ModelChangeStructureDataType{}
+		for _, c := range fields[8].([]ua.ExtensionObject) {
+			res = append(res, c.(ua.ModelChangeStructureDataType))
+		}
+		return res
+	}
+
+	if err := p.AddNode(p.rootNode, node); err != nil {
+		t.Fatal(err)
+	}
+	added := changes()
+	if len(added) != 2 || added[0].Affected != node.GetNodeID() || added[0].Verb != uint8(ua.ModelChangeStructureVerbMaskNodeAdded) ||
+		added[1].Affected != p.rootNode.GetNodeID() || added[1].Verb != uint8(ua.ModelChangeStructureVerbMaskReferenceAdded) {
+		t.Errorf("unexpected changes %+v", added)
+	}
+
+	if err := p.RemoveNode(node); err != nil {
+		t.Fatal(err)
+	}
+	deleted := changes()
+	if len(deleted) != 2 || deleted[1].Affected != node.GetNodeID() || deleted[1].Verb != uint8(ua.ModelChangeStructureVerbMaskNodeDeleted) {
+		t.Errorf("unexpected changes %+v", deleted)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	p := newTestProjectManager(t)
+	if err := p.ImportWithPrefix(NewDefaultJsonProject(p.ctx), "Site1"); err != nil {
+		t.Fatal(err)
+	}
+	project, err := p.GetProject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "project.json")
+	if err := project.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := NewJsonProjectFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := p.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := NewJsonProjectFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("invalid json %s: %v", buf.Bytes(), err)
+	}
+
+	// the properties of a node are in no particular order.
+	var sortProperties func(n *JsonObjectNode)
+	sortProperties = func(n *JsonObjectNode) {
+		sort.Slice(n.Properties, func(i, j int) bool { return n.Properties[i].BrowseName.Name < n.Properties[j].BrowseName.Name })
+		for _, child := range n.Childs {
+			sortProperties(child)
+		}
+	}
+	sortProperties(saved.Root)
+	sortProperties(streamed.Root)
+	if !reflect.DeepEqual(saved, streamed) {
+		t.Errorf("expected streamed project to equal saved project, got %s", buf.Bytes())
+	}
+}
+
+func TestImportTagsCSV(t *testing.T) {
+	p := newTestProjectManager(t)
+	csv := `name,address,dataType,scaling
+Tag1,40001,Int16,
+Tag2, 40002, Float,"x*0.1"
+Tag3,40003
+Tag.4,40004,Int16,
+Tag1,40005,Int16,
+`
+	created, errs := p.ImportTagsCSV(p.rootNode, strings.NewReader(csv))
+	if created != 2 {
+		t.Errorf("expected 2 tags, got %d", created)
+	}
+	// a row with too few fields, an invalid name and a duplicate name.
+	for _, line := range []string{"line 4", "line 5", "line 6"} {
+		if errs[line] == nil {
+			t.Errorf("expected error on %s", line)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+
+	tag := p.rootNode.First(func(child *ObjectNode) bool { return child.GetBrowseName().Name == "Tag2" })
+	if tag == nil {
+		t.Fatal("expected Tag2 below the parent")
+	}
+	if tag.GetNodeType() != NodeTypeTag || tag.GetDisplayName().Text != "Tag2" {
+		t.Errorf("unexpected tag %s", tag.GetNodeID())
+	}
+	for name, value := range map[string]string{"Address": "40002", "DataType": "Float", "Scaling": "x*0.1"} {
+		if prop, ok := tag.GetProperty(name); !ok || prop.GetValue().Value != value {
+			t.Errorf("expected %s to be %q", name, value)
+		}
+	}
+
+	if created, errs := p.ImportTagsCSV(&ObjectNode{}, strings.NewReader(csv)); created != 0 || errs["parent"] != ErrNodeTypeNotAccepted {
+		t.Errorf("expected parent to reject tags, got %d %v", created, errs)
+	}
+}
+
+// failingPlugin is the plugin of an entry node that cannot connect to its device.
+type failingPlugin struct {
+	corePlugin
+	err error
+}
+
+func (f failingPlugin) Start(entryNode *ObjectNode) error { return f.err }
+func (f failingPlugin) Stop(entryNode *ObjectNode) error  { return nil }
+
+func TestPluginStartError(t *testing.T) {
+	p := newTestProjectManager(t)
+	errs := make(chan *PluginError, 1)
+	p.SetPluginErrorHandler(func(e *PluginError) { errs <- e })
+	node := newTestEntryNode()
+	node.plugin = failingPlugin{err: errors.New("connection refused")}
+	node.entry = true
+	p.entryNodes.Add(node)
+
+	p.onLoadPlugins(context.Background())
+	select {
+	case e := <-errs:
+		if e.NodeID != node.GetNodeID() || e.Operation != PluginOperationStart || e.Err.Error() != "connection refused" {
+			t.Errorf("unexpected error %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the failure to start the plugin to be reported")
+	}
+	if s := node.CommunicationStatus(); s != CommunicationStatusBad {
+		t.Errorf("expected CommunicationStatus %s, got %s", CommunicationStatusBad, s)
+	}
+	if errs := p.PluginErrors(); len(errs) != 1 || errs[0].NodeID != node.GetNodeID() {
+		t.Errorf("expected the failure as a warning of the project, got %v", errs)
+	}
+
+	// the failure is cleared when the plugin starts.
+	node.plugin = failingPlugin{}
+	p.reportPlugin(node, PluginOperationStart, node.GetPlugin().Start(node))
+	if errs := p.PluginErrors(); len(errs) != 0 {
+		t.Errorf("expected no warnings, got %v", errs)
+	}
+}
+
+// hungPlugin heartbeats until it hangs, and until it is started again.
+type hungPlugin struct {
+	corePlugin
+	sync.Mutex
+	hung      bool
+	heartbeat time.Time
+	starts    chan struct{}
+}
+
+func (h *hungPlugin) Start(entryNode *ObjectNode) error {
+	h.Lock()
+	h.hung = false
+	h.heartbeat = time.Now()
+	h.Unlock()
+	h.starts <- struct{}{}
+	return nil
+}
+
+func (h *hungPlugin) Stop(entryNode *ObjectNode) error { return nil }
+
+func (h *hungPlugin) LastHeartbeat(entryNode *ObjectNode) time.Time {
+	h.Lock()
+	defer h.Unlock()
+	if !h.hung {
+		h.heartbeat = time.Now()
+	}
+	return h.heartbeat
+}
+
+func TestPluginWatchdog(t *testing.T) {
+	p := newTestProjectManager(t)
+	plugin := &hungPlugin{starts: make(chan struct{}, 10)}
+	node := newTestEntryNode()
+	node.plugin = plugin
+	node.entry = true
+	p.entryNodes.Add(node)
+	p.onLoadPlugins(context.Background())
+	<-plugin.starts
+
+	p.SetWatchdogInterval(20 * time.Millisecond)
+	defer p.SetWatchdogInterval(0)
+	select {
+	case <-plugin.starts:
+		t.Fatal("expected a plugin that heartbeats not to be restarted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	plugin.Lock()
+	plugin.hung = true
+	plugin.Unlock()
+	select {
+	case <-plugin.starts:
+	case <-time.After(time.Second):
+		t.Fatal("expected a plugin that stopped heartbeating to be restarted")
+	}
+	if n := p.PluginRestarts()[node.GetNodeID()]; n < 1 {
+		t.Errorf("expected the restart to be counted, got %d", n)
+	}
+}
+
+// slowPlugin takes a while to connect to its device, and records the number of plugins starting at the same time.
+type slowPlugin struct {
+	corePlugin
+	sync.Mutex
+	wg       sync.WaitGroup
+	starting int
+	max      int
+}
+
+func (s *slowPlugin) Start(entryNode *ObjectNode) error {
+	defer s.wg.Done()
+	s.Lock()
+	s.starting++
+	if s.starting > s.max {
+		s.max = s.starting
+	}
+	s.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	s.Lock()
+	s.starting--
+	s.Unlock()
+	return nil
+}
+
+func TestPluginStartLimit(t *testing.T) {
+	p := newTestProjectManager(t)
+	p.SetPluginStartLimit(4)
+	plugin := &slowPlugin{}
+	for i := 0; i < 50; i++ {
+		node := newTestEntryNode()
+		node.NodeId = ua.NewNodeIDNumeric(DefaultNameSpace, uint32(i+1))
+		node.plugin = plugin
+		node.entry = true
+		p.entryNodes.Add(node)
+	}
+	plugin.wg.Add(50)
+	p.onLoadPlugins(context.Background())
+	plugin.wg.Wait()
+	if plugin.max > 4 {
+		t.Errorf("expected at most 4 plugins starting at the same time, got %d", plugin.max)
+	}
+	if plugin.max < 2 {
+		t.Errorf("expected plugins to start concurrently, got %d", plugin.max)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+const (
+	// the version of the UADP message mapping.
+	uadpVersion byte = 1
+	// UADPFlags
+	uadpFlagPublisherID       byte = 0x10
+	uadpFlagGroupHeader       byte = 0x20
+	uadpFlagPayloadHeader     byte = 0x40
+	uadpFlagExtendedFlags1    byte = 0x80
+	uadpPublisherIDUInt16     byte = 0x01
+	uadpExtendedFlagTimestamp byte = 0x20
+	// GroupFlags
+	uadpGroupFlagWriterGroupID  byte = 0x01
+	uadpGroupFlagSequenceNumber byte = 0x08
+	// DataSetFlags1
+	uadpDataSetFlagValid          byte = 0x01
+	uadpDataSetFlagDataValue      byte = 0x04
+	uadpDataSetFlagSequenceNumber byte = 0x08
+	// the default interval for publishing the data set.
+	defaultPubSubPublishingInterval = 1 * time.Second
+)
+
+// PubSubConfig configures a PubSubPublisher.
+type PubSubConfig struct {
+	// Address of the UDP multicast group, in the form opc.udp://[host]:[port]
+	Address string
+	// PublisherID identifies the server to the subscribers.
+	PublisherID uint16
+	// WriterGroupID of the writer group sending the NetworkMessages.
+	WriterGroupID uint16
+	// DataSetWriterID of the writer sending the DataSetMessages.
+	DataSetWriterID uint16
+	// PublishingInterval of the writer group. (default: 1 sec)
+	PublishingInterval time.Duration
+	// PublishedDataSet lists the variables published as the fields of the data set.
+	PublishedDataSet []ua.NodeID
+	// Roles used to read the published data set. (default: Observer)
+	Roles []ua.NodeID
+}
+
+// PubSubPublisher periodically publishes a data set as a UADP NetworkMessage over UDP.
+type PubSubPublisher struct {
+	srv            *UAServer
+	config         PubSubConfig
+	conn           net.Conn
+	ctx            context.Context
+	sequenceNumber uint16
+	closeCh        chan struct{}
+	closed         sync.Once
+}
+
+// NewPubSubPublisher starts publishing the data set, until the server or publisher is closed.
+func NewPubSubPublisher(srv *UAServer, config PubSubConfig) (*PubSubPublisher, error) {
+	addr, err := url.Parse(config.Address)
+	if err != nil || addr.Scheme != "opc.udp" || addr.Host == "" {
+		return nil, ua.BadTCPEndpointURLInvalid
+	}
+	if len(config.PublishedDataSet) == 0 {
+		return nil, ua.BadNothingToDo
+	}
+	if config.PublishingInterval <= 0 {
+		config.PublishingInterval = defaultPubSubPublishingInterval
+	}
+	if config.Roles == nil {
+		config.Roles = []ua.NodeID{ua.ObjectIDWellKnownRoleObserver}
+	}
+	conn, err := net.Dial("udp", addr.Host)
+	if err != nil {
+		return nil, ua.BadResourceUnavailable
+	}
+	p := &PubSubPublisher{
+		srv:     srv,
+		config:  config,
+		conn:    conn,
+		ctx:     context.WithValue(context.Background(), SessionKey, &Session{server: srv, userRoles: config.Roles}),
+		closeCh: make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Close stops publishing.
+func (p *PubSubPublisher) Close() {
+	p.closed.Do(func() {
+		close(p.closeCh)
+	})
+}
+
+func (p *PubSubPublisher) run() {
+	ticker := time.NewTicker(p.config.PublishingInterval)
+	defer ticker.Stop()
+	defer p.conn.Close()
+	for {
+		if err := p.publish(); err != nil {
+			p.srv.Logger().Warnf("Error publishing to '%s'. %s", p.config.Address, err)
+		}
+		select {
+		case <-p.closeCh:
+			return
+		case <-p.srv.closing:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish reads the data set and sends it as a NetworkMessage.
+func (p *PubSubPublisher) publish() error {
+	fields := make([]ua.DataValue, len(p.config.PublishedDataSet))
+	for i, id := range p.config.PublishedDataSet {
+		fields[i] = p.srv.readValue(p.ctx, ua.ReadValueID{NodeID: id, AttributeID: ua.AttributeIDValue})
+	}
+	p.sequenceNumber++
+	b, err := encodeNetworkMessage(p.config, p.sequenceNumber, time.Now(), fields)
+	if err != nil {
+		return err
+	}
+	_, err = p.conn.Write(b)
+	return err
+}
+
+// encodeNetworkMessage encodes a UADP NetworkMessage with one DataSetMessage, a key frame with DataValue fields.
+func encodeNetworkMessage(config PubSubConfig, sequenceNumber uint16, timestamp time.Time, fields []ua.DataValue) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := ua.NewBinaryEncoder(&buf, ua.NewEncodingContext())
+	// network message header
+	enc.WriteByte(uadpVersion | uadpFlagPublisherID | uadpFlagGroupHeader | uadpFlagPayloadHeader | uadpFlagExtendedFlags1)
+	enc.WriteByte(uadpPublisherIDUInt16 | uadpExtendedFlagTimestamp)
+	enc.WriteUInt16(config.PublisherID)
+	// group header
+	enc.WriteByte(uadpGroupFlagWriterGroupID | uadpGroupFlagSequenceNumber)
+	enc.WriteUInt16(config.WriterGroupID)
+	enc.WriteUInt16(sequenceNumber)
+	// payload header
+	enc.WriteByte(1)
+	enc.WriteUInt16(config.DataSetWriterID)
+	// extended network message header
+	enc.WriteDateTime(timestamp)
+	// data set message
+	enc.WriteByte(uadpDataSetFlagValid | uadpDataSetFlagDataValue | uadpDataSetFlagSequenceNumber)
+	enc.WriteUInt16(sequenceNumber)
+	enc.WriteUInt16(uint16(len(fields)))
+	for _, f := range fields {
+		if err := enc.WriteDataValue(f); err != nil {
+			return nil, ua.BadEncodingError
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// networkMessage holds the fields of a UADP NetworkMessage, as encoded by encodeNetworkMessage.
+type networkMessage struct {
+	flags, extendedFlags1 byte
+	publisherID           uint16
+	groupFlags            byte
+	writerGroupID         uint16
+	sequenceNumber        uint16
+	dataSetWriterIDs      []uint16
+	timestamp             time.Time
+	dataSetFlags1         byte
+	dataSetSequenceNumber uint16
+	fields                []ua.DataValue
+}
+
+func decodeNetworkMessage(t *testing.T, b []byte) networkMessage {
+	t.Helper()
+	var m networkMessage
+	dec := ua.NewBinaryDecoder(bytes.NewReader(b), ua.NewEncodingContext())
+	var count byte
+	var fieldCount uint16
+	for _, err := range []error{
+		dec.ReadByte(&m.flags),
+		dec.ReadByte(&m.extendedFlags1),
+		dec.ReadUInt16(&m.publisherID),
+		dec.ReadByte(&m.groupFlags),
+		dec.ReadUInt16(&m.writerGroupID),
+		dec.ReadUInt16(&m.sequenceNumber),
+		dec.ReadByte(&count),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.dataSetWriterIDs = make([]uint16, count)
+	for i := range m.dataSetWriterIDs {
+		if err := dec.ReadUInt16(&m.dataSetWriterIDs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, err := range []error{
+		dec.ReadDateTime(&m.timestamp),
+		dec.ReadByte(&m.dataSetFlags1),
+		dec.ReadUInt16(&m.dataSetSequenceNumber),
+		dec.ReadUInt16(&fieldCount),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.fields = make([]ua.DataValue, fieldCount)
+	for i := range m.fields {
+		if err := dec.ReadDataValue(&m.fields[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestPubSubPublisher(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	pub, err := NewPubSubPublisher(srv, PubSubConfig{
+		Address:            "opc.udp://" + l.LocalAddr().String(),
+		PublisherID:        7,
+		WriterGroupID:      100,
+		DataSetWriterID:    200,
+		PublishingInterval: 10 * time.Millisecond,
+		PublishedDataSet:   []ua.NodeID{testVariableID, ua.NewNodeIDString(1, "Unknown")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+
+	buf := make([]byte, 1500)
+	l.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := uint16(1); i <= 2; i++ {
+		n, _, err := l.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := decodeNetworkMessage(t, buf[:n])
+		if m.flags != 0xF1 || m.extendedFlags1 != 0x21 {
+			t.Errorf("unexpected flags %#x %#x", m.flags, m.extendedFlags1)
+		}
+		if m.publisherID != 7 || m.writerGroupID != 100 || len(m.dataSetWriterIDs) != 1 || m.dataSetWriterIDs[0] != 200 {
+			t.Errorf("unexpected ids %+v", m)
+		}
+		if m.sequenceNumber != i || m.dataSetSequenceNumber != i {
+			t.Errorf("expected sequence number %d, got %d", i, m.sequenceNumber)
+		}
+		if m.timestamp.IsZero() {
+			t.Error("expected timestamp")
+		}
+		if len(m.fields) != 2 {
+			t.Fatalf("expected 2 fields, got %d", len(m.fields))
+		}
+		if m.fields[0].Value != float64(42) || m.fields[0].StatusCode != ua.Good {
+			t.Errorf("unexpected field %+v", m.fields[0])
+		}
+		if m.fields[1].StatusCode != ua.BadNodeIDUnknown {
+			t.Errorf("expected %s, got %s", ua.BadNodeIDUnknown, m.fields[1].StatusCode)
+		}
+	}
+
+	if _, err := NewPubSubPublisher(srv, PubSubConfig{Address: "opc.tcp://127.0.0.1:4840", PublishedDataSet: []ua.NodeID{testVariableID}}); err != ua.BadTCPEndpointURLInvalid {
+		t.Errorf("expected %s, got %v", ua.BadTCPEndpointURLInvalid, err)
+	}
+}
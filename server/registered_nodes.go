@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// the length of the key of the handles of a session.
+const registeredNodesKeyLength = 8
+
+// registeredNodes are the nodes registered by a session. The handle of a registered node is an opaque NodeID of
+// the key of the session, the index of the slot of the node and the generation of the slot, so that Read and Write
+// of a handle skip the lookup in the namespace. A handle is released when the node is unregistered, or deleted from
+// the namespace, and a released slot is reused with the next generation.
+type registeredNodes struct {
+	sync.RWMutex
+	m     *NamespaceManager
+	key   []byte
+	slots []registeredSlot
+	free  []uint32
+	ids   map[ua.NodeID]uint32
+}
+
+// registeredSlot is a registered node, its NodeID when registered and the generation of the slot.
+type registeredSlot struct {
+	node Node
+	id   ua.NodeID
+	gen  uint32
+}
+
+// add registers the node, and returns its handle. A node registered twice has the same handle.
+func (r *registeredNodes) add(m *NamespaceManager, node Node) ua.NodeID {
+	id := node.GetNodeID()
+	m.trackRegistrations(r)
+	r.Lock()
+	defer r.Unlock()
+	if r.ids == nil {
+		r.key = getNextNonce(registeredNodesKeyLength)
+		r.ids = make(map[ua.NodeID]uint32)
+		r.m = m
+	}
+	i, ok := r.ids[id]
+	if !ok {
+		if n := len(r.free); n > 0 {
+			i, r.free = r.free[n-1], r.free[:n-1]
+		} else {
+			i = uint32(len(r.slots))
+			r.slots = append(r.slots, registeredSlot{})
+		}
+		r.slots[i].node, r.slots[i].id = node, id
+		r.ids[id] = i
+	}
+	handle := make([]byte, registeredNodesKeyLength+8)
+	copy(handle, r.key)
+	binary.LittleEndian.PutUint32(handle[registeredNodesKeyLength:], i)
+	binary.LittleEndian.PutUint32(handle[registeredNodesKeyLength+4:], r.slots[i].gen)
+	return ua.NewNodeIDOpaque(id.GetNamespaceIndex(), ua.ByteString(handle))
+}
+
+// slot returns the index of the slot of the handle, if the handle is current.
+func (r *registeredNodes) slot(handle ua.NodeID) (uint32, bool) {
+	h, ok := handle.(ua.NodeIDOpaque)
+	if !ok || len(h.ID) != registeredNodesKeyLength+8 || string(h.ID[:registeredNodesKeyLength]) != string(r.key) {
+		return 0, false
+	}
+	i := binary.LittleEndian.Uint32([]byte(h.ID[registeredNodesKeyLength:]))
+	gen := binary.LittleEndian.Uint32([]byte(h.ID[registeredNodesKeyLength+4:]))
+	if int(i) >= len(r.slots) || r.slots[i].node == nil || r.slots[i].gen != gen {
+		return 0, false
+	}
+	return i, true
+}
+
+// find returns the node of the handle.
+func (r *registeredNodes) find(handle ua.NodeID) (Node, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	i, ok := r.slot(handle)
+	if !ok {
+		return nil, false
+	}
+	return r.slots[i].node, true
+}
+
+// remove unregisters the node of the handle, and returns whether it was registered.
+func (r *registeredNodes) remove(handle ua.NodeID) bool {
+	r.Lock()
+	defer r.Unlock()
+	i, ok := r.slot(handle)
+	if !ok {
+		return false
+	}
+	r.release(i)
+	return true
+}
+
+// invalidate releases the handle of the node with the NodeID, since the node is deleted or its NodeID changed.
+func (r *registeredNodes) invalidate(id ua.NodeID) {
+	r.Lock()
+	defer r.Unlock()
+	if i, ok := r.ids[id]; ok {
+		r.release(i)
+	}
+}
+
+// release frees the slot for the next generation.
+func (r *registeredNodes) release(i uint32) {
+	delete(r.ids, r.slots[i].id)
+	r.slots[i] = registeredSlot{gen: r.slots[i].gen + 1}
+	r.free = append(r.free, i)
+}
+
+// Clear unregisters all nodes.
+func (r *registeredNodes) Clear() {
+	r.Lock()
+	m := r.m
+	r.m, r.key, r.slots, r.free, r.ids = nil, nil, nil, nil, nil
+	r.Unlock()
+	if m != nil {
+		m.untrackRegistrations(r)
+	}
+}
+
+// Len returns the number of registered nodes.
+func (r *registeredNodes) Len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.ids)
+}
+
+// trackRegistrations adds the nodes registered by a session, to invalidate when nodes are deleted.
+func (m *NamespaceManager) trackRegistrations(r *registeredNodes) {
+	m.registrationsLock.Lock()
+	defer m.registrationsLock.Unlock()
+	m.registrations[r] = struct{}{}
+}
+
+// untrackRegistrations removes the nodes registered by a session.
+func (m *NamespaceManager) untrackRegistrations(r *registeredNodes) {
+	m.registrationsLock.Lock()
+	defer m.registrationsLock.Unlock()
+	delete(m.registrations, r)
+}
+
+// invalidateRegistrations releases the handles of the node in every session.
+func (m *NamespaceManager) invalidateRegistrations(id ua.NodeID) {
+	m.registrationsLock.Lock()
+	defer m.registrationsLock.Unlock()
+	for r := range m.registrations {
+		r.invalidate(id)
+	}
+}
+
+// findNode returns the node with the given NodeID, or of the handle registered by the session of the request.
+func (srv *UAServer) findNode(ctx context.Context, id ua.NodeID) (Node, bool) {
+	if session, ok := ctx.Value(SessionKey).(*Session); ok {
+		if n, ok := session.registeredNodes.find(id); ok {
+			return n, true
+		}
+	}
+	return srv.NamespaceManager().FindNode(id)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestRegisterNodes(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	unknownID := ua.NewNodeIDString(1, "Unknown")
+	req := &ua.RegisterNodesRequest{
+		RequestHeader:   ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		NodesToRegister: []ua.NodeID{testVariableID, unknownID},
+	}
+	if err := srv.handleRegisterNodes(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	reg, ok := res.(*ua.RegisterNodesResponse)
+	if !ok || len(reg.RegisteredNodeIDs) != 2 || reg.RegisteredNodeIDs[0] == testVariableID || reg.RegisteredNodeIDs[1] != unknownID {
+		t.Fatalf("unexpected response %+v", res)
+	}
+	if n := session.registeredNodes.Len(); n != 1 {
+		t.Errorf("expected 1 registered node, got %d", n)
+	}
+
+	ctx = context.WithValue(context.Background(), SessionKey, session)
+	id := ua.ReadValueID{NodeID: reg.RegisteredNodeIDs[0], AttributeID: ua.AttributeIDValue}
+	if v := srv.readValue(ctx, id); v.StatusCode != ua.Good {
+		t.Errorf("expected registered node to be read, got %s", v.StatusCode)
+	}
+	// the NodeID is still valid, and the handle is valid only in the session.
+	if v := srv.readValue(ctx, ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}); v.StatusCode != ua.Good {
+		t.Errorf("expected registered node to be read by its NodeID, got %s", v.StatusCode)
+	}
+	other := newTestSession(t, srv, ctx, ch)
+	if _, ok := other.registeredNodes.find(id.NodeID); ok {
+		t.Error("expected the handle to be unknown in another session")
+	}
+
+	// deleting another node keeps the handle, deleting the registered node releases it.
+	m := srv.NamespaceManager()
+	o, _ := m.FindNode(testObjectID)
+	m.DeleteNode(o, false)
+	if v := srv.readValue(ctx, id); v.StatusCode != ua.Good {
+		t.Errorf("expected registered node to be read after another node is deleted, got %s", v.StatusCode)
+	}
+	n, _ := m.FindNode(testVariableID)
+	m.DeleteNode(n, false)
+	if v := srv.readValue(ctx, id); v.StatusCode != ua.BadNodeIDUnknown {
+		t.Errorf("expected %s, got %s", ua.BadNodeIDUnknown, v.StatusCode)
+	}
+	if n := session.registeredNodes.Len(); n != 0 {
+		t.Errorf("expected the handle of the deleted node to be released, got %d", n)
+	}
+}
+
+func BenchmarkReadRegistered(b *testing.B) {
+	srv, ctx := newTestServer(b, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	id := ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}
+	b.Run("Unregistered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			srv.readValue(ctx, id)
+		}
+	})
+	session := ctx.Value(SessionKey).(*Session)
+	n, _ := srv.NamespaceManager().FindNode(testVariableID)
+	id.NodeID = session.registeredNodes.add(srv.NamespaceManager(), n)
+	b.Run("Registered", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			srv.readValue(ctx, id)
+		}
+	})
+}
+
+func TestUnregisterNodes(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	srv.handleRegisterNodes(ch.serverSecureChannel, 1, &ua.RegisterNodesRequest{
+		RequestHeader:   ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		NodesToRegister: []ua.NodeID{testVariableID, testObjectID, testMethodID},
+	})
+	res, _ := ch.WaitResponse(1, time.Second)
+	handles := res.(*ua.RegisterNodesResponse).RegisteredNodeIDs
+	if n := session.registeredNodes.Len(); n != 3 {
+		t.Fatalf("expected 3 registered nodes, got %d", n)
+	}
+
+	req := &ua.UnregisterNodesRequest{
+		RequestHeader:     ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		NodesToUnregister: []ua.NodeID{handles[0], ua.NewNodeIDString(1, "Unknown")},
+	}
+	if err := srv.handleUnregisterNodes(ch.serverSecureChannel, 2, req); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := ch.WaitResponse(2, time.Second); res == nil {
+		t.Fatal("expected a response")
+	}
+	if _, ok := session.registeredNodes.find(handles[0]); ok {
+		t.Error("expected unregistered node to be released")
+	}
+	if n := session.registeredNodes.Len(); n != 2 {
+		t.Errorf("expected 2 registered nodes, got %d", n)
+	}
+
+	// the released slot is reused, and the old handle stays unknown.
+	n, _ := srv.NamespaceManager().FindNode(testVariableID)
+	if h := session.registeredNodes.add(srv.NamespaceManager(), n); h == handles[0] {
+		t.Error("expected a new handle for the node registered again")
+	}
+	if _, ok := session.registeredNodes.find(handles[0]); ok {
+		t.Error("expected the old handle to stay unknown")
+	}
+	session.registeredNodes.remove(handles[0])
+	if n := session.registeredNodes.Len(); n != 3 {
+		t.Errorf("expected 3 registered nodes, got %d", n)
+	}
+	for _, id := range handles {
+		session.registeredNodes.remove(id)
+	}
+	if n := session.registeredNodes.Len(); n != 1 {
+		t.Errorf("expected the node registered again to remain, got %d", n)
+	}
+
+	srv.SessionManager().Delete(session)
+	if n := session.registeredNodes.Len(); n != 0 {
+		t.Errorf("expected closed session to release its registered nodes, got %d", n)
+	}
+	if _, ok := srv.NamespaceManager().registrations[&session.registeredNodes]; ok {
+		t.Error("expected the namespace to forget the registered nodes of the closed session")
+	}
+}
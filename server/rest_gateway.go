@@ -0,0 +1,123 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// APIKeyHeader is the http header carrying the API key of a REST request.
+const APIKeyHeader = "X-API-Key"
+
+// RESTHandler returns a http.Handler that reads and writes the value of variables:
+//
+//	GET /nodes/{nodeid}/value
+//	PUT /nodes/{nodeid}/value
+//
+// The nodeid is path escaped, e.g. /nodes/ns=2;s=Demo.Temperature/value. Values are encoded as the JSON of ua.DataValue.
+// Requests are authenticated by an API key configured with WithAPIKeys. Mount the handler on a http.Server using TLS.
+func (srv *UAServer) RESTHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nodeID, ok := parseValuePath(r.URL)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		session, ok := srv.authenticateAPIKey(r)
+		if !ok {
+			writeJSONStatus(w, http.StatusUnauthorized, ua.BadIdentityTokenRejected)
+			return
+		}
+		ctx := context.WithValue(r.Context(), SessionKey, session)
+		switch r.Method {
+		case http.MethodGet:
+			dv := srv.readValue(ctx, ua.ReadValueID{NodeID: nodeID, AttributeID: ua.AttributeIDValue})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(httpStatus(dv.StatusCode))
+			json.NewEncoder(w).Encode(dv)
+		case http.MethodPut:
+			var dv ua.DataValue
+			if err := json.NewDecoder(r.Body).Decode(&dv); err != nil {
+				writeJSONStatus(w, http.StatusBadRequest, ua.BadDecodingError)
+				return
+			}
+			result := srv.writeValue(ctx, ua.WriteValue{NodeID: nodeID, AttributeID: ua.AttributeIDValue, Value: dv})
+			writeJSONStatus(w, httpStatus(result), result)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// parseValuePath returns the NodeID of a path in the form /nodes/{nodeid}/value.
+func parseValuePath(u *url.URL) (ua.NodeID, bool) {
+	p := u.EscapedPath()
+	if !strings.HasPrefix(p, "/nodes/") || !strings.HasSuffix(p, "/value") {
+		return nil, false
+	}
+	s, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(p, "/nodes/"), "/value"))
+	if err != nil || s == "" {
+		return nil, false
+	}
+	nodeID := ua.ParseNodeIDString(s)
+	if nodeID == nil {
+		return nil, false
+	}
+	return nodeID, true
+}
+
+// authenticateAPIKey returns a session with the roles of the user mapped to the API key of the request.
+func (srv *UAServer) authenticateAPIKey(r *http.Request) (*Session, bool) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, false
+	}
+	srv.RLock()
+	userName, ok := srv.apiKeys[key]
+	rp := srv.rolesProvider
+	srv.RUnlock()
+	if !ok || rp == nil {
+		return nil, false
+	}
+	roles, err := rp.GetRoles(ua.UserNameIdentity{UserName: userName}, "", "https://"+r.Host)
+	if err != nil {
+		return nil, false
+	}
+	return &Session{server: srv, userIdentity: ua.UserNameIdentity{UserName: userName}, userRoles: roles}, true
+}
+
+// httpStatus returns the http status for the result of reading or writing a value.
+func httpStatus(code ua.StatusCode) int {
+	switch code {
+	case ua.BadNodeIDUnknown, ua.BadNodeIDInvalid, ua.BadAttributeIDInvalid:
+		return http.StatusNotFound
+	case ua.BadUserAccessDenied, ua.BadNotReadable, ua.BadNotWritable:
+		return http.StatusForbidden
+	case ua.BadTypeMismatch, ua.BadOutOfRange, ua.BadWriteNotSupported:
+		return http.StatusBadRequest
+	case ua.BadCommunicationError, ua.BadNoCommunication, ua.BadDeviceFailure, ua.BadServerNotConnected:
+		return http.StatusBadGateway
+	case ua.BadTimeout:
+		return http.StatusGatewayTimeout
+	}
+	if code.IsBad() {
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+// writeJSONStatus writes the status code as JSON.
+func writeJSONStatus(w http.ResponseWriter, httpStatus int, code ua.StatusCode) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(struct {
+		Status ua.StatusCode `json:"status"`
+	}{code})
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func newTestRESTHandler(t *testing.T, permissions ua.PermissionType) (*UAServer, http.Handler) {
+	srv, _ := newTestServer(t, permissions)
+	srv.rolesProvider = NewRulesBasedRolesProvider(DefaultIdentityMappingRules)
+	srv.apiKeys = map[string]string{"secret": "dashboard"}
+	return srv, srv.RESTHandler()
+}
+
+func TestRESTRead(t *testing.T) {
+	_, h := newTestRESTHandler(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+
+	req := httptest.NewRequest(http.MethodGet, "/nodes/ns=1;s=Variable/value", nil)
+	req.Header.Set(APIKeyHeader, "secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var dv ua.DataValue
+	if err := json.Unmarshal(rec.Body.Bytes(), &dv); err != nil {
+		t.Fatal(err)
+	}
+	if dv.Value != float64(42) || dv.StatusCode != ua.Good || dv.SourceTimestamp.IsZero() {
+		t.Errorf("unexpected value %+v", dv)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/nodes/ns=1;s=Unknown/value", nil)
+	req.Header.Set(APIKeyHeader, "secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestRESTWrite(t *testing.T) {
+	srv, h := newTestRESTHandler(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+
+	req := httptest.NewRequest(http.MethodPut, "/nodes/ns=1;s=Variable/value", strings.NewReader(`{"value":{"type":11,"body":43.5}}`))
+	req.Header.Set(APIKeyHeader, "secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	if v := n.GetValue().Value; v != float64(43.5) {
+		t.Errorf("expected value 43.5, got %v", v)
+	}
+}
+
+func TestRESTPermissionDenied(t *testing.T) {
+	srv, h := newTestRESTHandler(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+
+	req := httptest.NewRequest(http.MethodPut, "/nodes/ns=1;s=Variable/value", strings.NewReader(`{"value":{"type":11,"body":43.5}}`))
+	req.Header.Set(APIKeyHeader, "secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	if v := n.GetValue().Value; v != float64(42) {
+		t.Errorf("expected value unchanged, got %v", v)
+	}
+
+	for _, key := range []string{"", "wrong"} {
+		req = httptest.NewRequest(http.MethodGet, "/nodes/ns=1;s=Variable/value", nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d for key %q, got %d", http.StatusUnauthorized, key, rec.Code)
+		}
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	cases := []struct {
+		code ua.StatusCode
+		want int
+	}{
+		{ua.Good, http.StatusOK},
+		{ua.GoodClamped, http.StatusOK},
+		{ua.UncertainLastUsableValue, http.StatusOK},
+		{ua.BadNodeIDUnknown, http.StatusNotFound},
+		{ua.BadUserAccessDenied, http.StatusForbidden},
+		{ua.BadTypeMismatch, http.StatusBadRequest},
+		{ua.BadCommunicationError, http.StatusBadGateway},
+		{ua.BadTimeout, http.StatusGatewayTimeout},
+		{ua.BadInternalError, http.StatusInternalServerError},
+		{ua.BadConfigurationError, http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		if got := httpStatus(c.code); got != c.want {
+			t.Errorf("httpStatus(%s) = %d, want %d", c.code, got, c.want)
+		}
+	}
+}
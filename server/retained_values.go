@@ -0,0 +1,101 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// SnapshotValues writes the current value of every retained variable to the file configured with WithRetainedValues.
+// Variables of namespace 0 and variables whose value is owned by a plugin are not retained.
+func (srv *UAServer) SnapshotValues() error {
+	srv.RLock()
+	path := srv.retainedValuesPath
+	srv.RUnlock()
+	if path == "" {
+		return nil
+	}
+	values := map[string]ua.DataValue{}
+	for _, n := range srv.NamespaceManager().variables() {
+		if !isRetained(n) {
+			continue
+		}
+		values[n.GetNodeID().String()] = n.GetValue()
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first, so a crash never leaves a partial snapshot.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RestoreValues sets the value of each retained variable from the file configured with WithRetainedValues.
+// Call after the project is loaded. Variables that no longer exist are skipped.
+func (srv *UAServer) RestoreValues() error {
+	srv.RLock()
+	path := srv.retainedValuesPath
+	srv.RUnlock()
+	if path == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	values := map[string]ua.DataValue{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	nm := srv.NamespaceManager()
+	for id, v := range values {
+		nodeID := ua.ParseNodeIDString(id)
+		if nodeID == nil {
+			continue
+		}
+		n, ok := nm.FindVariable(nodeID)
+		if !ok || !isRetained(n) {
+			continue
+		}
+		n.SetValue(v)
+	}
+	return nil
+}
+
+// isRetained returns true if the value of the variable is retained across restarts.
+// Values read from a handler, or owned by a plugin other than the core plugin, are overwritten by their owner.
+func isRetained(n *VariableNode) bool {
+	if n.GetNodeID().GetNamespaceIndex() == 0 || n.ReadValueHandler != nil {
+		return false
+	}
+	if owner := n.Owner(); owner != nil {
+		if p := owner.GetPlugin(); p != nil && p.GetId() != PluginIDCore {
+			return false
+		}
+	}
+	return true
+}
+
+// variables returns the variable nodes of the namespace.
+func (m *NamespaceManager) variables() []*VariableNode {
+	m.RLock()
+	defer m.RUnlock()
+	list := make([]*VariableNode, 0, len(m.nodes))
+	for _, n := range m.nodes {
+		if v, ok := n.(*VariableNode); ok {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestSnapshotRestoreValues(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	srv.retainedValuesPath = filepath.Join(t.TempDir(), "values.json")
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	ts := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	n.SetValue(ua.NewDataValue(float64(7.5), ua.UncertainLastUsableValue, ts, 0, ts, 0))
+
+	handled := NewVariableNode(
+		ua.NewNodeIDString(1, "Handled"),
+		ua.NewQualifiedName(1, "Handled"),
+		ua.NewLocalizedText("Handled", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{},
+		ua.NewDataValue(int32(1), 0, ts, 0, ts, 0),
+		ua.DataTypeIDInt32,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		-1,
+		false,
+		nil,
+	)
+	handled.ReadValueHandler = func(context.Context, ua.ReadValueID) ua.DataValue {
+		return ua.NewDataValue(int32(1), 0, time.Now(), 0, time.Now(), 0)
+	}
+	srv.NamespaceManager().AddNode(handled)
+
+	if err := srv.SnapshotValues(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a restart, where the project file resets the values.
+	n.SetValue(ua.NewDataValue(float64(0), 0, time.Now(), 0, time.Now(), 0))
+	handled.SetValue(ua.NewDataValue(int32(2), 0, time.Now(), 0, time.Now(), 0))
+	if err := srv.RestoreValues(); err != nil {
+		t.Fatal(err)
+	}
+
+	v := n.GetValue()
+	if v.Value != float64(7.5) || v.StatusCode != ua.UncertainLastUsableValue || !v.SourceTimestamp.Equal(ts) {
+		t.Errorf("expected retained value, got %+v", v)
+	}
+	if v := handled.GetValue().Value; v != int32(2) {
+		t.Errorf("expected value of handled variable not restored, got %v", v)
+	}
+
+	// without a file, nothing is retained.
+	srv.retainedValuesPath = ""
+	if err := srv.SnapshotValues(); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.RestoreValues(); err != nil {
+		t.Fatal(err)
+	}
+}
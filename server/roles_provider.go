@@ -3,6 +3,7 @@ package server
 import (
 	"crypto/sha1"
 	"fmt"
+	"time"
 
 	"github.com/afs/server/pkg/opcua/ua"
 )
@@ -200,3 +201,57 @@ func (p *RulesBasedRolesProvider) GetRoles(userIdentity interface{}, application
 	}
 	return roles, nil
 }
+
+// initializeRoleSet publishes the identity mapping rules of the well-known roles found in
+// Server/ServerCapabilities/RoleSet, so clients may read the role configuration.
+func (srv *UAServer) initializeRoleSet() {
+	p, ok := srv.rolesProvider.(*RulesBasedRolesProvider)
+	if !ok {
+		return
+	}
+	nm := srv.NamespaceManager()
+	for _, rule := range p.identityMappingRules {
+		role, ok := nm.FindObject(rule.NodeID)
+		if !ok {
+			continue
+		}
+		identities := make([]ua.ExtensionObject, len(rule.Identities))
+		for i, identity := range rule.Identities {
+			identities[i] = identity
+		}
+		applications := rule.Applications
+		if applications == nil {
+			applications = []string{}
+		}
+		endpoints := make([]ua.ExtensionObject, len(rule.Endpoints))
+		for i, ep := range rule.Endpoints {
+			endpoints[i] = ua.EndpointType{
+				EndpointURL:         ep.EndpointUrl,
+				SecurityMode:        parseMessageSecurityMode(ep.SecurityMode),
+				SecurityPolicyURI:   ep.SecurityPolicyURI,
+				TransportProfileURI: ep.TransportProfileUri,
+			}
+		}
+		for name, value := range map[string]interface{}{
+			"0:Identities":          identities,
+			"0:Applications":        applications,
+			"0:ApplicationsExclude": rule.ApplicationsExclude,
+			"0:Endpoints":           endpoints,
+			"0:EndpointsExclude":    rule.EndpointsExclude,
+		} {
+			if n, ok := nm.FindProperty(role, ua.ParseQualifiedName(name)); ok {
+				n.SetValue(ua.NewDataValue(value, 0, time.Now(), 0, time.Now(), 0))
+			}
+		}
+	}
+}
+
+// parseMessageSecurityMode returns the MessageSecurityMode with the given name.
+func parseMessageSecurityMode(s string) ua.MessageSecurityMode {
+	for _, mode := range []ua.MessageSecurityMode{ua.MessageSecurityModeNone, ua.MessageSecurityModeSign, ua.MessageSecurityModeSignAndEncrypt} {
+		if mode.String() == s {
+			return mode
+		}
+	}
+	return ua.MessageSecurityModeInvalid
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func rolePermissionsFor(role ua.NodeID) []ua.RolePermissionType {
+	for _, rp := range DefaultRolePermissions {
+		if rp.RoleID == role {
+			return []ua.RolePermissionType{rp}
+		}
+	}
+	return nil
+}
+
+func TestDefaultRolePermissions(t *testing.T) {
+	observer := rolePermissionsFor(ua.ObjectIDWellKnownRoleObserver)
+	if !IsUserPermitted(observer, ua.PermissionTypeBrowse) || !IsUserPermitted(observer, ua.PermissionTypeRead) {
+		t.Error("expected Observer to be permitted to Browse and Read")
+	}
+	if IsUserPermitted(observer, ua.PermissionTypeWrite) {
+		t.Error("expected Observer not to be permitted to Write")
+	}
+	operator := rolePermissionsFor(ua.ObjectIDWellKnownRoleOperator)
+	if !IsUserPermitted(operator, ua.PermissionTypeWrite) {
+		t.Error("expected Operator to be permitted to Write")
+	}
+}
+
+func TestInitializeRoleSet(t *testing.T) {
+	srv := &UAServer{
+		rolesProvider: NewRulesBasedRolesProvider(DefaultIdentityMappingRules),
+	}
+	srv.namespaceManager = NewNamespaceManager(srv)
+	if err := srv.namespaceManager.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	srv.initializeRoleSet()
+
+	nm := srv.NamespaceManager()
+	roleSet, ok := nm.FindObject(ua.ObjectIDServerServerCapabilitiesRoleSet)
+	if !ok {
+		t.Fatal("expected RoleSet node")
+	}
+	for _, role := range []ua.NodeID{
+		ua.ObjectIDWellKnownRoleAnonymous,
+		ua.ObjectIDWellKnownRoleAuthenticatedUser,
+		ua.ObjectIDWellKnownRoleObserver,
+		ua.ObjectIDWellKnownRoleOperator,
+		ua.ObjectIDWellKnownRoleEngineer,
+		ua.ObjectIDWellKnownRoleSecurityAdmin,
+	} {
+		found := false
+		for _, r := range roleSet.GetReferences() {
+			if !r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDOrganizes && ua.ToNodeID(r.TargetID, nm.NamespaceUris()) == role {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected RoleSet to organize role %s", role)
+		}
+	}
+
+	observer, ok := nm.FindObject(ua.ObjectIDWellKnownRoleObserver)
+	if !ok {
+		t.Fatal("expected Observer role node")
+	}
+	n, ok := nm.FindProperty(observer, ua.ParseQualifiedName("0:Identities"))
+	if !ok {
+		t.Fatal("expected Identities property")
+	}
+	identities, ok := n.GetValue().Value.([]ua.ExtensionObject)
+	if !ok || len(identities) != 1 {
+		t.Fatalf("expected one identity, got %v", n.GetValue().Value)
+	}
+	if rule, ok := identities[0].(ua.IdentityMappingRuleType); !ok || rule.CriteriaType != ua.IdentityCriteriaTypeAuthenticatedUser {
+		t.Errorf("expected AuthenticatedUser criteria, got %v", identities[0])
+	}
+}
@@ -1,12 +1,14 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"math"
 
 	"github.com/Eun/go-convert"
 	"github.com/afs/server/pkg/eris"
 	"github.com/afs/server/pkg/msg"
+	"github.com/afs/server/pkg/opcua/ua"
 )
 
 const (
@@ -67,13 +69,15 @@ func ReadLinearScale(value interface{}, scaledDT IDataType, rawLow, rawHigh, sca
 		return nil, err
 	}
 
+	// the scaled range may be inverted.
+	low, high := math.Min(scaledLow, scaledHigh), math.Max(scaledLow, scaledHigh)
 	scaledValue := (valuef64-rawLow)*readScaleFactor + scaledLow
-	if clampLow && scaledValue < scaledLow {
-		scaledValue = scaledLow
+	if clampLow && scaledValue < low {
+		scaledValue = low
 	}
 
-	if clamHigh && scaledValue > scaledHigh {
-		scaledValue = scaledHigh
+	if clamHigh && scaledValue > high {
+		scaledValue = high
 	}
 
 	if negateValue {
@@ -92,11 +96,13 @@ func WriteLinearScale(value interface{}, scaledDT IDataType, rawLow, rawHigh, sc
 	if negateValue {
 		valuef64 = valuef64 * -1
 	}
-	if clampLow && valuef64 < scaledLow {
-		valuef64 = scaledLow
+	// the scaled range may be inverted.
+	low, high := math.Min(scaledLow, scaledHigh), math.Max(scaledLow, scaledHigh)
+	if clampLow && valuef64 < low {
+		valuef64 = low
 	}
-	if clamHigh && valuef64 > scaledHigh {
-		valuef64 = scaledHigh
+	if clamHigh && valuef64 > high {
+		valuef64 = high
 	}
 
 	scaledValue := (valuef64-scaledLow)*writeScaleFactor + rawLow
@@ -236,3 +242,100 @@ func ValidateScaling(rawLow, rawHigh, scaledLow, scaledHigh float64, scaledDataT
 	}
 	return fieldErrors
 }
+
+// SetScalingBehavior converts the raw value of the variable to the engineering range when read, and a value
+// in the engineering range to raw when written, before calling the WriteValueHandler of the plugin. The ranges
+// are the RawLow, RawHigh, EngLow and EngHigh properties of the variable, in the namespace of the variable.
+// An inverted range, where EngLow > EngHigh, is supported. If the optional ClampToRange property is true, values
+// outside a range are limited to the range. Only numeric scalar values are scaled. The scaled value is a Double, and
+// a written value is rounded to the DataType of the variable if it is an integer type.
+func (m *NamespaceManager) SetScalingBehavior(node *VariableNode) error {
+	ns := node.GetNodeID().GetNamespaceIndex()
+	properties := make([]*VariableNode, 4)
+	for i, name := range []string{"RawLow", "RawHigh", "EngLow", "EngHigh"} {
+		prop, ok := m.FindProperty(node, ua.NewQualifiedName(ns, name))
+		if !ok {
+			return ua.BadNodeIDUnknown
+		}
+		properties[i] = prop
+	}
+	clampNode, hasClamp := m.FindProperty(node, ua.NewQualifiedName(ns, "ClampToRange"))
+	scaledDT, err := NewDataType("Double")
+	if err != nil {
+		return err
+	}
+	rawDT, isInteger := numericDataType(node.GetDataType())
+	if rawDT == nil {
+		rawDT = scaledDT
+	}
+	// ranges returns the raw and engineering ranges, and whether to clamp.
+	ranges := func() (rawLow, rawHigh, engLow, engHigh float64, clamp bool, ok bool) {
+		values := make([]float64, len(properties))
+		for i, prop := range properties {
+			if values[i], ok = toFloat64(prop.GetValue().Value); !ok {
+				return
+			}
+		}
+		if hasClamp {
+			clamp, _ = clampNode.GetValue().Value.(bool)
+		}
+		return values[0], values[1], values[2], values[3], clamp, values[0] != values[1] && values[2] != values[3]
+	}
+
+	node.Lock()
+	read, write := node.ReadValueHandler, node.WriteValueHandler
+	node.ReadValueHandler = func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		var result ua.DataValue
+		if read != nil {
+			result = read(ctx, req)
+		} else {
+			result = readRange(node.GetValue(), req.IndexRange)
+		}
+		if v, ok := toFloat64(result.Value); ok {
+			if rawLow, rawHigh, engLow, engHigh, clamp, ok := ranges(); ok {
+				factor := GetReadScaleFactor(SCALE_TYPE_LINEAR, rawLow, rawHigh, engLow, engHigh)
+				if scaled, err := ReadLinearScale(v, scaledDT, rawLow, rawHigh, engLow, engHigh, factor, clamp, clamp, false); err == nil {
+					result.Value = scaled
+				}
+			}
+		}
+		return result
+	}
+	node.WriteValueHandler = func(ctx context.Context, req ua.WriteValue) (ua.DataValue, ua.StatusCode) {
+		if v, ok := toFloat64(req.Value.Value); ok {
+			rawLow, rawHigh, engLow, engHigh, clamp, ok := ranges()
+			if !ok {
+				return ua.NilDataValue, ua.BadConfigurationError
+			}
+			factor := GetWriteScaleFactor(SCALE_TYPE_LINEAR, rawLow, rawHigh, engLow, engHigh)
+			raw, err := WriteLinearScale(v, scaledDT, rawLow, rawHigh, engLow, engHigh, factor, clamp, clamp, false)
+			if err != nil {
+				return ua.NilDataValue, ua.BadTypeMismatch
+			}
+			if isInteger {
+				raw = math.Round(raw.(float64))
+			}
+			if raw, err = rawDT.Convert(raw); err != nil {
+				return ua.NilDataValue, ua.BadOutOfRange
+			}
+			req.Value.Value = raw
+		}
+		if write != nil {
+			return write(ctx, req)
+		}
+		return writeRange(node.GetValue(), req.Value, req.IndexRange, m.server.now())
+	}
+	node.Unlock()
+	return nil
+}
+
+// numericDataType returns the data type of the numeric DataType, and whether it is an integer type.
+func numericDataType(dataType ua.NodeID) (IDataType, bool) {
+	for _, name := range []string{"byte", "sbyte", "uint16", "uint32", "uint64", "int16", "int32", "int64", "float", "double"} {
+		dt, err := NewDataType(name)
+		if err == nil && dt.GetNodeID() == dataType {
+			return dt, name != "float" && name != "double"
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// addScaledVariable adds a variable with the raw value and the scaling properties, and sets its scaling behavior.
+func addScaledVariable(t *testing.T, srv *UAServer, raw ua.Variant, dataType ua.NodeID, properties map[string]ua.Variant) *VariableNode {
+	nm := srv.NamespaceManager()
+	id := ua.NewNodeIDString(1, "Flow")
+	var refs []ua.Reference
+	var nodes []Node
+	for name, value := range properties {
+		propID := ua.NewNodeIDString(1, "Flow."+name)
+		refs = append(refs, ua.NewReference(ua.ReferenceTypeIDHasProperty, false, ua.NewExpandedNodeID(propID)))
+		nodes = append(nodes, NewVariableNode(
+			propID,
+			ua.NewQualifiedName(1, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(id))},
+			ua.NewDataValue(value, 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			-1,
+			false,
+			nil,
+		))
+	}
+	node := NewVariableNode(
+		id,
+		ua.NewQualifiedName(1, "Flow"),
+		ua.NewLocalizedText("Flow", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		refs,
+		ua.NewDataValue(raw, 0, time.Now(), 0, time.Now(), 0),
+		dataType,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		-1,
+		false,
+		nil,
+	)
+	if err := nm.AddNodes(append(nodes, node)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := nm.SetScalingBehavior(node); err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestScaling(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		properties map[string]ua.Variant
+		raw        float64
+		eng        float64
+		write      float64
+		written    float64
+	}{
+		{
+			name:       "normal",
+			properties: map[string]ua.Variant{"RawLow": float64(0), "RawHigh": float64(1000), "EngLow": float64(0), "EngHigh": float64(100)},
+			raw:        250,
+			eng:        25,
+			write:      75,
+			written:    750,
+		},
+		{
+			name:       "inverted",
+			properties: map[string]ua.Variant{"RawLow": float64(0), "RawHigh": float64(1000), "EngLow": float64(100), "EngHigh": float64(0)},
+			raw:        250,
+			eng:        75,
+			write:      10,
+			written:    900,
+		},
+		{
+			name:       "unclamped",
+			properties: map[string]ua.Variant{"RawLow": float64(0), "RawHigh": float64(1000), "EngLow": float64(0), "EngHigh": float64(100), "ClampToRange": false},
+			raw:        1500,
+			eng:        150,
+			write:      -10,
+			written:    -100,
+		},
+		{
+			name:       "clamped",
+			properties: map[string]ua.Variant{"RawLow": float64(0), "RawHigh": float64(1000), "EngLow": float64(0), "EngHigh": float64(100), "ClampToRange": true},
+			raw:        1500,
+			eng:        100,
+			write:      -10,
+			written:    0,
+		},
+		{
+			name:       "clamped inverted",
+			properties: map[string]ua.Variant{"RawLow": float64(0), "RawHigh": float64(1000), "EngLow": float64(100), "EngHigh": float64(0), "ClampToRange": true},
+			raw:        -500,
+			eng:        100,
+			write:      150,
+			written:    0,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+			node := addScaledVariable(t, srv, c.raw, ua.DataTypeIDDouble, c.properties)
+			if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: node.GetNodeID(), AttributeID: ua.AttributeIDValue}); dv.StatusCode != ua.Good || dv.Value != c.eng {
+				t.Errorf("expected value %v, got %v (%s)", c.eng, dv.Value, dv.StatusCode)
+			}
+			wv := ua.WriteValue{NodeID: node.GetNodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(c.write, 0, time.Time{}, 0, time.Time{}, 0)}
+			if result := srv.writeValue(ctx, wv); result != ua.Good {
+				t.Fatalf("expected %s, got %s", ua.Good, result)
+			}
+			if v := node.GetValue().Value; v != c.written {
+				t.Errorf("expected raw value %v, got %v", c.written, v)
+			}
+		})
+	}
+}
+
+func TestScalingIntegerTypes(t *testing.T) {
+	properties := map[string]ua.Variant{"RawLow": float64(0), "RawHigh": float64(100), "EngLow": float64(0), "EngHigh": float64(1000)}
+	for _, c := range []struct {
+		dataType ua.NodeID
+		raw      ua.Variant
+		eng      float64
+		write    ua.Variant
+		written  ua.Variant
+	}{
+		{ua.DataTypeIDInt16, int16(25), 250, int16(755), int16(76)},
+		{ua.DataTypeIDInt32, int32(-25), -250, int32(124), int32(12)},
+		{ua.DataTypeIDUInt16, uint16(100), 1000, uint16(5), uint16(1)},
+		{ua.DataTypeIDFloat, float32(25), 250, float32(75), float32(7.5)},
+	} {
+		t.Run(c.dataType.String(), func(t *testing.T) {
+			srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+			node := addScaledVariable(t, srv, c.raw, c.dataType, properties)
+			if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: node.GetNodeID(), AttributeID: ua.AttributeIDValue}); dv.StatusCode != ua.Good || dv.Value != c.eng {
+				t.Errorf("expected value %v, got %v (%s)", c.eng, dv.Value, dv.StatusCode)
+			}
+			// the raw value written is rounded to the DataType of the variable.
+			wv := ua.WriteValue{NodeID: node.GetNodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(c.write, 0, time.Time{}, 0, time.Time{}, 0)}
+			if result := srv.writeValue(ctx, wv); result != ua.Good {
+				t.Fatalf("expected %s, got %s", ua.Good, result)
+			}
+			if v := node.GetValue().Value; v != c.written {
+				t.Errorf("expected raw value %#v, got %#v", c.written, v)
+			}
+		})
+	}
+
+	// a raw value outside the range of the DataType is not written.
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	node := addScaledVariable(t, srv, int16(0), ua.DataTypeIDInt16, map[string]ua.Variant{"RawLow": float64(0), "RawHigh": float64(100000), "EngLow": float64(0), "EngHigh": float64(100)})
+	wv := ua.WriteValue{NodeID: node.GetNodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(int16(50), 0, time.Time{}, 0, time.Time{}, 0)}
+	if result := srv.writeValue(ctx, wv); result != ua.BadOutOfRange {
+		t.Errorf("expected %s, got %s", ua.BadOutOfRange, result)
+	}
+}
+
+func TestScalingRequiresProperties(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	node, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	if err := srv.NamespaceManager().SetScalingBehavior(node); err != ua.BadNodeIDUnknown {
+		t.Errorf("expected %s, got %v", ua.BadNodeIDUnknown, err)
+	}
+}
@@ -22,10 +22,16 @@ type Scheduler struct {
 	cancellationCh      chan struct{}
 	tickers             map[time.Duration]*PollGroup
 	minSamplingInterval time.Duration
+	samplingPhases      int
 }
 
 func NewScheduler(server *UAServer) *Scheduler {
-	s := &Scheduler{sync.Mutex{}, server.closing, make(map[time.Duration]*PollGroup), time.Duration(server.ServerCapabilities().MinSupportedSampleRate) * time.Millisecond}
+	s := &Scheduler{
+		cancellationCh:      server.closing,
+		tickers:             make(map[time.Duration]*PollGroup),
+		minSamplingInterval: time.Duration(server.ServerCapabilities().MinSupportedSampleRate) * time.Millisecond,
+		samplingPhases:      server.samplingPhases,
+	}
 	return s
 }
 
@@ -38,24 +44,43 @@ func (s *Scheduler) GetPollGroup(interval time.Duration) *PollGroup {
 	if t, ok := s.tickers[interval]; ok {
 		return t
 	}
-	t := NewPollGroup(interval, s.cancellationCh)
+	t := newPollGroup(interval, s.samplingPhases, s.cancellationCh)
 	s.tickers[interval] = t
 	return t
 }
 
+// PollGroup polls its listeners every interval. The listeners are spread over the phases of the interval, so they
+// are not all polled at the same tick.
 type PollGroup struct {
 	sync.Mutex
 	cancellationCh chan struct{}
 	interval       time.Duration
-	subs           map[PollListener]struct{}
+	phases         []map[PollListener]struct{}
+	subs           map[PollListener]int
 }
 
 func NewPollGroup(interval time.Duration, cancellationCh chan struct{}) *PollGroup {
+	return newPollGroup(interval, 1, cancellationCh)
+}
+
+// newPollGroup returns a PollGroup polling the listeners of one of the phases every interval/phases. The phases
+// are limited, so a phase is at least a millisecond.
+func newPollGroup(interval time.Duration, phases int, cancellationCh chan struct{}) *PollGroup {
+	if max := int(interval / time.Millisecond); phases > max {
+		phases = max
+	}
+	if phases < 1 {
+		phases = 1
+	}
 	b := &PollGroup{
 		Mutex:          sync.Mutex{},
 		cancellationCh: cancellationCh,
 		interval:       interval,
-		subs:           map[PollListener]struct{}{},
+		phases:         make([]map[PollListener]struct{}, phases),
+		subs:           map[PollListener]int{},
+	}
+	for i := range b.phases {
+		b.phases[i] = map[PollListener]struct{}{}
 	}
 	go b.run()
 	// log.Printf("Opening PollGroup %d ms\n", b.interval.Nanoseconds()/1000000)
@@ -63,7 +88,8 @@ func NewPollGroup(interval time.Duration, cancellationCh chan struct{}) *PollGro
 }
 
 func (b *PollGroup) run() {
-	ticker := time.NewTicker(b.interval)
+	ticker := time.NewTicker(b.interval / time.Duration(len(b.phases)))
+	phase := 0
 	for {
 		select {
 		case <-b.cancellationCh:
@@ -73,33 +99,54 @@ func (b *PollGroup) run() {
 			for sub := range b.subs {
 				delete(b.subs, sub)
 			}
+			for i := range b.phases {
+				b.phases[i] = map[PollListener]struct{}{}
+			}
 			b.Unlock()
 			return
 		case <-ticker.C:
-			b.Lock()
-			listeners := make([]PollListener, len(b.subs))
-			i := 0
-			for sub := range b.subs {
-				listeners[i] = sub
-				i++
-			}
-			b.Unlock()
-			for _, listener := range listeners {
-				listener.Poll()
-			}
+			b.poll(phase)
+			phase = (phase + 1) % len(b.phases)
 		}
 	}
 }
 
-func (b *PollGroup) Subscribe(listener PollListener) {
+// poll polls the listeners of the phase.
+func (b *PollGroup) poll(phase int) {
 	b.Lock()
-	b.subs[listener] = struct{}{}
+	listeners := make([]PollListener, 0, len(b.phases[phase]))
+	for sub := range b.phases[phase] {
+		listeners = append(listeners, sub)
+	}
 	b.Unlock()
+	for _, listener := range listeners {
+		listener.Poll()
+	}
+}
+
+// Subscribe adds the listener to the phase with the fewest listeners.
+func (b *PollGroup) Subscribe(listener PollListener) {
+	b.Lock()
+	defer b.Unlock()
+	if _, ok := b.subs[listener]; ok {
+		return
+	}
+	phase := 0
+	for i := range b.phases {
+		if len(b.phases[i]) < len(b.phases[phase]) {
+			phase = i
+		}
+	}
+	b.phases[phase][listener] = struct{}{}
+	b.subs[listener] = phase
 }
 
 func (b *PollGroup) Unsubscribe(listener PollListener) {
 	b.Lock()
-	delete(b.subs, listener)
+	if phase, ok := b.subs[listener]; ok {
+		delete(b.phases[phase], listener)
+		delete(b.subs, listener)
+	}
 	b.Unlock()
 }
 
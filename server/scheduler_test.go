@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// countListener counts its polls.
+type countListener struct{ polls int }
+
+func (l *countListener) Poll() { l.polls++ }
+
+func TestPollGroupPhases(t *testing.T) {
+	closing := make(chan struct{})
+	defer close(closing)
+	b := newPollGroup(time.Hour, 4, closing)
+	listeners := make([]*countListener, 10)
+	for i := range listeners {
+		listeners[i] = &countListener{}
+		b.Subscribe(listeners[i])
+	}
+	b.Subscribe(listeners[0])
+	b.Unsubscribe(listeners[9])
+	for i, phase := range b.phases {
+		if n := len(phase); n < 2 || n > 3 {
+			t.Errorf("phase %d: expected 2 or 3 listeners, got %d", i, n)
+		}
+	}
+
+	// each listener is polled once in an interval.
+	for phase := range b.phases {
+		b.poll(phase)
+	}
+	for i, l := range listeners[:9] {
+		if l.polls != 1 {
+			t.Errorf("listener %d: expected 1 poll, got %d", i, l.polls)
+		}
+	}
+	if listeners[9].polls != 0 {
+		t.Errorf("expected no poll of the unsubscribed listener, got %d", listeners[9].polls)
+	}
+
+	// a phase is at least a millisecond.
+	if b := newPollGroup(2*time.Millisecond, 10, closing); len(b.phases) != 2 {
+		t.Errorf("expected 2 phases of 1ms, got %d", len(b.phases))
+	}
+}
+
+// readListener reads the test variable, as a monitored item samples its node.
+type readListener struct {
+	srv *UAServer
+	ctx context.Context
+}
+
+func (l *readListener) Poll() {
+	l.srv.readValue(l.ctx, ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue})
+}
+
+// BenchmarkPollGroupPhases samples 10k items once per interval, and reports the longest tick. Spreading the items
+// over the phases of the interval reduces the longest tick, while the time per interval remains the same.
+func BenchmarkPollGroupPhases(b *testing.B) {
+	srv, ctx := newTestServer(b, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	for _, phases := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("phases=%d", phases), func(b *testing.B) {
+			closing := make(chan struct{})
+			defer close(closing)
+			g := newPollGroup(time.Hour, phases, closing)
+			for i := 0; i < 10000; i++ {
+				g.Subscribe(&readListener{srv: srv, ctx: ctx})
+			}
+			var peak time.Duration
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for phase := range g.phases {
+					start := time.Now()
+					g.poll(phase)
+					if d := time.Since(start); d > peak {
+						peak = d
+					}
+				}
+			}
+			b.ReportMetric(float64(peak.Microseconds()), "peak-us/tick")
+		})
+	}
+}
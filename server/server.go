@@ -4,15 +4,18 @@ import (
 	"context"
 	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
 	_ "embed"
 	"log"
 	"net"
 	"net/url"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/afs/server/pkg/opcua/ua"
 	"github.com/gammazero/workerpool"
+	"github.com/sirupsen/logrus"
 )
 
 type key string
@@ -20,6 +23,10 @@ type key string
 const (
 	// SessionKey stores the current session in context
 	SessionKey key = "opcua-session"
+	// maxAgeKey stores the MaxAge of the current Read request in context
+	maxAgeKey key = "opcua-max-age"
+	// rangeWriteKey stores the rangeWrite of the index range writes of the current Write request in context
+	rangeWriteKey key = "opcua-range-write"
 	// documents the version of binary protocol that this library supports.
 	protocolVersion uint32 = 0
 	// the default size of the send and recieve buffers.
@@ -34,10 +41,26 @@ const (
 	defaultMaxSessionCount uint32 = 0
 	// the default number of subscriptions that may be active.
 	defaultMaxSubscriptionCount uint32 = 0
+	// the default number of Publish requests that may be queued for a session.
+	defaultMaxPublishRequestsPerSession uint32 = 64
 	// the default number of worker threads that may be created.
 	defaultMaxWorkerThreads int = 4
 	// the length of nonce in bytes.
 	nonceLength int = 32
+	// the default limit on the length of the password of a UserNameIdentityToken, in bytes.
+	defaultMaxPasswordLength uint32 = 64
+	// the default limit on the number of references returned for a node by Browse or BrowseNext.
+	defaultMaxReferencesPerNode uint32 = 1000
+	// the default limit on the length of the BrowseName of an ObjectNode, in characters.
+	defaultMaxBrowseNameLength int = 128
+	// the default limit on the length of the DisplayName of an ObjectNode, in characters.
+	defaultMaxDisplayNameLength int = 256
+	// the timeout for dialing the reverse-connect endpoint of a client.
+	defaultReverseConnectTimeout = 10 * time.Second
+	// the delay before retrying a reverse connection, doubled after each failed attempt.
+	minReverseConnectDelay = 1 * time.Second
+	// the limit on the delay before retrying a reverse connection.
+	maxReverseConnectDelay = 30 * time.Second
 )
 
 var (
@@ -50,14 +73,19 @@ type UAServer struct {
 	sync.RWMutex
 	localDescription                   ua.ApplicationDescription
 	endpoints                          []ua.EndpointDescription
+	endpointConfigs                    []EndpointConfig
 	sessionTimeout                     float64
+	idleTimeout                        time.Duration
 	maxSessionCount                    uint32
 	maxSubscriptionCount               uint32
 	serverCapabilities                 *ua.ServerCapabilities
 	buildInfo                          ua.BuildInfo
 	certPath                           string
 	keyPath                            string
+	generateCertificate                bool
 	trustedCertsPath                   string
+	rejectedCertsPath                  string
+	trustLock                          sync.RWMutex
 	endpointURL                        string
 	suppressCertificateExpired         bool
 	suppressCertificateChainIncomplete bool
@@ -87,8 +115,31 @@ type UAServer struct {
 	serverDiagnosticsSummary           *ua.ServerDiagnosticsSummaryDataType
 	scheduler                          *Scheduler
 	historian                          HistoryReadWriter
+	eventHistory                       *EventHistory
+	eventReplay                        *eventReplay
+	minEventSeverity                   uint16
+	samplingPhases                     int
+	projectManager                     *ProjectManager
+	clock                              Clock
+	logger                             Logger
+	faultLogThrottle                   *logThrottle
+	retiredServiceCounters             map[string]ua.ServiceCounterDataType
+	webSocketEndpointURL               string
+	webSocketTLSConfig                 *tls.Config
+	apiKeys                            map[string]string
+	retainedValuesPath                 string
+	writeConfirmation                  bool
+	minPasswordLength                  uint32
+	maxPasswordLength                  uint32
+	maxReferencesPerNode               uint32
+	maxBrowseNameLength                int
+	maxDisplayNameLength               int
+	maxNestingDepth                    int
+	maxPublishRequestsPerSession       uint32
+	defaultLocale                      string
 	allowAnonymousIdentity             bool
 	allowSecurityPolicyNone            bool
+	discoveryEndpoint                  bool
 	userNameIdentityAuthenticator      UserNameIdentityAuthenticator
 	x509IdentityAuthenticator          X509IdentityAuthenticator
 	issuedIdentityAuthenticator        IssuedIdentityAuthenticator
@@ -126,10 +177,21 @@ func New(localDescription ua.ApplicationDescription, certPath, keyPath, endpoint
 		listeners:                          make([]net.Listener, 0, 3),
 		serverUris:                         []string{localDescription.ApplicationURI},
 		state:                              ua.ServerStateUnknown,
-		startTime:                          time.Now(),
 		serverDiagnosticsSummary:           &ua.ServerDiagnosticsSummaryDataType{},
 		rolesProvider:                      NewRulesBasedRolesProvider(DefaultIdentityMappingRules),
 		rolePermissions:                    DefaultRolePermissions,
+		discoveryEndpoint:                  true,
+		maxPasswordLength:                  defaultMaxPasswordLength,
+		defaultLocale:                      DefaultLocale,
+		maxReferencesPerNode:               defaultMaxReferencesPerNode,
+		maxBrowseNameLength:                defaultMaxBrowseNameLength,
+		maxDisplayNameLength:               defaultMaxDisplayNameLength,
+		maxNestingDepth:                    ua.DefaultMaxNestingDepth,
+		maxPublishRequestsPerSession:       defaultMaxPublishRequestsPerSession,
+		logger:                             logrus.StandardLogger(),
+		faultLogThrottle:                   newLogThrottle(defaultLogThrottleInterval),
+		clock:                              realClock{},
+		generateCertificate:                true,
 	}
 
 	// apply each option to the default
@@ -138,6 +200,7 @@ func New(localDescription ua.ApplicationDescription, certPath, keyPath, endpoint
 			return nil, err
 		}
 	}
+	srv.startTime = srv.now()
 
 	srv.workerpool = workerpool.New(srv.maxWorkerThreads)
 	srv.channelManager = NewChannelManager(srv)
@@ -146,6 +209,25 @@ func New(localDescription ua.ApplicationDescription, certPath, keyPath, endpoint
 	srv.namespaceManager = NewNamespaceManager(srv)
 	srv.scheduler = NewScheduler(srv)
 
+	if srv.generateCertificate {
+		_, certErr := os.Stat(srv.certPath)
+		_, keyErr := os.Stat(srv.keyPath)
+		switch {
+		case os.IsNotExist(certErr) && os.IsNotExist(keyErr):
+			if err := createCertificate(srv.localDescription.ApplicationURI, srv.localDescription.ApplicationName.Text, srv.endpointURL, srv.certPath, srv.keyPath); err != nil {
+				log.Printf("Error creating x509 key pair. %s\n", err)
+				return nil, err
+			}
+		case os.IsNotExist(certErr):
+			// a key without its certificate is not replaced.
+			log.Printf("Error loading x509 key pair. %s\n", certErr)
+			return nil, certErr
+		case os.IsNotExist(keyErr):
+			// a certificate without its key is not replaced.
+			log.Printf("Error loading x509 key pair. %s\n", keyErr)
+			return nil, keyErr
+		}
+	}
 	cert, err := tls.LoadX509KeyPair(srv.certPath, srv.keyPath)
 	if err != nil {
 		log.Printf("Error loading x509 key pair. %s\n", err)
@@ -175,6 +257,33 @@ func (srv *UAServer) LocalCertificate() []byte {
 	return srv.localCertificate
 }
 
+// SetCertificate replaces the certificate and private key of the local application, e.g. before the certificate
+// expires. Secure channels opened from now on, and the endpoints returned by GetEndpoints, use the new
+// certificate. Open secure channels, and the sessions on them, keep the certificate they were opened with until
+// the channel is closed. The certificate must be DER encoded.
+func (srv *UAServer) SetCertificate(cert []byte, key *rsa.PrivateKey) error {
+	crt, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return ua.BadCertificateInvalid
+	}
+	if pub, ok := crt.PublicKey.(*rsa.PublicKey); !ok || key == nil || pub.N.Cmp(key.N) != 0 || pub.E != key.E {
+		return ua.BadCertificateInvalid
+	}
+	srv.Lock()
+	srv.localCertificate = cert
+	srv.localPrivateKey = key
+	srv.endpoints = nil
+	srv.Unlock()
+	return nil
+}
+
+// localKeyPair gets the certificate and private key of the local application.
+func (srv *UAServer) localKeyPair() ([]byte, *rsa.PrivateKey) {
+	srv.RLock()
+	defer srv.RUnlock()
+	return srv.localCertificate, srv.localPrivateKey
+}
+
 // EndpointURL gets the endpoint url.
 func (srv *UAServer) EndpointURL() string {
 	srv.RLock()
@@ -184,10 +293,10 @@ func (srv *UAServer) EndpointURL() string {
 
 // Endpoints gets the endpoint descriptions.
 func (srv *UAServer) Endpoints() []ua.EndpointDescription {
-	srv.RLock()
-	defer srv.RUnlock()
+	srv.Lock()
+	defer srv.Unlock()
 	if srv.endpoints == nil {
-		srv.endpoints = srv.buildEndpointDescriptions()
+		srv.endpoints = srv.buildWebSocketEndpointDescriptions(srv.buildEndpointDescriptions())
 	}
 	return srv.endpoints
 }
@@ -275,6 +384,13 @@ func (srv *UAServer) Scheduler() *Scheduler {
 	return srv.scheduler
 }
 
+// Logger gets the Logger.
+func (srv *UAServer) Logger() Logger {
+	srv.RLock()
+	defer srv.RUnlock()
+	return srv.logger
+}
+
 // Historian gets the HistoryReadWriter.
 func (srv *UAServer) Historian() HistoryReadWriter {
 	srv.RLock()
@@ -282,6 +398,20 @@ func (srv *UAServer) Historian() HistoryReadWriter {
 	return srv.historian
 }
 
+// EventHistory gets the EventHistory, or nil if events are not stored.
+func (srv *UAServer) EventHistory() *EventHistory {
+	srv.RLock()
+	defer srv.RUnlock()
+	return srv.eventHistory
+}
+
+// IdleTimeout gets the duration that a connection may be idle before being closed by the server.
+func (srv *UAServer) IdleTimeout() time.Duration {
+	srv.RLock()
+	defer srv.RUnlock()
+	return srv.idleTimeout
+}
+
 // MaxSessionCount gets the maximum number of sessions.
 func (srv *UAServer) MaxSessionCount() uint32 {
 	srv.RLock()
@@ -289,6 +419,16 @@ func (srv *UAServer) MaxSessionCount() uint32 {
 	return srv.maxSessionCount
 }
 
+// MaxNestingDepth gets the maximum depth of nested values that may be decoded from a request.
+func (srv *UAServer) MaxNestingDepth() int {
+	srv.RLock()
+	defer srv.RUnlock()
+	if srv.maxNestingDepth == 0 {
+		return ua.DefaultMaxNestingDepth
+	}
+	return srv.maxNestingDepth
+}
+
 // MaxSubscriptionCount gets the maximum number of subscriptions.
 func (srv *UAServer) MaxSubscriptionCount() uint32 {
 	srv.RLock()
@@ -296,6 +436,37 @@ func (srv *UAServer) MaxSubscriptionCount() uint32 {
 	return srv.maxSubscriptionCount
 }
 
+// MaxPublishRequestsPerSession gets the maximum number of Publish requests queued for a session.
+func (srv *UAServer) MaxPublishRequestsPerSession() uint32 {
+	srv.RLock()
+	defer srv.RUnlock()
+	if srv.maxPublishRequestsPerSession == 0 {
+		return defaultMaxPublishRequestsPerSession
+	}
+	return srv.maxPublishRequestsPerSession
+}
+
+// MaxBrowseNameLength gets the maximum length of the BrowseName of an ObjectNode, in characters. Zero is unlimited.
+func (srv *UAServer) MaxBrowseNameLength() int {
+	if srv == nil {
+		return defaultMaxBrowseNameLength
+	}
+	srv.RLock()
+	defer srv.RUnlock()
+	return srv.maxBrowseNameLength
+}
+
+// MaxDisplayNameLength gets the maximum length of the DisplayName of an ObjectNode, in characters. Zero is
+// unlimited.
+func (srv *UAServer) MaxDisplayNameLength() int {
+	if srv == nil {
+		return defaultMaxDisplayNameLength
+	}
+	srv.RLock()
+	defer srv.RUnlock()
+	return srv.maxDisplayNameLength
+}
+
 // ServerCapabilities gets the capabilities of the server.
 func (srv *UAServer) ServerCapabilities() *ua.ServerCapabilities {
 	srv.RLock()
@@ -325,7 +496,35 @@ func (srv *UAServer) ListenAndServe() error {
 		<-srv.stateSemaphore
 		return ua.BadResourceUnavailable
 	}
+	return srv.start(l)
+}
+
+// Serve accepts incoming connections on the listener and then handles service requests.
+// The listener is closed when the server is closed. Serve always returns a non-nil error.
+// After Shutdown or Close, the returned error is BadServerHalted.
+func (srv *UAServer) Serve(l net.Listener) error {
+	srv.stateSemaphore <- struct{}{}
+	if srv.state != ua.ServerStateUnknown {
+		<-srv.stateSemaphore
+		l.Close()
+		return ua.BadInternalError
+	}
+	return srv.start(l)
+}
+
+// start sets the server running on the listener, and releases the state semaphore held by the caller.
+func (srv *UAServer) start(l net.Listener) error {
 	srv.listeners = append(srv.listeners, l)
+	if srv.webSocketEndpointURL != "" {
+		wl, err := srv.listenWebSocket()
+		if err != nil {
+			l.Close()
+			<-srv.stateSemaphore
+			return err
+		}
+		srv.listeners = append(srv.listeners, wl)
+		go srv.serveWebSocket(wl)
+	}
 	srv.setState(ua.ServerStateRunning)
 	<-srv.stateSemaphore
 
@@ -352,6 +551,11 @@ func (srv *UAServer) Close() error {
 	// close subscriptions
 	close(srv.closing)
 
+	// keep the retained values for the next start
+	if err := srv.SnapshotValues(); err != nil {
+		log.Printf("Error saving retained values: %s\n", err.Error())
+	}
+
 	// close listeners
 	for _, l := range srv.listeners {
 		err := l.Close()
@@ -427,21 +631,106 @@ func (srv *UAServer) serve(l net.Listener) error {
 		}
 		delay = 0
 		ch := newServerSecureChannel(srv, conn, srv.receiveBufferSize, srv.sendBufferSize, srv.maxMessageSize, srv.maxChunkCount, srv.trace)
-		go func(ch *serverSecureChannel) {
-			err := ch.Open()
+		go srv.openChannel(ch)
+	}
+}
+
+// openChannel opens the secure channel and adds it to the channel manager, or aborts the channel on error.
+func (srv *UAServer) openChannel(ch *serverSecureChannel) {
+	err := ch.Open()
+	if err != nil {
+		if reason, ok := err.(ua.StatusCode); ok {
+			ch.Abort(reason, reason.Error())
+			return
+		}
+		ch.Abort(ua.BadSecureChannelClosed, err.Error())
+		return
+	}
+	srv.channelManager.Add(ch)
+}
+
+// AddReverseConnection dials out to the reverse-connect endpoint of a client, sends a ReverseHello
+// message, and then handles the secure channel as usual. The server keeps one connection open and
+// waiting for the client, reconnecting with a backoff when the client is not listening.
+// The clientEndpointURL is in the form opc.tcp://[host]:[port]
+func (srv *UAServer) AddReverseConnection(clientEndpointURL string) error {
+	switch srv.State() {
+	case ua.ServerStateShutdown, ua.ServerStateFailed:
+		return ua.BadServerHalted
+	}
+	clientURL, err := url.Parse(clientEndpointURL)
+	if err != nil || clientURL.Host == "" {
+		return ua.BadTCPEndpointURLInvalid
+	}
+	go srv.reverseConnect(clientURL.Host)
+	return nil
+}
+
+// reverseConnect maintains an outbound connection to a client's reverse-connect endpoint until the server is closed.
+func (srv *UAServer) reverseConnect(address string) {
+	var delay time.Duration
+	for {
+		select {
+		case <-srv.closing:
+			return
+		default:
+		}
+		conn, err := net.DialTimeout("tcp", address, defaultReverseConnectTimeout)
+		if err == nil {
+			err = srv.sendReverseHello(conn)
 			if err != nil {
+				conn.Close()
+			}
+		}
+		if err == nil {
+			ch := newServerSecureChannel(srv, conn, srv.receiveBufferSize, srv.sendBufferSize, srv.maxMessageSize, srv.maxChunkCount, srv.trace)
+			// blocks until the client sends Hello and OpenSecureChannel.
+			if err = ch.Open(); err != nil {
 				if reason, ok := err.(ua.StatusCode); ok {
 					ch.Abort(reason, reason.Error())
-					return
+				} else {
+					ch.Abort(ua.BadSecureChannelClosed, err.Error())
 				}
-				ch.Abort(ua.BadSecureChannelClosed, err.Error())
-				return
+			} else {
+				srv.channelManager.Add(ch)
+				delay = 0
+				continue
 			}
-			srv.channelManager.Add(ch)
-		}(ch)
+		}
+		// the client is not listening, or dropped the connection before opening the channel.
+		if delay == 0 {
+			delay = minReverseConnectDelay
+		} else {
+			delay *= 2
+		}
+		if delay > maxReverseConnectDelay {
+			delay = maxReverseConnectDelay
+		}
+		select {
+		case <-srv.closing:
+			return
+		case <-time.After(delay):
+		}
 	}
 }
 
+// sendReverseHello sends the ReverseHello message to the client.
+func (srv *UAServer) sendReverseHello(conn net.Conn) error {
+	buf := *(bytesPool.Get().(*[]byte))
+	defer bytesPool.Put(&buf)
+	var writer = ua.NewWriter(buf)
+	var ec = ua.NewEncodingContext()
+	var enc = ua.NewBinaryEncoder(writer, ec)
+	serverURI := srv.LocalDescription().ApplicationURI
+	endpointURL := srv.EndpointURL()
+	enc.WriteUInt32(ua.MessageTypeReverseHello)
+	enc.WriteUInt32(uint32(16 + len(serverURI) + len(endpointURL)))
+	enc.WriteString(serverURI)
+	enc.WriteString(endpointURL)
+	_, err := conn.Write(writer.Bytes())
+	return err
+}
+
 func (srv *UAServer) handleCloseSecureChannel(ch *serverSecureChannel, requestid uint32, req *ua.CloseSecureChannelRequest) error {
 	srv.ChannelManager().Delete(ch)
 	ch.Close()
@@ -454,7 +743,7 @@ func (srv *UAServer) initializeNamespace() error {
 		return err
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerAuditing); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindNode(ua.MethodIDServerRequestServerStateChange); ok {
 		nm.DeleteNode(n, true)
@@ -463,10 +752,10 @@ func (srv *UAServer) initializeNamespace() error {
 		nm.DeleteNode(n, true)
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServiceLevel); ok {
-		n.SetValue(ua.NewDataValue(byte(255), 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(byte(255), 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerRedundancyRedundancySupport); ok {
-		n.SetValue(ua.NewDataValue(int32(0), 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(int32(0), 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindNode(ua.VariableIDServerServerRedundancyCurrentServerID); ok {
 		nm.DeleteNode(n, false)
@@ -483,172 +772,58 @@ func (srv *UAServer) initializeNamespace() error {
 
 	if n, ok := nm.FindVariable(ua.VariableIDServerNamespaceArray); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.NamespaceUris(), 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.NamespaceUris(), 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerArray); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.ServerUris(), 0, time.Now(), 0, time.Now(), 0)
-		})
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatus); ok {
-		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(
-				ua.ServerStatusDataType{
-					StartTime:           srv.startTime,
-					CurrentTime:         time.Now(),
-					State:               srv.state,
-					BuildInfo:           srv.buildInfo,
-					ShutdownReason:      srv.shutdownReason,
-					SecondsTillShutdown: srv.secondsTillShutdown,
-				}, 0, time.Now(), 0, time.Now(), 0)
-		})
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusState); ok {
-		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(int32(srv.State()), 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.ServerUris(), 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusCurrentTime); ok {
-		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(time.Now(), 0, time.Now(), 0, time.Now(), 0)
-		})
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusSecondsTillShutdown); ok {
-		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.secondsTillShutdown, 0, time.Now(), 0, time.Now(), 0)
-		})
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusShutdownReason); ok {
-		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.shutdownReason, 0, time.Now(), 0, time.Now(), 0)
-		})
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusStartTime); ok {
-		n.SetValue(ua.NewDataValue(srv.startTime, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfo); ok {
-		n.SetValue(ua.NewDataValue(srv.buildInfo, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoProductURI); ok {
-		n.SetValue(ua.NewDataValue(srv.buildInfo.ProductURI, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoManufacturerName); ok {
-		n.SetValue(ua.NewDataValue(srv.buildInfo.ManufacturerName, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoProductName); ok {
-		n.SetValue(ua.NewDataValue(srv.buildInfo.ProductName, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoSoftwareVersion); ok {
-		n.SetValue(ua.NewDataValue(srv.buildInfo.SoftwareVersion, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoBuildNumber); ok {
-		n.SetValue(ua.NewDataValue(srv.buildInfo.BuildNumber, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoBuildDate); ok {
-		n.SetValue(ua.NewDataValue(srv.buildInfo.BuildDate, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesLocaleIDArray); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.LocaleIDArray, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesMaxStringLength); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.MaxStringLength, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesMaxArrayLength); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.MaxArrayLength, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesMaxByteStringLength); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.MaxByteStringLength, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesMaxBrowseContinuationPoints); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.MaxBrowseContinuationPoints, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesMaxHistoryContinuationPoints); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.MaxHistoryContinuationPoints, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesMaxQueryContinuationPoints); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.MaxQueryContinuationPoints, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesMinSupportedSampleRate); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.MinSupportedSampleRate, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesServerProfileArray); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.ServerProfileArray, 0, time.Now(), 0, time.Now(), 0))
+	srv.initializeServerStatus(nm)
+	srv.initializeServerCapabilities(nm)
+	srv.initializeConditionMethods(nm)
+	if err := srv.initializeMinEventSeverity(nm); err != nil {
+		return err
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesAccessHistoryDataCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesInsertDataCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesReplaceDataCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesUpdateDataCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesDeleteRawCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesDeleteAtTimeCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesAccessHistoryEventsCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesMaxReturnDataValues); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesMaxReturnEventValues); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesInsertAnnotationCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesInsertEventCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesReplaceEventCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDHistoryServerCapabilitiesUpdateEventCapability); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxMonitoredItemsPerCall); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerBrowse); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerBrowse, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerHistoryReadData); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryReadData, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerHistoryReadEvents); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryReadEvents, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerHistoryUpdateData); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryUpdateData, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerHistoryUpdateEvents); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryUpdateEvents, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerMethodCall); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerMethodCall, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerNodeManagement); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerNodeManagement, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerRead); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerRead, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerRegisterNodes); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerRegisterNodes, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerTranslateBrowsePathsToNodeIDs); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerTranslateBrowsePathsToNodeIds, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerWrite); ok {
-		n.SetValue(ua.NewDataValue(srv.serverCapabilities.OperationLimits.MaxNodesPerWrite, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(false, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindObject(ua.ObjectIDServerServerCapabilitiesModellingRules); ok {
 		if mandatory, ok := nm.FindObject(ua.ObjectIDModellingRuleMandatory); ok {
@@ -669,90 +844,90 @@ func (srv *UAServer) initializeNamespace() error {
 		}
 	}
 	if nr, ok := nm.FindVariable(ua.VariableIDModellingRuleMandatoryNamingRule); ok {
-		nr.SetValue(ua.NewDataValue(int32(1), 0, time.Now(), 0, time.Now(), 0))
+		nr.SetValue(ua.NewDataValue(int32(1), 0, srv.now(), 0, srv.now(), 0))
 	}
 	if nr, ok := nm.FindVariable(ua.VariableIDModellingRuleMandatoryPlaceholderNamingRule); ok {
-		nr.SetValue(ua.NewDataValue(int32(1), 0, time.Now(), 0, time.Now(), 0))
+		nr.SetValue(ua.NewDataValue(int32(1), 0, srv.now(), 0, srv.now(), 0))
 	}
 	if nr, ok := nm.FindVariable(ua.VariableIDModellingRuleOptionalNamingRule); ok {
-		nr.SetValue(ua.NewDataValue(int32(2), 0, time.Now(), 0, time.Now(), 0))
+		nr.SetValue(ua.NewDataValue(int32(2), 0, srv.now(), 0, srv.now(), 0))
 	}
 	if nr, ok := nm.FindVariable(ua.VariableIDModellingRuleOptionalPlaceholderNamingRule); ok {
-		nr.SetValue(ua.NewDataValue(int32(2), 0, time.Now(), 0, time.Now(), 0))
+		nr.SetValue(ua.NewDataValue(int32(2), 0, srv.now(), 0, srv.now(), 0))
 	}
 
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsEnabledFlag); ok {
-		n.SetValue(ua.NewDataValue(srv.serverDiagnostics, 0, time.Now(), 0, time.Now(), 0))
+		n.SetValue(ua.NewDataValue(srv.serverDiagnostics, 0, srv.now(), 0, srv.now(), 0))
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummary); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummaryCumulatedSessionCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.CumulatedSessionCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.CumulatedSessionCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummaryCumulatedSubscriptionCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.CumulatedSubscriptionCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.CumulatedSubscriptionCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummaryCurrentSessionCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.CurrentSessionCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.CurrentSessionCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummaryCurrentSubscriptionCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.CurrentSubscriptionCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.CurrentSubscriptionCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummaryServerViewCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.ServerViewCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.ServerViewCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummarySecurityRejectedSessionCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.SecurityRejectedSessionCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.SecurityRejectedSessionCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummarySessionAbortCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.SessionAbortCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.SessionAbortCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummaryPublishingIntervalCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.PublishingIntervalCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.PublishingIntervalCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummarySecurityRejectedRequestsCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.SecurityRejectedRequestsCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.SecurityRejectedRequestsCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummaryRejectedRequestsCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.RejectedRequestsCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.RejectedRequestsCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummaryRejectedSessionCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.RejectedSessionCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.RejectedSessionCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsServerDiagnosticsSummarySessionTimeoutCount); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			return ua.NewDataValue(srv.serverDiagnosticsSummary.SessionTimeoutCount, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(srv.serverDiagnosticsSummary.SessionTimeoutCount, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsSubscriptionDiagnosticsArray); ok {
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 			if !srv.serverDiagnostics {
-				return ua.NewDataValue(nil, 0, time.Now(), 0, time.Now(), 0)
+				return ua.NewDataValue(nil, 0, srv.now(), 0, srv.now(), 0)
 			}
 			a := make([]ua.ExtensionObject, 0, 16)
 			for _, s := range srv.SubscriptionManager().subscriptionsByID {
@@ -793,7 +968,7 @@ func (srv *UAServer) initializeNamespace() error {
 				s.RUnlock()
 				a = append(a, e)
 			}
-			return ua.NewDataValue(a, 0, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(a, 0, srv.now(), 0, srv.now(), 0)
 		})
 	}
 	if n, ok := nm.FindNode(ua.VariableIDServerServerDiagnosticsSamplingIntervalDiagnosticsArray); ok {
@@ -902,11 +1077,28 @@ func (srv *UAServer) initializeNamespace() error {
 			return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
 		})
 	}
+
+	srv.initializeRoleSet()
 	return nil
 }
 
 func (srv *UAServer) buildEndpointDescriptions() []ua.EndpointDescription {
 	eds := []ua.EndpointDescription{}
+	if srv.endpointConfigs != nil {
+		for _, c := range srv.endpointConfigs {
+			eds = append(eds, ua.EndpointDescription{
+				EndpointURL:         srv.endpointURL,
+				Server:              srv.localDescription,
+				ServerCertificate:   ua.ByteString(srv.localCertificate),
+				SecurityMode:        c.SecurityMode,
+				SecurityPolicyURI:   c.SecurityPolicyURI,
+				TransportProfileURI: ua.TransportProfileURIUaTcpTransport,
+				SecurityLevel:       securityLevel(c.SecurityPolicyURI, c.SecurityMode),
+				UserIdentityTokens:  c.buildUserTokenPolicies(),
+			})
+		}
+		return sortBySecurityLevel(eds)
+	}
 	if srv.allowSecurityPolicyNone {
 		toks := []ua.UserTokenPolicy{}
 		if srv.allowAnonymousIdentity {
@@ -924,11 +1116,11 @@ func (srv *UAServer) buildEndpointDescriptions() []ua.EndpointDescription {
 		eds = append(eds, ua.EndpointDescription{
 			EndpointURL:         srv.endpointURL,
 			Server:              srv.localDescription,
-			ServerCertificate:   ua.ByteString(srv.LocalCertificate()),
+			ServerCertificate:   ua.ByteString(srv.localCertificate),
 			SecurityMode:        ua.MessageSecurityModeNone,
 			SecurityPolicyURI:   ua.SecurityPolicyURINone,
 			TransportProfileURI: ua.TransportProfileURIUaTcpTransport,
-			SecurityLevel:       byte(len(eds)),
+			SecurityLevel:       securityLevel(ua.SecurityPolicyURINone, ua.MessageSecurityModeNone),
 			UserIdentityTokens:  toks,
 		})
 	}
@@ -956,13 +1148,13 @@ func (srv *UAServer) buildEndpointDescriptions() []ua.EndpointDescription {
 		eds = append(eds, ua.EndpointDescription{
 			EndpointURL:         srv.endpointURL,
 			Server:              srv.localDescription,
-			ServerCertificate:   ua.ByteString(srv.LocalCertificate()),
+			ServerCertificate:   ua.ByteString(srv.localCertificate),
 			SecurityMode:        ua.MessageSecurityModeSignAndEncrypt,
 			SecurityPolicyURI:   uri,
 			TransportProfileURI: ua.TransportProfileURIUaTcpTransport,
-			SecurityLevel:       byte(len(eds)),
+			SecurityLevel:       securityLevel(uri, ua.MessageSecurityModeSignAndEncrypt),
 			UserIdentityTokens:  toks,
 		})
 	}
-	return eds
+	return sortBySecurityLevel(eds)
 }
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// serverCapabilityValues maps the variables of the ServerCapabilities object of the Server object, and of its
+// OperationLimits, to the value they report.
+var serverCapabilityValues = map[ua.NodeID]func(c *ua.ServerCapabilities) interface{}{
+	ua.VariableIDServerServerCapabilitiesLocaleIDArray:                func(c *ua.ServerCapabilities) interface{} { return c.LocaleIDArray },
+	ua.VariableIDServerServerCapabilitiesMaxStringLength:              func(c *ua.ServerCapabilities) interface{} { return c.MaxStringLength },
+	ua.VariableIDServerServerCapabilitiesMaxArrayLength:               func(c *ua.ServerCapabilities) interface{} { return c.MaxArrayLength },
+	ua.VariableIDServerServerCapabilitiesMaxByteStringLength:          func(c *ua.ServerCapabilities) interface{} { return c.MaxByteStringLength },
+	ua.VariableIDServerServerCapabilitiesMaxBrowseContinuationPoints:  func(c *ua.ServerCapabilities) interface{} { return c.MaxBrowseContinuationPoints },
+	ua.VariableIDServerServerCapabilitiesMaxHistoryContinuationPoints: func(c *ua.ServerCapabilities) interface{} { return c.MaxHistoryContinuationPoints },
+	ua.VariableIDServerServerCapabilitiesMaxQueryContinuationPoints:   func(c *ua.ServerCapabilities) interface{} { return c.MaxQueryContinuationPoints },
+	ua.VariableIDServerServerCapabilitiesMinSupportedSampleRate:       func(c *ua.ServerCapabilities) interface{} { return c.MinSupportedSampleRate },
+	ua.VariableIDServerServerCapabilitiesServerProfileArray:           func(c *ua.ServerCapabilities) interface{} { return c.ServerProfileArray },
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxMonitoredItemsPerCall: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxMonitoredItemsPerCall
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerBrowse: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerBrowse
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerHistoryReadData: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerHistoryReadData
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerHistoryReadEvents: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerHistoryReadEvents
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerHistoryUpdateData: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerHistoryUpdateData
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerHistoryUpdateEvents: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerHistoryUpdateEvents
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerMethodCall: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerMethodCall
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerNodeManagement: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerNodeManagement
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerRead: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerRead
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerRegisterNodes: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerRegisterNodes
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerTranslateBrowsePathsToNodeIDs: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerTranslateBrowsePathsToNodeIds
+	},
+	ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerWrite: func(c *ua.ServerCapabilities) interface{} {
+		return c.OperationLimits.MaxNodesPerWrite
+	},
+}
+
+// initializeServerCapabilities sets the handlers of the variables of the ServerCapabilities object of the Server
+// object, so clients read the limits the services enforce, even if the capabilities change after startup.
+func (srv *UAServer) initializeServerCapabilities(nm *NamespaceManager) {
+	for id, value := range serverCapabilityValues {
+		if n, ok := nm.FindVariable(id); ok {
+			value := value
+			n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+				return ua.NewDataValue(value(srv.ServerCapabilities()), 0, srv.now(), 0, srv.now(), 0)
+			})
+		}
+	}
+}
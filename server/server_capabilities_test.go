@@ -0,0 +1,71 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestServerCapabilitiesOperationLimits(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	srv.initializeServerCapabilities(nm)
+
+	limits, ok := nm.FindObject(ua.ObjectIDServerServerCapabilitiesOperationLimits)
+	if !ok {
+		t.Fatal("expected OperationLimits node")
+	}
+	// the variables report the current limits, even if they change after startup.
+	srv.ServerCapabilities().OperationLimits.MaxNodesPerRead = 25
+	srv.ServerCapabilities().MinSupportedSampleRate = 250
+	expected := map[string]uint32{
+		"MaxNodesPerRead":                          25,
+		"MaxNodesPerWrite":                         1000,
+		"MaxNodesPerMethodCall":                    1000,
+		"MaxNodesPerBrowse":                        1000,
+		"MaxNodesPerRegisterNodes":                 1000,
+		"MaxNodesPerTranslateBrowsePathsToNodeIds": 1000,
+		"MaxNodesPerNodeManagement":                1000,
+		"MaxMonitoredItemsPerCall":                 1000,
+		"MaxNodesPerHistoryReadData":               1000,
+		"MaxNodesPerHistoryReadEvents":             1000,
+		"MaxNodesPerHistoryUpdateData":             1000,
+		"MaxNodesPerHistoryUpdateEvents":           1000,
+	}
+	found := 0
+	for _, r := range limits.GetReferences() {
+		if r.IsInverse || r.ReferenceTypeID != ua.ReferenceTypeIDHasProperty {
+			continue
+		}
+		n, ok := nm.FindVariable(ua.ToNodeID(r.TargetID, nm.NamespaceUris()))
+		if !ok {
+			continue
+		}
+		want, ok := expected[n.GetBrowseName().Name]
+		if !ok {
+			continue
+		}
+		found++
+		if n.ReadValueHandler == nil {
+			t.Errorf("%s: expected a read handler", n.GetBrowseName().Name)
+			continue
+		}
+		if v := n.ReadValueHandler(ctx, ua.ReadValueID{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue}).Value; v != want {
+			t.Errorf("%s: expected %d, got %v", n.GetBrowseName().Name, want, v)
+		}
+	}
+	if found != len(expected) {
+		t.Errorf("expected %d operation limits, found %d", len(expected), found)
+	}
+
+	n, ok := nm.FindVariable(ua.VariableIDServerServerCapabilitiesMinSupportedSampleRate)
+	if !ok {
+		t.Fatal("expected MinSupportedSampleRate node")
+	}
+	if v := n.ReadValueHandler(ctx, ua.ReadValueID{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue}).Value; v != float64(250) {
+		t.Errorf("expected MinSupportedSampleRate 250, got %v", v)
+	}
+}
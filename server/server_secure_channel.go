@@ -52,6 +52,8 @@ type serverSecureChannel struct {
 	tokenIDLock                 sync.RWMutex
 	tokenID                     uint32
 	tokenLock                   sync.RWMutex
+	tokenCreatedAt              time.Time
+	tokenLifetime               uint32
 	securityPolicyURI           string
 	securityPolicy              ua.SecurityPolicy
 	securityMode                ua.MessageSecurityMode
@@ -69,6 +71,8 @@ type serverSecureChannel struct {
 	sequenceNumber             uint32
 	sendingTokenID             uint32
 	receivingTokenID           uint32
+	receivingTokenExpires      time.Time
+	previousKeys               *receivingKeys
 	localSigningKey            []byte
 	localEncryptingKey         []byte
 	localInitializationVector  []byte
@@ -86,30 +90,46 @@ type serverSecureChannel struct {
 	symDecryptingBlockCipher cipher.Block
 	trace                    bool
 
-	receiveBufferSize uint32
-	sendBufferSize    uint32
-	maxMessageSize    uint32
-	maxChunkCount     uint32
-	endpointURL       string
-	conn              net.Conn
-	closed            bool
+	receiveBufferSize   uint32
+	sendBufferSize      uint32
+	maxMessageSize      uint32
+	maxChunkCount       uint32
+	endpointURL         string
+	conn                net.Conn
+	transportProfileURI string
+	closed              bool
+	responseWriter      func(ua.ServiceResponse, uint32) error
+}
+
+// receivingKeys are the keys that verify and decrypt the messages secured with a token that was renewed. The
+// client may send messages secured with the previous token until it receives the renewed token, so the channel
+// accepts them until the previous token expires.
+type receivingKeys struct {
+	tokenID               uint32
+	expires               time.Time
+	verifyHMAC            hash.Hash
+	decryptingBlockCipher cipher.Block
+	initializationVector  []byte
 }
 
 // newServerSecureChannel initializes a new instance of the UaTcpSecureChannel.
 func newServerSecureChannel(srv *UAServer, conn net.Conn, receiveBufferSize, sendBufferSize, maxMessageSize, maxChunkCount uint32, trace bool) *serverSecureChannel {
+	// the channel keeps the certificate it was opened with, when the certificate of the server is replaced.
+	localCertificate, localPrivateKey := srv.localKeyPair()
 	ch := &serverSecureChannel{
-		srv:               srv,
-		conn:              conn,
-		receiveBufferSize: receiveBufferSize,
-		sendBufferSize:    sendBufferSize,
-		maxMessageSize:    maxMessageSize,
-		maxChunkCount:     maxChunkCount,
-		trace:             trace,
-		channelID:         getNextServerChannelID(),
-		securityPolicyURI: ua.SecurityPolicyURINone,
-		securityPolicy:    new(ua.SecurityPolicyNone),
-		localCertificate:  srv.localCertificate,
-		localPrivateKey:   srv.localPrivateKey,
+		srv:                 srv,
+		conn:                conn,
+		receiveBufferSize:   receiveBufferSize,
+		sendBufferSize:      sendBufferSize,
+		maxMessageSize:      maxMessageSize,
+		maxChunkCount:       maxChunkCount,
+		trace:               trace,
+		transportProfileURI: ua.TransportProfileURIUaTcpTransport,
+		channelID:           getNextServerChannelID(),
+		securityPolicyURI:   ua.SecurityPolicyURINone,
+		securityPolicy:      new(ua.SecurityPolicyNone),
+		localCertificate:    localCertificate,
+		localPrivateKey:     localPrivateKey,
 	}
 	return ch
 }
@@ -242,6 +262,18 @@ func (ch *serverSecureChannel) Write(res ua.ServiceResponse, id uint32) error {
 		b, _ := json.MarshalIndent(res, "", " ")
 		log.Printf("%s%s", reflect.TypeOf(res).Elem().Name(), b)
 	}
+	if fault, ok := res.(*ua.ServiceFault); ok {
+		if ok, count := ch.srv.faultLogThrottle.allow(faultLogKey{ch.channelID, fault.ResponseHeader.ServiceResult}); ok {
+			if count > 1 {
+				ch.srv.Logger().Warnf("Service fault on channel '%d'. status: %s, request handle: %d, occurrences since last logged: %d", ch.channelID, fault.ResponseHeader.ServiceResult, fault.ResponseHeader.RequestHandle, count)
+			} else {
+				ch.srv.Logger().Warnf("Service fault on channel '%d'. status: %s, request handle: %d", ch.channelID, fault.ResponseHeader.ServiceResult, fault.ResponseHeader.RequestHandle)
+			}
+		}
+	}
+	if ch.responseWriter != nil {
+		return ch.responseWriter(res, id)
+	}
 	switch res1 := res.(type) {
 	case *ua.OpenSecureChannelResponse:
 		err := ch.sendOpenSecureChannelResponse(res1, id)
@@ -373,8 +405,14 @@ func (ch *serverSecureChannel) onOpen() error {
 	if !ok {
 		return ua.BadDecodingError
 	}
+	// the symmetric keys are derived from the nonces, so they must be as long as the policy requires.
+	if oscr.SecurityMode != ua.MessageSecurityModeNone && len(oscr.ClientNonce) != ch.securityPolicy.NonceSize() {
+		return ua.BadNonceInvalid
+	}
 	ch.tokenLock.Lock()
 	ch.tokenID = ch.getNextTokenID()
+	ch.tokenCreatedAt = time.Now()
+	ch.tokenLifetime = oscr.RequestedLifetime
 	ch.securityMode = oscr.SecurityMode
 	if ch.securityMode != ua.MessageSecurityModeNone {
 		ch.localNonce = getNextNonce(ch.securityPolicy.NonceSize())
@@ -383,17 +421,23 @@ func (ch *serverSecureChannel) onOpen() error {
 	}
 	ch.remoteNonce = []byte(oscr.ClientNonce)
 	ch.tokenLock.Unlock()
-	for _, ep := range ch.srv.Endpoints() {
-		if ep.TransportProfileURI == ua.TransportProfileURIUaTcpTransport && ep.SecurityPolicyURI == ch.securityPolicyURI && ep.SecurityMode == ch.securityMode {
-			ch.localEndpoint = ep
-			break
-		}
+	if ep, ok := ch.srv.findEndpoint(ch.transportProfileURI, ch.securityPolicyURI, ch.securityMode); ok {
+		ch.localEndpoint = ep
+	} else if ch.securityPolicyURI != ua.SecurityPolicyURINone || ch.securityMode != ua.MessageSecurityModeNone || !ch.srv.discoveryEndpoint {
+		// the negotiated security policy and mode must match one of the endpoints.
+		return ua.BadSecurityPolicyRejected
 	}
 	// connecting for discovery only
 	if ch.localEndpoint.EndpointURL == "" && ch.securityPolicyURI == ua.SecurityPolicyURINone && ch.securityMode == ua.MessageSecurityModeNone {
+		discoveryURL := ch.srv.endpointURL
+		if ch.transportProfileURI == ua.TransportProfileURIWssUaBinaryTransport {
+			discoveryURL = ch.srv.webSocketEndpointURL
+		} else if len(ch.srv.localDescription.DiscoveryURLs) > 0 {
+			discoveryURL = ch.srv.localDescription.DiscoveryURLs[0]
+		}
 		ch.discoveryOnly = true
 		ch.localEndpoint = ua.EndpointDescription{
-			EndpointURL:       ch.srv.localDescription.DiscoveryURLs[0],
+			EndpointURL:       discoveryURL,
 			Server:            ch.srv.localDescription,
 			SecurityMode:      ua.MessageSecurityModeNone,
 			SecurityPolicyURI: ua.SecurityPolicyURINone,
@@ -404,7 +448,7 @@ func (ch *serverSecureChannel) onOpen() error {
 					SecurityPolicyURI: ua.SecurityPolicyURINone,
 				},
 			},
-			TransportProfileURI: ua.TransportProfileURIUaTcpTransport,
+			TransportProfileURI: ch.transportProfileURI,
 			SecurityLevel:       0,
 		}
 	}
@@ -418,8 +462,7 @@ func (ch *serverSecureChannel) onOpen() error {
 		if err != nil {
 			return ua.BadSecurityChecksFailed
 		}
-		valid, err := validateClientCertificate(cert, ch.srv.trustedCertsPath, ch.srv.suppressCertificateExpired, ch.srv.suppressCertificateChainIncomplete)
-		if !valid {
+		if err := ch.srv.validateRemoteCertificate(cert); err != nil {
 			return err
 		}
 		ch.remotePublicKey = cert.PublicKey.(*rsa.PublicKey)
@@ -429,15 +472,15 @@ func (ch *serverSecureChannel) onOpen() error {
 	}
 	res := &ua.OpenSecureChannelResponse{
 		ResponseHeader: ua.ResponseHeader{
-			Timestamp:     time.Now(),
+			Timestamp:     ch.srv.now(),
 			RequestHandle: oscr.Header().RequestHandle,
 		},
 		ServerProtocolVersion: protocolVersion,
 		SecurityToken: ua.ChannelSecurityToken{
 			ChannelID:       ch.channelID,
 			TokenID:         ch.tokenID,
-			CreatedAt:       time.Now(),
-			RevisedLifetime: oscr.RequestedLifetime,
+			CreatedAt:       ch.tokenCreatedAt,
+			RevisedLifetime: ch.tokenLifetime,
 		},
 		ServerNonce: ua.ByteString(ch.localNonce),
 	}
@@ -1128,6 +1171,7 @@ func (ch *serverSecureChannel) readRequest() (ua.ServiceRequest, uint32, error)
 	var bodyStream = buffer.NewPartitionAt(bufferPool)
 	defer bodyStream.Reset()
 	var bodyDecoder = ua.NewBinaryDecoder(bodyStream, ch)
+	bodyDecoder.SetMaxNestingDepth(ch.srv.MaxNestingDepth())
 
 	// read chunks
 	var chunkCount int32
@@ -1176,13 +1220,37 @@ func (ch *serverSecureChannel) readRequest() (ua.ServiceRequest, uint32, error)
 				return nil, 0, ua.BadDecodingError
 			}
 
-			// detect new token
+			// select the keys of the token
 			ch.tokenLock.RLock()
-			if ch.receivingTokenID != tokenID {
+			verifyHMAC, decryptingBlockCipher, remoteInitializationVector := ch.symVerifyHMAC, ch.symDecryptingBlockCipher, ch.remoteInitializationVector
+			switch {
+			case tokenID == ch.receivingTokenID:
+
+			case ch.previousKeys != nil && tokenID == ch.previousKeys.tokenID:
+				// the message was sent before the client received the renewed token.
+				if time.Now().After(ch.previousKeys.expires) {
+					ch.tokenLock.RUnlock()
+					return nil, 0, ua.BadSecureChannelTokenUnknown
+				}
+				verifyHMAC, decryptingBlockCipher, remoteInitializationVector = ch.previousKeys.verifyHMAC, ch.previousKeys.decryptingBlockCipher, ch.previousKeys.initializationVector
+
+			case tokenID == ch.tokenID:
+				// the client uses the token issued last, so keep the keys of the previous token for the messages in flight.
+				if ch.receivingTokenID != 0 {
+					ch.previousKeys = &receivingKeys{
+						tokenID:               ch.receivingTokenID,
+						expires:               ch.receivingTokenExpires,
+						verifyHMAC:            ch.symVerifyHMAC,
+						decryptingBlockCipher: ch.symDecryptingBlockCipher,
+						initializationVector:  ch.remoteInitializationVector,
+					}
+				}
 				ch.receivingTokenID = tokenID
+				ch.receivingTokenExpires = ch.tokenCreatedAt.Add(time.Duration(ch.tokenLifetime) * time.Millisecond)
 
 				if ch.securityMode != ua.MessageSecurityModeNone {
 					// (re)create security keys for verifying, decrypting
+					ch.remoteInitializationVector = make([]byte, len(ch.remoteInitializationVector))
 					remoteSecurityKey := calculatePSHA(ch.localNonce, ch.remoteNonce, len(ch.remoteSigningKey)+len(ch.remoteEncryptingKey)+len(ch.remoteInitializationVector), ch.securityPolicyURI)
 					jj := copy(ch.remoteSigningKey, remoteSecurityKey)
 					jj += copy(ch.remoteEncryptingKey, remoteSecurityKey[jj:])
@@ -1221,7 +1289,12 @@ func (ch *serverSecureChannel) readRequest() (ua.ServiceRequest, uint32, error)
 					}
 				}
 
+				verifyHMAC, decryptingBlockCipher, remoteInitializationVector = ch.symVerifyHMAC, ch.symDecryptingBlockCipher, ch.remoteInitializationVector
 				// log.Printf("Installed security token. %d\n", ch.sendingTokenId)
+
+			default:
+				ch.tokenLock.RUnlock()
+				return nil, 0, ua.BadSecureChannelTokenUnknown
 			}
 			ch.tokenLock.RUnlock()
 
@@ -1229,10 +1302,10 @@ func (ch *serverSecureChannel) readRequest() (ua.ServiceRequest, uint32, error)
 			// decrypt
 			if ch.securityMode == ua.MessageSecurityModeSignAndEncrypt {
 				span := ch.receiveBuffer[plainHeaderSize:count]
-				if len(span)%ch.symDecryptingBlockCipher.BlockSize() != 0 {
+				if len(span)%decryptingBlockCipher.BlockSize() != 0 {
 					return nil, 0, ua.BadDecodingError
 				}
-				symDecryptor := cipher.NewCBCDecrypter(ch.symDecryptingBlockCipher, ch.remoteInitializationVector)
+				symDecryptor := cipher.NewCBCDecrypter(decryptingBlockCipher, remoteInitializationVector)
 				symDecryptor.CryptBlocks(span, span)
 			}
 
@@ -1240,11 +1313,11 @@ func (ch *serverSecureChannel) readRequest() (ua.ServiceRequest, uint32, error)
 			if ch.securityMode != ua.MessageSecurityModeNone {
 				sigEnd := int(messageLength)
 				sigStart := sigEnd - ch.securityPolicy.SymSignatureSize()
-				ch.symVerifyHMAC.Reset()
-				if _, err := ch.symVerifyHMAC.Write(ch.receiveBuffer[:sigStart]); err != nil {
+				verifyHMAC.Reset()
+				if _, err := verifyHMAC.Write(ch.receiveBuffer[:sigStart]); err != nil {
 					return nil, 0, ua.BadDecodingError
 				}
-				sig := ch.symVerifyHMAC.Sum(nil)
+				sig := verifyHMAC.Sum(nil)
 				if !hmac.Equal(sig, ch.receiveBuffer[sigStart:sigEnd]) {
 					return nil, 0, ua.BadSecurityChecksFailed
 				}
@@ -1569,8 +1642,27 @@ func (ch *serverSecureChannel) requestWorker() {
 	}
 }
 
+// WriteServiceFault writes a ServiceFault with the status code in response to the request.
+func (ch *serverSecureChannel) WriteServiceFault(requestHandle uint32, status ua.StatusCode, id uint32) error {
+	return ch.Write(
+		&ua.ServiceFault{
+			ResponseHeader: ua.ResponseHeader{
+				Timestamp:     ch.srv.now(),
+				RequestHandle: requestHandle,
+				ServiceResult: status,
+			},
+		},
+		id,
+	)
+}
+
 // handleRequest directs the request to the correct handler depending on the type of request.
 func (ch *serverSecureChannel) handleRequest(req ua.ServiceRequest, requestid uint32) error {
+	// discovery only?
+	if ch.discoveryOnly && !isDiscoveryRequest(req) {
+		ch.WriteServiceFault(req.Header().RequestHandle, ua.BadSecurityPolicyRejected, requestid)
+		return nil
+	}
 	switch req := req.(type) {
 	case *ua.PublishRequest:
 		return ch.srv.handlePublish(ch, requestid, req)
@@ -1630,27 +1722,33 @@ func (ch *serverSecureChannel) handleRequest(req ua.ServiceRequest, requestid ui
 		return ch.srv.handleCancel(ch, requestid, req)
 
 	default:
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.Header().RequestHandle,
-					ServiceResult: ua.BadServiceUnsupported,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.Header().RequestHandle, ua.BadServiceUnsupported, requestid)
 		return nil
 	}
 }
 
+// isDiscoveryRequest returns true if the request may be handled by a secure channel that is connected for discovery only.
+func isDiscoveryRequest(req ua.ServiceRequest) bool {
+	switch req.(type) {
+	case *ua.FindServersRequest, *ua.GetEndpointsRequest, *ua.OpenSecureChannelRequest, *ua.CloseSecureChannelRequest:
+		return true
+	default:
+		return false
+	}
+}
+
 func (ch *serverSecureChannel) handleOpenSecureChannel(requestid uint32, req *ua.OpenSecureChannelRequest) error {
 	if req.RequestType == ua.SecurityTokenRequestTypeIssue {
 		return ua.BadSecurityChecksFailed
 	}
-	// handle renew token
+	if ch.securityMode != ua.MessageSecurityModeNone && len(req.ClientNonce) != ch.securityPolicy.NonceSize() {
+		return ch.WriteServiceFault(req.RequestHandle, ua.BadNonceInvalid, requestid)
+	}
+	// handle renew token. The keys of the new token are used when the client first sends a message secured with it.
 	ch.tokenLock.Lock()
 	ch.tokenID = ch.getNextTokenID()
+	ch.tokenCreatedAt = time.Now()
+	ch.tokenLifetime = req.RequestedLifetime
 	if ch.securityMode != ua.MessageSecurityModeNone {
 		ch.localNonce = getNextNonce(ch.securityPolicy.NonceSize())
 	} else {
@@ -1660,15 +1758,15 @@ func (ch *serverSecureChannel) handleOpenSecureChannel(requestid uint32, req *ua
 	ch.tokenLock.Unlock()
 	res := &ua.OpenSecureChannelResponse{
 		ResponseHeader: ua.ResponseHeader{
-			Timestamp:     time.Now(),
+			Timestamp:     ch.srv.now(),
 			RequestHandle: req.Header().RequestHandle,
 		},
 		ServerProtocolVersion: protocolVersion,
 		SecurityToken: ua.ChannelSecurityToken{
 			ChannelID:       ch.channelID,
 			TokenID:         ch.tokenID,
-			CreatedAt:       time.Now(),
-			RevisedLifetime: req.RequestedLifetime,
+			CreatedAt:       ch.tokenCreatedAt,
+			RevisedLifetime: ch.tokenLifetime,
 		},
 		ServerNonce: ua.ByteString(ch.localNonce),
 	}
@@ -1761,6 +1859,11 @@ func (ch *serverSecureChannel) read(p []byte) (int, error) {
 		return 0, ua.BadSecureChannelClosed
 	}
 
+	// the idle timeout closes the connection when the next chunk is not received in time.
+	if d := ch.srv.IdleTimeout(); d > 0 {
+		ch.conn.SetReadDeadline(time.Now().Add(d))
+	}
+
 	var err error
 	num := 0
 	n := 0
@@ -1769,6 +1872,9 @@ func (ch *serverSecureChannel) read(p []byte) (int, error) {
 		n, err = ch.conn.Read(p[num:count])
 		if err != nil || n == 0 {
 			// log.Println("Error in conn.Read() " + err.Error())
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				ch.srv.Logger().Infof("Closing idle channel '%d'.", ch.channelID)
+			}
 			ch.conn.Close()
 			ch.closed = true
 			return num, err
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/awcullen/opcua/client"
+)
+
+func TestDiscoveryOnlyRequests(t *testing.T) {
+	cases := []struct {
+		req  ua.ServiceRequest
+		want bool
+	}{
+		{&ua.GetEndpointsRequest{}, true},
+		{&ua.FindServersRequest{}, true},
+		{&ua.CloseSecureChannelRequest{}, true},
+		{&ua.BrowseRequest{}, false},
+		{&ua.ReadRequest{}, false},
+		{&ua.CreateSessionRequest{}, false},
+	}
+	for _, c := range cases {
+		if got := isDiscoveryRequest(c.req); got != c.want {
+			t.Errorf("isDiscoveryRequest(%T) = %t, want %t", c.req, got, c.want)
+		}
+	}
+}
+
+func TestDiscoveryOnlyChannel(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	ch := newTestChannel(srv)
+	ch.discoveryOnly = true
+
+	// a channel connected for discovery only refuses other services with a fault.
+	if err := ch.handleRequest(&ua.ReadRequest{RequestHeader: ua.RequestHeader{RequestHandle: 42}}, 1); err != nil {
+		t.Fatal(err)
+	}
+	res, ok := ch.WaitResponse(1, time.Second)
+	if !ok {
+		t.Fatal("expected a response")
+	}
+	if fault, ok := res.(*ua.ServiceFault); !ok || fault.ResponseHeader.ServiceResult != ua.BadSecurityPolicyRejected || fault.ResponseHeader.RequestHandle != 42 {
+		t.Errorf("expected ServiceFault %s, got %+v", ua.BadSecurityPolicyRejected, res)
+	}
+
+	if err := ch.handleRequest(&ua.GetEndpointsRequest{RequestHeader: ua.RequestHeader{RequestHandle: 43}}, 2); err != nil {
+		t.Fatal(err)
+	}
+	res, ok = ch.WaitResponse(2, time.Second)
+	if !ok {
+		t.Fatal("expected a response")
+	}
+	if r, ok := res.(*ua.GetEndpointsResponse); !ok || r.ResponseHeader.RequestHandle != 43 {
+		t.Errorf("expected GetEndpointsResponse, got %+v", res)
+	}
+}
+
+// newTestTokenChannel returns a secure channel signing messages with Basic256Sha256, whose client end is conn.
+func newTestTokenChannel(t *testing.T) (*serverSecureChannel, net.Conn, *[]ua.ServiceResponse) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	serverConn, conn := net.Pipe()
+	t.Cleanup(func() { serverConn.Close(); conn.Close() })
+	responses := []ua.ServiceResponse{}
+	ch := newServerSecureChannel(srv, serverConn, defaultBufferSize, defaultBufferSize, 0, 0, false)
+	ch.responseWriter = func(res ua.ServiceResponse, id uint32) error {
+		responses = append(responses, res)
+		return nil
+	}
+	ch.securityPolicyURI = ua.SecurityPolicyURIBasic256Sha256
+	ch.securityPolicy = new(ua.SecurityPolicyBasic256Sha256)
+	ch.securityMode = ua.MessageSecurityModeSign
+	ch.receiveBuffer = make([]byte, defaultBufferSize)
+	ch.localSigningKey = make([]byte, ch.securityPolicy.SymSignatureKeySize())
+	ch.localEncryptingKey = make([]byte, ch.securityPolicy.SymEncryptionKeySize())
+	ch.localInitializationVector = make([]byte, ch.securityPolicy.SymEncryptionBlockSize())
+	ch.remoteSigningKey = make([]byte, ch.securityPolicy.SymSignatureKeySize())
+	ch.remoteEncryptingKey = make([]byte, ch.securityPolicy.SymEncryptionKeySize())
+	ch.remoteInitializationVector = make([]byte, ch.securityPolicy.SymEncryptionBlockSize())
+	return ch, conn, &responses
+}
+
+// renewTestToken renews the token of the channel, and returns the token and the key the client signs with.
+func renewTestToken(t *testing.T, ch *serverSecureChannel, responses *[]ua.ServiceResponse) (uint32, []byte) {
+	clientNonce := getNextNonce(ch.securityPolicy.NonceSize())
+	req := &ua.OpenSecureChannelRequest{RequestType: ua.SecurityTokenRequestTypeRenew, SecurityMode: ch.securityMode, ClientNonce: ua.ByteString(clientNonce), RequestedLifetime: 60000}
+	if err := ch.handleOpenSecureChannel(1, req); err != nil {
+		t.Fatal(err)
+	}
+	res := (*responses)[len(*responses)-1].(*ua.OpenSecureChannelResponse)
+	key := calculatePSHA([]byte(res.ServerNonce), clientNonce, ch.securityPolicy.SymSignatureKeySize()+ch.securityPolicy.SymEncryptionKeySize()+ch.securityPolicy.SymEncryptionBlockSize(), ch.securityPolicyURI)
+	return res.SecurityToken.TokenID, key[:ch.securityPolicy.SymSignatureKeySize()]
+}
+
+// sendTestRequest sends a ReadRequest secured with the token to the channel, and returns the result of reading it.
+func sendTestRequest(t *testing.T, ch *serverSecureChannel, conn net.Conn, tokenID uint32, signingKey []byte, handle uint32) (ua.ServiceRequest, error) {
+	var body bytes.Buffer
+	enc := ua.NewBinaryEncoder(&body, ch)
+	if err := enc.WriteNodeID(ua.ObjectIDReadRequestEncodingDefaultBinary); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&ua.ReadRequest{RequestHeader: ua.RequestHeader{RequestHandle: handle}}); err != nil {
+		t.Fatal(err)
+	}
+	size := 16 + sequenceHeaderSize + body.Len() + ch.securityPolicy.SymSignatureSize()
+	var msg bytes.Buffer
+	for _, v := range []uint32{ua.MessageTypeFinal, uint32(size), ch.channelID, tokenID, handle, handle} {
+		binary.Write(&msg, binary.LittleEndian, v)
+	}
+	msg.Write(body.Bytes())
+	mac := ch.securityPolicy.SymHMACFactory(signingKey)
+	mac.Write(msg.Bytes())
+	msg.Write(mac.Sum(nil))
+	go conn.Write(msg.Bytes())
+	req, _, err := ch.readRequest()
+	return req, err
+}
+
+func TestRenewSecurityToken(t *testing.T) {
+	ch, conn, responses := newTestTokenChannel(t)
+	oldToken, oldKey := renewTestToken(t, ch, responses)
+	if _, err := sendTestRequest(t, ch, conn, oldToken, oldKey, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	newToken, newKey := renewTestToken(t, ch, responses)
+	if newToken == oldToken {
+		t.Fatal("expected a new token")
+	}
+	// until the client uses the new token, it secures messages with the previous one.
+	if _, err := sendTestRequest(t, ch, conn, oldToken, oldKey, 2); err != nil {
+		t.Fatalf("expected a message secured with the previous token to be accepted, got %v", err)
+	}
+	if _, err := sendTestRequest(t, ch, conn, newToken, newKey, 3); err != nil {
+		t.Fatalf("expected a message secured with the new token to be accepted, got %v", err)
+	}
+	// a message sent before the renewal may still be in flight.
+	req, err := sendTestRequest(t, ch, conn, oldToken, oldKey, 4)
+	if err != nil {
+		t.Fatalf("expected a message secured with the previous token to be accepted during the overlap, got %v", err)
+	}
+	if r, ok := req.(*ua.ReadRequest); !ok || r.RequestHandle != 4 {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if _, err := sendTestRequest(t, ch, conn, newToken, oldKey, 5); err != ua.BadSecurityChecksFailed {
+		t.Errorf("expected %s for a message signed with the wrong key, got %v", ua.BadSecurityChecksFailed, err)
+	}
+	if _, err := sendTestRequest(t, ch, conn, 99, newKey, 6); err != ua.BadSecureChannelTokenUnknown {
+		t.Errorf("expected %s for an unknown token, got %v", ua.BadSecureChannelTokenUnknown, err)
+	}
+	ch.previousKeys.expires = time.Now().Add(-time.Second)
+	if _, err := sendTestRequest(t, ch, conn, oldToken, oldKey, 7); err != ua.BadSecureChannelTokenUnknown {
+		t.Errorf("expected %s for an expired token, got %v", ua.BadSecureChannelTokenUnknown, err)
+	}
+}
+
+func TestSecurityPolicyInterop(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpointURL := fmt.Sprintf("opc.tcp://127.0.0.1:%d", l.Addr().(*net.TCPAddr).Port)
+	dir := t.TempDir()
+	srv, err := New(
+		ua.ApplicationDescription{
+			ApplicationURI:  "urn:127.0.0.1:testserver",
+			ApplicationName: ua.LocalizedText{Text: "testserver"},
+			ApplicationType: ua.ApplicationTypeServer,
+		},
+		filepath.Join(dir, "server.crt"),
+		filepath.Join(dir, "server.key"),
+		endpointURL,
+		WithInsecureSkipVerify(),
+		WithAnonymousIdentity(true),
+	)
+	if err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.State() != ua.ServerStateRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the server to be running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the server offers these policies with SignAndEncrypt only.
+	cert, key := newTestCertificate(t, "127.0.0.1", "urn:127.0.0.1:testclient")
+	for _, uri := range []string{
+		ua.SecurityPolicyURIBasic256Sha256,
+		ua.SecurityPolicyURIAes128Sha256RsaOaep,
+		ua.SecurityPolicyURIAes256Sha256RsaPss,
+	} {
+		t.Run(uri[len("http://opcfoundation.org/UA/SecurityPolicy#"):], func(t *testing.T) {
+			// opening the session exchanges messages secured with the symmetric keys of the policy.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			ch, err := client.Dial(ctx, endpointURL,
+				client.WithSecurityPolicyURI(uri),
+				client.WithClientCertificate(cert, key),
+				client.WithInsecureSkipVerify(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ch.SecurityPolicyURI() != uri {
+				t.Errorf("expected %s, got %s", uri, ch.SecurityPolicyURI())
+			}
+			if err := ch.Close(ctx); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestNewWithoutGenerateCertificate(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationType: ua.ApplicationTypeServer},
+		filepath.Join(dir, "server.crt"),
+		filepath.Join(dir, "server.key"),
+		"opc.tcp://127.0.0.1:4840",
+		WithGenerateCertificate(false),
+	); err == nil {
+		t.Error("expected an error when no certificate is found and none is generated")
+	}
+}
+
+func TestNewKeepsKeyWithoutCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	if err := createCertificate("urn:127.0.0.1:testserver", "testserver", "opc.tcp://127.0.0.1:4840", certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a deployment that lost its certificate keeps its key.
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationType: ua.ApplicationTypeServer},
+		certFile,
+		keyFile,
+		"opc.tcp://127.0.0.1:4840",
+	); err == nil {
+		t.Error("expected an error when the certificate of the key is missing")
+	}
+	if buf, err := ioutil.ReadFile(keyFile); err != nil || !bytes.Equal(buf, key) {
+		t.Error("expected the key to be unchanged")
+	}
+	if _, err := os.Stat(certFile); !os.IsNotExist(err) {
+		t.Error("expected no certificate to be generated")
+	}
+}
+
+func TestRenewSecurityTokenNonceLength(t *testing.T) {
+	ch, _, responses := newTestTokenChannel(t)
+	req := &ua.OpenSecureChannelRequest{RequestType: ua.SecurityTokenRequestTypeRenew, SecurityMode: ch.securityMode, ClientNonce: ua.ByteString(getNextNonce(16)), RequestedLifetime: 60000}
+	if err := ch.handleOpenSecureChannel(1, req); err != nil {
+		t.Fatal(err)
+	}
+	if fault, ok := (*responses)[0].(*ua.ServiceFault); !ok || fault.ResponseHeader.ServiceResult != ua.BadNonceInvalid {
+		t.Errorf("expected %s for a short nonce, got %+v", ua.BadNonceInvalid, (*responses)[0])
+	}
+	if ch.tokenID != 0 {
+		t.Errorf("expected no token to be issued, got %d", ch.tokenID)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	srv.idleTimeout = 50 * time.Millisecond
+	serverConn, conn := net.Pipe()
+	t.Cleanup(func() { serverConn.Close(); conn.Close() })
+	ch := newServerSecureChannel(srv, serverConn, defaultBufferSize, defaultBufferSize, 0, 0, false)
+
+	// the client connects, but sends nothing.
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- ch.Open() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected the idle channel to fail to open")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the idle channel to be closed after the timeout")
+	}
+	if elapsed := time.Since(start); elapsed < srv.idleTimeout {
+		t.Errorf("expected the channel to be closed after %s, closed after %s", srv.idleTimeout, elapsed)
+	}
+	if !ch.closed {
+		t.Error("expected the channel to be closed")
+	}
+	if _, err := conn.Write([]byte{0}); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestReverseConnectBackoffWhenDropped(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan struct{}, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// the client accepts the connection, but drops it before opening the channel.
+			conn.Close()
+			accepted <- struct{}{}
+		}
+	}()
+	go srv.reverseConnect(ln.Addr().String())
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("expected the server to connect")
+	}
+	// the server waits minReverseConnectDelay before connecting again.
+	select {
+	case <-accepted:
+		t.Fatal("expected the server to back off after the connection was dropped")
+	case <-time.After(minReverseConnectDelay / 2):
+	}
+}
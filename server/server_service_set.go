@@ -9,11 +9,13 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/x509"
 	"encoding/binary"
+	"io/ioutil"
 	"math"
 	"net/url"
-	"sort"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -42,7 +44,7 @@ func (srv *UAServer) findServers(ch *serverSecureChannel, requestid uint32, req
 	ch.Write(
 		&ua.FindServersResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			Servers: srvs,
@@ -70,7 +72,7 @@ func (srv *UAServer) getEndpoints(ch *serverSecureChannel, requestid uint32, req
 	ch.Write(
 		&ua.GetEndpointsResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			Endpoints: eps,
@@ -80,16 +82,45 @@ func (srv *UAServer) getEndpoints(ch *serverSecureChannel, requestid uint32, req
 	return nil
 }
 
+// authorize returns the session of the request, if the session is activated on the channel. Otherwise, it writes
+// a ServiceFault and returns false, so the handler returns without processing the request. It counts the request,
+// and any error, in the diagnostics of the session.
+func (srv *UAServer) authorize(ch *serverSecureChannel, requestid uint32, req ua.ServiceRequest) (*Session, bool) {
+	header := req.Header()
+	session, ok := srv.SessionManager().Get(header.AuthenticationToken)
+	if !ok {
+		ch.WriteServiceFault(header.RequestHandle, ua.BadSessionIDInvalid, requestid)
+		return nil, false
+	}
+	count, errorCount := session.requestCounters(req)
+	if count != nil {
+		*count++
+		session.requestCount++
+	}
+	status := ua.Good
+	switch id := session.SecureChannelId(); {
+	case id == 0:
+		srv.SessionManager().Delete(session)
+		status = ua.BadSessionNotActivated
+	case id != ch.ChannelID():
+		status = ua.BadSecureChannelIDInvalid
+	}
+	if status != ua.Good {
+		ch.WriteServiceFault(header.RequestHandle, status, requestid)
+		if errorCount != nil {
+			*errorCount++
+			session.errorCount++
+		}
+		return nil, false
+	}
+	return session, true
+}
+
 // createSession creates a session.
 func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint32, req *ua.CreateSessionRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
 	// check endpointurl hostname matches one of the certificate hostnames
 	valid := false
-	if crt, err := x509.ParseCertificate(srv.LocalCertificate()); err == nil {
+	if crt, err := x509.ParseCertificate(ch.localCertificate); err == nil {
 		if remoteURL, err := url.Parse(req.EndpointURL); err == nil {
 			hostname := remoteURL.Host
 			i := strings.Index(hostname, ":")
@@ -102,16 +133,7 @@ func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint
 		}
 	}
 	if !valid {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadCertificateHostNameInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadCertificateHostNameInvalid, requestid)
 		return nil
 	}
 	// check nonce
@@ -132,29 +154,11 @@ func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint
 			}
 		}
 		if !valid {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadCertificateURIInvalid,
-					},
-				},
-				requestid,
-			)
+			ch.WriteServiceFault(req.RequestHandle, ua.BadCertificateURIInvalid, requestid)
 			return nil
 		}
-		if len(req.ClientNonce) < int(nonceLength) {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadNonceInvalid,
-					},
-				},
-				requestid,
-			)
+		if len(req.ClientNonce) < sessionNonceLength(ch.SecurityPolicyURI()) {
+			ch.WriteServiceFault(req.RequestHandle, ua.BadNonceInvalid, requestid)
 			return nil
 		}
 	default:
@@ -167,7 +171,7 @@ func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint
 		hash.Write([]byte(req.ClientCertificate))
 		hash.Write([]byte(req.ClientNonce))
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPKCS1v15(rand.Reader, srv.localPrivateKey, crypto.SHA1, hashed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, ch.localPrivateKey, crypto.SHA1, hashed)
 		if err != nil {
 			return err
 		}
@@ -181,7 +185,7 @@ func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint
 		hash.Write([]byte(req.ClientCertificate))
 		hash.Write([]byte(req.ClientNonce))
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPKCS1v15(rand.Reader, srv.localPrivateKey, crypto.SHA256, hashed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, ch.localPrivateKey, crypto.SHA256, hashed)
 		if err != nil {
 			return err
 		}
@@ -195,7 +199,7 @@ func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint
 		hash.Write([]byte(req.ClientCertificate))
 		hash.Write([]byte(req.ClientNonce))
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPSS(rand.Reader, srv.localPrivateKey, crypto.SHA256, hashed, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		signature, err := rsa.SignPSS(rand.Reader, ch.localPrivateKey, crypto.SHA256, hashed, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
 		if err != nil {
 			return err
 		}
@@ -218,7 +222,7 @@ func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint
 		ua.NewNodeIDOpaque(1, ua.ByteString(getNextNonce(15))),
 		sessionName,
 		ua.NewNodeIDOpaque(0, ua.ByteString(getNextNonce(nonceLength))),
-		ua.ByteString(getNextNonce(nonceLength)),
+		ua.ByteString(getNextNonce(sessionNonceLength(ch.SecurityPolicyURI()))),
 		(time.Duration(req.RequestedSessionTimeout) * time.Millisecond),
 		req.ClientDescription,
 		req.ServerURI,
@@ -227,31 +231,22 @@ func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint
 	)
 	err := srv.SessionManager().Add(session)
 	if err != nil {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManySessions,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManySessions, requestid)
 		return nil
 	}
-	// log.Printf("Created session '%s'.\n", req.SessionName)
+	srv.Logger().Debugf("Created session '%s'.", req.SessionName)
 
 	ch.Write(
 		&ua.CreateSessionResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			SessionID:                  session.sessionId,
 			AuthenticationToken:        session.authenticationToken,
 			RevisedSessionTimeout:      req.RequestedSessionTimeout,
 			ServerNonce:                session.sessionNonce,
-			ServerCertificate:          ua.ByteString(srv.LocalCertificate()),
+			ServerCertificate:          ua.ByteString(ch.localCertificate),
 			ServerEndpoints:            srv.Endpoints(),
 			ServerSoftwareCertificates: nil,
 			ServerSignature:            serverSignature,
@@ -264,63 +259,41 @@ func (srv *UAServer) handleCreateSession(ch *serverSecureChannel, requestid uint
 
 // handleActivateSession activates a session.
 func (srv *UAServer) handleActivateSession(ch *serverSecureChannel, requestid uint32, req *ua.ActivateSessionRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
 	// get session
 	m := srv.sessionManager
 	session, ok := m.Get(req.AuthenticationToken)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadSessionIDInvalid, requestid)
 		return nil
 	}
 
-	// verify the client's signature.
+	// verify the client's signature of the current nonce of the session.
+	nonce := session.SessionNonce()
 	var err error
 	switch ch.SecurityPolicyURI() {
 	case ua.SecurityPolicyURIBasic128Rsa15, ua.SecurityPolicyURIBasic256:
 		hash := crypto.SHA1.New()
-		hash.Write(srv.LocalCertificate())
-		hash.Write([]byte(session.SessionNonce()))
+		hash.Write(ch.localCertificate)
+		hash.Write([]byte(nonce))
 		hashed := hash.Sum(nil)
 		err = rsa.VerifyPKCS1v15(ch.RemotePublicKey(), crypto.SHA1, hashed, []byte(req.ClientSignature.Signature))
 
 	case ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep:
 		hash := crypto.SHA256.New()
-		hash.Write(srv.LocalCertificate())
-		hash.Write([]byte(session.SessionNonce()))
+		hash.Write(ch.localCertificate)
+		hash.Write([]byte(nonce))
 		hashed := hash.Sum(nil)
 		err = rsa.VerifyPKCS1v15(ch.RemotePublicKey(), crypto.SHA256, hashed, []byte(req.ClientSignature.Signature))
 
 	case ua.SecurityPolicyURIAes256Sha256RsaPss:
 		hash := crypto.SHA256.New()
-		hash.Write(srv.LocalCertificate())
-		hash.Write([]byte(session.SessionNonce()))
+		hash.Write(ch.localCertificate)
+		hash.Write([]byte(nonce))
 		hashed := hash.Sum(nil)
 		err = rsa.VerifyPSS(ch.RemotePublicKey(), crypto.SHA256, hashed, []byte(req.ClientSignature.Signature), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
 	}
 	if err != nil {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadApplicationSignatureInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadApplicationSignatureInvalid, requestid)
 		return nil
 	}
 
@@ -328,48 +301,18 @@ func (srv *UAServer) handleActivateSession(ch *serverSecureChannel, requestid ui
 	var userIdentity interface{}
 	switch userIdentityToken := req.UserIdentityToken.(type) {
 	case ua.IssuedIdentityToken:
-		var tokenPolicy *ua.UserTokenPolicy
-		for _, t := range ch.LocalEndpoint().UserIdentityTokens {
-			if t.TokenType == ua.UserTokenTypeCertificate && t.PolicyID == userIdentityToken.PolicyID {
-				tokenPolicy = &t
-				break
-			}
-		}
-		if tokenPolicy == nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+		_, status := findUserTokenPolicy(ch.LocalEndpoint(), ua.UserTokenTypeCertificate, userIdentityToken.PolicyID)
+		if status != ua.Good {
+			ch.WriteServiceFault(req.RequestHandle, status, requestid)
 			return nil
 		}
 		// TODO: validate IssuedIdentity
 		userIdentity = ua.IssuedIdentity{TokenData: userIdentityToken.TokenData}
 
 	case ua.X509IdentityToken:
-		var tokenPolicy *ua.UserTokenPolicy
-		for _, t := range ch.LocalEndpoint().UserIdentityTokens {
-			if t.TokenType == ua.UserTokenTypeCertificate && t.PolicyID == userIdentityToken.PolicyID {
-				tokenPolicy = &t
-				break
-			}
-		}
-		if tokenPolicy == nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+		tokenPolicy, status := findUserTokenPolicy(ch.LocalEndpoint(), ua.UserTokenTypeCertificate, userIdentityToken.PolicyID)
+		if status != ua.Good {
+			ch.WriteServiceFault(req.RequestHandle, status, requestid)
 			return nil
 		}
 		secPolicyURI := tokenPolicy.SecurityPolicyURI
@@ -378,102 +321,51 @@ func (srv *UAServer) handleActivateSession(ch *serverSecureChannel, requestid ui
 		}
 		userCert, err := x509.ParseCertificate([]byte(userIdentityToken.CertificateData))
 		if err != nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			ch.WriteServiceFault(req.RequestHandle, ua.BadIdentityTokenInvalid, requestid)
 			return nil
 		}
 		userKey, ok := userCert.PublicKey.(*rsa.PublicKey)
 		if !ok {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			ch.WriteServiceFault(req.RequestHandle, ua.BadIdentityTokenInvalid, requestid)
 			return nil
 		}
 
 		switch secPolicyURI {
 		case ua.SecurityPolicyURIBasic128Rsa15, ua.SecurityPolicyURIBasic256:
 			hash := crypto.SHA1.New()
-			hash.Write(srv.LocalCertificate())
-			hash.Write([]byte(session.SessionNonce()))
+			hash.Write(ch.localCertificate)
+			hash.Write([]byte(nonce))
 			hashed := hash.Sum(nil)
 			err = rsa.VerifyPKCS1v15(userKey, crypto.SHA1, hashed, []byte(req.UserTokenSignature.Signature))
 
 		case ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep:
 			hash := crypto.SHA256.New()
-			hash.Write(srv.LocalCertificate())
-			hash.Write([]byte(session.SessionNonce()))
+			hash.Write(ch.localCertificate)
+			hash.Write([]byte(nonce))
 			hashed := hash.Sum(nil)
 			err = rsa.VerifyPKCS1v15(userKey, crypto.SHA256, hashed, []byte(req.UserTokenSignature.Signature))
 
 		case ua.SecurityPolicyURIAes256Sha256RsaPss:
 			hash := crypto.SHA256.New()
-			hash.Write(srv.LocalCertificate())
-			hash.Write([]byte(session.SessionNonce()))
+			hash.Write(ch.localCertificate)
+			hash.Write([]byte(nonce))
 			hashed := hash.Sum(nil)
 			err = rsa.VerifyPSS(userKey, crypto.SHA256, hashed, []byte(req.UserTokenSignature.Signature), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
 		}
 		if err != nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenRejected,
-					},
-				},
-				requestid,
-			)
+			ch.WriteServiceFault(req.RequestHandle, ua.BadIdentityTokenRejected, requestid)
 			return nil
 		}
 		userIdentity = ua.X509Identity{Certificate: userIdentityToken.CertificateData}
 
 	case ua.UserNameIdentityToken:
-		var tokenPolicy *ua.UserTokenPolicy
-		for _, t := range ch.LocalEndpoint().UserIdentityTokens {
-			if t.TokenType == ua.UserTokenTypeUserName && t.PolicyID == userIdentityToken.PolicyID {
-				tokenPolicy = &t
-				break
-			}
-		}
-		if tokenPolicy == nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+		tokenPolicy, status := findUserTokenPolicy(ch.LocalEndpoint(), ua.UserTokenTypeUserName, userIdentityToken.PolicyID)
+		if status != ua.Good {
+			ch.WriteServiceFault(req.RequestHandle, status, requestid)
 			return nil
 		}
 		if userIdentityToken.UserName == "" {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			ch.WriteServiceFault(req.RequestHandle, ua.BadIdentityTokenInvalid, requestid)
 			return nil
 		}
 		cipherBytes := []byte(userIdentityToken.Password)
@@ -485,153 +377,95 @@ func (srv *UAServer) handleActivateSession(ch *serverSecureChannel, requestid ui
 		switch secPolicyURI {
 		case ua.SecurityPolicyURIBasic128Rsa15:
 			if userIdentityToken.EncryptionAlgorithm != ua.RsaV15KeyWrap {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenInvalid,
-						},
-					},
-					requestid,
-				)
+				ch.WriteServiceFault(req.RequestHandle, ua.BadIdentityTokenInvalid, requestid)
 				return nil
 			}
 			plainBuf := buffer.NewPartitionAt(bufferPool)
 			cipherBuf := buffer.NewPartitionAt(bufferPool)
 			cipherBuf.Write(cipherBytes)
-			cipherText := make([]byte, int32(len(srv.localPrivateKey.D.Bytes())))
+			cipherText := make([]byte, int32(len(ch.localPrivateKey.D.Bytes())))
 			for cipherBuf.Len() > 0 {
 				cipherBuf.Read(cipherText)
 				// decrypt with local private key.
-				plainText, err := rsa.DecryptPKCS1v15(rand.Reader, srv.localPrivateKey, cipherText)
+				plainText, err := rsa.DecryptPKCS1v15(rand.Reader, ch.localPrivateKey, cipherText)
 				if err != nil {
 					return err
 				}
 				plainBuf.Write(plainText)
 			}
-			plainLength := uint32(0)
-			if plainBuf.Len() > 0 {
-				binary.Read(plainBuf, binary.LittleEndian, &plainLength)
-			}
-			if plainLength < 32 || plainLength > 96 {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenRejected,
-						},
-					},
-					requestid,
-				)
-				return nil
-			}
-			passwordBytes := make([]byte, plainLength-32)
-			plainBuf.Read(passwordBytes)
+			secret, _ := ioutil.ReadAll(plainBuf)
 			cipherBuf.Reset()
 			plainBuf.Reset()
-			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: string(passwordBytes)}
+			password, status := srv.parseUserPassword(secret, []byte(nonce))
+			if status != ua.Good {
+				ch.WriteServiceFault(req.RequestHandle, status, requestid)
+				return nil
+			}
+			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: password}
 
 		case ua.SecurityPolicyURIBasic256, ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep:
 			if userIdentityToken.EncryptionAlgorithm != ua.RsaOaepKeyWrap {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenInvalid,
-						},
-					},
-					requestid,
-				)
+				ch.WriteServiceFault(req.RequestHandle, ua.BadIdentityTokenInvalid, requestid)
 				return nil
 			}
 			plainBuf := buffer.NewPartitionAt(bufferPool)
 			cipherBuf := buffer.NewPartitionAt(bufferPool)
 			cipherBuf.Write(cipherBytes)
-			cipherText := make([]byte, int32(len(srv.localPrivateKey.D.Bytes())))
+			cipherText := make([]byte, int32(len(ch.localPrivateKey.D.Bytes())))
 			for cipherBuf.Len() > 0 {
 				cipherBuf.Read(cipherText)
 				// decrypt with local private key.
-				plainText, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, srv.localPrivateKey, cipherText, []byte{})
+				plainText, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, ch.localPrivateKey, cipherText, []byte{})
 				if err != nil {
 					return err
 				}
 				plainBuf.Write(plainText)
 			}
-			plainLength := uint32(0)
-			if plainBuf.Len() > 0 {
-				binary.Read(plainBuf, binary.LittleEndian, &plainLength)
-			}
-			if plainLength < 32 || plainLength > 96 {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenRejected,
-						},
-					},
-					requestid,
-				)
-				return nil
-			}
-			passwordBytes := make([]byte, plainLength-32)
-			plainBuf.Read(passwordBytes)
+			secret, _ := ioutil.ReadAll(plainBuf)
 			cipherBuf.Reset()
 			plainBuf.Reset()
-			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: string(passwordBytes)}
+			password, status := srv.parseUserPassword(secret, []byte(nonce))
+			if status != ua.Good {
+				ch.WriteServiceFault(req.RequestHandle, status, requestid)
+				return nil
+			}
+			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: password}
 
 		case ua.SecurityPolicyURIAes256Sha256RsaPss:
 			if userIdentityToken.EncryptionAlgorithm != ua.RsaOaepSha256KeyWrap {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenInvalid,
-						},
-					},
-					requestid,
-				)
+				ch.WriteServiceFault(req.RequestHandle, ua.BadIdentityTokenInvalid, requestid)
 				return nil
 			}
 			plainBuf := buffer.NewPartitionAt(bufferPool)
 			cipherBuf := buffer.NewPartitionAt(bufferPool)
 			cipherBuf.Write(cipherBytes)
-			cipherText := make([]byte, int32(len(srv.localPrivateKey.D.Bytes())))
+			cipherText := make([]byte, int32(len(ch.localPrivateKey.D.Bytes())))
 			for cipherBuf.Len() > 0 {
 				cipherBuf.Read(cipherText)
 				// decrypt with local private key.
-				plainText, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, srv.localPrivateKey, cipherText, []byte{})
+				plainText, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, ch.localPrivateKey, cipherText, []byte{})
 				if err != nil {
 					return err
 				}
 				plainBuf.Write(plainText)
 			}
-			plainLength := uint32(0)
-			if plainBuf.Len() > 0 {
-				binary.Read(plainBuf, binary.LittleEndian, &plainLength)
+			secret, _ := ioutil.ReadAll(plainBuf)
+			cipherBuf.Reset()
+			plainBuf.Reset()
+			password, status := srv.parseUserPassword(secret, []byte(nonce))
+			if status != ua.Good {
+				ch.WriteServiceFault(req.RequestHandle, status, requestid)
+				return nil
 			}
-			if plainLength < 32 || plainLength > 96 {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenRejected,
-						},
-					},
-					requestid,
-				)
+			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: password}
+
+		case ua.SecurityPolicyURINone:
+			// the password is not encrypted, so it is only accepted if the secure channel encrypts it.
+			if userIdentityToken.EncryptionAlgorithm != "" || ch.LocalEndpoint().SecurityMode != ua.MessageSecurityModeSignAndEncrypt {
+				ch.WriteServiceFault(req.RequestHandle, ua.BadIdentityTokenInvalid, requestid)
 				return nil
 			}
-			passwordBytes := make([]byte, plainLength-32)
-			plainBuf.Read(passwordBytes)
-			cipherBuf.Reset()
-			plainBuf.Reset()
-			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: string(passwordBytes)}
+			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: string(cipherBytes)}
 
 		default:
 			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: string(cipherBytes)}
@@ -639,24 +473,9 @@ func (srv *UAServer) handleActivateSession(ch *serverSecureChannel, requestid ui
 		}
 
 	case ua.AnonymousIdentityToken:
-		var tokenPolicy *ua.UserTokenPolicy
-		for _, t := range ch.LocalEndpoint().UserIdentityTokens {
-			if t.TokenType == ua.UserTokenTypeAnonymous && t.PolicyID == userIdentityToken.PolicyID {
-				tokenPolicy = &t
-				break
-			}
-		}
-		if tokenPolicy == nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+		_, status := findUserTokenPolicy(ch.LocalEndpoint(), ua.UserTokenTypeAnonymous, userIdentityToken.PolicyID)
+		if status != ua.Good {
+			ch.WriteServiceFault(req.RequestHandle, status, requestid)
 			return nil
 		}
 		userIdentity = ua.AnonymousIdentity{}
@@ -666,11 +485,8 @@ func (srv *UAServer) handleActivateSession(ch *serverSecureChannel, requestid ui
 	// authenticate user
 	switch id := userIdentity.(type) {
 	case ua.AnonymousIdentity:
-		if srv.allowAnonymousIdentity {
-			err = nil
-		} else {
-			err = ua.BadUserAccessDenied
-		}
+		// the endpoint only offers an anonymous token policy when anonymous identity is allowed.
+		err = nil
 
 	case ua.UserNameIdentity:
 		if auth := srv.userNameIdentityAuthenticator; auth != nil {
@@ -698,45 +514,31 @@ func (srv *UAServer) handleActivateSession(ch *serverSecureChannel, requestid ui
 
 	}
 	if err != nil {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadUserAccessDenied,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadUserAccessDenied, requestid)
 		return nil
 	}
 
 	// get roles
 	userRoles, err := srv.rolesProvider.GetRoles(userIdentity, ch.remoteApplicationURI, ch.localEndpoint.EndpointURL)
 	if err != nil {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadUserAccessDenied,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadUserAccessDenied, requestid)
 		return nil
 	}
 
+	// each nonce is used once, so the signature cannot be replayed, even by a concurrent request.
+	if !session.swapSessionNonce(nonce, ua.ByteString(getNextNonce(sessionNonceLength(ch.SecurityPolicyURI())))) {
+		ch.WriteServiceFault(req.RequestHandle, ua.BadApplicationSignatureInvalid, requestid)
+		return nil
+	}
 	session.SetUserIdentity(userIdentity)
 	session.SetUserRoles(userRoles)
-	session.SetSessionNonce(ua.ByteString(getNextNonce(nonceLength)))
 	session.SetSecureChannelId(ch.ChannelID())
-	session.localeIds = req.LocaleIDs
+	session.SetLocaleIDs(req.LocaleIDs)
 
 	ch.Write(
 		&ua.ActivateSessionResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			ServerNonce:     session.SessionNonce(),
@@ -748,55 +550,60 @@ func (srv *UAServer) handleActivateSession(ch *serverSecureChannel, requestid ui
 	return nil
 }
 
-// closeSession closes a session.
-func (srv *UAServer) handleCloseSession(ch *serverSecureChannel, requestid uint32, req *ua.CloseSessionRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
+// parseUserPassword returns the password of the decrypted secret of a UserNameIdentityToken, which is the length
+// of the remainder, the password and the server nonce. The secret must end with the current nonce of the session,
+// so a secret captured from an earlier activation is rejected.
+func (srv *UAServer) parseUserPassword(secret, serverNonce []byte) (string, ua.StatusCode) {
+	if len(secret) < 4 {
+		return "", ua.BadIdentityTokenRejected
 	}
-	// get session
-	session, ok := srv.sessionManager.Get(req.AuthenticationToken)
-	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
+	length := binary.LittleEndian.Uint32(secret)
+	secret = secret[4:]
+	if uint64(length) > uint64(len(secret)) || uint64(length) < uint64(len(serverNonce)) {
+		return "", ua.BadIdentityTokenRejected
 	}
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		return nil
+	passwordLength := length - uint32(len(serverNonce))
+	if passwordLength < srv.minPasswordLength || passwordLength > srv.maxPasswordLength {
+		return "", ua.BadIdentityTokenRejected
 	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
+	if subtle.ConstantTimeCompare(secret[passwordLength:length], serverNonce) != 1 {
+		return "", ua.BadIdentityTokenRejected
+	}
+	return string(secret[:passwordLength]), ua.Good
+}
+
+// findUserTokenPolicy returns the policy of the endpoint for the token type with the policy id. The status is
+// BadIdentityTokenRejected if the endpoint does not accept the token type, whatever the server allows on other
+// endpoints, or BadIdentityTokenInvalid if no policy of the token type has the policy id.
+func findUserTokenPolicy(ep ua.EndpointDescription, tokenType ua.UserTokenType, policyID string) (*ua.UserTokenPolicy, ua.StatusCode) {
+	status := ua.BadIdentityTokenRejected
+	for _, t := range ep.UserIdentityTokens {
+		if t.TokenType != tokenType {
+			continue
+		}
+		if t.PolicyID == policyID {
+			return &t, ua.Good
+		}
+		status = ua.BadIdentityTokenInvalid
+	}
+	return nil, status
+}
+
+// sessionNonceLength returns the length of the nonces of a session created on a secure channel with the
+// security policy. The client nonce must be at least this long.
+func sessionNonceLength(securityPolicyURI string) int {
+	switch securityPolicyURI {
+	case ua.SecurityPolicyURIBasic128Rsa15:
+		return 16
+	default:
+		return nonceLength
+	}
+}
+
+// closeSession closes a session.
+func (srv *UAServer) handleCloseSession(ch *serverSecureChannel, requestid uint32, req *ua.CloseSessionRequest) error {
+	session, ok := srv.authorize(ch, requestid, req)
+	if !ok {
 		return nil
 	}
 
@@ -812,12 +619,12 @@ func (srv *UAServer) handleCloseSession(ch *serverSecureChannel, requestid uint3
 	// delete session
 	srv.sessionManager.Delete(session)
 
-	// log.Printf("Deleted session '%s'.\n", session.SessionName())
+	srv.Logger().Debugf("Deleted session '%s'.", session.SessionName())
 
 	ch.Write(
 		&ua.CloseSessionResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 		},
@@ -828,60 +635,14 @@ func (srv *UAServer) handleCloseSession(ch *serverSecureChannel, requestid uint3
 
 // handleCancel cancels a request.
 func (srv *UAServer) handleCancel(ch *serverSecureChannel, requestid uint32, req *ua.CancelRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.sessionManager.Get(req.AuthenticationToken)
-	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
+	if _, ok := srv.authorize(ch, requestid, req); !ok {
 		return nil
 	}
 
 	ch.Write(
 		&ua.CancelResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 		},
@@ -896,125 +657,42 @@ func (srv *UAServer) handleCancel(ch *serverSecureChannel, requestid uint32, req
 // DeleteReferences deletes one or more References of a Node.
 
 func (srv *UAServer) handleBrowse(ch *serverSecureChannel, requestid uint32, req *ua.BrowseRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.browseCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.browseErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.browseErrorCount++
-		session.errorCount++
 		return nil
 	}
 
+	// the members of the view, or nil to browse the entire address space. Only references to members are returned.
+	var viewMembers map[ua.NodeID]struct{}
 	if req.View.ViewID != nil {
 		m := srv.NamespaceManager()
 		n, ok := m.FindNode(req.View.ViewID)
 		if !ok {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadViewIDUnknown,
-					},
-				},
-				requestid,
-			)
+			ch.WriteServiceFault(req.RequestHandle, ua.BadViewIDUnknown, requestid)
 			session.browseErrorCount++
 			session.errorCount++
 			return nil
 		}
 		if n.GetNodeClass() != ua.NodeClassView {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadViewIDUnknown,
-					},
-				},
-				requestid,
-			)
+			ch.WriteServiceFault(req.RequestHandle, ua.BadViewIDUnknown, requestid)
 			session.browseErrorCount++
 			session.errorCount++
 			return nil
 		}
+		// a stale ViewVersion is not an error, the current members of the view are browsed.
+		viewMembers = m.ViewMembers(req.View.ViewID)
 	}
 
 	l := len(req.NodesToBrowse)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.browseErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerBrowse) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.browseErrorCount++
 		session.errorCount++
 		return nil
@@ -1076,7 +754,13 @@ func (srv *UAServer) handleBrowse(ch *serverSecureChannel, requestid uint32, req
 				if !(allTypes || d.ReferenceTypeID == r.ReferenceTypeID || (d.IncludeSubtypes && m.IsSubtype(r.ReferenceTypeID, d.ReferenceTypeID))) {
 					continue
 				}
-				t, ok := m.FindNode(ua.ToNodeID(r.TargetID, srv.NamespaceUris()))
+				targetID := ua.ToNodeID(r.TargetID, srv.NamespaceUris())
+				if viewMembers != nil {
+					if _, ok := viewMembers[targetID]; !ok {
+						continue
+					}
+				}
+				t, ok := m.FindNode(targetID)
 				if !ok {
 					results[i] = ua.BrowseResult{StatusCode: ua.BadNodeIDUnknown}
 					wg.Done()
@@ -1132,15 +816,13 @@ func (srv *UAServer) handleBrowse(ch *serverSecureChannel, requestid uint32, req
 				})
 			}
 
-			if max := int(req.RequestedMaxReferencesPerNode); max > 0 && len(rds) > max {
-				cp, err := session.addBrowseContinuationPoint(rds[max:], max)
-				if err != nil {
-					results[i] = ua.BrowseResult{
-						StatusCode: ua.BadNoContinuationPoints,
-					}
-					wg.Done()
-					return
-				}
+			max := int(req.RequestedMaxReferencesPerNode)
+			// the server limit keeps the response within the message size when the client requests no limit.
+			if limit := int(srv.maxReferencesPerNode); limit > 0 && (max == 0 || max > limit) {
+				max = limit
+			}
+			if max > 0 && len(rds) > max {
+				cp := session.addBrowseContinuationPoint(rds[max:], max)
 				results[i] = ua.BrowseResult{
 					ContinuationPoint: ua.ByteString(cp),
 					References:        rds[:max],
@@ -1162,7 +844,7 @@ func (srv *UAServer) handleBrowse(ch *serverSecureChannel, requestid uint32, req
 		ch.Write(
 			&ua.BrowseResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHandle,
 				},
 				Results: results,
@@ -1174,90 +856,21 @@ func (srv *UAServer) handleBrowse(ch *serverSecureChannel, requestid uint32, req
 }
 
 func (srv *UAServer) handleBrowseNext(ch *serverSecureChannel, requestid uint32, req *ua.BrowseNextRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.browseNextCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.browseNextErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.browseNextErrorCount++
-		session.errorCount++
 		return nil
 	}
 
 	l := len(req.ContinuationPoints)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.browseNextErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerBrowse) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.browseNextErrorCount++
 		session.errorCount++
 		return nil
@@ -1296,14 +909,7 @@ func (srv *UAServer) handleBrowseNext(ch *serverSecureChannel, requestid uint32,
 				return
 			}
 			if len(rds) > max {
-				cp, err := session.addBrowseContinuationPoint(rds[max:], max)
-				if err != nil {
-					results[i] = ua.BrowseResult{
-						StatusCode: ua.BadNoContinuationPoints,
-					}
-					wg.Done()
-					return
-				}
+				cp := session.addBrowseContinuationPoint(rds[max:], max)
 				results[i] = ua.BrowseResult{
 					ContinuationPoint: ua.ByteString(cp),
 					References:        rds[:max],
@@ -1324,7 +930,7 @@ func (srv *UAServer) handleBrowseNext(ch *serverSecureChannel, requestid uint32,
 		ch.Write(
 			&ua.BrowseNextResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 				},
 				Results: results,
@@ -1336,90 +942,21 @@ func (srv *UAServer) handleBrowseNext(ch *serverSecureChannel, requestid uint32,
 }
 
 func (srv *UAServer) handleTranslateBrowsePathsToNodeIds(ch *serverSecureChannel, requestid uint32, req *ua.TranslateBrowsePathsToNodeIDsRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.translateBrowsePathsToNodeIdsCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.translateBrowsePathsToNodeIdsErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.translateBrowsePathsToNodeIdsErrorCount++
-		session.errorCount++
 		return nil
 	}
 
 	l := len(req.BrowsePaths)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.translateBrowsePathsToNodeIdsErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerTranslateBrowsePathsToNodeIds) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.translateBrowsePathsToNodeIdsErrorCount++
 		session.errorCount++
 		return nil
@@ -1484,7 +1021,7 @@ func (srv *UAServer) handleTranslateBrowsePathsToNodeIds(ch *serverSecureChannel
 		ch.Write(
 			&ua.TranslateBrowsePathsToNodeIDsResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 				},
 				Results: results,
@@ -1496,104 +1033,41 @@ func (srv *UAServer) handleTranslateBrowsePathsToNodeIds(ch *serverSecureChannel
 }
 
 func (srv *UAServer) handleRegisterNodes(ch *serverSecureChannel, requestid uint32, req *ua.RegisterNodesRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.registerNodesCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.registerNodesErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.registerNodesErrorCount++
-		session.errorCount++
 		return nil
 	}
 
 	l := len(req.NodesToRegister)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.registerNodesErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerRegisterNodes) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.registerNodesErrorCount++
 		session.errorCount++
 		return nil
 	}
 	results := make([]ua.NodeID, l)
 
+	// resolve the nodes now, and return handles, so later reads and writes of the session skip the lookup.
+	// Unknown nodes are returned as is, since the server need not validate them.
+	m := srv.NamespaceManager()
 	for ii := 0; ii < l; ii++ {
 		results[ii] = req.NodesToRegister[ii]
+		if n, ok := m.FindNode(results[ii]); ok {
+			results[ii] = session.registeredNodes.add(m, n)
+		}
 	}
 
 	ch.Write(
 		&ua.RegisterNodesResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			RegisteredNodeIDs: results,
@@ -1604,99 +1078,35 @@ func (srv *UAServer) handleRegisterNodes(ch *serverSecureChannel, requestid uint
 }
 
 func (srv *UAServer) handleUnregisterNodes(ch *serverSecureChannel, requestid uint32, req *ua.UnregisterNodesRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.unregisterNodesCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.unregisterNodesErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.unregisterNodesErrorCount++
-		session.errorCount++
 		return nil
 	}
 
 	l := len(req.NodesToUnregister)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.unregisterNodesErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerRegisterNodes) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.unregisterNodesErrorCount++
 		session.errorCount++
 		return nil
 	}
 
+	// handles that were not registered are ignored.
+	for _, id := range req.NodesToUnregister {
+		session.registeredNodes.remove(id)
+	}
+
 	ch.Write(
 		&ua.UnregisterNodesResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 		},
@@ -1782,92 +1192,25 @@ func (srv *UAServer) target(nodeID ua.NodeID, element ua.RelativePathElement) ([
 
 // Read returns a list of Node attributes.
 func (srv *UAServer) handleRead(ch *serverSecureChannel, requestid uint32, req *ua.ReadRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
-	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.readCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.readErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.readErrorCount++
-		session.errorCount++
+	session, ok := srv.authorize(ch, requestid, req)
+	if !ok {
 		return nil
 	}
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, SessionKey, session)
+	ctx = context.WithValue(ctx, userPermissionCacheKey, newUserPermissionCache(session))
 
 	// check MaxAge
 	if req.MaxAge < 0.0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadMaxAgeInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadMaxAgeInvalid, requestid)
 		session.readErrorCount++
 		session.errorCount++
 		return nil
 	}
+	ctx = context.WithValue(ctx, maxAgeKey, req.MaxAge)
 	// check TimestampsToReturn
 	if req.TimestampsToReturn < ua.TimestampsToReturnSource || req.TimestampsToReturn > ua.TimestampsToReturnNeither {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTimestampsToReturnInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTimestampsToReturnInvalid, requestid)
 		session.readErrorCount++
 		session.errorCount++
 		return nil
@@ -1875,37 +1218,37 @@ func (srv *UAServer) handleRead(ch *serverSecureChannel, requestid uint32, req *
 	// check nothing to do
 	l := len(req.NodesToRead)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.readErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerRead) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.readErrorCount++
 		session.errorCount++
 		return nil
 	}
 
+	// prefer a single transaction with the device, if the plugin supports it
+	if reader, ok := srv.batchReader(req.NodesToRead); ok {
+		go func() {
+			results := srv.readBatch(ctx, reader, req.NodesToRead)
+			ch.Write(
+				&ua.ReadResponse{
+					ResponseHeader: ua.ResponseHeader{
+						Timestamp:     srv.now(),
+						RequestHandle: req.RequestHandle,
+					},
+					Results: selectTimestamps(results, req.TimestampsToReturn),
+				},
+				requestid,
+			)
+		}()
+		return nil
+	}
+
 	results := make([]ua.DataValue, l)
 	wp := srv.WorkerPool()
 	wg := sync.WaitGroup{}
@@ -1925,7 +1268,7 @@ func (srv *UAServer) handleRead(ch *serverSecureChannel, requestid uint32, req *
 		ch.Write(
 			&ua.ReadResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHandle,
 				},
 				Results: selectTimestamps(results, req.TimestampsToReturn),
@@ -1938,59 +1281,8 @@ func (srv *UAServer) handleRead(ch *serverSecureChannel, requestid uint32, req *
 
 // Write sets a list of Node attributes.
 func (srv *UAServer) handleWrite(ch *serverSecureChannel, requestid uint32, req *ua.WriteRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.writeCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.writeErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.writeErrorCount++
-		session.errorCount++
 		return nil
 	}
 	ctx := context.Background()
@@ -1999,32 +1291,14 @@ func (srv *UAServer) handleWrite(ch *serverSecureChannel, requestid uint32, req
 	// check nothing to do
 	l := len(req.NodesToWrite)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.writeErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerWrite) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.writeErrorCount++
 		session.errorCount++
 		return nil
@@ -2032,16 +1306,33 @@ func (srv *UAServer) handleWrite(ch *serverSecureChannel, requestid uint32, req
 
 	results := make([]ua.StatusCode, l)
 
+	// index range writes to the same variable form one task, so its value is copied once.
+	tasks := make([][]int, 0, l)
+	ranges := make(map[ua.NodeID]int)
+	for i, n := range req.NodesToWrite {
+		if n.AttributeID == ua.AttributeIDValue && n.IndexRange != "" {
+			if t, ok := ranges[n.NodeID]; ok {
+				tasks[t] = append(tasks[t], i)
+				continue
+			}
+			ranges[n.NodeID] = len(tasks)
+		}
+		tasks = append(tasks, []int{i})
+	}
+
 	// handle requests in parallel using server thread pool.
 	wp := srv.WorkerPool()
 	wg := sync.WaitGroup{}
-	wg.Add(l)
+	wg.Add(len(tasks))
 
-	for ii := 0; ii < l; ii++ {
-		i := ii
+	for _, t := range tasks {
+		task := t
 		wp.Submit(func() {
-			n := req.NodesToWrite[i]
-			results[i] = srv.writeValue(ctx, n)
+			if len(task) == 1 {
+				results[task[0]] = srv.writeValue(ctx, req.NodesToWrite[task[0]])
+			} else {
+				srv.writeRanges(ctx, req.NodesToWrite, task, results)
+			}
 			wg.Done()
 		})
 	}
@@ -2051,7 +1342,7 @@ func (srv *UAServer) handleWrite(ch *serverSecureChannel, requestid uint32, req
 		ch.Write(
 			&ua.WriteResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now().UTC(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 				},
 				Results: results,
@@ -2065,59 +1356,8 @@ func (srv *UAServer) handleWrite(ch *serverSecureChannel, requestid uint32, req
 
 // HistoryRead returns a list of historical values.
 func (srv *UAServer) handleHistoryRead(ch *serverSecureChannel, requestid uint32, req *ua.HistoryReadRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	// session.readCount++
-	// session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		// session.readErrorCount++
-		// session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		// session.readErrorCount++
-		// session.errorCount++
 		return nil
 	}
 	ctx := context.Background()
@@ -2125,16 +1365,7 @@ func (srv *UAServer) handleHistoryRead(ch *serverSecureChannel, requestid uint32
 
 	// check TimestampsToReturn
 	if req.TimestampsToReturn < ua.TimestampsToReturnSource || req.TimestampsToReturn > ua.TimestampsToReturnBoth {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadInvalidTimestampArgument,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadInvalidTimestampArgument, requestid)
 		// session.readErrorCount++
 		// session.errorCount++
 		return nil
@@ -2142,32 +1373,14 @@ func (srv *UAServer) handleHistoryRead(ch *serverSecureChannel, requestid uint32
 	// check nothing to do
 	l := len(req.NodesToRead)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		// session.readErrorCount++
 		// session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryReadData) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		// session.readErrorCount++
 		// session.errorCount++
 		return nil
@@ -2175,27 +1388,24 @@ func (srv *UAServer) handleHistoryRead(ch *serverSecureChannel, requestid uint32
 
 	// check if historian installed
 	h := srv.historian
-	if h == nil {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadHistoryOperationUnsupported,
-				},
-			},
-			requestid,
-		)
+	_, readEvent := req.HistoryReadDetails.(ua.ReadEventDetails)
+	if h == nil && !(readEvent && srv.eventHistory != nil) {
+		ch.WriteServiceFault(req.RequestHandle, ua.BadHistoryOperationUnsupported, requestid)
 		return nil
 	}
 
 	switch details := req.HistoryReadDetails.(type) {
 	case ua.ReadEventDetails:
-		results, status := h.ReadEvent(ctx, req.NodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+		results, status := srv.historyRead(session, req.NodesToRead, func(nodes []ua.HistoryReadValueID) ([]ua.HistoryReadResult, ua.StatusCode) {
+			if srv.eventHistory != nil {
+				return srv.eventHistory.ReadEvent(ctx, nodes, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+			}
+			return h.ReadEvent(ctx, nodes, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+		})
 		ch.Write(
 			&ua.HistoryReadResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 					ServiceResult: status,
 				},
@@ -2206,11 +1416,13 @@ func (srv *UAServer) handleHistoryRead(ch *serverSecureChannel, requestid uint32
 		return nil
 
 	case ua.ReadRawModifiedDetails:
-		results, status := h.ReadRawModified(ctx, req.NodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+		results, status := srv.historyRead(session, req.NodesToRead, func(nodes []ua.HistoryReadValueID) ([]ua.HistoryReadResult, ua.StatusCode) {
+			return h.ReadRawModified(ctx, nodes, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+		})
 		ch.Write(
 			&ua.HistoryReadResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 					ServiceResult: status,
 				},
@@ -2221,11 +1433,13 @@ func (srv *UAServer) handleHistoryRead(ch *serverSecureChannel, requestid uint32
 		return nil
 
 	case ua.ReadProcessedDetails:
-		results, status := h.ReadProcessed(ctx, req.NodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+		results, status := srv.historyRead(session, req.NodesToRead, func(nodes []ua.HistoryReadValueID) ([]ua.HistoryReadResult, ua.StatusCode) {
+			return h.ReadProcessed(ctx, nodes, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+		})
 		ch.Write(
 			&ua.HistoryReadResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 					ServiceResult: status,
 				},
@@ -2236,11 +1450,13 @@ func (srv *UAServer) handleHistoryRead(ch *serverSecureChannel, requestid uint32
 		return nil
 
 	case ua.ReadAtTimeDetails:
-		results, status := h.ReadAtTime(ctx, req.NodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+		results, status := srv.historyRead(session, req.NodesToRead, func(nodes []ua.HistoryReadValueID) ([]ua.HistoryReadResult, ua.StatusCode) {
+			return h.ReadAtTime(ctx, nodes, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+		})
 		ch.Write(
 			&ua.HistoryReadResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 					ServiceResult: status,
 				},
@@ -2251,19 +1467,48 @@ func (srv *UAServer) handleHistoryRead(ch *serverSecureChannel, requestid uint32
 		return nil
 	}
 
-	ch.Write(
-		&ua.ServiceFault{
-			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
-				RequestHandle: req.RequestHandle,
-				ServiceResult: ua.BadHistoryOperationInvalid,
-			},
-		},
-		requestid,
-	)
+	ch.WriteServiceFault(req.RequestHandle, ua.BadHistoryOperationInvalid, requestid)
 	return nil
 }
 
+// historyRead calls read with the continuation points of the historian in place of those issued by the session,
+// and replaces the continuation points returned by the historian with new ones issued by the session. A node with
+// an unknown or released continuation point is not passed to read.
+func (srv *UAServer) historyRead(session *Session, nodesToRead []ua.HistoryReadValueID, read func(nodes []ua.HistoryReadValueID) ([]ua.HistoryReadResult, ua.StatusCode)) ([]ua.HistoryReadResult, ua.StatusCode) {
+	results := make([]ua.HistoryReadResult, len(nodesToRead))
+	nodes := make([]ua.HistoryReadValueID, 0, len(nodesToRead))
+	indexes := make([]int, 0, len(nodesToRead))
+	for i, n := range nodesToRead {
+		if len(n.ContinuationPoint) > 0 {
+			cp, ok := session.removeHistoryContinuationPoint([]byte(n.ContinuationPoint))
+			if !ok {
+				results[i] = ua.HistoryReadResult{StatusCode: ua.BadContinuationPointInvalid}
+				continue
+			}
+			n.ContinuationPoint = ua.ByteString(cp)
+		}
+		nodes = append(nodes, n)
+		indexes = append(indexes, i)
+	}
+	if len(nodes) == 0 {
+		return results, ua.Good
+	}
+	res, status := read(nodes)
+	if status.IsBad() {
+		return res, status
+	}
+	for j, r := range res {
+		if j >= len(indexes) {
+			break
+		}
+		if len(r.ContinuationPoint) > 0 {
+			r.ContinuationPoint = ua.ByteString(session.addHistoryContinuationPoint([]byte(r.ContinuationPoint)))
+		}
+		results[indexes[j]] = r
+	}
+	return results, status
+}
+
 // readRange returns slice of value specified by IndexRange
 func readRange(source ua.DataValue, indexRange string) ua.DataValue {
 	if indexRange == "" {
@@ -2598,10 +1843,10 @@ func readRange(source ua.DataValue, indexRange string) ua.DataValue {
 	}
 }
 
-// writeRange sets subset of value specified by IndexRange
-func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.DataValue, ua.StatusCode) {
+// writeRange sets subset of value specified by IndexRange, stamped with the time now.
+func writeRange(source ua.DataValue, value ua.DataValue, indexRange string, now time.Time) (ua.DataValue, ua.StatusCode) {
 	if indexRange == "" {
-		return ua.NewDataValue(value.Value, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(value.Value, value.StatusCode, now, 0, now, 0), ua.Good
 	}
 	ranges := strings.Split(indexRange, ",")
 	switch src := source.Value.(type) {
@@ -2621,7 +1866,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]rune, len(v1))
 		copy(dst, v1)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(string(dst), value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(string(dst), value.StatusCode, now, 0, now, 0), ua.Good
 	case ua.ByteString:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2637,7 +1882,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]byte, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(ua.ByteString(dst), value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(ua.ByteString(dst), value.StatusCode, now, 0, now, 0), ua.Good
 	case []bool:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2653,7 +1898,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]bool, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []int8:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2669,7 +1914,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]int8, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []byte:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2685,7 +1930,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]byte, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []int16:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2701,7 +1946,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]int16, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []uint16:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2717,7 +1962,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]uint16, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []int32:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2733,7 +1978,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]int32, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []uint32:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2749,7 +1994,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]uint32, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []int64:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2765,7 +2010,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]int64, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []uint64:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2781,7 +2026,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]uint64, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []float32:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2797,7 +2042,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]float32, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []float64:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2813,7 +2058,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]float64, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []string:
 		if len(ranges) > 2 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2829,7 +2074,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]string, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []time.Time:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2845,7 +2090,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]time.Time, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []uuid.UUID:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2861,7 +2106,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]uuid.UUID, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.ByteString:
 		if len(ranges) > 2 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2877,7 +2122,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.ByteString, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.XMLElement:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2893,7 +2138,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.XMLElement, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.NodeID:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2909,7 +2154,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.NodeID, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.ExpandedNodeID:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2925,7 +2170,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.ExpandedNodeID, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.StatusCode:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2941,7 +2186,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.StatusCode, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.QualifiedName:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2957,7 +2202,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.QualifiedName, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.LocalizedText:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2973,7 +2218,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.LocalizedText, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.ExtensionObject:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2989,7 +2234,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.ExtensionObject, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.DataValue:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -3005,7 +2250,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.DataValue, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.Variant:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -3021,7 +2266,7 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.Variant, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	case []ua.DiagnosticInfo:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -3037,12 +2282,118 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		dst := make([]ua.DiagnosticInfo, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, now, 0, now, 0), ua.Good
 	default:
 		return ua.NilDataValue, ua.BadIndexRangeNoData
 	}
 }
 
+// AccessLevelArrayExtend is a server specific bit of the AccessLevel of an array variable. If set, writing with an
+// index range beyond the end of the array extends the array, filling any gap with zero values.
+const AccessLevelArrayExtend byte = 0x80
+
+// extendArray returns the source extended with zero values to hold the last index of the range, up to
+// maxArrayLength. Sources that already hold the range, and multi-dimensional ranges, are returned unchanged.
+func extendArray(source ua.DataValue, value ua.DataValue, indexRange string, maxArrayLength uint32) (ua.DataValue, ua.StatusCode) {
+	if strings.Contains(indexRange, ",") {
+		return source, ua.Good
+	}
+	last := indexRange
+	if index := strings.Index(indexRange, ":"); index != -1 {
+		last = indexRange[index+1:]
+	}
+	hi, err := strconv.ParseInt(last, 10, 32)
+	if err != nil || hi < 0 {
+		// let writeRange report the invalid range.
+		return source, ua.Good
+	}
+	length := int(hi) + 1
+	// an empty array takes the type of the value written.
+	typ := reflect.TypeOf(source.Value)
+	if source.Value == nil {
+		typ = reflect.TypeOf(value.Value)
+	}
+	if typ == nil || typ.Kind() != reflect.Slice {
+		return source, ua.Good
+	}
+	src := reflect.ValueOf(source.Value)
+	if source.Value != nil && src.Len() >= length {
+		return source, ua.Good
+	}
+	if length > int(maxArrayLength) {
+		return ua.NilDataValue, ua.BadOutOfRange
+	}
+	dst := reflect.MakeSlice(typ, length, length)
+	if source.Value != nil {
+		reflect.Copy(dst, src)
+	}
+	source.Value = dst.Interface()
+	return source, ua.Good
+}
+
+// rangeWrite holds the value of a variable while the index ranges of a Write request are written to it.
+type rangeWrite struct {
+	now     time.Time
+	node    *VariableNode
+	value   ua.DataValue
+	owned   bool
+	changed bool
+}
+
+// accepts returns true if the index ranges written to the node may be applied to one copy of its value.
+func (w *rangeWrite) accepts(n *VariableNode) bool {
+	if w.node != nil && w.node != n {
+		return false
+	}
+	return n.GetAccessLevel()&AccessLevelArrayExtend == 0
+}
+
+// write writes the value to the index range of the copy of the value of the node. The copy is made by the first
+// write, and later writes of a one-dimensional range update it in place.
+func (w *rangeWrite) write(n *VariableNode, value ua.DataValue, indexRange string) ua.StatusCode {
+	if w.node == nil {
+		w.node = n
+		w.value = n.GetValue()
+	}
+	dst := reflect.ValueOf(w.value.Value)
+	src := reflect.ValueOf(value.Value)
+	if indexRange == "" || strings.Contains(indexRange, ",") || dst.Kind() != reflect.Slice || src.Kind() != reflect.Slice || src.Type() != dst.Type() {
+		result, status := writeRange(w.value, value, indexRange, w.now)
+		if status == ua.Good {
+			w.value, w.owned, w.changed = result, true, true
+		}
+		return status
+	}
+	i, j, status := parseBounds(indexRange, dst.Len())
+	if status.IsBad() {
+		return status
+	}
+	if j-i != src.Len() {
+		return ua.BadIndexRangeNoData
+	}
+	if !w.owned {
+		clone := reflect.MakeSlice(dst.Type(), dst.Len(), dst.Len())
+		reflect.Copy(clone, dst)
+		dst, w.owned = clone, true
+	}
+	reflect.Copy(dst.Slice(i, j), src)
+	w.value, w.changed = ua.NewDataValue(dst.Interface(), value.StatusCode, w.now, 0, w.now, 0), true
+	return ua.Good
+}
+
+// writeRanges writes the values to the index ranges of one variable in order, copying its value once, then sets
+// the value of the variable.
+func (srv *UAServer) writeRanges(ctx context.Context, nodesToWrite []ua.WriteValue, indices []int, results []ua.StatusCode) {
+	w := &rangeWrite{now: srv.now()}
+	ctx = context.WithValue(ctx, rangeWriteKey, w)
+	for _, i := range indices {
+		results[i] = srv.writeValue(ctx, nodesToWrite[i])
+	}
+	if w.changed {
+		w.node.SetValue(w.value)
+	}
+}
+
 func parseBounds(s string, length int) (int, int, ua.StatusCode) {
 	lo := int64(-1)
 	hi := int64(-1)
@@ -3099,84 +2450,35 @@ func parseBounds(s string, length int) (int, int, ua.StatusCode) {
 	return int(lo), int(hi), ua.Good
 }
 
-// selectTimestamps returns new instances of DataValue with only the selected timestamps.
+// selectTimestamps clears the timestamps that are not selected, in place. The values are returned unchanged if both
+// timestamps are selected, and a value is only written if it has a timestamp to clear.
 func selectTimestamps(values []ua.DataValue, timestampsToReturn ua.TimestampsToReturn) []ua.DataValue {
+	var source, server bool
 	switch timestampsToReturn {
 	case ua.TimestampsToReturnSource:
-		for i, value := range values {
-			values[i] = ua.NewDataValue(value.Value, value.StatusCode, value.SourceTimestamp, 0, time.Time{}, 0)
-		}
-		return values
+		source = true
 	case ua.TimestampsToReturnServer:
-		for i, value := range values {
-			values[i] = ua.NewDataValue(value.Value, value.StatusCode, time.Time{}, 0, value.ServerTimestamp, 0)
-		}
-		return values
+		server = true
 	case ua.TimestampsToReturnNeither:
-		for i, value := range values {
-			values[i] = ua.NewDataValue(value.Value, value.StatusCode, time.Time{}, 0, time.Time{}, 0)
-		}
-		return values
 	default:
 		return values
 	}
+	for i := range values {
+		v := &values[i]
+		if !source && (!v.SourceTimestamp.IsZero() || v.SourcePicoseconds != 0) {
+			v.SourceTimestamp, v.SourcePicoseconds = time.Time{}, 0
+		}
+		if !server && (!v.ServerTimestamp.IsZero() || v.ServerPicoseconds != 0) {
+			v.ServerTimestamp, v.ServerPicoseconds = time.Time{}, 0
+		}
+	}
+	return values
 }
 
 // Call invokes a list of Methods.
 func (srv *UAServer) handleCall(ch *serverSecureChannel, requestid uint32, req *ua.CallRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.callCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.callErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.callErrorCount++
-		session.errorCount++
 		return nil
 	}
 	ctx := context.Background()
@@ -3184,32 +2486,14 @@ func (srv *UAServer) handleCall(ch *serverSecureChannel, requestid uint32, req *
 
 	l := len(req.MethodsToCall)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.callErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerMethodCall) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.callErrorCount++
 		session.errorCount++
 		return nil
@@ -3225,55 +2509,7 @@ func (srv *UAServer) handleCall(ch *serverSecureChannel, requestid uint32, req *
 	for ii := 0; ii < l; ii++ {
 		i := ii
 		wp.Submit(func() {
-			n := req.MethodsToCall[i]
-			m := srv.NamespaceManager()
-			n1, ok := m.FindNode(n.ObjectID)
-			if !ok {
-				results[i] = ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
-				wg.Done()
-				return
-			}
-			rp := n1.GetUserRolePermissions(ctx)
-			if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
-				results[i] = ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
-				wg.Done()
-				return
-			}
-			switch n1.(type) {
-			case *ObjectNode:
-			case *ObjectTypeNode:
-			default:
-				results[i] = ua.CallMethodResult{StatusCode: ua.BadNodeClassInvalid}
-				wg.Done()
-				return
-			}
-			n2, ok := m.FindNode(n.MethodID)
-			if !ok {
-				results[i] = ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
-				wg.Done()
-				return
-			}
-			rp = n2.GetUserRolePermissions(ctx)
-			if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
-				results[i] = ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
-				wg.Done()
-				return
-			}
-			// TODO: check if method is hasComponent of object or objectType
-			switch n3 := n2.(type) {
-			case *MethodNode:
-				if !n3.UserExecutable(ctx) {
-					results[i] = ua.CallMethodResult{StatusCode: ua.BadUserAccessDenied}
-				} else {
-					if n3.callMethodHandler != nil {
-						results[i] = n3.callMethodHandler(ctx, n)
-					} else {
-						results[i] = ua.CallMethodResult{StatusCode: ua.BadNotImplemented}
-					}
-				}
-			default:
-				results[i] = ua.CallMethodResult{StatusCode: ua.BadAttributeIDInvalid}
-			}
+			results[i] = srv.callMethod(ctx, req.MethodsToCall[i])
 			wg.Done()
 		})
 	}
@@ -3283,7 +2519,7 @@ func (srv *UAServer) handleCall(ch *serverSecureChannel, requestid uint32, req *
 		ch.Write(
 			&ua.CallResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 				},
 				Results: results,
@@ -3294,61 +2530,59 @@ func (srv *UAServer) handleCall(ch *serverSecureChannel, requestid uint32, req *
 	return nil
 }
 
-// CreateMonitoredItems creates and adds one or more MonitoredItems to a Subscription.
-func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, requestid uint32, req *ua.CreateMonitoredItemsRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
+// callMethod calls the method of the object.
+func (srv *UAServer) callMethod(ctx context.Context, n ua.CallMethodRequest) ua.CallMethodResult {
+	m := srv.NamespaceManager()
+	n1, ok := m.FindNode(n.ObjectID)
+	if !ok {
+		return ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
 	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	rp := n1.GetUserRolePermissions(ctx)
+	if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+		return ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
+	}
+	switch n1.(type) {
+	case *ObjectNode:
+	case *ObjectTypeNode:
+	default:
+		// the condition of a limit alarm is the variable itself, only acknowledged and confirmed.
+		if !isConditionMethod(n.MethodID) {
+			return ua.CallMethodResult{StatusCode: ua.BadNodeClassInvalid}
+		}
+		if _, ok := m.findCondition(n.ObjectID); !ok {
+			return ua.CallMethodResult{StatusCode: ua.BadNodeClassInvalid}
+		}
+	}
+	n2, ok := m.FindNode(n.MethodID)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
+		return ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
 	}
-	session.createMonitoredItemsCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.createMonitoredItemsErrorCount++
-		session.errorCount++
-		return nil
+	rp = n2.GetUserRolePermissions(ctx)
+	if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+		return ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
 	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.createMonitoredItemsErrorCount++
-		session.errorCount++
+	// TODO: check if method is hasComponent of object or objectType
+	switch n3 := n2.(type) {
+	case *MethodNode:
+		if !IsUserPermitted(rp, ua.PermissionTypeCall) || !n3.UserExecutable(ctx) {
+			return ua.CallMethodResult{StatusCode: ua.BadUserAccessDenied}
+		}
+		if status, results := srv.validateInputArguments(n3, n.InputArguments); status != ua.Good {
+			return ua.CallMethodResult{StatusCode: status, InputArgumentResults: results}
+		}
+		if n3.callMethodHandler != nil {
+			return srv.coerceOutputArguments(n3, n3.callMethodHandler(ctx, n))
+		}
+		return ua.CallMethodResult{StatusCode: ua.BadNotImplemented}
+	default:
+		return ua.CallMethodResult{StatusCode: ua.BadAttributeIDInvalid}
+	}
+}
+
+// CreateMonitoredItems creates and adds one or more MonitoredItems to a Subscription.
+func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, requestid uint32, req *ua.CreateMonitoredItemsRequest) error {
+	session, ok := srv.authorize(ch, requestid, req)
+	if !ok {
 		return nil
 	}
 	ctx := context.Background()
@@ -3357,16 +2591,7 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 	// get subscription
 	sub, ok := srv.SubscriptionManager().Get(req.SubscriptionID)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSubscriptionIDInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadSubscriptionIDInvalid, requestid)
 		session.createMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
@@ -3376,16 +2601,7 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 	sub.Unlock()
 
 	if req.TimestampsToReturn < ua.TimestampsToReturnSource || req.TimestampsToReturn > ua.TimestampsToReturnNeither {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTimestampsToReturnInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTimestampsToReturnInvalid, requestid)
 		session.createMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
@@ -3393,32 +2609,14 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 
 	l := len(req.ItemsToCreate)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.createMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.createMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
@@ -3432,6 +2630,11 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 			results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadNodeIDUnknown}
 			continue
 		}
+		rp := n.GetUserRolePermissions(ctx)
+		if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+			results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadNodeIDUnknown}
+			continue
+		}
 		attr := item.ItemToMonitor.AttributeID
 		if !n.IsAttributeIDValid(attr) {
 			results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadAttributeIDInvalid}
@@ -3449,7 +2652,7 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadNotReadable}
 				continue
 			}
-			if (n2.UserAccessLevel(ctx) & ua.AccessLevelsCurrentRead) == 0 {
+			if !IsUserPermitted(rp, ua.PermissionTypeRead) || (n2.UserAccessLevel(ctx)&ua.AccessLevelsCurrentRead) == 0 {
 				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadUserAccessDenied}
 				continue
 			}
@@ -3477,6 +2680,13 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 					continue
 				}
 			}
+			// the percent deadband is a percentage of the EURange of the variable.
+			if ua.DeadbandType(dcf.DeadbandType) == ua.DeadbandTypePercent {
+				if _, ok := srv.euRange(n2); !ok {
+					results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadFilterNotAllowed}
+					continue
+				}
+			}
 			mi := NewMonitoredItem(ctx, sub, n, item.ItemToMonitor, item.MonitoringMode, item.RequestedParameters, req.TimestampsToReturn, minSupportedSampleRate)
 			sub.AppendItem(mi)
 			results[i] = ua.MonitoredItemCreateResult{
@@ -3496,7 +2706,6 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadNotReadable}
 				continue
 			}
-			rp := n2.GetUserRolePermissions(ctx)
 			if !IsUserPermitted(rp, ua.PermissionTypeReceiveEvents) {
 				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadUserAccessDenied}
 				continue
@@ -3515,11 +2724,6 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 			}
 			continue
 		default:
-			rp := n.GetUserRolePermissions(ctx)
-			if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
-				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadAttributeIDInvalid}
-				continue
-			}
 			if item.RequestedParameters.Filter != nil {
 				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadFilterNotAllowed}
 				continue
@@ -3538,7 +2742,7 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 	ch.Write(
 		&ua.CreateMonitoredItemsResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			Results: results,
@@ -3550,59 +2754,8 @@ func (srv *UAServer) handleCreateMonitoredItems(ch *serverSecureChannel, request
 
 // ModifyMonitoredItems modifies MonitoredItems of a Subscription.
 func (srv *UAServer) handleModifyMonitoredItems(ch *serverSecureChannel, requestid uint32, req *ua.ModifyMonitoredItemsRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.modifyMonitoredItemsCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.modifyMonitoredItemsErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.modifyMonitoredItemsErrorCount++
-		session.errorCount++
 		return nil
 	}
 	ctx := context.Background()
@@ -3611,16 +2764,7 @@ func (srv *UAServer) handleModifyMonitoredItems(ch *serverSecureChannel, request
 	// get subscription
 	sub, ok := srv.SubscriptionManager().Get(req.SubscriptionID)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSubscriptionIDInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadSubscriptionIDInvalid, requestid)
 		session.modifyMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
@@ -3630,16 +2774,7 @@ func (srv *UAServer) handleModifyMonitoredItems(ch *serverSecureChannel, request
 	sub.Unlock()
 
 	if req.TimestampsToReturn < ua.TimestampsToReturnSource || req.TimestampsToReturn > ua.TimestampsToReturnNeither {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTimestampsToReturnInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTimestampsToReturnInvalid, requestid)
 		session.modifyMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
@@ -3647,32 +2782,14 @@ func (srv *UAServer) handleModifyMonitoredItems(ch *serverSecureChannel, request
 
 	l := len(req.ItemsToModify)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.modifyMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.modifyMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
@@ -3705,6 +2822,13 @@ func (srv *UAServer) handleModifyMonitoredItems(ch *serverSecureChannel, request
 						continue
 					}
 				}
+				// the percent deadband is a percentage of the EURange of the variable.
+				if ua.DeadbandType(dcf.DeadbandType) == ua.DeadbandTypePercent {
+					if _, ok := srv.euRange(item.node.(*VariableNode)); !ok {
+						results[i] = ua.MonitoredItemModifyResult{StatusCode: ua.BadFilterNotAllowed}
+						continue
+					}
+				}
 				results[i] = item.Modify(ctx, modifyReq)
 				continue
 			case attr == ua.AttributeIDEventNotifier:
@@ -3734,7 +2858,7 @@ func (srv *UAServer) handleModifyMonitoredItems(ch *serverSecureChannel, request
 	ch.Write(
 		&ua.ModifyMonitoredItemsResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			Results: results,
@@ -3746,59 +2870,8 @@ func (srv *UAServer) handleModifyMonitoredItems(ch *serverSecureChannel, request
 
 // SetMonitoringMode sets the monitoring mode for one or more MonitoredItems of a Subscription.
 func (srv *UAServer) handleSetMonitoringMode(ch *serverSecureChannel, requestid uint32, req *ua.SetMonitoringModeRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.setMonitoringModeCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.setMonitoringModeErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.setMonitoringModeErrorCount++
-		session.errorCount++
 		return nil
 	}
 	ctx := context.Background()
@@ -3807,16 +2880,7 @@ func (srv *UAServer) handleSetMonitoringMode(ch *serverSecureChannel, requestid
 	// get subscription
 	sub, ok := srv.SubscriptionManager().Get(req.SubscriptionID)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSubscriptionIDInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadSubscriptionIDInvalid, requestid)
 		session.setMonitoringModeErrorCount++
 		session.errorCount++
 		return nil
@@ -3827,32 +2891,14 @@ func (srv *UAServer) handleSetMonitoringMode(ch *serverSecureChannel, requestid
 
 	l := len(req.MonitoredItemIDs)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.setMonitoringModeErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.setMonitoringModeErrorCount++
 		session.errorCount++
 		return nil
@@ -3860,6 +2906,8 @@ func (srv *UAServer) handleSetMonitoringMode(ch *serverSecureChannel, requestid
 
 	results := make([]ua.StatusCode, l)
 
+	// the items enabled by the request report their current values in one notification.
+	sub.beginMonitoringModeChange()
 	for i, id := range req.MonitoredItemIDs {
 		if item, ok := sub.FindItem(id); ok {
 			item.SetMonitoringMode(ctx, req.MonitoringMode)
@@ -3868,11 +2916,12 @@ func (srv *UAServer) handleSetMonitoringMode(ch *serverSecureChannel, requestid
 			results[i] = ua.BadMonitoredItemIDInvalid
 		}
 	}
+	sub.endMonitoringModeChange()
 
 	ch.Write(
 		&ua.SetMonitoringModeResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			Results: results,
@@ -3884,75 +2933,15 @@ func (srv *UAServer) handleSetMonitoringMode(ch *serverSecureChannel, requestid
 
 // SetTriggering creates and deletes triggering links for a triggering item.
 func (srv *UAServer) handleSetTriggering(ch *serverSecureChannel, requestid uint32, req *ua.SetTriggeringRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.setTriggeringCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.setTriggeringErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.setTriggeringErrorCount++
-		session.errorCount++
 		return nil
 	}
 
 	// get subscription
 	sub, ok := srv.SubscriptionManager().Get(req.SubscriptionID)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSubscriptionIDInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadSubscriptionIDInvalid, requestid)
 		session.setTriggeringErrorCount++
 		session.errorCount++
 		return nil
@@ -3962,16 +2951,7 @@ func (srv *UAServer) handleSetTriggering(ch *serverSecureChannel, requestid uint
 	sub.Unlock()
 
 	if len(req.LinksToRemove) == 0 && len(req.LinksToAdd) == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.setTriggeringErrorCount++
 		session.errorCount++
 		return nil
@@ -3979,16 +2959,7 @@ func (srv *UAServer) handleSetTriggering(ch *serverSecureChannel, requestid uint
 
 	trigger, ok := sub.FindItem(req.TriggeringItemID)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadMonitoredItemIDInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadMonitoredItemIDInvalid, requestid)
 		session.setTriggeringErrorCount++
 		session.errorCount++
 		return nil
@@ -4025,7 +2996,7 @@ func (srv *UAServer) handleSetTriggering(ch *serverSecureChannel, requestid uint
 	ch.Write(
 		&ua.SetTriggeringResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			AddResults:    addResults,
@@ -4038,59 +3009,8 @@ func (srv *UAServer) handleSetTriggering(ch *serverSecureChannel, requestid uint
 
 // DeleteMonitoredItems removes one or more MonitoredItems of a Subscription.
 func (srv *UAServer) handleDeleteMonitoredItems(ch *serverSecureChannel, requestid uint32, req *ua.DeleteMonitoredItemsRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.deleteMonitoredItemsCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.deleteMonitoredItemsErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.deleteMonitoredItemsErrorCount++
-		session.errorCount++
 		return nil
 	}
 	ctx := context.Background()
@@ -4099,16 +3019,7 @@ func (srv *UAServer) handleDeleteMonitoredItems(ch *serverSecureChannel, request
 	// get subscription
 	sub, ok := srv.SubscriptionManager().Get(req.SubscriptionID)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSubscriptionIDInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadSubscriptionIDInvalid, requestid)
 		session.deleteMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
@@ -4119,32 +3030,14 @@ func (srv *UAServer) handleDeleteMonitoredItems(ch *serverSecureChannel, request
 
 	l := len(req.MonitoredItemIDs)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.deleteMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
 	}
 	// check too many operations
 	if l > int(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManyOperations, requestid)
 		session.deleteMonitoredItemsErrorCount++
 		session.errorCount++
 		return nil
@@ -4162,7 +3055,7 @@ func (srv *UAServer) handleDeleteMonitoredItems(ch *serverSecureChannel, request
 	ch.Write(
 		&ua.DeleteMonitoredItemsResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			Results: results,
@@ -4240,169 +3133,49 @@ func (srv *UAServer) validateIndexRange(ctx context.Context, s string, dataType
 
 // CreateSubscription creates a Subscription.
 func (srv *UAServer) handleCreateSubscription(ch *serverSecureChannel, requestid uint32, req *ua.CreateSubscriptionRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.createSubscriptionCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.createSubscriptionErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.createSubscriptionErrorCount++
-		session.errorCount++
 		return nil
 	}
 
 	sm := srv.SubscriptionManager()
 	s := NewSubscription(sm, session, req.RequestedPublishingInterval, req.RequestedLifetimeCount, req.RequestedMaxKeepAliveCount, req.MaxNotificationsPerPublish, req.PublishingEnabled, req.Priority)
 	if err := sm.Add(s); err != nil {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManySubscriptions,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadTooManySubscriptions, requestid)
 		session.createSubscriptionErrorCount++
 		session.errorCount++
 		return nil
 	}
-	s.startPublishing()
-	// log.Printf("Created subscription '%d'.\n", s.id)
-
-	ch.Write(
-		&ua.CreateSubscriptionResponse{
-			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
-				RequestHandle: req.RequestHeader.RequestHandle,
-			},
-			SubscriptionID:            s.id,
-			RevisedPublishingInterval: s.publishingInterval,
-			RevisedLifetimeCount:      s.lifetimeCount,
-			RevisedMaxKeepAliveCount:  s.maxKeepAliveCount,
-		},
-		requestid,
-	)
-	return nil
-}
-
-// ModifySubscription modifies a Subscription.
-func (srv *UAServer) handleModifySubscription(ch *serverSecureChannel, requestid uint32, req *ua.ModifySubscriptionRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
-	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.modifySubscriptionCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.modifySubscriptionErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.modifySubscriptionErrorCount++
-		session.errorCount++
-		return nil
-	}
+	s.startPublishing()
+	srv.Logger().Debugf("Created subscription '%d'.", s.id)
+
+	ch.Write(
+		&ua.CreateSubscriptionResponse{
+			ResponseHeader: ua.ResponseHeader{
+				Timestamp:     srv.now(),
+				RequestHandle: req.RequestHeader.RequestHandle,
+			},
+			SubscriptionID:            s.id,
+			RevisedPublishingInterval: s.publishingInterval,
+			RevisedLifetimeCount:      s.lifetimeCount,
+			RevisedMaxKeepAliveCount:  s.maxKeepAliveCount,
+		},
+		requestid,
+	)
+	return nil
+}
+
+// ModifySubscription modifies a Subscription.
+func (srv *UAServer) handleModifySubscription(ch *serverSecureChannel, requestid uint32, req *ua.ModifySubscriptionRequest) error {
+	session, ok := srv.authorize(ch, requestid, req)
+	if !ok {
+		return nil
+	}
 
 	// get subscription
 	sub, ok := srv.SubscriptionManager().Get(req.SubscriptionID)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSubscriptionIDInvalid,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadSubscriptionIDInvalid, requestid)
 		session.modifySubscriptionErrorCount++
 		session.errorCount++
 		return nil
@@ -4413,7 +3186,7 @@ func (srv *UAServer) handleModifySubscription(ch *serverSecureChannel, requestid
 	ch.Write(
 		&ua.ModifySubscriptionResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			RevisedPublishingInterval: sub.publishingInterval,
@@ -4427,59 +3200,7 @@ func (srv *UAServer) handleModifySubscription(ch *serverSecureChannel, requestid
 
 // SetPublishingMode enables sending of Notifications on one or more Subscriptions.
 func (srv *UAServer) handleSetPublishingMode(ch *serverSecureChannel, requestid uint32, req *ua.SetPublishingModeRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
-	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.setPublishingModeCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.setPublishingModeErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.setPublishingModeErrorCount++
-		session.errorCount++
+	if _, ok := srv.authorize(ch, requestid, req); !ok {
 		return nil
 	}
 
@@ -4497,7 +3218,7 @@ func (srv *UAServer) handleSetPublishingMode(ch *serverSecureChannel, requestid
 	ch.Write(
 		&ua.SetPublishingModeResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			Results: results,
@@ -4511,72 +3232,14 @@ func (srv *UAServer) handleSetPublishingMode(ch *serverSecureChannel, requestid
 
 // DeleteSubscriptions deletes one or more Subscriptions.
 func (srv *UAServer) handleDeleteSubscriptions(ch *serverSecureChannel, requestid uint32, req *ua.DeleteSubscriptionsRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.deleteSubscriptionsCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.deleteSubscriptionsErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
 		return nil
 	}
 
 	l := len(req.SubscriptionIDs)
 	if l == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNothingToDo, requestid)
 		session.deleteSubscriptionsErrorCount++
 		session.errorCount++
 		return nil
@@ -4588,7 +3251,7 @@ func (srv *UAServer) handleDeleteSubscriptions(ch *serverSecureChannel, requesti
 		if s, ok := sm.Get(id); ok {
 			sm.Delete(s)
 			s.Delete()
-			// log.Printf("Deleted subscription '%d'.\n", id)
+			srv.Logger().Debugf("Deleted subscription '%d'.", id)
 			results[i] = ua.Good
 		} else {
 			results[i] = ua.BadSubscriptionIDInvalid
@@ -4597,7 +3260,7 @@ func (srv *UAServer) handleDeleteSubscriptions(ch *serverSecureChannel, requesti
 	ch.Write(
 		&ua.DeleteSubscriptionsResponse{
 			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
+				Timestamp:     srv.now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
 			Results: results,
@@ -4608,16 +3271,7 @@ func (srv *UAServer) handleDeleteSubscriptions(ch *serverSecureChannel, requesti
 	if len(sm.GetBySession(session)) == 0 {
 		ch, requestid, req, _, ok := session.removePublishRequest()
 		for ok {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadNoSubscription,
-					},
-				},
-				requestid,
-			)
+			ch.WriteServiceFault(req.RequestHandle, ua.BadNoSubscription, requestid)
 			session.publishErrorCount++
 			session.errorCount++
 			ch, requestid, req, _, ok = session.removePublishRequest()
@@ -4628,59 +3282,8 @@ func (srv *UAServer) handleDeleteSubscriptions(ch *serverSecureChannel, requesti
 
 // Publish returns a NotificationMessage or a keep-alive Message.
 func (srv *UAServer) handlePublish(ch *serverSecureChannel, requestid uint32, req *ua.PublishRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
-		return nil
-	}
-	session.publishCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.publishErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
-		session.publishErrorCount++
-		session.errorCount++
 		return nil
 	}
 
@@ -4718,7 +3321,7 @@ func (srv *UAServer) handlePublish(ch *serverSecureChannel, requestid uint32, re
 		ch.Write(
 			&ua.PublishResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 				},
 				SubscriptionID:           op.subscriptionId,
@@ -4735,30 +3338,15 @@ func (srv *UAServer) handlePublish(ch *serverSecureChannel, requestid uint32, re
 	}
 
 	if sm.Len() == 0 {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNoSubscription,
-				},
-			},
-			requestid,
-		)
+		ch.WriteServiceFault(req.RequestHandle, ua.BadNoSubscription, requestid)
 		session.publishErrorCount++
 		session.errorCount++
 		return nil
 	}
 
-	subs := sm.GetBySession(session)
-	sort.Slice(subs, func(i, j int) bool {
-		return subs[i].priority > subs[j].priority
-	})
-
-	for _, sub := range subs {
-		if sub.handleLatePublishRequest(ch, requestid, req, results) {
-			return nil
-		}
+	// a late subscription uses the request at once; subscriptions share the requests by priority.
+	if session.publishLate(sm.GetBySession(session), ch, requestid, req, results) {
+		return nil
 	}
 
 	session.addPublishRequest(ch, requestid, req, results)
@@ -4767,116 +3355,33 @@ func (srv *UAServer) handlePublish(ch *serverSecureChannel, requestid uint32, re
 
 // Republish requests the Server to republish a NotificationMessage from its retransmission queue.
 func (srv *UAServer) handleRepublish(ch *serverSecureChannel, requestid uint32, req *ua.RepublishRequest) error {
-	// discovery only?
-	if ch.discoveryOnly {
-		ch.Abort(ua.BadSecurityPolicyRejected, "")
-		return nil
-	}
-	// get session
-	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	session, ok := srv.authorize(ch, requestid, req)
 	if !ok {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionIDInvalid,
-				},
-			},
-			requestid,
-		)
 		return nil
 	}
-	session.republishCount++
-	session.requestCount++
-	// check channelId
-	id := session.SecureChannelId()
-	if id == 0 {
-		srv.SessionManager().Delete(session)
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSessionNotActivated,
-				},
-			},
-			requestid,
-		)
-		session.republishErrorCount++
-		session.errorCount++
-		return nil
-	}
-	if id != ch.ChannelID() {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSecureChannelIDInvalid,
-				},
-			},
-			requestid,
-		)
+
+	s, ok := srv.SubscriptionManager().Get(req.SubscriptionID)
+	if !ok {
+		ch.WriteServiceFault(req.RequestHandle, ua.BadSubscriptionIDInvalid, requestid)
 		session.republishErrorCount++
 		session.errorCount++
 		return nil
 	}
 
-	s, ok := srv.SubscriptionManager().Get(req.SubscriptionID)
-	if !ok {
+	if nm, ok := s.republish(req.RetransmitSequenceNumber); ok {
 		ch.Write(
-			&ua.ServiceFault{
+			&ua.RepublishResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSubscriptionIDInvalid,
+					Timestamp:     srv.now(),
+					RequestHandle: req.RequestHeader.RequestHandle,
 				},
+				NotificationMessage: nm,
 			},
 			requestid,
 		)
-		session.republishErrorCount++
-		session.errorCount++
 		return nil
 	}
-
-	s.Lock()
-	s.lifetimeCounter = 0
-	s.Unlock()
-
-	s.republishRequestCount++
-	s.republishMessageRequestCount++
-	q := s.retransmissionQueue
-	for e := q.Front(); e != nil; e = e.Next() {
-		if nm, ok := e.Value.(ua.NotificationMessage); ok {
-			if req.RetransmitSequenceNumber == nm.SequenceNumber {
-				ch.Write(
-					&ua.RepublishResponse{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHeader.RequestHandle,
-						},
-						NotificationMessage: nm,
-					},
-					requestid,
-				)
-				s.republishMessageCount++
-				q.Remove(e)
-				e.Value = nil
-				return nil
-			}
-		}
-	}
-	ch.Write(
-		&ua.ServiceFault{
-			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
-				RequestHandle: req.RequestHandle,
-				ServiceResult: ua.BadMessageNotAvailable,
-			},
-		},
-		requestid,
-	)
+	ch.WriteServiceFault(req.RequestHandle, ua.BadMessageNotAvailable, requestid)
 	session.republishErrorCount++
 	session.errorCount++
 	return nil
@@ -4884,7 +3389,7 @@ func (srv *UAServer) handleRepublish(ch *serverSecureChannel, requestid uint32,
 
 // WriteValue writes the value of the attribute.
 func (srv *UAServer) writeValue(ctx context.Context, writeValue ua.WriteValue) ua.StatusCode {
-	n, ok := srv.NamespaceManager().FindNode(writeValue.NodeID)
+	n, ok := srv.findNode(ctx, writeValue.NodeID)
 	if !ok {
 		return ua.BadNodeIDUnknown
 	}
@@ -4902,20 +3407,20 @@ func (srv *UAServer) writeValue(ctx context.Context, writeValue ua.WriteValue) u
 			if (n1.GetAccessLevel() & ua.AccessLevelsCurrentWrite) == 0 {
 				return ua.BadNotWritable
 			}
-			if (n1.UserAccessLevel(ctx) & ua.AccessLevelsCurrentWrite) == 0 {
+			if !IsUserPermitted(rp, ua.PermissionTypeWrite) || (n1.UserAccessLevel(ctx)&ua.AccessLevelsCurrentWrite) == 0 {
 				return ua.BadUserAccessDenied
 			}
 			// check data type
 			destType := srv.NamespaceManager().FindVariantType(n1.GetDataType())
 			destRank := n1.GetValueRank()
 			// special case convert bytestring to byte array
-			if destType == ua.VariantTypeByte && destRank == ua.ValueRankOneDimension {
+			if destType == ua.VariantTypeByte && (destRank == ua.ValueRankOneDimension || destRank == ua.ValueRankScalarOrOneDimension || destRank == ua.ValueRankAny) {
 				if v1, ok := writeValue.Value.Value.(ua.ByteString); ok {
 					writeValue.Value.Value = []byte(v1)
 				}
 			}
 			// special case convert byte array to bytestring
-			if destType == ua.VariantTypeByteString && destRank == ua.ValueRankScalar {
+			if destType == ua.VariantTypeByteString && (destRank == ua.ValueRankScalar || destRank == ua.ValueRankScalarOrOneDimension || destRank == ua.ValueRankAny) {
 				if v1, ok := writeValue.Value.Value.([]byte); ok {
 					writeValue.Value.Value = ua.ByteString(v1)
 				}
@@ -5325,25 +3830,63 @@ func (srv *UAServer) writeValue(ctx context.Context, writeValue ua.WriteValue) u
 				}
 			}
 
+			// an enumeration value must be one of the values defined by its EnumStrings or EnumValues.
+			if status := srv.NamespaceManager().checkEnumValue(n1, writeValue.Value.Value); status != ua.Good {
+				return status
+			}
+
+			// a value outside the EURange of the variable is rejected or clamped, see SetRangeCheck.
+			clamped := false
+			if check := n1.GetRangeCheck(); check != RangeCheckNone {
+				if r, ok := srv.euRange(n1); ok {
+					var status ua.StatusCode
+					if writeValue.Value, clamped, status = checkRange(check, r, writeValue.Value); status != ua.Good {
+						return status
+					}
+				}
+			}
+
+			var result ua.DataValue
+			var status ua.StatusCode
 			if f := n1.WriteValueHandler; f != nil {
-				result, status := f(ctx, writeValue)
-				if status == ua.Good {
-					n1.SetValue(result)
+				result, status = f(ctx, writeValue)
+				// the device may have changed even if the write failed, so the next Read calls the ReadValueHandler.
+				n1.invalidateReadCache()
+				// the handler sends the value to the device, wait for the device to confirm the write.
+				if c := srv.writeConfirmer(n1); c != nil && status == ua.Good {
+					status = c.ConfirmWrite(ctx, n1, result)
+				}
+			} else if w, ok := ctx.Value(rangeWriteKey).(*rangeWrite); ok && w.accepts(n1) {
+				// the value is set once all ranges of the request are written, see writeRanges.
+				if status = w.write(n1, writeValue.Value, writeValue.IndexRange); status == ua.Good && clamped {
+					return ua.GoodClamped
 				}
 				return status
 			} else {
-				result, status := writeRange(n1.GetValue(), writeValue.Value, writeValue.IndexRange)
+				current := n1.GetValue()
+				if writeValue.IndexRange != "" && (n1.GetAccessLevel()&AccessLevelArrayExtend) != 0 {
+					current, status = extendArray(current, writeValue.Value, writeValue.IndexRange, srv.serverCapabilities.MaxArrayLength)
+				}
 				if status == ua.Good {
-					n1.SetValue(result)
+					result, status = writeRange(current, writeValue.Value, writeValue.IndexRange, srv.now())
+				}
+			}
+			if status == ua.Good {
+				n1.SetValue(result)
+				if clamped {
+					return ua.GoodClamped
 				}
-				return status
 			}
+			return status
 		default:
 			return ua.BadAttributeIDInvalid
 		}
 	case ua.AttributeIDHistorizing:
 		switch n1 := n.(type) {
 		case *VariableNode:
+			if (n1.GetAccessLevel() & ua.AccessLevelsHistoryWrite) == 0 {
+				return ua.BadNotWritable
+			}
 			// check for PermissionTypeWriteHistorizing
 			if !IsUserPermitted(rp, ua.PermissionTypeWriteHistorizing) {
 				return ua.BadUserAccessDenied
@@ -5352,6 +3895,10 @@ func (srv *UAServer) writeValue(ctx context.Context, writeValue ua.WriteValue) u
 			if !ok {
 				return ua.BadTypeMismatch
 			}
+			// a node without a historian has nowhere to store its history.
+			if v && n1.historian == nil {
+				return ua.BadHistoryOperationUnsupported
+			}
 			n1.SetHistorizing(v)
 			return ua.Good
 		default:
@@ -5362,190 +3909,295 @@ func (srv *UAServer) writeValue(ctx context.Context, writeValue ua.WriteValue) u
 	}
 }
 
+// writeConfirmer returns the plugin that confirms writes to the variable, or nil if writes are applied immediately.
+func (srv *UAServer) writeConfirmer(n *VariableNode) WriteConfirmer {
+	if !srv.writeConfirmation {
+		return nil
+	}
+	owner := n.Owner()
+	if owner == nil {
+		return nil
+	}
+	p := owner.GetPlugin()
+	if p == nil || p.GetId() == PluginIDCore {
+		return nil
+	}
+	c, _ := p.(WriteConfirmer)
+	return c
+}
+
+// checkReadValue returns Good if the user may read the Value attribute of the variable.
+func checkReadValue(ctx context.Context, n *VariableNode, rp []ua.RolePermissionType) ua.StatusCode {
+	// check the access level for the variable.
+	if (n.GetAccessLevel() & ua.AccessLevelsCurrentRead) == 0 {
+		return ua.BadNotReadable
+	}
+	// the UserAccessLevel of the variable has CurrentRead if the session's roles have the Read permission.
+	if _, ok := ctx.Value(SessionKey).(*Session); !ok || !IsUserPermitted(rp, ua.PermissionTypeRead) {
+		return ua.BadUserAccessDenied
+	}
+	return ua.Good
+}
+
+// batchReader returns the BatchReader of the plugin, if the nodes to read are the whole Value attributes of
+// variables all owned by the same plugin. A variable with a ReadValueHandler is read by its handler instead.
+func (srv *UAServer) batchReader(ids []ua.ReadValueID) (BatchReader, bool) {
+	var plugin Plugin
+	for _, id := range ids {
+		if id.AttributeID != ua.AttributeIDValue || id.IndexRange != "" {
+			return nil, false
+		}
+		n, ok := srv.NamespaceManager().FindVariable(id.NodeID)
+		if !ok || n.Owner() == nil || n.ReadValueHandler != nil {
+			return nil, false
+		}
+		p := n.Owner().GetPlugin()
+		if p == nil || p.GetId() == PluginIDCore || (plugin != nil && p.GetId() != plugin.GetId()) {
+			return nil, false
+		}
+		plugin = p
+	}
+	reader, ok := plugin.(BatchReader)
+	return reader, ok
+}
+
+// readBatch returns the values of the variables, reading the variables the user may read in one call to the
+// BatchReader.
+func (srv *UAServer) readBatch(ctx context.Context, reader BatchReader, ids []ua.ReadValueID) []ua.DataValue {
+	results := make([]ua.DataValue, len(ids))
+	batch := make([]ua.ReadValueID, 0, len(ids))
+	indexes := make([]int, 0, len(ids))
+	for i, id := range ids {
+		if id.DataEncoding.Name != "" {
+			results[i] = ua.NewDataValue(nil, ua.BadDataEncodingInvalid, time.Time{}, 0, srv.now(), 0)
+			continue
+		}
+		// the node may be deleted since batchReader.
+		n1, _ := srv.findNode(ctx, id.NodeID)
+		n, ok := n1.(*VariableNode)
+		if !ok {
+			results[i] = ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, srv.now(), 0)
+			continue
+		}
+		rp := userRolePermissions(ctx, n)
+		if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+			results[i] = ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, srv.now(), 0)
+			continue
+		}
+		if status := checkReadValue(ctx, n, rp); status != ua.Good {
+			results[i] = ua.NewDataValue(nil, status, time.Time{}, 0, srv.now(), 0)
+			continue
+		}
+		batch = append(batch, id)
+		indexes = append(indexes, i)
+	}
+	if len(batch) == 0 {
+		return results
+	}
+	values := reader.ReadValues(ctx, batch)
+	for j, i := range indexes {
+		if j < len(values) {
+			results[i] = values[j]
+		} else {
+			results[i] = ua.NewDataValue(nil, ua.BadInternalError, time.Time{}, 0, srv.now(), 0)
+		}
+	}
+	return results
+}
+
 // readValue returns the value of the attribute.
 func (srv *UAServer) readValue(ctx context.Context, readValueId ua.ReadValueID) ua.DataValue {
 	if readValueId.DataEncoding.Name != "" {
-		return ua.NewDataValue(nil, ua.BadDataEncodingInvalid, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(nil, ua.BadDataEncodingInvalid, time.Time{}, 0, srv.now(), 0)
 	}
 	if readValueId.IndexRange != "" && readValueId.AttributeID != ua.AttributeIDValue {
-		return ua.NewDataValue(nil, ua.BadIndexRangeNoData, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(nil, ua.BadIndexRangeNoData, time.Time{}, 0, srv.now(), 0)
 	}
-	n, ok := srv.NamespaceManager().FindNode(readValueId.NodeID)
+	n, ok := srv.findNode(ctx, readValueId.NodeID)
 	if !ok {
-		return ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, srv.now(), 0)
 	}
-	rp := n.GetUserRolePermissions(ctx)
+	rp := userRolePermissions(ctx, n)
 	if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
-		return ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, srv.now(), 0)
 	}
 	switch readValueId.AttributeID {
 	case ua.AttributeIDValue:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			// check the access level for the variable.
-			if (n1.GetAccessLevel() & ua.AccessLevelsCurrentRead) == 0 {
-				return ua.NewDataValue(nil, ua.BadNotReadable, time.Time{}, 0, time.Now(), 0)
-			}
-			if (n1.UserAccessLevel(ctx) & ua.AccessLevelsCurrentRead) == 0 {
-				return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Time{}, 0, time.Now(), 0)
+			if status := checkReadValue(ctx, n1, rp); status != ua.Good {
+				return ua.NewDataValue(nil, status, time.Time{}, 0, srv.now(), 0)
 			}
 			if f := n1.ReadValueHandler; f != nil {
-				return f(ctx, readValueId)
+				if readValueId.IndexRange != "" {
+					return f(ctx, readValueId)
+				}
+				// a Read may accept a value read within its MaxAge, instead of calling the device again.
+				if maxAge, _ := ctx.Value(maxAgeKey).(float64); maxAge > 0 {
+					if v, ok := n1.cachedRead(maxAge); ok {
+						return v
+					}
+				}
+				v := f(ctx, readValueId)
+				if !v.StatusCode.IsBad() {
+					n1.cacheRead(v)
+				}
+				return v
 			}
 			return readRange(n1.GetValue(), readValueId.IndexRange)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDNodeID:
-		return ua.NewDataValue(n.GetNodeID(), ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(n.GetNodeID(), ua.Good, time.Time{}, 0, srv.now(), 0)
 	case ua.AttributeIDNodeClass:
-		return ua.NewDataValue(int32(n.GetNodeClass()), ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(int32(n.GetNodeClass()), ua.Good, time.Time{}, 0, srv.now(), 0)
 	case ua.AttributeIDBrowseName:
-		return ua.NewDataValue(n.GetBrowseName(), ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(n.GetBrowseName(), ua.Good, time.Time{}, 0, srv.now(), 0)
 	case ua.AttributeIDDisplayName:
-		return ua.NewDataValue(n.GetDisplayName(), ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(srv.localize(ctx, n, ua.AttributeIDDisplayName, n.GetDisplayName()), ua.Good, time.Time{}, 0, srv.now(), 0)
 	case ua.AttributeIDDescription:
-		return ua.NewDataValue(n.GetDescription(), ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(srv.localize(ctx, n, ua.AttributeIDDescription, n.GetDescription()), ua.Good, time.Time{}, 0, srv.now(), 0)
 	case ua.AttributeIDIsAbstract:
 		switch n1 := n.(type) {
 		case *DataTypeNode:
-			return ua.NewDataValue(n1.IsAbstract(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.IsAbstract(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		case *ObjectTypeNode:
-			return ua.NewDataValue(n1.IsAbstract(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.IsAbstract(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		case *ReferenceTypeNode:
-			return ua.NewDataValue(n1.IsAbstract(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.IsAbstract(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		case *VariableTypeNode:
-			return ua.NewDataValue(n1.IsAbstract(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.IsAbstract(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDSymmetric:
 		switch n1 := n.(type) {
 		case *ReferenceTypeNode:
-			return ua.NewDataValue(n1.Symmetric(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.Symmetric(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDInverseName:
 		switch n1 := n.(type) {
 		case *ReferenceTypeNode:
-			return ua.NewDataValue(n1.InverseName(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.InverseName(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDContainsNoLoops:
 		switch n1 := n.(type) {
 		case *ViewNode:
-			return ua.NewDataValue(n1.ContainsNoLoops(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.ContainsNoLoops(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDEventNotifier:
 		switch n1 := n.(type) {
 		case *ObjectNode:
-			return ua.NewDataValue(n1.EventNotifier(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.EventNotifier(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		case *ViewNode:
-			return ua.NewDataValue(n1.EventNotifier(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.EventNotifier(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDDataType:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			return ua.NewDataValue(n1.GetDataType(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.GetDataType(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		case *VariableTypeNode:
-			return ua.NewDataValue(n1.DataType(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.DataType(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDValueRank:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			return ua.NewDataValue(n1.GetValueRank(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.GetValueRank(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		case *VariableTypeNode:
-			return ua.NewDataValue(n1.ValueRank(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.ValueRank(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDArrayDimensions:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			return ua.NewDataValue(n1.GetArrayDimensions(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.GetArrayDimensions(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		case *VariableTypeNode:
-			return ua.NewDataValue(n1.ArrayDimensions(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.ArrayDimensions(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDAccessLevel:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			return ua.NewDataValue(n1.GetAccessLevel(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.GetAccessLevel(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDUserAccessLevel:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			return ua.NewDataValue(n1.UserAccessLevel(ctx), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.UserAccessLevel(ctx), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDMinimumSamplingInterval:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			return ua.NewDataValue(n1.GetMinimumSamplingInterval(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.GetMinimumSamplingInterval(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDHistorizing:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			return ua.NewDataValue(n1.GetHistorizing(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.GetHistorizing(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDExecutable:
 		switch n1 := n.(type) {
 		case *MethodNode:
-			return ua.NewDataValue(n1.Executable(), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.Executable(), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDUserExecutable:
 		switch n1 := n.(type) {
 		case *MethodNode:
-			return ua.NewDataValue(n1.UserExecutable(ctx), ua.Good, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(n1.UserExecutable(ctx), ua.Good, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDDataTypeDefinition:
 		switch n1 := n.(type) {
 		case *DataTypeNode:
 			if def := n1.DataTypeDefinition(); def != nil {
-				return ua.NewDataValue(def, ua.Good, time.Time{}, 0, time.Now(), 0)
+				return ua.NewDataValue(def, ua.Good, time.Time{}, 0, srv.now(), 0)
 			}
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		default:
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 	case ua.AttributeIDRolePermissions:
 		if !IsUserPermitted(rp, ua.PermissionTypeReadRolePermissions) {
-			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 		}
 		s1 := n.GetRolePermissions()
 		s2 := make([]ua.ExtensionObject, len(s1))
 		for i := range s1 {
 			s2[i] = s1[i]
 		}
-		return ua.NewDataValue(s2, ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(s2, ua.Good, time.Time{}, 0, srv.now(), 0)
 	case ua.AttributeIDUserRolePermissions:
 		s1 := n.GetUserRolePermissions(ctx)
 		s2 := make([]ua.ExtensionObject, len(s1))
 		for i := range s1 {
 			s2[i] = s1[i]
 		}
-		return ua.NewDataValue(s2, ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(s2, ua.Good, time.Time{}, 0, srv.now(), 0)
 	default:
-		return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, srv.now(), 0)
 	}
 }
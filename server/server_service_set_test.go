@@ -0,0 +1,1707 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/gammazero/workerpool"
+)
+
+var (
+	testVariableID = ua.NewNodeIDString(1, "Variable")
+	testObjectID   = ua.NewNodeIDString(1, "Object")
+	testMethodID   = ua.NewNodeIDString(1, "Method")
+)
+
+// newTestServer returns a server whose namespace contains an object, method and variable
+// that grant the Observer role the given permissions, and a context for a session in the Observer role.
+func newTestServer(t testing.TB, permissions ua.PermissionType) (*UAServer, context.Context) {
+	srv := &UAServer{
+		serverCapabilities:   ua.NewServerCapabilities(),
+		closing:              make(chan struct{}),
+		maxWorkerThreads:     defaultMaxWorkerThreads,
+		maxBrowseNameLength:  defaultMaxBrowseNameLength,
+		maxDisplayNameLength: defaultMaxDisplayNameLength,
+		logger:               nopLogger{},
+	}
+	t.Cleanup(func() { close(srv.closing) })
+	srv.workerpool = workerpool.New(srv.maxWorkerThreads)
+	srv.sessionManager = NewSessionManager(srv)
+	srv.namespaceManager = NewNamespaceManager(srv)
+	rp := []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: permissions}}
+	variable := NewVariableNode(
+		testVariableID,
+		ua.NewQualifiedName(1, "Variable"),
+		ua.NewLocalizedText("Variable", ""),
+		ua.NewLocalizedText("", ""),
+		rp,
+		[]ua.Reference{},
+		ua.NewDataValue(float64(42), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		-1,
+		false,
+		nil,
+	)
+	object := NewObjectNode(
+		testObjectID,
+		ua.NewQualifiedName(1, "Object"),
+		ua.NewLocalizedText("Object", ""),
+		ua.NewLocalizedText("", ""),
+		rp,
+		[]ua.Reference{},
+		0,
+	)
+	method := NewMethodNode(
+		testMethodID,
+		ua.NewQualifiedName(1, "Method"),
+		ua.NewLocalizedText("Method", ""),
+		ua.NewLocalizedText("", ""),
+		rp,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(testObjectID))},
+		true,
+	)
+	method.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+		return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
+	})
+	if err := srv.namespaceManager.AddNodes(variable, object, method); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{server: srv, userRoles: []ua.NodeID{ua.ObjectIDWellKnownRoleObserver}}
+	return srv, context.WithValue(context.Background(), SessionKey, session)
+}
+
+// newTestVariable returns a readable and writable variable, whose DisplayName is its BrowseName. A variable with
+// a fixed number of dimensions has dimensions of any length.
+func newTestVariable(id ua.NodeID, browseName ua.QualifiedName, dataType ua.NodeID, valueRank int32, value ua.DataValue, rolePermissions []ua.RolePermissionType, references ...ua.Reference) *VariableNode {
+	arrayDimensions := []uint32{}
+	if valueRank > 0 {
+		arrayDimensions = make([]uint32, valueRank)
+	}
+	if references == nil {
+		references = []ua.Reference{}
+	}
+	return NewVariableNode(
+		id,
+		browseName,
+		ua.NewLocalizedText(browseName.Name, ""),
+		ua.NewLocalizedText("", ""),
+		rolePermissions,
+		references,
+		value,
+		dataType,
+		valueRank,
+		arrayDimensions,
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		-1,
+		false,
+		nil,
+	)
+}
+
+// newTestChannel returns a loopback channel for the server, without security.
+func newTestChannel(srv *UAServer) *loopbackChannel {
+	return newLoopbackChannel(srv, ua.EndpointDescription{SecurityPolicyURI: ua.SecurityPolicyURINone, SecurityMode: ua.MessageSecurityModeNone})
+}
+
+// newTestScheduler sets a scheduler on the server whose poll groups don't tick during a test, so the test samples
+// the items itself. The scheduler is stopped with the server when the test ends.
+func newTestScheduler(srv *UAServer) {
+	srv.scheduler = &Scheduler{cancellationCh: srv.closing, tickers: map[time.Duration]*PollGroup{}, minSamplingInterval: time.Minute}
+}
+
+// newTestSubscription sets a test scheduler and a subscription manager on the server, and returns a subscription
+// added to it for a session in the role of the context, on a new loopback channel.
+func newTestSubscription(t *testing.T, srv *UAServer, ctx context.Context) (*Subscription, *loopbackChannel) {
+	newTestScheduler(srv)
+	srv.subscriptionManager = NewSubscriptionManager(srv)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	sub := NewSubscription(srv.subscriptionManager, session, 1000, 30, 10, 0, true, 0)
+	if err := srv.subscriptionManager.Add(sub); err != nil {
+		t.Fatal(err)
+	}
+	return sub, ch
+}
+
+func TestAuthorize(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	ch := newTestChannel(srv)
+	other := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	inactive := NewSession(srv, ua.NewNodeIDNumeric(1, 3), "inactive", ua.NewNodeIDNumeric(1, 4), "", time.Minute, ua.ApplicationDescription{}, "", "", 0)
+	if err := srv.SessionManager().Add(inactive); err != nil {
+		t.Fatal(err)
+	}
+	authorize := func(ch *loopbackChannel, requestID int, token ua.NodeID) (*Session, ua.StatusCode) {
+		req := &ua.ReadRequest{RequestHeader: ua.RequestHeader{AuthenticationToken: token, RequestHandle: uint32(requestID)}}
+		s, ok := srv.authorize(ch.serverSecureChannel, uint32(requestID), req)
+		if ok {
+			return s, ua.Good
+		}
+		res, _ := ch.WaitResponse(len(ch.Responses()), time.Second)
+		fault, isFault := res.(*ua.ServiceFault)
+		if !isFault || fault.ResponseHeader.RequestHandle != uint32(requestID) {
+			t.Fatalf("expected ServiceFault for request %d, got %+v", requestID, res)
+		}
+		return nil, fault.ResponseHeader.ServiceResult
+	}
+
+	if s, status := authorize(ch, 1, session.AuthenticationToken()); status != ua.Good || s != session {
+		t.Errorf("expected the session, got %s", status)
+	}
+	if _, status := authorize(ch, 2, ua.NewNodeIDNumeric(1, 99)); status != ua.BadSessionIDInvalid {
+		t.Errorf("expected %s, got %s", ua.BadSessionIDInvalid, status)
+	}
+	if _, status := authorize(other, 3, session.AuthenticationToken()); status != ua.BadSecureChannelIDInvalid {
+		t.Errorf("expected %s, got %s", ua.BadSecureChannelIDInvalid, status)
+	}
+	if session.readCount != 2 || session.readErrorCount != 1 || session.requestCount != 2 || session.errorCount != 1 {
+		t.Errorf("unexpected counts: read %d, read errors %d, requests %d, errors %d", session.readCount, session.readErrorCount, session.requestCount, session.errorCount)
+	}
+	if _, status := authorize(ch, 4, inactive.AuthenticationToken()); status != ua.BadSessionNotActivated {
+		t.Errorf("expected %s, got %s", ua.BadSessionNotActivated, status)
+	}
+	if _, ok := srv.SessionManager().Get(inactive.AuthenticationToken()); ok {
+		t.Error("expected the session that is not activated to be closed")
+	}
+}
+
+func TestReadRequiresReadPermission(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}); dv.StatusCode != ua.BadUserAccessDenied {
+		t.Errorf("expected %s, got %s", ua.BadUserAccessDenied, dv.StatusCode)
+	}
+	if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDBrowseName}); dv.StatusCode != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, dv.StatusCode)
+	}
+
+	srv, ctx = newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}); dv.StatusCode != ua.Good || dv.Value != float64(42) {
+		t.Errorf("expected value 42, got %v (%s)", dv.Value, dv.StatusCode)
+	}
+}
+
+func TestWriteRequiresWritePermission(t *testing.T) {
+	wv := ua.WriteValue{NodeID: testVariableID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(float64(43), 0, time.Time{}, 0, time.Time{}, 0)}
+	for _, permissions := range []ua.PermissionType{
+		ua.PermissionTypeBrowse,
+		ua.PermissionTypeBrowse | ua.PermissionTypeRead,
+	} {
+		srv, ctx := newTestServer(t, permissions)
+		if result := srv.writeValue(ctx, wv); result != ua.BadUserAccessDenied {
+			t.Errorf("expected %s, got %s", ua.BadUserAccessDenied, result)
+		}
+		if n, _ := srv.NamespaceManager().FindVariable(testVariableID); n.GetValue().Value != float64(42) {
+			t.Errorf("expected value to be unchanged, got %v", n.GetValue().Value)
+		}
+	}
+}
+
+func TestWriteHistorizing(t *testing.T) {
+	wv := ua.WriteValue{NodeID: testVariableID, AttributeID: ua.AttributeIDHistorizing, Value: ua.NewDataValue(true, 0, time.Time{}, 0, time.Time{}, 0)}
+
+	// the node must have the HistoryWrite access level.
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeWriteHistorizing)
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	n.historian = &memoryHistorian{}
+	if result := srv.writeValue(ctx, wv); result != ua.BadNotWritable {
+		t.Errorf("expected %s, got %s", ua.BadNotWritable, result)
+	}
+
+	// the user must have the WriteHistorizing permission.
+	n.SetAccessLevel(n.GetAccessLevel() | ua.AccessLevelsHistoryWrite)
+	srv2, ctx2 := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeWrite)
+	n2, _ := srv2.NamespaceManager().FindVariable(testVariableID)
+	n2.historian = &memoryHistorian{}
+	n2.SetAccessLevel(n2.GetAccessLevel() | ua.AccessLevelsHistoryWrite)
+	if result := srv2.writeValue(ctx2, wv); result != ua.BadUserAccessDenied {
+		t.Errorf("expected %s, got %s", ua.BadUserAccessDenied, result)
+	}
+
+	if result := srv.writeValue(ctx, wv); result != ua.Good || !n.GetHistorizing() {
+		t.Errorf("expected historizing enabled, got %s", result)
+	}
+
+	// historizing may not be enabled without a historian, but may be disabled.
+	n.historian = nil
+	n.SetHistorizing(false)
+	if result := srv.writeValue(ctx, wv); result != ua.BadHistoryOperationUnsupported || n.GetHistorizing() {
+		t.Errorf("expected %s, got %s", ua.BadHistoryOperationUnsupported, result)
+	}
+	wv.Value.Value = false
+	if result := srv.writeValue(ctx, wv); result != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, result)
+	}
+}
+
+// devicePlugin is a device plugin that confirms writes with the status of the device.
+type devicePlugin struct {
+	Plugin
+	status ua.StatusCode
+	writes []ua.DataValue
+}
+
+func (p *devicePlugin) GetId() int16 { return 1 }
+
+func (p *devicePlugin) ConfirmWrite(ctx context.Context, node *VariableNode, value ua.DataValue) ua.StatusCode {
+	p.writes = append(p.writes, value)
+	return p.status
+}
+
+func TestWriteConfirmedByDevice(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	srv.writeConfirmation = true
+	p := &devicePlugin{status: ua.BadCommunicationError}
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	n.SetOwner(&ObjectNode{plugin: p})
+	n.SetWriteValueHandler(func(ctx context.Context, req ua.WriteValue) (ua.DataValue, ua.StatusCode) {
+		return req.Value, ua.Good
+	})
+
+	wv := ua.WriteValue{NodeID: testVariableID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(float64(43), 0, time.Time{}, 0, time.Time{}, 0)}
+	if result := srv.writeValue(ctx, wv); result != ua.BadCommunicationError {
+		t.Errorf("expected %s, got %s", ua.BadCommunicationError, result)
+	}
+	if v := n.GetValue().Value; v != float64(42) {
+		t.Errorf("expected value to be unchanged, got %v", v)
+	}
+	if len(p.writes) != 1 || p.writes[0].Value != float64(43) {
+		t.Errorf("expected write of 43 sent to the device, got %v", p.writes)
+	}
+
+	p.status = ua.Good
+	if result := srv.writeValue(ctx, wv); result != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, result)
+	}
+	if v := n.GetValue().Value; v != float64(43) {
+		t.Errorf("expected value 43, got %v", v)
+	}
+
+	// without the option, the plugin is not asked to confirm.
+	srv.writeConfirmation = false
+	p.status = ua.BadCommunicationError
+	wv.Value.Value = float64(44)
+	if result := srv.writeValue(ctx, wv); result != ua.Good || len(p.writes) != 2 {
+		t.Errorf("expected write applied without confirmation, got %s", result)
+	}
+}
+
+func TestWriteConfirmedWritesDeviceOnce(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	srv.writeConfirmation = true
+	p := &devicePlugin{status: ua.Good}
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	n.SetOwner(&ObjectNode{plugin: p})
+	sent := 0
+	n.SetWriteValueHandler(func(ctx context.Context, req ua.WriteValue) (ua.DataValue, ua.StatusCode) {
+		sent++
+		return req.Value, ua.Good
+	})
+
+	wv := ua.WriteValue{NodeID: testVariableID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(float64(43), 0, time.Time{}, 0, time.Time{}, 0)}
+	if result := srv.writeValue(ctx, wv); result != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, result)
+	}
+	if sent != 1 || len(p.writes) != 1 {
+		t.Errorf("expected one device write and its confirmation, got %d writes and %d confirmations", sent, len(p.writes))
+	}
+
+	// a variable without a handler has no device write to confirm.
+	n.SetWriteValueHandler(nil)
+	wv.Value.Value = float64(44)
+	if result := srv.writeValue(ctx, wv); result != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, result)
+	}
+	if sent != 1 || len(p.writes) != 1 {
+		t.Errorf("expected no device write, got %d writes and %d confirmations", sent, len(p.writes))
+	}
+	if v := n.GetValue().Value; v != float64(44) {
+		t.Errorf("expected value 44, got %v", v)
+	}
+}
+
+func TestWriteIndexRangeExtendsArray(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	srv.serverCapabilities.MaxArrayLength = 10
+	rp := []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeRead | ua.PermissionTypeBrowse | ua.PermissionTypeWrite}}
+	array := func(name string, accessLevel byte) *VariableNode {
+		return NewVariableNode(
+			ua.NewNodeIDString(1, name),
+			ua.NewQualifiedName(1, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			rp,
+			[]ua.Reference{},
+			ua.NewDataValue([]int32{0, 1, 2}, 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDInt32,
+			ua.ValueRankOneDimension,
+			[]uint32{0},
+			accessLevel,
+			-1,
+			false,
+			nil,
+		)
+	}
+	strict := array("Strict", ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite)
+	growing := array("Growing", ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite|AccessLevelArrayExtend)
+	if err := srv.NamespaceManager().AddNodes(strict, growing); err != nil {
+		t.Fatal(err)
+	}
+	write := func(n *VariableNode, indexRange string, value []int32) ua.StatusCode {
+		return srv.writeValue(ctx, ua.WriteValue{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue, IndexRange: indexRange, Value: ua.NewDataValue(value, 0, time.Time{}, 0, time.Time{}, 0)})
+	}
+
+	if result := write(strict, "4:5", []int32{4, 5}); result != ua.BadIndexRangeNoData {
+		t.Errorf("expected %s, got %s", ua.BadIndexRangeNoData, result)
+	}
+	if result := write(growing, "4:5", []int32{4, 5}); result != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, result)
+	}
+	if v := growing.GetValue().Value; !reflect.DeepEqual(v, []int32{0, 1, 2, 0, 4, 5}) {
+		t.Errorf("expected array extended, got %v", v)
+	}
+	// a range inside the array writes as usual.
+	if result := write(growing, "1", []int32{7}); result != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, result)
+	}
+	if v := growing.GetValue().Value; !reflect.DeepEqual(v, []int32{0, 7, 2, 0, 4, 5}) {
+		t.Errorf("unexpected array %v", v)
+	}
+	if result := write(growing, "10:11", []int32{10, 11}); result != ua.BadOutOfRange {
+		t.Errorf("expected %s, got %s", ua.BadOutOfRange, result)
+	}
+	if v := growing.GetValue().Value; len(v.([]int32)) != 6 {
+		t.Errorf("expected array unchanged, got %v", v)
+	}
+}
+
+// newTestArray adds a Double array variable of the given length to the namespace of the server.
+func newTestArray(t testing.TB, srv *UAServer, length int) *VariableNode {
+	rp := []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeRead | ua.PermissionTypeBrowse | ua.PermissionTypeWrite}}
+	n := newTestVariable(ua.NewNodeIDString(1, "Array"), ua.NewQualifiedName(1, "Array"), ua.DataTypeIDDouble, ua.ValueRankOneDimension, ua.NewDataValue(make([]float64, length), 0, time.Now(), 0, time.Now(), 0), rp)
+	if err := srv.NamespaceManager().AddNodes(n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWriteRanges(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	n := newTestArray(t, srv, 6)
+	before := n.GetValue().Value.([]float64)
+	wvs := []ua.WriteValue{
+		{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue, IndexRange: "0:1", Value: ua.NewDataValue([]float64{1, 2}, 0, time.Time{}, 0, time.Time{}, 0)},
+		{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue, IndexRange: "9", Value: ua.NewDataValue([]float64{9}, 0, time.Time{}, 0, time.Time{}, 0)},
+		{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue, IndexRange: "4", Value: ua.NewDataValue([]float64{5}, 0, time.Time{}, 0, time.Time{}, 0)},
+		{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue, IndexRange: "1", Value: ua.NewDataValue([]float64{3}, 0, time.Time{}, 0, time.Time{}, 0)},
+	}
+	results := make([]ua.StatusCode, len(wvs))
+	srv.writeRanges(ctx, wvs, []int{0, 1, 2, 3}, results)
+	if !reflect.DeepEqual(results, []ua.StatusCode{ua.Good, ua.BadIndexRangeNoData, ua.Good, ua.Good}) {
+		t.Errorf("unexpected results %v", results)
+	}
+	// the ranges are written in order to a copy of the value.
+	if v := n.GetValue().Value; !reflect.DeepEqual(v, []float64{1, 3, 0, 0, 5, 0}) {
+		t.Errorf("unexpected array %v", v)
+	}
+	if !reflect.DeepEqual(before, make([]float64, 6)) {
+		t.Errorf("expected the previous value unchanged, got %v", before)
+	}
+}
+
+func BenchmarkWriteRanges(b *testing.B) {
+	srv, ctx := newTestServer(b, ua.PermissionTypeBrowse)
+	n := newTestArray(b, srv, 10000)
+	wvs := make([]ua.WriteValue, 10)
+	indices := make([]int, len(wvs))
+	for i := range wvs {
+		wvs[i] = ua.WriteValue{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue, IndexRange: fmt.Sprintf("%d:%d", i*1000, i*1000+9), Value: ua.NewDataValue(make([]float64, 10), 0, time.Time{}, 0, time.Time{}, 0)}
+		indices[i] = i
+	}
+	results := make([]ua.StatusCode, len(wvs))
+	b.Run("Separate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j, wv := range wvs {
+				results[j] = srv.writeValue(ctx, wv)
+			}
+		}
+	})
+	b.Run("Coalesced", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			srv.writeRanges(ctx, wvs, indices, results)
+		}
+	})
+}
+
+func TestWriteByteStringConversion(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	rp := []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeRead | ua.PermissionTypeBrowse | ua.PermissionTypeWrite}}
+	variable := func(name string, dataType ua.NodeID, rank int32) *VariableNode {
+		n := newTestVariable(ua.NewNodeIDString(1, name), ua.NewQualifiedName(1, name), dataType, rank, ua.DataValue{}, rp)
+		if err := srv.NamespaceManager().AddNode(n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	write := func(n *VariableNode, value interface{}) ua.StatusCode {
+		return srv.writeValue(ctx, ua.WriteValue{NodeID: n.GetNodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(value, 0, time.Time{}, 0, time.Time{}, 0)})
+	}
+	for _, rank := range []int32{ua.ValueRankScalar, ua.ValueRankScalarOrOneDimension, ua.ValueRankAny} {
+		n := variable(fmt.Sprintf("ByteString%d", rank), ua.DataTypeIDByteString, rank)
+		if result := write(n, []byte("abc")); result != ua.Good {
+			t.Errorf("rank %d: expected %s, got %s", rank, ua.Good, result)
+		}
+		if v := n.GetValue().Value; v != ua.ByteString("abc") {
+			t.Errorf("rank %d: expected ByteString abc, got %#v", rank, v)
+		}
+	}
+	for _, rank := range []int32{ua.ValueRankOneDimension, ua.ValueRankScalarOrOneDimension, ua.ValueRankAny} {
+		n := variable(fmt.Sprintf("Bytes%d", rank), ua.DataTypeIDByte, rank)
+		if result := write(n, ua.ByteString("abc")); result != ua.Good {
+			t.Errorf("rank %d: expected %s, got %s", rank, ua.Good, result)
+		}
+		if v := n.GetValue().Value; !reflect.DeepEqual(v, []byte("abc")) {
+			t.Errorf("rank %d: expected []byte abc, got %#v", rank, v)
+		}
+	}
+}
+
+// testPoint is a custom structure, encoded by the functions registered with the ExtensionObjectRegistry.
+type testPoint struct {
+	X, Y float64
+}
+
+func TestWriteReadRegisteredExtensionObject(t *testing.T) {
+	id := ua.NewExpandedNodeID(ua.NewNodeIDNumeric(1, 5001))
+	if err := ua.DefaultExtensionObjectRegistry.Register(reflect.TypeOf(testPoint{}), id,
+		func(enc *ua.BinaryEncoder, value ua.ExtensionObject) error {
+			p := value.(testPoint)
+			if err := enc.WriteDouble(p.X); err != nil {
+				return err
+			}
+			return enc.WriteDouble(p.Y)
+		},
+		func(dec *ua.BinaryDecoder) (ua.ExtensionObject, error) {
+			var p testPoint
+			if err := dec.ReadDouble(&p.X); err != nil {
+				return nil, err
+			}
+			return p, dec.ReadDouble(&p.Y)
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer ua.DefaultExtensionObjectRegistry.Unregister(id)
+
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	pointID := ua.NewNodeIDString(1, "Point")
+	if err := srv.NamespaceManager().AddNode(NewVariableNode(
+		pointID,
+		ua.NewQualifiedName(1, "Point"),
+		ua.NewLocalizedText("Point", ""),
+		ua.NewLocalizedText("", ""),
+		[]ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeWrite}},
+		[]ua.Reference{},
+		ua.NewDataValue(testPoint{}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDStructure,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		-1,
+		false,
+		nil,
+	)); err != nil {
+		t.Fatal(err)
+	}
+	// roundTrip encodes and decodes the value, as sent over a secure channel.
+	roundTrip := func(v ua.DataValue) ua.DataValue {
+		var buf bytes.Buffer
+		if err := ua.NewBinaryEncoder(&buf, ua.NewEncodingContext()).WriteDataValue(v); err != nil {
+			t.Fatal(err)
+		}
+		var out ua.DataValue
+		if err := ua.NewBinaryDecoder(&buf, ua.NewEncodingContext()).ReadDataValue(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	p := testPoint{X: 1.5, Y: -2}
+	wv := ua.WriteValue{NodeID: pointID, AttributeID: ua.AttributeIDValue, Value: roundTrip(ua.NewDataValue(p, 0, time.Time{}, 0, time.Time{}, 0))}
+	if result := srv.writeValue(ctx, wv); result != ua.Good {
+		t.Fatalf("expected %s, got %s", ua.Good, result)
+	}
+	dv := roundTrip(srv.readValue(ctx, ua.ReadValueID{NodeID: pointID, AttributeID: ua.AttributeIDValue}))
+	if dv.StatusCode != ua.Good || dv.Value != p {
+		t.Errorf("expected %v, got %v (%s)", p, dv.Value, dv.StatusCode)
+	}
+}
+
+func TestBrowseOnlyPermitsAttributesButNotValue(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	for _, attr := range []uint32{ua.AttributeIDNodeID, ua.AttributeIDBrowseName, ua.AttributeIDDisplayName, ua.AttributeIDDataType} {
+		if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: testVariableID, AttributeID: attr}); dv.StatusCode != ua.Good {
+			t.Errorf("attribute %d: expected %s, got %s", attr, ua.Good, dv.StatusCode)
+		}
+	}
+	if dv := srv.readValue(ctx, ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDUserAccessLevel}); dv.Value != byte(0) {
+		t.Errorf("expected UserAccessLevel 0, got %v", dv.Value)
+	}
+}
+
+func TestCallRequiresCallPermission(t *testing.T) {
+	req := ua.CallMethodRequest{ObjectID: testObjectID, MethodID: testMethodID}
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	if result := srv.callMethod(ctx, req); result.StatusCode != ua.BadUserAccessDenied {
+		t.Errorf("expected %s, got %s", ua.BadUserAccessDenied, result.StatusCode)
+	}
+
+	srv, ctx = newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeCall)
+	if result := srv.callMethod(ctx, req); result.StatusCode != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, result.StatusCode)
+	}
+}
+
+func TestCallValidatesInputArguments(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeCall)
+	inputArguments := NewVariableNode(
+		ua.NewNodeIDString(1, "Method.InputArguments"),
+		ua.NewQualifiedName(0, "InputArguments"),
+		ua.NewLocalizedText("InputArguments", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(testMethodID))},
+		ua.NewDataValue([]ua.ExtensionObject{
+			ua.Argument{Name: "setpoint", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+			ua.Argument{Name: "enable", DataType: ua.DataTypeIDBoolean, ValueRank: ua.ValueRankScalar},
+		}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDArgument,
+		ua.ValueRankOneDimension,
+		[]uint32{0},
+		ua.AccessLevelsCurrentRead,
+		-1,
+		false,
+		nil,
+	)
+	if err := srv.NamespaceManager().AddNode(inputArguments); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(args ...ua.Variant) ua.CallMethodResult {
+		return srv.callMethod(ctx, ua.CallMethodRequest{ObjectID: testObjectID, MethodID: testMethodID, InputArguments: args})
+	}
+	if result := call(float64(1)); result.StatusCode != ua.BadArgumentsMissing {
+		t.Errorf("expected %s, got %s", ua.BadArgumentsMissing, result.StatusCode)
+	}
+	if result := call(float64(1), true, true); result.StatusCode != ua.BadTooManyArguments {
+		t.Errorf("expected %s, got %s", ua.BadTooManyArguments, result.StatusCode)
+	}
+	result := call("1", true)
+	if result.StatusCode != ua.BadInvalidArgument {
+		t.Errorf("expected %s, got %s", ua.BadInvalidArgument, result.StatusCode)
+	}
+	if len(result.InputArgumentResults) != 2 || result.InputArgumentResults[0] != ua.BadTypeMismatch || result.InputArgumentResults[1] != ua.Good {
+		t.Errorf("expected [%s %s], got %v", ua.BadTypeMismatch, ua.Good, result.InputArgumentResults)
+	}
+	if result := call([]float64{1}, true); result.StatusCode != ua.BadInvalidArgument {
+		t.Errorf("expected %s, got %s", ua.BadInvalidArgument, result.StatusCode)
+	}
+	if result := call(float64(1), true); result.StatusCode != ua.Good {
+		t.Errorf("expected %s, got %s", ua.Good, result.StatusCode)
+	}
+}
+
+// batchPlugin is a device plugin that reads the values of its variables in one call.
+type batchPlugin struct {
+	Plugin
+	id    int16
+	calls [][]ua.ReadValueID
+}
+
+func (p *batchPlugin) GetId() int16 { return p.id }
+
+func (p *batchPlugin) ReadValues(ctx context.Context, ids []ua.ReadValueID) []ua.DataValue {
+	p.calls = append(p.calls, ids)
+	values := make([]ua.DataValue, len(ids))
+	for i := range ids {
+		values[i] = ua.NewDataValue(float64(i), ua.Good, time.Now(), 0, time.Now(), 0)
+	}
+	return values
+}
+
+func TestReadBatch(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	nm := srv.NamespaceManager()
+	p := &batchPlugin{id: 1}
+	owner := &ObjectNode{plugin: p}
+	variable, _ := nm.FindVariable(testVariableID)
+	variable.SetOwner(owner)
+	otherID := ua.NewNodeIDString(1, "Other")
+	other := NewVariableNode(
+		otherID,
+		ua.NewQualifiedName(1, "Other"),
+		ua.NewLocalizedText("Other", ""),
+		ua.NewLocalizedText("", ""),
+		variable.GetRolePermissions(),
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(testObjectID))},
+		ua.NewDataValue(float64(0), ua.Good, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentWrite,
+		-1,
+		false,
+		nil,
+	)
+	other.SetOwner(owner)
+	if err := nm.AddNode(other); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []ua.ReadValueID{
+		{NodeID: testVariableID, AttributeID: ua.AttributeIDValue},
+		{NodeID: otherID, AttributeID: ua.AttributeIDValue},
+		{NodeID: testVariableID, AttributeID: ua.AttributeIDValue},
+	}
+	reader, ok := srv.batchReader(ids)
+	if !ok {
+		t.Fatal("expected the batch reader of the plugin")
+	}
+	results := srv.readBatch(ctx, reader, ids)
+	if len(p.calls) != 1 || len(p.calls[0]) != 2 {
+		t.Fatalf("expected 1 call with 2 readable nodes, got %v", p.calls)
+	}
+	if results[0].Value != float64(0) || results[1].StatusCode != ua.BadNotReadable || results[2].Value != float64(1) {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	// nodes of another plugin, or other attributes, are read one at a time.
+	other.SetOwner(&ObjectNode{plugin: &batchPlugin{id: 2}})
+	if _, ok := srv.batchReader(ids); ok {
+		t.Error("expected no batch reader for nodes of different plugins")
+	}
+	if _, ok := srv.batchReader([]ua.ReadValueID{{NodeID: testVariableID, AttributeID: ua.AttributeIDBrowseName}}); ok {
+		t.Error("expected no batch reader for other attributes")
+	}
+
+	// a range of the value, or a variable with a handler, e.g. a scaled variable, are read one at a time.
+	other.SetOwner(owner)
+	if _, ok := srv.batchReader([]ua.ReadValueID{{NodeID: testVariableID, AttributeID: ua.AttributeIDValue, IndexRange: "0"}}); ok {
+		t.Error("expected no batch reader for an index range")
+	}
+	other.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		return ua.NewDataValue(float64(42), ua.Good, time.Now(), 0, time.Now(), 0)
+	})
+	if _, ok := srv.batchReader(ids); ok {
+		t.Error("expected no batch reader for a variable with a ReadValueHandler")
+	}
+
+	// a node deleted after the batch reader was chosen is unknown.
+	other.SetReadValueHandler(nil)
+	if reader, ok = srv.batchReader(ids); !ok {
+		t.Fatal("expected the batch reader of the plugin")
+	}
+	if err := nm.DeleteNode(other, false); err != nil {
+		t.Fatal(err)
+	}
+	if results := srv.readBatch(ctx, reader, ids); results[1].StatusCode != ua.BadNodeIDUnknown {
+		t.Errorf("expected %s, got %s", ua.BadNodeIDUnknown, results[1].StatusCode)
+	}
+}
+
+func TestReadMaxAge(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead|ua.PermissionTypeWrite)
+	n, _ := srv.NamespaceManager().FindVariable(testVariableID)
+	calls := 0
+	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		calls++
+		return ua.NewDataValue(float64(calls), ua.Good, time.Now(), 0, time.Now(), 0)
+	})
+	rv := ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}
+	for _, c := range []struct {
+		maxAge float64
+		calls  int
+	}{
+		// MaxAge 0 always reads the device.
+		{0, 1},
+		{0, 2},
+		// a large MaxAge accepts the last value read.
+		{math.MaxFloat64, 2},
+		{60000, 2},
+		// the last value read is older than 1ms.
+		{1, 3},
+	} {
+		if c.maxAge == 1 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		dv := srv.readValue(context.WithValue(ctx, maxAgeKey, c.maxAge), rv)
+		if calls != c.calls || dv.Value != float64(c.calls) {
+			t.Errorf("MaxAge %v: expected %d calls, got %d with value %v", c.maxAge, c.calls, calls, dv.Value)
+		}
+	}
+
+	// setting or writing the value, or replacing the handler, discards the last value read.
+	read := func() interface{} {
+		return srv.readValue(context.WithValue(ctx, maxAgeKey, float64(60000)), rv).Value
+	}
+	n.SetValue(ua.NewDataValue(float64(10), ua.Good, time.Now(), 0, time.Now(), 0))
+	if v := read(); calls != 4 || v != float64(4) {
+		t.Errorf("expected the handler to be called after SetValue, got %d calls with value %v", calls, v)
+	}
+	n.SetWriteValueHandler(func(ctx context.Context, req ua.WriteValue) (ua.DataValue, ua.StatusCode) {
+		return req.Value, ua.Good
+	})
+	if status := srv.writeValue(ctx, ua.WriteValue{NodeID: testVariableID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(float64(20), ua.Good, time.Time{}, 0, time.Time{}, 0)}); status != ua.Good {
+		t.Fatalf("expected %s, got %s", ua.Good, status)
+	}
+	if v := read(); calls != 5 || v != float64(5) {
+		t.Errorf("expected the handler to be called after a write, got %d calls with value %v", calls, v)
+	}
+	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		return ua.NewDataValue("replaced", ua.Good, time.Now(), 0, time.Now(), 0)
+	})
+	if v := read(); v != "replaced" {
+		t.Errorf("expected the value of the new handler, got %v", v)
+	}
+}
+
+func TestCallCoercesOutputArguments(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeCall)
+	outputArguments := NewVariableNode(
+		ua.NewNodeIDString(1, "Method.OutputArguments"),
+		ua.NewQualifiedName(0, "OutputArguments"),
+		ua.NewLocalizedText("OutputArguments", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(testMethodID))},
+		ua.NewDataValue([]ua.ExtensionObject{
+			ua.Argument{Name: "value", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+			ua.Argument{Name: "counts", DataType: ua.DataTypeIDByte, ValueRank: ua.ValueRankOneDimension},
+		}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDArgument,
+		ua.ValueRankOneDimension,
+		[]uint32{0},
+		ua.AccessLevelsCurrentRead,
+		-1,
+		false,
+		nil,
+	)
+	if err := srv.NamespaceManager().AddNode(outputArguments); err != nil {
+		t.Fatal(err)
+	}
+	method, _ := srv.NamespaceManager().FindMethod(testMethodID)
+	call := func(outputs ...ua.Variant) ua.CallMethodResult {
+		method.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+			return ua.CallMethodResult{OutputArguments: outputs}
+		})
+		return srv.callMethod(ctx, ua.CallMethodRequest{ObjectID: testObjectID, MethodID: testMethodID})
+	}
+
+	result := call(42, []int{1, 2})
+	if result.StatusCode != ua.Good || len(result.OutputArguments) != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if v, ok := result.OutputArguments[0].(float64); !ok || v != 42 {
+		t.Errorf("expected float64 42, got %T %v", result.OutputArguments[0], result.OutputArguments[0])
+	}
+	if v, ok := result.OutputArguments[1].([]uint8); !ok || len(v) != 2 || v[0] != 1 || v[1] != 2 {
+		t.Errorf("expected []uint8 [1 2], got %T %v", result.OutputArguments[1], result.OutputArguments[1])
+	}
+	if result := call(float64(1.5), []uint8{1}); result.StatusCode != ua.Good || result.OutputArguments[0] != 1.5 {
+		t.Errorf("expected arguments of the declared types to be unchanged, got %+v", result)
+	}
+	for name, outputs := range map[string][]ua.Variant{
+		"string":           {"42", []uint8{1}},
+		"out of range":     {float64(1), []int{256}},
+		"negative":         {float64(1), []int{-1}},
+		"missing":          {float64(1)},
+		"scalar for array": {float64(1), 1},
+	} {
+		if result := call(outputs...); result.StatusCode != ua.BadInternalError {
+			t.Errorf("%s: expected %s, got %s", name, ua.BadInternalError, result.StatusCode)
+		}
+	}
+}
+
+func TestActivateSessionUserTokenPolicy(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		tokenTypes []ua.UserTokenType
+		policyID   string
+		result     ua.StatusCode
+	}{
+		{"anonymous allowed", []ua.UserTokenType{ua.UserTokenTypeAnonymous}, "Anonymous", ua.Good},
+		{"anonymous disallowed", []ua.UserTokenType{ua.UserTokenTypeUserName}, "Anonymous", ua.BadIdentityTokenRejected},
+		{"unknown policy", []ua.UserTokenType{ua.UserTokenTypeAnonymous}, "Unknown", ua.BadIdentityTokenInvalid},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+			// anonymous identity is allowed by the server, but each endpoint decides.
+			srv.allowAnonymousIdentity = true
+			srv.rolesProvider = NewRulesBasedRolesProvider(DefaultIdentityMappingRules)
+			cfg := EndpointConfig{SecurityPolicyURI: ua.SecurityPolicyURINone, SecurityMode: ua.MessageSecurityModeNone, UserTokenTypes: c.tokenTypes}
+			ch := newLoopbackChannel(srv, ua.EndpointDescription{
+				SecurityPolicyURI:  cfg.SecurityPolicyURI,
+				SecurityMode:       cfg.SecurityMode,
+				UserIdentityTokens: cfg.buildUserTokenPolicies(),
+			})
+			session := NewSession(srv, ua.NewNodeIDNumeric(1, 1), "test", ua.NewNodeIDNumeric(1, 2), "", time.Minute, ua.ApplicationDescription{}, "", "", 0)
+			if err := srv.SessionManager().Add(session); err != nil {
+				t.Fatal(err)
+			}
+
+			req := &ua.ActivateSessionRequest{
+				RequestHeader:     ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+				UserIdentityToken: ua.AnonymousIdentityToken{PolicyID: c.policyID},
+			}
+			if err := srv.handleActivateSession(ch.serverSecureChannel, 1, req); err != nil {
+				t.Fatal(err)
+			}
+			res, ok := ch.WaitResponse(1, time.Second)
+			if !ok {
+				t.Fatal("expected a response")
+			}
+			if c.result == ua.Good {
+				if _, ok := res.(*ua.ActivateSessionResponse); !ok {
+					t.Errorf("expected ActivateSessionResponse, got %+v", res)
+				}
+				return
+			}
+			if fault, ok := res.(*ua.ServiceFault); !ok || fault.ResponseHeader.ServiceResult != c.result {
+				t.Errorf("expected ServiceFault %s, got %+v", c.result, res)
+			}
+		})
+	}
+}
+
+func TestParseUserPassword(t *testing.T) {
+	srv := &UAServer{minPasswordLength: 1, maxPasswordLength: defaultMaxPasswordLength}
+	nonce := getNextNonce(nonceLength)
+	secret := func(password string, nonce []byte) []byte {
+		b := make([]byte, 4, 4+len(password)+len(nonce))
+		binary.LittleEndian.PutUint32(b, uint32(len(password)+len(nonce)))
+		return append(append(b, password...), nonce...)
+	}
+	if password, status := srv.parseUserPassword(secret("secret", nonce), nonce); status != ua.Good || password != "secret" {
+		t.Errorf("expected password %q, got %q (%s)", "secret", password, status)
+	}
+	for name, b := range map[string][]byte{
+		"mismatched nonce": secret("secret", getNextNonce(nonceLength)),
+		"short nonce":      secret("secret", nonce[:16]),
+		"empty password":   secret("", nonce),
+		"long password":    secret(string(make([]byte, defaultMaxPasswordLength+1)), nonce),
+		"truncated":        secret("secret", nonce)[:20],
+		"empty":            {},
+	} {
+		if _, status := srv.parseUserPassword(b, nonce); status != ua.BadIdentityTokenRejected {
+			t.Errorf("%s: expected %s, got %s", name, ua.BadIdentityTokenRejected, status)
+		}
+	}
+}
+
+func TestActivateSessionRejectsReplayedSignature(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	srv.rolesProvider = NewRulesBasedRolesProvider(DefaultIdentityMappingRules)
+	srv.localCertificate = []byte("server certificate")
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := EndpointConfig{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSignAndEncrypt, UserTokenTypes: []ua.UserTokenType{ua.UserTokenTypeAnonymous}}
+	ch := newLoopbackChannel(srv, ua.EndpointDescription{
+		SecurityPolicyURI:  cfg.SecurityPolicyURI,
+		SecurityMode:       cfg.SecurityMode,
+		UserIdentityTokens: cfg.buildUserTokenPolicies(),
+	})
+	ch.remotePublicKey = &clientKey.PublicKey
+	session := NewSession(srv, ua.NewNodeIDNumeric(1, 1), "test", ua.NewNodeIDNumeric(1, 2), ua.ByteString(getNextNonce(nonceLength)), time.Minute, ua.ApplicationDescription{}, "", "", 0)
+	if err := srv.SessionManager().Add(session); err != nil {
+		t.Fatal(err)
+	}
+
+	// sign the current nonce of the session.
+	nonce := session.SessionNonce()
+	hash := sha256.New()
+	hash.Write(srv.LocalCertificate())
+	hash.Write([]byte(nonce))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, clientKey, crypto.SHA256, hash.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &ua.ActivateSessionRequest{
+		RequestHeader:     ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		ClientSignature:   ua.SignatureData{Signature: ua.ByteString(signature), Algorithm: ua.RsaSha256Signature},
+		UserIdentityToken: ua.AnonymousIdentityToken{PolicyID: "Anonymous"},
+	}
+	srv.handleActivateSession(ch.serverSecureChannel, 1, req)
+	res, _ := ch.WaitResponse(1, time.Second)
+	activated, ok := res.(*ua.ActivateSessionResponse)
+	if !ok {
+		t.Fatalf("expected ActivateSessionResponse, got %+v", res)
+	}
+	if activated.ServerNonce == nonce || session.SessionNonce() != activated.ServerNonce {
+		t.Errorf("expected the session nonce to be the new server nonce")
+	}
+
+	// the signature of the previous nonce is rejected.
+	srv.handleActivateSession(ch.serverSecureChannel, 2, req)
+	res, _ = ch.WaitResponse(2, time.Second)
+	if fault, ok := res.(*ua.ServiceFault); !ok || fault.ResponseHeader.ServiceResult != ua.BadApplicationSignatureInvalid {
+		t.Errorf("expected ServiceFault %s, got %+v", ua.BadApplicationSignatureInvalid, res)
+	}
+}
+
+func TestActivateSessionPlaintextPassword(t *testing.T) {
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name                string
+		securityMode        ua.MessageSecurityMode
+		encryptionAlgorithm string
+		result              ua.StatusCode
+	}{
+		{"None", ua.MessageSecurityModeNone, "", ua.BadIdentityTokenInvalid},
+		{"Sign", ua.MessageSecurityModeSign, "", ua.BadIdentityTokenInvalid},
+		{"SignAndEncrypt", ua.MessageSecurityModeSignAndEncrypt, "", ua.Good},
+		{"SignAndEncrypt with algorithm", ua.MessageSecurityModeSignAndEncrypt, ua.RsaOaepKeyWrap, ua.BadIdentityTokenInvalid},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+			srv.rolesProvider = NewRulesBasedRolesProvider(DefaultIdentityMappingRules)
+			srv.localCertificate = []byte("server certificate")
+			srv.userNameIdentityAuthenticator = AuthenticateUserNameIdentityFunc(func(id ua.UserNameIdentity, applicationURI string, endpointURL string) error {
+				if id.UserName != "user" || id.Password != "secret" {
+					return ua.BadUserAccessDenied
+				}
+				return nil
+			})
+			securityPolicyURI := ua.SecurityPolicyURIBasic256Sha256
+			if c.securityMode == ua.MessageSecurityModeNone {
+				securityPolicyURI = ua.SecurityPolicyURINone
+			}
+			// the token policy of the endpoint does not encrypt the password.
+			ch := newLoopbackChannel(srv, ua.EndpointDescription{
+				SecurityPolicyURI: securityPolicyURI,
+				SecurityMode:      c.securityMode,
+				UserIdentityTokens: []ua.UserTokenPolicy{{
+					PolicyID:          "UserName",
+					TokenType:         ua.UserTokenTypeUserName,
+					SecurityPolicyURI: ua.SecurityPolicyURINone,
+				}},
+			})
+			ch.remotePublicKey = &clientKey.PublicKey
+			session := NewSession(srv, ua.NewNodeIDNumeric(1, 1), "test", ua.NewNodeIDNumeric(1, 2), ua.ByteString(getNextNonce(nonceLength)), time.Minute, ua.ApplicationDescription{}, "", "", 0)
+			if err := srv.SessionManager().Add(session); err != nil {
+				t.Fatal(err)
+			}
+			req := &ua.ActivateSessionRequest{
+				RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+				UserIdentityToken: ua.UserNameIdentityToken{
+					PolicyID:            "UserName",
+					UserName:            "user",
+					Password:            ua.ByteString("secret"),
+					EncryptionAlgorithm: c.encryptionAlgorithm,
+				},
+			}
+			if c.securityMode != ua.MessageSecurityModeNone {
+				hash := sha256.New()
+				hash.Write(srv.LocalCertificate())
+				hash.Write([]byte(session.SessionNonce()))
+				signature, err := rsa.SignPKCS1v15(rand.Reader, clientKey, crypto.SHA256, hash.Sum(nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.ClientSignature = ua.SignatureData{Signature: ua.ByteString(signature), Algorithm: ua.RsaSha256Signature}
+			}
+			if err := srv.handleActivateSession(ch.serverSecureChannel, 1, req); err != nil {
+				t.Fatal(err)
+			}
+			res, _ := ch.WaitResponse(1, time.Second)
+			if c.result == ua.Good {
+				if _, ok := res.(*ua.ActivateSessionResponse); !ok {
+					t.Errorf("expected ActivateSessionResponse, got %+v", res)
+				}
+				return
+			}
+			if fault, ok := res.(*ua.ServiceFault); !ok || fault.ResponseHeader.ServiceResult != c.result {
+				t.Errorf("expected ServiceFault %s, got %+v", c.result, res)
+			}
+		})
+	}
+}
+
+// newTestCertificate returns a self-signed certificate for the host and application uri, and its key.
+func newTestCertificate(t *testing.T, host string, applicationURI string) ([]byte, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse(applicationURI)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{host},
+		URIs:         []*url.URL{uri},
+	}
+	crt, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt, key
+}
+
+func TestCreateSessionNonceLength(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	srv.localCertificate, srv.localPrivateKey = newTestCertificate(t, "localhost", "urn:localhost:server")
+	clientCertificate, _ := newTestCertificate(t, "localhost", "urn:localhost:client")
+	for _, c := range []struct {
+		securityPolicyURI string
+		nonceLength       int
+		result            ua.StatusCode
+	}{
+		{ua.SecurityPolicyURIBasic128Rsa15, 16, ua.Good},
+		{ua.SecurityPolicyURIBasic128Rsa15, 15, ua.BadNonceInvalid},
+		{ua.SecurityPolicyURIAes256Sha256RsaPss, 32, ua.Good},
+		{ua.SecurityPolicyURIAes256Sha256RsaPss, 16, ua.BadNonceInvalid},
+	} {
+		ch := newLoopbackChannel(srv, ua.EndpointDescription{SecurityPolicyURI: c.securityPolicyURI, SecurityMode: ua.MessageSecurityModeSignAndEncrypt})
+		req := &ua.CreateSessionRequest{
+			ClientDescription:       ua.ApplicationDescription{ApplicationURI: "urn:localhost:client"},
+			EndpointURL:             "opc.tcp://localhost:4840",
+			ClientNonce:             ua.ByteString(getNextNonce(c.nonceLength)),
+			ClientCertificate:       ua.ByteString(clientCertificate),
+			RequestedSessionTimeout: 60000,
+		}
+		if err := srv.handleCreateSession(ch.serverSecureChannel, 1, req); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := ch.WaitResponse(1, time.Second)
+		if c.result != ua.Good {
+			if fault, ok := res.(*ua.ServiceFault); !ok || fault.ResponseHeader.ServiceResult != c.result {
+				t.Errorf("%s: expected ServiceFault %s for a nonce of %d bytes, got %+v", c.securityPolicyURI, c.result, c.nonceLength, res)
+			}
+			continue
+		}
+		created, ok := res.(*ua.CreateSessionResponse)
+		if !ok {
+			t.Errorf("%s: expected CreateSessionResponse for a nonce of %d bytes, got %+v", c.securityPolicyURI, c.nonceLength, res)
+			continue
+		}
+		if n := len(created.ServerNonce); n != c.nonceLength {
+			t.Errorf("%s: expected a server nonce of %d bytes, got %d", c.securityPolicyURI, c.nonceLength, n)
+		}
+	}
+}
+
+func TestCreateCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "pki", "server.crt"), filepath.Join(dir, "pki", "server.key")
+	if err := createCertificate("urn:localhost:server", "server", "opc.tcp://localhost:4840", certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crt.URIs) != 1 || crt.URIs[0].String() != "urn:localhost:server" {
+		t.Errorf("expected the application uri in the certificate, got %v", crt.URIs)
+	}
+
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	srv.localDescription = ua.ApplicationDescription{ApplicationURI: "urn:localhost:server"}
+	srv.localCertificate = cert.Certificate[0]
+	srv.localPrivateKey = cert.PrivateKey.(*rsa.PrivateKey)
+	clientCertificate, _ := newTestCertificate(t, "localhost", "urn:localhost:client")
+	ch := newLoopbackChannel(srv, ua.EndpointDescription{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSignAndEncrypt})
+	req := &ua.CreateSessionRequest{
+		ClientDescription:       ua.ApplicationDescription{ApplicationURI: "urn:localhost:client"},
+		EndpointURL:             "opc.tcp://localhost:4840",
+		ClientNonce:             ua.ByteString(getNextNonce(32)),
+		ClientCertificate:       ua.ByteString(clientCertificate),
+		RequestedSessionTimeout: 60000,
+	}
+	if err := srv.handleCreateSession(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	created, ok := res.(*ua.CreateSessionResponse)
+	if !ok {
+		t.Fatalf("expected CreateSessionResponse, got %+v", res)
+	}
+	if !bytes.Equal([]byte(created.ServerCertificate), crt.Raw) {
+		t.Error("expected the generated certificate in the response")
+	}
+}
+
+func TestSetCertificate(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	srv.allowAnonymousIdentity = true
+	srv.rolesProvider = NewRulesBasedRolesProvider(DefaultIdentityMappingRules)
+	oldCertificate, oldKey := newTestCertificate(t, "localhost", "urn:localhost:server")
+	if err := srv.SetCertificate(oldCertificate, oldKey); err != nil {
+		t.Fatal(err)
+	}
+	clientCertificate, clientKey := newTestCertificate(t, "localhost", "urn:localhost:client")
+	cfg := EndpointConfig{SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256, SecurityMode: ua.MessageSecurityModeSignAndEncrypt, UserTokenTypes: []ua.UserTokenType{ua.UserTokenTypeAnonymous}}
+	newChannel := func() *loopbackChannel {
+		ch := newLoopbackChannel(srv, ua.EndpointDescription{
+			SecurityPolicyURI:  cfg.SecurityPolicyURI,
+			SecurityMode:       cfg.SecurityMode,
+			UserIdentityTokens: cfg.buildUserTokenPolicies(),
+		})
+		ch.remotePublicKey = &clientKey.PublicKey
+		return ch
+	}
+	createSession := func(ch *loopbackChannel) *ua.CreateSessionResponse {
+		req := &ua.CreateSessionRequest{
+			ClientDescription:       ua.ApplicationDescription{ApplicationURI: "urn:localhost:client"},
+			EndpointURL:             "opc.tcp://localhost:4840",
+			ClientNonce:             ua.ByteString(getNextNonce(32)),
+			ClientCertificate:       ua.ByteString(clientCertificate),
+			RequestedSessionTimeout: 60000,
+		}
+		if err := srv.handleCreateSession(ch.serverSecureChannel, 1, req); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := ch.WaitResponse(len(ch.Responses()), time.Second)
+		created, ok := res.(*ua.CreateSessionResponse)
+		if !ok {
+			t.Fatalf("expected CreateSessionResponse, got %+v", res)
+		}
+		return created
+	}
+	oldCh := newChannel()
+	existing := createSession(oldCh)
+	if !bytes.Equal([]byte(existing.ServerCertificate), oldCertificate) {
+		t.Fatal("expected the current certificate")
+	}
+
+	newCertificate, newKey := newTestCertificate(t, "localhost", "urn:localhost:server")
+	if err := srv.SetCertificate(newCertificate, oldKey); err != ua.BadCertificateInvalid {
+		t.Errorf("expected %s for a key of another certificate, got %v", ua.BadCertificateInvalid, err)
+	}
+	if err := srv.SetCertificate(newCertificate, newKey); err != nil {
+		t.Fatal(err)
+	}
+	if created := createSession(newChannel()); !bytes.Equal([]byte(created.ServerCertificate), newCertificate) {
+		t.Error("expected a new session to receive the new certificate")
+	}
+	for _, ep := range srv.Endpoints() {
+		if !bytes.Equal([]byte(ep.ServerCertificate), newCertificate) {
+			t.Errorf("expected endpoint %s to have the new certificate", ep.SecurityPolicyURI)
+		}
+	}
+
+	// the session created before the rotation is activated with the certificate of its channel.
+	hash := sha256.New()
+	hash.Write(oldCertificate)
+	hash.Write([]byte(existing.ServerNonce))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, clientKey, crypto.SHA256, hash.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &ua.ActivateSessionRequest{
+		RequestHeader:     ua.RequestHeader{AuthenticationToken: existing.AuthenticationToken},
+		ClientSignature:   ua.SignatureData{Signature: ua.ByteString(signature), Algorithm: ua.RsaSha256Signature},
+		UserIdentityToken: ua.AnonymousIdentityToken{PolicyID: "Anonymous"},
+	}
+	if err := srv.handleActivateSession(oldCh.serverSecureChannel, 2, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := oldCh.WaitResponse(2, time.Second)
+	if _, ok := res.(*ua.ActivateSessionResponse); !ok {
+		t.Errorf("expected ActivateSessionResponse, got %+v", res)
+	}
+}
+
+func TestBrowseMaxReferencesPerNode(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	srv.maxReferencesPerNode = 100
+	object, _ := srv.NamespaceManager().FindObject(testObjectID)
+	refs := object.GetReferences()
+	for i := 0; i < 250; i++ {
+		refs = append(refs, ua.NewReference(ua.ReferenceTypeIDOrganizes, false, ua.NewExpandedNodeID(testVariableID)))
+	}
+	object.SetReferences(refs)
+	total := len(refs)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	for _, c := range []struct {
+		requested uint32
+		page      int
+	}{
+		// the client requests no limit, so the server limit applies.
+		{0, 100},
+		{10, 10},
+		{500, 100},
+	} {
+		req := &ua.BrowseRequest{
+			RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+			NodesToBrowse: []ua.BrowseDescription{{
+				NodeID:          testObjectID,
+				BrowseDirection: ua.BrowseDirectionBoth,
+				ResultMask:      uint32(ua.BrowseResultMaskAll),
+			}},
+			RequestedMaxReferencesPerNode: c.requested,
+		}
+		if err := srv.handleBrowse(ch.serverSecureChannel, 1, req); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := ch.WaitResponse(1, time.Second)
+		browse, ok := res.(*ua.BrowseResponse)
+		if !ok || len(browse.Results) != 1 {
+			t.Fatalf("unexpected response %+v", res)
+		}
+		result := browse.Results[0]
+		count := len(result.References)
+		for requestID := 2; len(result.ContinuationPoint) > 0; requestID++ {
+			if len(result.References) != c.page {
+				t.Fatalf("requested %d: expected pages of %d references, got %d", c.requested, c.page, len(result.References))
+			}
+			next := &ua.BrowseNextRequest{
+				RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+				ContinuationPoints: []ua.ByteString{result.ContinuationPoint},
+			}
+			if err := srv.handleBrowseNext(ch.serverSecureChannel, uint32(requestID), next); err != nil {
+				t.Fatal(err)
+			}
+			res, _ := ch.WaitResponse(requestID, time.Second)
+			result = res.(*ua.BrowseNextResponse).Results[0]
+			count += len(result.References)
+		}
+		if count != total {
+			t.Errorf("requested %d: expected %d references, got %d", c.requested, total, count)
+		}
+	}
+}
+
+func TestBrowseView(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	nm := srv.NamespaceManager()
+	object, _ := nm.FindObject(testObjectID)
+	rp := object.GetRolePermissions()
+	ids := make([]ua.NodeID, 4)
+	for i := range ids {
+		name := string(rune('A' + i))
+		ids[i] = ua.NewNodeIDString(1, "Object."+name)
+		if err := nm.AddNode(NewObjectNode(
+			ids[i],
+			ua.NewQualifiedName(1, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			rp,
+			[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDOrganizes, true, ua.NewExpandedNodeID(testObjectID))},
+			0,
+		)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viewID := ua.NewNodeIDString(1, "View")
+	view := NewViewNode(
+		viewID,
+		ua.NewQualifiedName(1, "View"),
+		ua.NewLocalizedText("View", ""),
+		ua.NewLocalizedText("", ""),
+		rp,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDOrganizes, false, ua.NewExpandedNodeID(ids[1])),
+			ua.NewReference(ua.ReferenceTypeIDOrganizes, false, ua.NewExpandedNodeID(ids[3])),
+		},
+		true,
+		0,
+	)
+	if err := nm.AddNode(view); err != nil {
+		t.Fatal(err)
+	}
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+
+	browse := func(requestID int, view ua.NodeID, node ua.NodeID) []ua.NodeID {
+		req := &ua.BrowseRequest{
+			RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+			View:          ua.ViewDescription{ViewID: view},
+			NodesToBrowse: []ua.BrowseDescription{{
+				NodeID:          node,
+				BrowseDirection: ua.BrowseDirectionForward,
+				ReferenceTypeID: ua.ReferenceTypeIDOrganizes,
+				ResultMask:      uint32(ua.BrowseResultMaskAll),
+			}},
+		}
+		if err := srv.handleBrowse(ch.serverSecureChannel, uint32(requestID), req); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := ch.WaitResponse(requestID, time.Second)
+		r, ok := res.(*ua.BrowseResponse)
+		if !ok || len(r.Results) != 1 || r.Results[0].StatusCode != ua.Good {
+			t.Fatalf("unexpected response %+v", res)
+		}
+		targets := []ua.NodeID{}
+		for _, rd := range r.Results[0].References {
+			targets = append(targets, ua.ToNodeID(rd.NodeID, nm.NamespaceUris()))
+		}
+		return targets
+	}
+	if targets := browse(1, nil, testObjectID); len(targets) != 4 {
+		t.Errorf("expected 4 nodes without a view, got %v", targets)
+	}
+	for i, node := range []ua.NodeID{testObjectID, viewID} {
+		if targets := browse(2+i, viewID, node); len(targets) != 2 || targets[0] != ids[1] || targets[1] != ids[3] {
+			t.Errorf("%s: expected the 2 nodes of the view, got %v", node, targets)
+		}
+	}
+}
+
+func TestViewVersion(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	nm := srv.NamespaceManager()
+	object, _ := nm.FindObject(testObjectID)
+	rp := object.GetRolePermissions()
+	viewID := ua.NewNodeIDString(1, "View")
+	view := NewViewNode(
+		viewID,
+		ua.NewQualifiedName(1, "View"),
+		ua.NewLocalizedText("View", ""),
+		ua.NewLocalizedText("", ""),
+		rp,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDOrganizes, true, ua.NewExpandedNodeID(testObjectID))},
+		true,
+		0,
+	)
+	if err := nm.AddNode(view); err != nil {
+		t.Fatal(err)
+	}
+	// an inverse reference does not change the members of the view.
+	view.SetReferences(append(view.GetReferences(), ua.NewReference(ua.ReferenceTypeIDHierarchicalReferences, true, ua.NewExpandedNodeID(testObjectID))))
+	if v := view.ViewVersion(); v != 0 {
+		t.Fatalf("expected version 0, got %d", v)
+	}
+	member := ua.NewNodeIDString(1, "Object.Member")
+	if err := nm.AddNode(NewObjectNode(
+		member,
+		ua.NewQualifiedName(1, "Member"),
+		ua.NewLocalizedText("Member", ""),
+		ua.NewLocalizedText("", ""),
+		rp,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDOrganizes, true, ua.NewExpandedNodeID(testObjectID)),
+			ua.NewReference(ua.ReferenceTypeIDOrganizes, true, ua.NewExpandedNodeID(viewID)),
+		},
+		0,
+	)); err != nil {
+		t.Fatal(err)
+	}
+	if v := view.ViewVersion(); v != 1 {
+		t.Errorf("expected adding a member to increment the version to 1, got %d", v)
+	}
+
+	// a browse with the stale version is served with the current members of the view.
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	req := &ua.BrowseRequest{
+		RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		View:          ua.ViewDescription{ViewID: viewID, ViewVersion: 0},
+		NodesToBrowse: []ua.BrowseDescription{{
+			NodeID:          testObjectID,
+			BrowseDirection: ua.BrowseDirectionForward,
+			ReferenceTypeID: ua.ReferenceTypeIDOrganizes,
+			ResultMask:      uint32(ua.BrowseResultMaskAll),
+		}},
+	}
+	if err := srv.handleBrowse(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	r, ok := res.(*ua.BrowseResponse)
+	if !ok || len(r.Results) != 1 || r.Results[0].StatusCode != ua.Good || len(r.Results[0].References) != 1 ||
+		ua.ToNodeID(r.Results[0].References[0].NodeID, nm.NamespaceUris()) != member {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	// the version is read from the ViewVersion property of the view.
+	prop, ok := nm.FindProperty(view, ua.NewQualifiedName(0, "ViewVersion"))
+	if !ok {
+		t.Fatal("expected a ViewVersion property")
+	}
+	readVersion := func(requestID uint32) interface{} {
+		req := &ua.ReadRequest{
+			RequestHeader:      ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+			NodesToRead:        []ua.ReadValueID{{NodeID: prop.GetNodeID(), AttributeID: ua.AttributeIDValue}},
+		}
+		if err := srv.handleRead(ch.serverSecureChannel, requestID, req); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := ch.WaitResponse(int(requestID), time.Second)
+		r, ok := res.(*ua.ReadResponse)
+		if !ok || len(r.Results) != 1 {
+			t.Fatalf("unexpected response %+v", res)
+		}
+		return r.Results[0].Value
+	}
+	if v := readVersion(2); v != uint32(1) {
+		t.Errorf("expected ViewVersion 1, got %v", v)
+	}
+
+	node, _ := nm.FindObject(member)
+	nm.DeleteNode(node, false)
+	if v := view.ViewVersion(); v != 2 {
+		t.Errorf("expected removing a member to increment the version to 2, got %d", v)
+	}
+	if v := readVersion(3); v != uint32(2) {
+		t.Errorf("expected ViewVersion 2, got %v", v)
+	}
+}
+
+func TestPublishPriorityFairness(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	srv.subscriptionManager = NewSubscriptionManager(srv)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	newSub := func(priority byte) (*Subscription, *MonitoredItem) {
+		sub := NewSubscription(srv.subscriptionManager, session, 1000, 30, 10, 0, true, priority)
+		if err := srv.subscriptionManager.Add(sub); err != nil {
+			t.Fatal(err)
+		}
+		mi := newTestDataChangeItem(ua.MonitoringModeReporting)
+		mi.sub = sub
+		sub.items[1] = mi
+		return sub, mi
+	}
+	high, highItem := newSub(3)
+	low, lowItem := newSub(0)
+
+	// both subscriptions always have data waiting, so a strict priority order would never serve the low one.
+	served := map[uint32]int{}
+	for i := 1; i <= 100; i++ {
+		now := time.Now()
+		for _, sub := range []*Subscription{high, low} {
+			sub.Lock()
+			sub.isLate = true
+			sub.Unlock()
+		}
+		highItem.prequeue.PushBack(ua.NewDataValue(float64(i), 0, now, 0, now, 0))
+		lowItem.prequeue.PushBack(ua.NewDataValue(float64(i), 0, now, 0, now, 0))
+		req := &ua.PublishRequest{RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken(), RequestHandle: uint32(i)}}
+		if err := srv.handlePublish(ch.serverSecureChannel, uint32(i), req); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := ch.WaitResponse(i, time.Second)
+		r, ok := res.(*ua.PublishResponse)
+		if !ok {
+			t.Fatalf("unexpected response %+v", res)
+		}
+		served[r.SubscriptionID]++
+	}
+	// the weights are Priority+1, so the low priority subscription is served one time in five.
+	if served[high.id] != 80 || served[low.id] != 20 {
+		t.Errorf("expected 80 and 20 responses, got %d and %d", served[high.id], served[low.id])
+	}
+}
+
+func TestKeepAliveSequenceNumbers(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	srv.subscriptionManager = NewSubscriptionManager(srv)
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	sub := NewSubscription(srv.subscriptionManager, session, 1000, 30, 1, 0, true, 0)
+	if err := srv.subscriptionManager.Add(sub); err != nil {
+		t.Fatal(err)
+	}
+	mi := newTestDataChangeItem(ua.MonitoringModeReporting)
+	mi.sub = sub
+	sub.items[1] = mi
+
+	// the first message is a keep-alive, then keep-alives alternate with data.
+	next := uint32(1)
+	sent := []uint32{}
+	for i, data := range []bool{false, true, true, false, true, false, false, true, false} {
+		session.addPublishRequest(ch.serverSecureChannel, uint32(i+1), &ua.PublishRequest{RequestHeader: ua.RequestHeader{Timestamp: time.Now(), TimeoutHint: 60000}}, nil)
+		if data {
+			now := time.Now()
+			mi.prequeue.PushBack(ua.NewDataValue(float64(i), 0, now, 0, now, 0))
+		}
+		// a keep-alive is sent when the keep-alive count has elapsed without data.
+		for j := 0; j < 2 && len(ch.Responses()) == i; j++ {
+			sub.publish(time.Now())
+		}
+		res, _ := ch.WaitResponse(i+1, time.Second)
+		r, ok := res.(*ua.PublishResponse)
+		if !ok {
+			t.Fatalf("%d: unexpected response %+v", i, res)
+		}
+		nm := r.NotificationMessage
+		if data {
+			if len(nm.NotificationData) == 0 || nm.SequenceNumber != next {
+				t.Fatalf("%d: expected data with sequence number %d, got %+v", i, next, nm)
+			}
+			sent = append(sent, next)
+			next++
+		} else if len(nm.NotificationData) != 0 || nm.SequenceNumber != next {
+			// a keep-alive carries the sequence number of the next data, without consuming it.
+			t.Fatalf("%d: expected keep-alive with sequence number %d, got %+v", i, next, nm)
+		}
+		if !reflect.DeepEqual(r.AvailableSequenceNumbers, sent) {
+			t.Errorf("%d: expected available sequence numbers %v, got %v", i, sent, r.AvailableSequenceNumbers)
+		}
+	}
+
+	// every available message can be republished, until it is acknowledged.
+	n := len(ch.Responses())
+	for k := 0; k < 2; k++ {
+		for _, seq := range sent {
+			n++
+			if err := srv.handleRepublish(ch.serverSecureChannel, uint32(n), &ua.RepublishRequest{RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken(), RequestHandle: uint32(n)}, SubscriptionID: sub.id, RetransmitSequenceNumber: seq}); err != nil {
+				t.Fatal(err)
+			}
+			res, _ := ch.WaitResponse(n, time.Second)
+			if r, ok := res.(*ua.RepublishResponse); !ok || r.NotificationMessage.SequenceNumber != seq {
+				t.Errorf("expected message %d to be republished, got %+v", seq, res)
+			}
+		}
+	}
+	if !sub.acknowledge(sent[0]) {
+		t.Fatalf("expected message %d to be acknowledged", sent[0])
+	}
+	n++
+	srv.handleRepublish(ch.serverSecureChannel, uint32(n), &ua.RepublishRequest{RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken(), RequestHandle: uint32(n)}, SubscriptionID: sub.id, RetransmitSequenceNumber: sent[0]})
+	res, _ := ch.WaitResponse(n, time.Second)
+	if f, ok := res.(*ua.ServiceFault); !ok || f.ResponseHeader.ServiceResult != ua.BadMessageNotAvailable {
+		t.Errorf("expected %s for an acknowledged message, got %+v", ua.BadMessageNotAvailable, res)
+	}
+}
+
+func TestPublishAfterReconnect(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	srv.subscriptionManager = NewSubscriptionManager(srv)
+	ch1 := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch1)
+	sub := NewSubscription(srv.subscriptionManager, session, 1000, 30, 1, 0, true, 0)
+	if err := srv.subscriptionManager.Add(sub); err != nil {
+		t.Fatal(err)
+	}
+	mi := newTestDataChangeItem(ua.MonitoringModeReporting)
+	mi.sub = sub
+	sub.items[1] = mi
+	session.addPublishRequest(ch1.serverSecureChannel, 1, &ua.PublishRequest{RequestHeader: ua.RequestHeader{Timestamp: time.Now(), TimeoutHint: 60000}}, nil)
+
+	// the session is activated on a new channel, while a request of the old channel is queued.
+	ch2 := newTestChannel(srv)
+	session.SetSecureChannelId(ch2.ChannelID())
+	if err := srv.handlePublish(ch2.serverSecureChannel, 1, &ua.PublishRequest{RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken(), Timestamp: time.Now(), TimeoutHint: 60000}}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	mi.prequeue.PushBack(ua.NewDataValue(float64(1), 0, now, 0, now, 0))
+	for i := 0; i < 2 && len(ch2.Responses()) == 0; i++ {
+		sub.publish(time.Now())
+	}
+	res, _ := ch2.WaitResponse(1, time.Second)
+	if r, ok := res.(*ua.PublishResponse); !ok || r.SubscriptionID != sub.id || len(r.NotificationMessage.NotificationData) == 0 {
+		t.Fatalf("expected the notification on the new channel, got %+v", res)
+	}
+	res, _ = ch1.WaitResponse(1, time.Second)
+	if f, ok := res.(*ua.ServiceFault); !ok || f.ResponseHeader.ServiceResult != ua.BadSecureChannelIDInvalid {
+		t.Errorf("expected %s on the old channel, got %+v", ua.BadSecureChannelIDInvalid, res)
+	}
+}
+
+func TestMaxPublishRequestsPerSession(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse)
+	if err := WithMaxPublishRequestsPerSession(3)(srv); err != nil {
+		t.Fatal(err)
+	}
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	for i := 1; i <= 5; i++ {
+		session.addPublishRequest(ch.serverSecureChannel, uint32(i), &ua.PublishRequest{RequestHeader: ua.RequestHeader{Timestamp: time.Now(), TimeoutHint: 60000, RequestHandle: uint32(i)}}, nil)
+	}
+	// the oldest requests are answered to make room for the newest.
+	for i := 1; i <= 2; i++ {
+		res, _ := ch.WaitResponse(i, time.Second)
+		if f, ok := res.(*ua.ServiceFault); !ok || f.ResponseHeader.ServiceResult != ua.BadTooManyPublishRequests || f.ResponseHeader.RequestHandle != uint32(i) {
+			t.Errorf("expected %s for request %d, got %+v", ua.BadTooManyPublishRequests, i, res)
+		}
+	}
+	if n := len(ch.Responses()); n != 2 {
+		t.Errorf("expected 2 responses, got %d", n)
+	}
+	for i := 3; i <= 5; i++ {
+		_, requestid, _, _, ok := session.removePublishRequest()
+		if !ok || requestid != uint32(i) {
+			t.Errorf("expected request %d queued, got %d", i, requestid)
+		}
+	}
+	if err := WithMaxPublishRequestsPerSession(0)(srv); err != ua.BadInvalidArgument {
+		t.Errorf("expected %s, got %v", ua.BadInvalidArgument, err)
+	}
+}
+
+func TestSelectTimestamps(t *testing.T) {
+	now := time.Now()
+	for _, c := range []struct {
+		timestampsToReturn ua.TimestampsToReturn
+		source, server     bool
+	}{
+		{ua.TimestampsToReturnBoth, true, true},
+		{ua.TimestampsToReturnSource, true, false},
+		{ua.TimestampsToReturnServer, false, true},
+		{ua.TimestampsToReturnNeither, false, false},
+	} {
+		values := []ua.DataValue{
+			ua.NewDataValue(float64(1), 0, now, 10, now, 20),
+			ua.NewDataValue(float64(2), 0, time.Time{}, 0, time.Time{}, 0),
+		}
+		v := selectTimestamps(values, c.timestampsToReturn)[0]
+		if v.Value != float64(1) || (v.SourceTimestamp == now && v.SourcePicoseconds == 10) != c.source || (v.ServerTimestamp == now && v.ServerPicoseconds == 20) != c.server {
+			t.Errorf("%s: unexpected value %+v", c.timestampsToReturn, v)
+		}
+		if v := values[1]; v.Value != float64(2) || !v.SourceTimestamp.IsZero() || !v.ServerTimestamp.IsZero() {
+			t.Errorf("%s: unexpected value without timestamps %+v", c.timestampsToReturn, v)
+		}
+	}
+}
+
+func BenchmarkSelectTimestamps(b *testing.B) {
+	srv, ctx := newTestServer(b, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	id := ua.ReadValueID{NodeID: testVariableID, AttributeID: ua.AttributeIDValue}
+	results := make([]ua.DataValue, 1000)
+	for _, timestampsToReturn := range []ua.TimestampsToReturn{ua.TimestampsToReturnBoth, ua.TimestampsToReturnSource} {
+		b.Run(timestampsToReturn.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for j := range results {
+					results[j] = srv.readValue(ctx, id)
+				}
+				selectTimestamps(results, timestampsToReturn)
+			}
+		})
+	}
+}
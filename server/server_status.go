@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// initializeServerStatus sets the handlers of the ServerStatus variable of the Server object and its components.
+func (srv *UAServer) initializeServerStatus(nm *NamespaceManager) {
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatus); ok {
+		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+			return ua.NewDataValue(srv.ServerStatus(), 0, srv.now(), 0, srv.now(), 0)
+		})
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusState); ok {
+		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+			return ua.NewDataValue(int32(srv.ServerStatus().State), 0, srv.now(), 0, srv.now(), 0)
+		})
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusCurrentTime); ok {
+		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+			return ua.NewDataValue(srv.now(), 0, srv.now(), 0, srv.now(), 0)
+		})
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusSecondsTillShutdown); ok {
+		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+			return ua.NewDataValue(srv.secondsTillShutdown, 0, srv.now(), 0, srv.now(), 0)
+		})
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusShutdownReason); ok {
+		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+			return ua.NewDataValue(srv.shutdownReason, 0, srv.now(), 0, srv.now(), 0)
+		})
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusStartTime); ok {
+		n.SetValue(ua.NewDataValue(srv.startTime, 0, srv.now(), 0, srv.now(), 0))
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfo); ok {
+		n.SetValue(ua.NewDataValue(srv.buildInfo, 0, srv.now(), 0, srv.now(), 0))
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoProductURI); ok {
+		n.SetValue(ua.NewDataValue(srv.buildInfo.ProductURI, 0, srv.now(), 0, srv.now(), 0))
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoManufacturerName); ok {
+		n.SetValue(ua.NewDataValue(srv.buildInfo.ManufacturerName, 0, srv.now(), 0, srv.now(), 0))
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoProductName); ok {
+		n.SetValue(ua.NewDataValue(srv.buildInfo.ProductName, 0, srv.now(), 0, srv.now(), 0))
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoSoftwareVersion); ok {
+		n.SetValue(ua.NewDataValue(srv.buildInfo.SoftwareVersion, 0, srv.now(), 0, srv.now(), 0))
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoBuildNumber); ok {
+		n.SetValue(ua.NewDataValue(srv.buildInfo.BuildNumber, 0, srv.now(), 0, srv.now(), 0))
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerStatusBuildInfoBuildDate); ok {
+		n.SetValue(ua.NewDataValue(srv.buildInfo.BuildDate, 0, srv.now(), 0, srv.now(), 0))
+	}
+}
+
+// ServerStatus returns the status of the server. While running, the state is CommunicationFault if the project
+// of the ProjectManager failed to load.
+func (srv *UAServer) ServerStatus() ua.ServerStatusDataType {
+	srv.RLock()
+	status := ua.ServerStatusDataType{
+		StartTime:           srv.startTime,
+		CurrentTime:         srv.now(),
+		State:               srv.state,
+		BuildInfo:           srv.buildInfo,
+		ShutdownReason:      srv.shutdownReason,
+		SecondsTillShutdown: srv.secondsTillShutdown,
+	}
+	p := srv.projectManager
+	srv.RUnlock()
+	if status.State == ua.ServerStateRunning && p != nil && p.state != nil && p.GetCurrentState() == PROJECT_STATE_ERROR {
+		status.State = ua.ServerStateCommunicationFault
+	}
+	return status
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/qmuntal/stateless"
+)
+
+func TestServerStatus(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	srv.startTime = time.Now().Add(-time.Hour)
+	srv.state = ua.ServerStateRunning
+	srv.buildInfo = ua.BuildInfo{ProductName: "Test", SoftwareVersion: "1.0"}
+	srv.initializeServerStatus(nm)
+
+	read := func(id ua.NodeID) ua.Variant {
+		n, ok := nm.FindVariable(id)
+		if !ok {
+			t.Fatalf("%s not found", id)
+		}
+		if n.ReadValueHandler != nil {
+			return n.ReadValueHandler(ctx, ua.ReadValueID{NodeID: id, AttributeID: ua.AttributeIDValue}).Value
+		}
+		return n.GetValue().Value
+	}
+	first := read(ua.VariableIDServerServerStatus).(ua.ServerStatusDataType)
+	time.Sleep(10 * time.Millisecond)
+	second := read(ua.VariableIDServerServerStatus).(ua.ServerStatusDataType)
+	if !first.StartTime.Equal(srv.startTime) || !second.StartTime.Equal(first.StartTime) {
+		t.Errorf("expected stable start time %v, got %v and %v", srv.startTime, first.StartTime, second.StartTime)
+	}
+	if !second.CurrentTime.After(first.CurrentTime) {
+		t.Errorf("expected current time to advance, got %v and %v", first.CurrentTime, second.CurrentTime)
+	}
+	if first.State != ua.ServerStateRunning || first.BuildInfo.ProductName != "Test" {
+		t.Errorf("unexpected status %+v", first)
+	}
+	if v := read(ua.VariableIDServerServerStatusBuildInfoSoftwareVersion); v != "1.0" {
+		t.Errorf("expected software version 1.0, got %v", v)
+	}
+
+	// the state reports a project that failed to load.
+	p := newTestProjectManager(t)
+	p.state = stateless.NewStateMachine(PROJECT_STATE_ERROR)
+	srv.projectManager = p
+	if state := read(ua.VariableIDServerServerStatus).(ua.ServerStatusDataType).State; state != ua.ServerStateCommunicationFault {
+		t.Errorf("expected %s, got %s", ua.ServerStateCommunicationFault, state)
+	}
+	if state := read(ua.VariableIDServerServerStatusState); state != int32(ua.ServerStateCommunicationFault) {
+		t.Errorf("expected %d, got %v", ua.ServerStateCommunicationFault, state)
+	}
+}
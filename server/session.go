@@ -1,9 +1,8 @@
 package server
 
 import (
-	"encoding/binary"
+	"sort"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/afs/server/pkg/opcua/ua"
@@ -23,26 +22,21 @@ type stateChangeOp struct {
 
 type Session struct {
 	sync.RWMutex
-	server              *UAServer
-	sessionId           ua.NodeID
-	sessionName         string
-	authenticationToken ua.NodeID
-	timeout             time.Duration
-	userIdentity        interface{}
-	userRoles           []ua.NodeID
-	sessionNonce        ua.ByteString
-	lastAccess          time.Time
-	publishRequests     chan *publishOp
-	stateChanges        chan *stateChangeOp
-	channelId           uint32
-	browseCPs           map[uint32]struct {
-		data []ua.ReferenceDescription
-		max  int
-	}
-	lastBrowseCP                            uint32
-	maxBrowseContinuationPoints             int
-	historyCPs                              map[uint32]time.Time
-	maxHistoryContinuationPoints            int
+	server                                  *UAServer
+	sessionId                               ua.NodeID
+	sessionName                             string
+	authenticationToken                     ua.NodeID
+	timeout                                 time.Duration
+	userIdentity                            interface{}
+	userRoles                               []ua.NodeID
+	sessionNonce                            ua.ByteString
+	lastAccess                              time.Time
+	publishRequests                         chan *publishOp
+	publishLock                             sync.Mutex
+	stateChanges                            chan *stateChangeOp
+	channelId                               uint32
+	continuationPoints                      *ContinuationPointManager
+	registeredNodes                         registeredNodes
 	clientDescription                       ua.ApplicationDescription
 	serverUri                               string
 	endpointUrl                             string
@@ -121,29 +115,27 @@ func NewSession(server *UAServer, sessionId ua.NodeID, sessionName string, authe
 		authenticationToken: authenticationToken,
 		timeout:             timeout,
 		sessionNonce:        sessionNonce,
-		lastAccess:          time.Now(),
-		publishRequests:     make(chan *publishOp, 64),
+		lastAccess:          server.now(),
+		publishRequests:     make(chan *publishOp, server.MaxPublishRequestsPerSession()),
 		stateChanges:        make(chan *stateChangeOp, 64),
-		browseCPs: make(map[uint32]struct {
-			data []ua.ReferenceDescription
-			max  int
-		}, 16),
-		maxBrowseContinuationPoints:  int(server.ServerCapabilities().MaxBrowseContinuationPoints),
-		historyCPs:                   make(map[uint32]time.Time, 16),
-		maxHistoryContinuationPoints: int(server.ServerCapabilities().MaxHistoryContinuationPoints),
-		clientDescription:            clientDescription,
-		serverUri:                    serverUri,
-		endpointUrl:                  endpointUrl,
-		localeIds:                    []string{"en-US"},
-		maxResponseMessageSize:       maxResponseMessageSize,
-		timeCreated:                  time.Now(),
-		clientUserIdHistory:          []string{},
+		continuationPoints: NewContinuationPointManager(map[ContinuationPointKind]int{
+			ContinuationPointBrowse:  int(server.ServerCapabilities().MaxBrowseContinuationPoints),
+			ContinuationPointHistory: int(server.ServerCapabilities().MaxHistoryContinuationPoints),
+			ContinuationPointQuery:   int(server.ServerCapabilities().MaxQueryContinuationPoints),
+		}),
+		clientDescription:      clientDescription,
+		serverUri:              serverUri,
+		endpointUrl:            endpointUrl,
+		localeIds:              []string{"en-US"},
+		maxResponseMessageSize: maxResponseMessageSize,
+		timeCreated:            server.now(),
+		clientUserIdHistory:    []string{},
 	}
 }
 
 func (s *Session) IsExpired() bool {
 	s.RLock()
-	ret := time.Now().After(s.LastAccess().Add(s.timeout))
+	ret := s.server.now().After(s.LastAccess().Add(s.timeout))
 	s.RUnlock()
 	return ret
 }
@@ -157,14 +149,8 @@ func (s *Session) delete() {
 	s.userRoles = nil
 	s.sessionNonce = ua.ByteString("")
 	s.publishRequests = nil
-	for k := range s.browseCPs {
-		delete(s.browseCPs, k)
-	}
-	s.browseCPs = nil
-	for k := range s.historyCPs {
-		delete(s.historyCPs, k)
-	}
-	s.historyCPs = nil
+	s.continuationPoints.Clear()
+	s.registeredNodes.Clear()
 	s.clientUserIdHistory = nil
 	s.Unlock()
 }
@@ -233,6 +219,57 @@ func (s *Session) SetUserIdentity(value interface{}) {
 	s.Unlock()
 }
 
+// requestCounters returns the counters of the requests and errors of the service of the request, or nil if the
+// service is not counted.
+func (s *Session) requestCounters(req ua.ServiceRequest) (count *uint32, errorCount *uint32) {
+	switch req.(type) {
+	case *ua.ReadRequest:
+		return &s.readCount, &s.readErrorCount
+	case *ua.HistoryReadRequest:
+		return &s.historyReadCount, &s.historyReadErrorCount
+	case *ua.WriteRequest:
+		return &s.writeCount, &s.writeErrorCount
+	case *ua.CallRequest:
+		return &s.callCount, &s.callErrorCount
+	case *ua.CreateMonitoredItemsRequest:
+		return &s.createMonitoredItemsCount, &s.createMonitoredItemsErrorCount
+	case *ua.ModifyMonitoredItemsRequest:
+		return &s.modifyMonitoredItemsCount, &s.modifyMonitoredItemsErrorCount
+	case *ua.SetMonitoringModeRequest:
+		return &s.setMonitoringModeCount, &s.setMonitoringModeErrorCount
+	case *ua.SetTriggeringRequest:
+		return &s.setTriggeringCount, &s.setTriggeringErrorCount
+	case *ua.DeleteMonitoredItemsRequest:
+		return &s.deleteMonitoredItemsCount, &s.deleteMonitoredItemsErrorCount
+	case *ua.CreateSubscriptionRequest:
+		return &s.createSubscriptionCount, &s.createSubscriptionErrorCount
+	case *ua.ModifySubscriptionRequest:
+		return &s.modifySubscriptionCount, &s.modifySubscriptionErrorCount
+	case *ua.SetPublishingModeRequest:
+		return &s.setPublishingModeCount, &s.setPublishingModeErrorCount
+	case *ua.PublishRequest:
+		return &s.publishCount, &s.publishErrorCount
+	case *ua.RepublishRequest:
+		return &s.republishCount, &s.republishErrorCount
+	case *ua.TransferSubscriptionsRequest:
+		return &s.transferSubscriptionsCount, &s.transferSubscriptionsErrorCount
+	case *ua.DeleteSubscriptionsRequest:
+		return &s.deleteSubscriptionsCount, &s.deleteSubscriptionsErrorCount
+	case *ua.BrowseRequest:
+		return &s.browseCount, &s.browseErrorCount
+	case *ua.BrowseNextRequest:
+		return &s.browseNextCount, &s.browseNextErrorCount
+	case *ua.TranslateBrowsePathsToNodeIDsRequest:
+		return &s.translateBrowsePathsToNodeIdsCount, &s.translateBrowsePathsToNodeIdsErrorCount
+	case *ua.RegisterNodesRequest:
+		return &s.registerNodesCount, &s.registerNodesErrorCount
+	case *ua.UnregisterNodesRequest:
+		return &s.unregisterNodesCount, &s.unregisterNodesErrorCount
+	default:
+		return nil, nil
+	}
+}
+
 func (s *Session) UserRoles() []ua.NodeID {
 	s.RLock()
 	res := s.userRoles
@@ -246,6 +283,20 @@ func (s *Session) SetUserRoles(value []ua.NodeID) {
 	s.Unlock()
 }
 
+// LocaleIDs returns the locales requested by the client, in order of preference.
+func (s *Session) LocaleIDs() []string {
+	s.RLock()
+	res := s.localeIds
+	s.RUnlock()
+	return res
+}
+
+func (s *Session) SetLocaleIDs(value []string) {
+	s.Lock()
+	s.localeIds = value
+	s.Unlock()
+}
+
 func (s *Session) SessionNonce() ua.ByteString {
 	s.RLock()
 	res := s.sessionNonce
@@ -259,6 +310,17 @@ func (s *Session) SetSessionNonce(value ua.ByteString) {
 	s.Unlock()
 }
 
+// swapSessionNonce sets the session nonce to the new nonce, if it is still the old nonce.
+func (s *Session) swapSessionNonce(old, new ua.ByteString) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.sessionNonce != old {
+		return false
+	}
+	s.sessionNonce = new
+	return true
+}
+
 func (s *Session) LastAccess() time.Time {
 	s.RLock()
 	res := s.lastAccess
@@ -292,16 +354,7 @@ func (s *Session) addPublishRequest(ch *serverSecureChannel, requestid uint32, r
 			return
 		default:
 			op := <-s.publishRequests
-			op.ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: op.req.RequestHandle,
-						ServiceResult: ua.BadTooManyPublishRequests,
-					},
-				},
-				op.requestId,
-			)
+			op.ch.WriteServiceFault(op.req.RequestHandle, ua.BadTooManyPublishRequests, op.requestId)
 		}
 	}
 }
@@ -315,17 +368,14 @@ func (s *Session) removePublishRequest() (*serverSecureChannel, uint32, *ua.Publ
 			rid := op.requestId
 			results := op.results
 			// check if expired
-			if time.Now().After(req.RequestHeader.Timestamp.Add(time.Duration(req.RequestHeader.TimeoutHint) * time.Millisecond)) {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadTimeout,
-						},
-					},
-					rid,
-				)
+			if s.server.now().After(req.RequestHeader.Timestamp.Add(time.Duration(req.RequestHeader.TimeoutHint) * time.Millisecond)) {
+				ch.WriteServiceFault(req.RequestHandle, ua.BadTimeout, rid)
+				continue
+			}
+			// a request received on a channel the session is no longer bound to is not used, so the
+			// notifications are published on the channel of the session.
+			if ch.ChannelID() != s.SecureChannelId() {
+				ch.WriteServiceFault(req.RequestHandle, ua.BadSecureChannelIDInvalid, rid)
 				continue
 			}
 			return ch, rid, req, results, true
@@ -335,35 +385,83 @@ func (s *Session) removePublishRequest() (*serverSecureChannel, uint32, *ua.Publ
 	}
 }
 
-func (s *Session) addBrowseContinuationPoint(data []ua.ReferenceDescription, max int) ([]byte, error) {
-	s.Lock()
-	defer s.Unlock()
-	if s.maxBrowseContinuationPoints > 0 && len(s.browseCPs) >= s.maxBrowseContinuationPoints {
-		return nil, ua.BadNoContinuationPoints
+// publishLate offers the Publish request to the late subscriptions of the session, and returns true if one of
+// them used it.
+//
+// The subscriptions are served by smooth weighted round-robin, with a weight of Priority+1. Each time a request
+// is used, every late subscription earns its weight in credit, the subscriptions are tried in order of credit,
+// then weight, and the one that publishes is charged the sum of the weights. Over time each subscription is
+// served in proportion to its weight, so a busy subscription of high priority delays, but never starves, a
+// subscription of lower priority. A subscription tried with nothing to publish earns no credit, so an idle
+// subscription cannot save up credit for later.
+func (s *Session) publishLate(subs []*Subscription, ch *serverSecureChannel, requestid uint32, req *ua.PublishRequest, results []ua.StatusCode) bool {
+	type candidate struct {
+		sub            *Subscription
+		weight, credit int
 	}
-	id := atomic.AddUint32(&s.lastBrowseCP, 1)
-	s.browseCPs[id] = struct {
-		data []ua.ReferenceDescription
-		max  int
-	}{data, max}
-	cp := make([]byte, 4)
-	binary.LittleEndian.PutUint32(cp, id)
-	return cp, nil
+	s.publishLock.Lock()
+	defer s.publishLock.Unlock()
+	candidates := make([]candidate, 0, len(subs))
+	total := 0
+	for _, sub := range subs {
+		sub.RLock()
+		if sub.isLate {
+			w := int(sub.priority) + 1
+			candidates = append(candidates, candidate{sub, w, sub.publishCredit + w})
+			total += w
+		}
+		sub.RUnlock()
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.credit != b.credit {
+			return a.credit > b.credit
+		}
+		if a.weight != b.weight {
+			return a.weight > b.weight
+		}
+		return a.sub.id < b.sub.id
+	})
+	for i, c := range candidates {
+		if c.sub.handleLatePublishRequest(ch, requestid, req, results) {
+			c.sub.publishCredit = c.credit - total
+			for _, c1 := range candidates[i+1:] {
+				c1.sub.publishCredit = c1.credit
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// browseContinuationPoint is the data of a Browse continuation point: the references not yet returned, and the
+// maximum number of references to return at a time.
+type browseContinuationPoint struct {
+	data []ua.ReferenceDescription
+	max  int
+}
+
+func (s *Session) addBrowseContinuationPoint(data []ua.ReferenceDescription, max int) []byte {
+	return s.continuationPoints.Add(ContinuationPointBrowse, browseContinuationPoint{data, max})
 }
 
 func (s *Session) removeBrowseContinuationPoint(cp []byte) ([]ua.ReferenceDescription, int, bool) {
-	if cp == nil {
+	x, ok := s.continuationPoints.Remove(ContinuationPointBrowse, cp)
+	if !ok {
 		return nil, 0, false
 	}
-	s.Lock()
-	id := binary.LittleEndian.Uint32(cp)
-	x, ok := s.browseCPs[id]
-	if ok {
-		delete(s.browseCPs, id)
-	}
-	s.Unlock()
-	if ok {
-		return x.data, x.max, ok
+	bcp := x.(browseContinuationPoint)
+	return bcp.data, bcp.max, true
+}
+
+func (s *Session) addHistoryContinuationPoint(cp []byte) []byte {
+	return s.continuationPoints.Add(ContinuationPointHistory, cp)
+}
+
+func (s *Session) removeHistoryContinuationPoint(cp []byte) ([]byte, bool) {
+	x, ok := s.continuationPoints.Remove(ContinuationPointHistory, cp)
+	if !ok {
+		return nil, false
 	}
-	return nil, 0, false
+	return x.([]byte), true
 }
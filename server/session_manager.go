@@ -43,7 +43,7 @@ func (m *SessionManager) Get(authenticationToken ua.NodeID) (*Session, bool) {
 	if !ok {
 		return nil, false
 	}
-	s.SetLastAccess(time.Now())
+	s.SetLastAccess(m.server.now())
 	return s, ok
 }
 
@@ -67,11 +67,16 @@ func (m *SessionManager) Add(s *Session) error {
 func (m *SessionManager) Delete(s *Session) {
 	m.Lock()
 	defer m.Unlock()
+	_, ok := m.sessionsByToken[s.authenticationToken]
 	delete(m.sessionsByToken, s.authenticationToken)
 	if m.server.serverDiagnostics {
 		m.removeDiagnosticsNode(s)
 		m.server.serverDiagnosticsSummary.CurrentSessionCount = uint32(len(m.sessionsByToken))
 	}
+	// the session may be deleted twice, when closed as it expires.
+	if ok {
+		m.server.retireSessionCounters(s)
+	}
 	s.delete()
 }
 
@@ -94,7 +99,9 @@ func (m *SessionManager) checkForExpiredSessions() {
 				m.server.serverDiagnosticsSummary.CurrentSessionCount = uint32(len(m.sessionsByToken))
 				m.server.Unlock()
 			}
+			m.server.retireSessionCounters(s)
 			s.delete()
+			m.server.Logger().Debugf("Deleted expired session '%s'.", s.SessionName())
 		}
 	}
 }
@@ -127,7 +134,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsObject.GetNodeID())),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(ua.VariableIDServerServerDiagnosticsSessionsDiagnosticsSummarySessionDiagnosticsArray)),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDSessionDiagnosticsDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -188,7 +195,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			QueryNextCount:                     ua.ServiceCounterDataType{TotalCount: s.queryNextCount, ErrorCount: s.queryNextErrorCount},
 			RegisterNodesCount:                 ua.ServiceCounterDataType{TotalCount: s.registerNodesCount, ErrorCount: s.registerNodesErrorCount},
 			UnregisterNodesCount:               ua.ServiceCounterDataType{TotalCount: s.unregisterNodesCount, ErrorCount: s.unregisterNodesErrorCount},
-		}, 0, time.Now(), 0, time.Now(), 0)
+		}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, sessionDiagnosticsVariable)
 	n := NewVariableNode(
@@ -201,7 +208,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDNodeID,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -211,7 +218,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.sessionId, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.sessionId, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -224,7 +231,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -234,7 +241,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.sessionName, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.sessionName, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -247,7 +254,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -257,7 +264,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.clientDescription, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.clientDescription, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -270,7 +277,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -280,7 +287,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.serverUri, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.serverUri, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -293,7 +300,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -303,7 +310,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.endpointUrl, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.endpointUrl, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -316,7 +323,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankOneDimension,
 		[]uint32{0},
@@ -326,7 +333,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.localeIds, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.localeIds, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -339,7 +346,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDDouble,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -349,7 +356,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(float64(s.timeout.Nanoseconds()/1000000), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(float64(s.timeout.Nanoseconds()/1000000), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -362,7 +369,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -372,7 +379,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.maxResponseMessageSize, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.maxResponseMessageSize, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -385,7 +392,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDDateTime,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -395,7 +402,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.timeCreated, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.timeCreated, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -408,7 +415,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDDateTime,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -418,7 +425,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.lastAccess, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.lastAccess, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -431,7 +438,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -441,7 +448,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(len(srv.subscriptionManager.GetBySession(s))), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(len(srv.subscriptionManager.GetBySession(s))), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -454,7 +461,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -469,7 +476,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		for _, sub := range subs {
 			itemCount += len(sub.items)
 		}
-		return ua.NewDataValue(uint32(itemCount), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(itemCount), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -482,7 +489,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -492,7 +499,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(len(s.publishRequests)), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(len(s.publishRequests)), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -505,7 +512,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -515,7 +522,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.requestCount, ErrorCount: s.errorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.requestCount, ErrorCount: s.errorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -528,7 +535,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -538,7 +545,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.unauthorizedRequestCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.unauthorizedRequestCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -551,7 +558,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -561,7 +568,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.readCount, ErrorCount: s.readErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.readCount, ErrorCount: s.readErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -574,7 +581,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -584,7 +591,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.historyReadCount, ErrorCount: s.historyReadErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.historyReadCount, ErrorCount: s.historyReadErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -597,7 +604,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -607,7 +614,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.writeCount, ErrorCount: s.writeErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.writeCount, ErrorCount: s.writeErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -620,7 +627,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -630,7 +637,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.historyUpdateCount, ErrorCount: s.historyUpdateErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.historyUpdateCount, ErrorCount: s.historyUpdateErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -643,7 +650,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -653,7 +660,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.callCount, ErrorCount: s.callErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.callCount, ErrorCount: s.callErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -666,7 +673,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -676,7 +683,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.createMonitoredItemsCount, ErrorCount: s.createMonitoredItemsErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.createMonitoredItemsCount, ErrorCount: s.createMonitoredItemsErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -689,7 +696,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -699,7 +706,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.modifyMonitoredItemsCount, ErrorCount: s.modifyMonitoredItemsErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.modifyMonitoredItemsCount, ErrorCount: s.modifyMonitoredItemsErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -712,7 +719,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -722,7 +729,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.setMonitoringModeCount, ErrorCount: s.setMonitoringModeErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.setMonitoringModeCount, ErrorCount: s.setMonitoringModeErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -735,7 +742,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -745,7 +752,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.setTriggeringCount, ErrorCount: s.setTriggeringErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.setTriggeringCount, ErrorCount: s.setTriggeringErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -758,7 +765,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -768,7 +775,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.deleteMonitoredItemsCount, ErrorCount: s.deleteMonitoredItemsErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.deleteMonitoredItemsCount, ErrorCount: s.deleteMonitoredItemsErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -781,7 +788,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -791,7 +798,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.createSubscriptionCount, ErrorCount: s.createSubscriptionErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.createSubscriptionCount, ErrorCount: s.createSubscriptionErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -804,7 +811,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -814,7 +821,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.modifySubscriptionCount, ErrorCount: s.modifySubscriptionErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.modifySubscriptionCount, ErrorCount: s.modifySubscriptionErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -827,7 +834,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -837,7 +844,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.setPublishingModeCount, ErrorCount: s.setPublishingModeErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.setPublishingModeCount, ErrorCount: s.setPublishingModeErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -850,7 +857,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -860,7 +867,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.publishCount, ErrorCount: s.publishErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.publishCount, ErrorCount: s.publishErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -873,7 +880,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -883,7 +890,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.republishCount, ErrorCount: s.republishErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.republishCount, ErrorCount: s.republishErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -896,7 +903,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -906,7 +913,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.transferSubscriptionsCount, ErrorCount: s.transferSubscriptionsErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.transferSubscriptionsCount, ErrorCount: s.transferSubscriptionsErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -919,7 +926,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -929,7 +936,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.deleteSubscriptionsCount, ErrorCount: s.deleteSubscriptionsErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.deleteSubscriptionsCount, ErrorCount: s.deleteSubscriptionsErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -942,7 +949,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -952,7 +959,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.addNodesCount, ErrorCount: s.addNodesErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.addNodesCount, ErrorCount: s.addNodesErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -965,7 +972,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -975,7 +982,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.addReferencesCount, ErrorCount: s.addReferencesErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.addReferencesCount, ErrorCount: s.addReferencesErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -988,7 +995,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -998,7 +1005,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.deleteNodesCount, ErrorCount: s.deleteNodesErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.deleteNodesCount, ErrorCount: s.deleteNodesErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1011,7 +1018,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1021,7 +1028,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.deleteReferencesCount, ErrorCount: s.deleteReferencesErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.deleteReferencesCount, ErrorCount: s.deleteReferencesErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1034,7 +1041,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1044,7 +1051,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.browseCount, ErrorCount: s.browseErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.browseCount, ErrorCount: s.browseErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1057,7 +1064,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1067,7 +1074,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.browseNextCount, ErrorCount: s.browseNextErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.browseNextCount, ErrorCount: s.browseNextErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1080,7 +1087,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1090,7 +1097,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.translateBrowsePathsToNodeIdsCount, ErrorCount: s.translateBrowsePathsToNodeIdsErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.translateBrowsePathsToNodeIdsCount, ErrorCount: s.translateBrowsePathsToNodeIdsErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1103,7 +1110,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1113,7 +1120,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.queryFirstCount, ErrorCount: s.queryFirstErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.queryFirstCount, ErrorCount: s.queryFirstErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1126,7 +1133,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1136,7 +1143,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.queryNextCount, ErrorCount: s.queryNextErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.queryNextCount, ErrorCount: s.queryNextErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1149,7 +1156,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1159,7 +1166,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.registerNodesCount, ErrorCount: s.registerNodesErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.registerNodesCount, ErrorCount: s.registerNodesErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1172,7 +1179,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBaseDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1182,7 +1189,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.unregisterNodesCount, ErrorCount: s.unregisterNodesErrorCount}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ServiceCounterDataType{TotalCount: s.unregisterNodesCount, ErrorCount: s.unregisterNodesErrorCount}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 
@@ -1198,7 +1205,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsObject.GetNodeID())),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(ua.VariableIDServerServerDiagnosticsSessionsDiagnosticsSummarySessionSecurityDiagnosticsArray)),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDSessionSecurityDiagnosticsDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1210,7 +1217,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	sessionSecurityDiagnosticsVariable.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1219,14 +1226,14 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
 		return ua.NewDataValue(ua.SessionSecurityDiagnosticsDataType{
 			SessionID:               s.sessionId,
@@ -1238,7 +1245,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			SecurityMode:            ch.SecurityMode(),
 			SecurityPolicyURI:       ch.SecurityPolicyURI(),
 			ClientCertificate:       ua.ByteString(ch.RemoteCertificate()),
-		}, 0, time.Now(), 0, time.Now(), 0)
+		}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, sessionSecurityDiagnosticsVariable)
 	n = NewVariableNode(
@@ -1251,7 +1258,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDNodeID,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1263,7 +1270,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1272,16 +1279,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue(s.sessionId, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.sessionId, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1294,7 +1301,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1306,7 +1313,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1315,16 +1322,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue(s.clientUserIdOfSession, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.clientUserIdOfSession, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1337,7 +1344,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankOneDimension,
 		[]uint32{0},
@@ -1349,7 +1356,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1358,16 +1365,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue(s.clientUserIdHistory, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.clientUserIdHistory, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1380,7 +1387,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1392,7 +1399,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1401,16 +1408,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue(s.authenticationMechanism, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.authenticationMechanism, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1423,7 +1430,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1435,7 +1442,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1444,16 +1451,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue("UA Binary", 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue("UA Binary", 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1466,7 +1473,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1478,7 +1485,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1487,16 +1494,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue(ua.TransportProfileURIUaTcpTransport, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.TransportProfileURIUaTcpTransport, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1509,7 +1516,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDMessageSecurityMode,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1521,7 +1528,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1530,16 +1537,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue(int32(ch.SecurityMode()), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(int32(ch.SecurityMode()), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1552,7 +1559,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1564,7 +1571,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1573,16 +1580,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue(ch.SecurityPolicyURI(), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ch.SecurityPolicyURI(), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1595,7 +1602,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionSecurityDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDByteString,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -1607,7 +1614,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
 		session, ok := ctx.Value(SessionKey).(*Session)
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ok = false
 		for _, n := range session.userRoles {
@@ -1616,16 +1623,16 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			}
 		}
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
 		if !ok {
-			return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadUserAccessDenied, srv.now(), 0, srv.now(), 0)
 		}
 		if ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
-			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, time.Now(), 0, time.Now(), 0)
+			return ua.NewDataValue(nil, ua.BadSecurityModeInsufficient, srv.now(), 0, srv.now(), 0)
 		}
-		return ua.NewDataValue(ua.ByteString(ch.RemoteCertificate()), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(ua.ByteString(ch.RemoteCertificate()), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 
@@ -1640,7 +1647,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDSubscriptionDiagnosticsArrayType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(sessionDiagnosticsObject.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDSubscriptionDiagnosticsDataType,
 		ua.ValueRankOneDimension,
 		[]uint32{0},
@@ -1650,7 +1657,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	subscriptionDiagnosticsArrayVariable.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue([]ua.ExtensionObject{}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue([]ua.ExtensionObject{}, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, subscriptionDiagnosticsArrayVariable)
 
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// dataTypesNamespaceSuffix is appended to the ApplicationUri of the server, for the namespace of the user-defined
+// data types.
+const dataTypesNamespaceSuffix = "/DataTypes"
+
+// RegisterStructureType adds a DataType node for a user-defined structure, with a Default Binary encoding node and
+// the DataTypeDefinition, so a client may decode the values of the structure. The BaseDataType of the definition is
+// Structure if null, and the DefaultEncodingId is set to the new encoding node. Returns the NodeID of the DataType,
+// for the DataType attribute of the variables, or BadNodeIdExists if a data type with the name is registered already.
+func (srv *UAServer) RegisterStructureType(name string, def ua.StructureDefinition) (ua.NodeID, error) {
+	nm := srv.NamespaceManager()
+	ns := nm.Add(srv.LocalDescription().ApplicationURI + dataTypesNamespaceSuffix)
+	dataTypeID := ua.NewNodeIDString(ns, name)
+	encodingID := ua.NewNodeIDString(ns, name+"_Encoding_DefaultBinary")
+	if _, ok := nm.FindNode(dataTypeID); ok {
+		return nil, ua.BadNodeIDExists
+	}
+	if _, ok := nm.FindNode(encodingID); ok {
+		return nil, ua.BadNodeIDExists
+	}
+	if def.BaseDataType == nil {
+		def.BaseDataType = ua.DataTypeIDStructure
+	}
+	def.DefaultEncodingID = encodingID
+
+	dataType := NewDataTypeNode(
+		dataTypeID,
+		ua.NewQualifiedName(ns, name),
+		ua.NewLocalizedText(name, ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasSubtype, true, ua.NewExpandedNodeID(def.BaseDataType)),
+			ua.NewReference(ua.ReferenceTypeIDHasEncoding, false, ua.NewExpandedNodeID(encodingID)),
+		},
+		false,
+	)
+	dataType.SetDataTypeDefinition(def)
+	encoding := NewObjectNode(
+		encodingID,
+		ua.NewQualifiedName(0, "Default Binary"),
+		ua.NewLocalizedText("Default Binary", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDDataTypeEncodingType)),
+			ua.NewReference(ua.ReferenceTypeIDHasEncoding, true, ua.NewExpandedNodeID(dataTypeID)),
+		},
+		0,
+	)
+	if err := nm.AddNodes(dataType, encoding); err != nil {
+		return nil, err
+	}
+	return dataTypeID, nil
+}
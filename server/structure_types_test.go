@@ -0,0 +1,73 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestRegisterStructureType(t *testing.T) {
+	srv, ctx := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	srv.rolePermissions = []ua.RolePermissionType{{RoleID: ua.ObjectIDWellKnownRoleObserver, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead}}
+	nm := srv.NamespaceManager()
+	if err := nm.LoadNodeSetFromBuffer(nodeset104); err != nil {
+		t.Fatal(err)
+	}
+	point := ua.StructureDefinition{
+		StructureType: ua.StructureTypeStructure,
+		Fields: []ua.StructureField{
+			{Name: "X", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+			{Name: "Y", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+		},
+	}
+	dataTypeID, err := srv.RegisterStructureType("Point", point)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns := nm.NamespaceUris()[dataTypeID.GetNamespaceIndex()]; ns != srv.LocalDescription().ApplicationURI+dataTypesNamespaceSuffix {
+		t.Errorf("unexpected namespace of the data type %s", ns)
+	}
+	if !nm.IsSubtype(dataTypeID, ua.DataTypeIDStructure) {
+		t.Error("expected a subtype of Structure")
+	}
+
+	ch := newTestChannel(srv)
+	session := newTestSession(t, srv, ctx, ch)
+	req := &ua.BrowseRequest{
+		RequestHeader: ua.RequestHeader{AuthenticationToken: session.AuthenticationToken()},
+		NodesToBrowse: []ua.BrowseDescription{{
+			NodeID:          dataTypeID,
+			BrowseDirection: ua.BrowseDirectionForward,
+			ReferenceTypeID: ua.ReferenceTypeIDHasEncoding,
+			ResultMask:      uint32(ua.BrowseResultMaskAll),
+		}},
+	}
+	if err := srv.handleBrowse(ch.serverSecureChannel, 1, req); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := ch.WaitResponse(1, time.Second)
+	browse, ok := res.(*ua.BrowseResponse)
+	if !ok || len(browse.Results) != 1 || len(browse.Results[0].References) != 1 {
+		t.Fatalf("expected the encoding node, got %+v", res)
+	}
+	encoding := browse.Results[0].References[0]
+	if encoding.BrowseName.Name != "Default Binary" || encoding.TypeDefinition.NodeID != ua.ObjectTypeIDDataTypeEncodingType {
+		t.Errorf("unexpected encoding node %+v", encoding)
+	}
+
+	dv := srv.readValue(ctx, ua.ReadValueID{NodeID: dataTypeID, AttributeID: ua.AttributeIDDataTypeDefinition})
+	def, ok := dv.Value.(ua.StructureDefinition)
+	if !ok || len(def.Fields) != 2 || def.BaseDataType != ua.DataTypeIDStructure || def.DefaultEncodingID != ua.ToNodeID(encoding.NodeID, nm.NamespaceUris()) {
+		t.Errorf("unexpected DataTypeDefinition %+v", dv)
+	}
+
+	// a second registration of the name does not replace the data type.
+	if id, err := srv.RegisterStructureType("Point", ua.StructureDefinition{StructureType: ua.StructureTypeStructure}); err != ua.BadNodeIDExists || id != nil {
+		t.Errorf("expected %s, got %v, %v", ua.BadNodeIDExists, id, err)
+	}
+	dv = srv.readValue(ctx, ua.ReadValueID{NodeID: dataTypeID, AttributeID: ua.AttributeIDDataTypeDefinition})
+	if def, ok := dv.Value.(ua.StructureDefinition); !ok || len(def.Fields) != 2 {
+		t.Errorf("expected the registered DataTypeDefinition, got %+v", dv)
+	}
+}
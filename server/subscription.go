@@ -42,6 +42,7 @@ type Subscription struct {
 	lifetimeCounter              uint32
 	moreNotifications            bool
 	session                      *Session
+	srv                          *UAServer
 	manager                      *SubscriptionManager
 	retransmissionQueue          *list.List
 	isLate                       bool
@@ -61,6 +62,9 @@ type Subscription struct {
 	monitoredItemCount           uint32
 	disabledMonitoredItemCount   uint32
 	monitoringQueueOverflowCount uint32
+	modeChanges                  int
+	publishCredit                int // guarded by the publishLock of the session
+	publishDeferred              bool
 }
 
 // NewSubscription instantiates a new Subscription.
@@ -68,6 +72,7 @@ func NewSubscription(manager *SubscriptionManager, session *Session, publishingI
 	s := &Subscription{
 		manager:             manager,
 		session:             session,
+		srv:                 session.server,
 		id:                  atomic.AddUint32(&subscriptionID, 1),
 		publishingEnabled:   publishingEnabled,
 		priority:            priority,
@@ -154,6 +159,10 @@ func (s *Subscription) DeleteItem(ctx context.Context, id uint32) bool {
 	ret := false
 	if item, ok := s.items[id]; ok {
 		delete(s.items, id)
+		// remove the links of the triggering items to the deleted item.
+		for _, trigger := range s.items {
+			trigger.removeTriggeredItem(item)
+		}
 		item.Delete()
 		s.monitoredItemCount--
 		if item.monitoringMode == ua.MonitoringModeDisabled {
@@ -282,6 +291,23 @@ func (s *Subscription) acknowledge(seqNum uint32) bool {
 	return false
 }
 
+// republish returns the NotificationMessage with the sequence number from the retransmission queue. The message
+// remains in the queue until the client acknowledges it.
+func (s *Subscription) republish(seqNum uint32) (ua.NotificationMessage, bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.lifetimeCounter = 0
+	s.republishRequestCount++
+	s.republishMessageRequestCount++
+	for e := s.retransmissionQueue.Front(); e != nil; e = e.Next() {
+		if nm, ok := e.Value.(ua.NotificationMessage); ok && nm.SequenceNumber == seqNum {
+			s.republishMessageCount++
+			return nm, true
+		}
+	}
+	return ua.NotificationMessage{}, false
+}
+
 func (s *Subscription) startPublishing() {
 	// log.Printf("startPublishing %d \n", s.id)
 	s.cancelPublishing = make(chan struct{})
@@ -305,16 +331,40 @@ func (s *Subscription) stopPublishing() {
 	close(s.cancelPublishing)
 }
 
+// beginMonitoringModeChange defers publishing until endMonitoringModeChange, so that the current values
+// reported by a batch of items enabled at once are sent in a single NotificationMessage.
+func (s *Subscription) beginMonitoringModeChange() {
+	s.Lock()
+	s.modeChanges++
+	s.Unlock()
+}
+
+// endMonitoringModeChange publishes at once if publishing was deferred by the change.
+func (s *Subscription) endMonitoringModeChange() {
+	s.Lock()
+	s.modeChanges--
+	deferred := false
+	// the publish is deferred until the last of overlapping changes ends.
+	if s.modeChanges == 0 {
+		deferred = s.publishDeferred
+		s.publishDeferred = false
+	}
+	s.Unlock()
+	if deferred {
+		s.publish(s.srv.now())
+	}
+}
+
 func (s *Subscription) publish(_ time.Time) {
 	// log.Printf("onPublish %d \n", s.id)
 	s.Lock()
-	notificationsAvailable := false
-	tn := time.Now()
-	for _, item := range s.items {
-		if item.notificationsAvailable(tn, false, s.resend) {
-			notificationsAvailable = true
-		}
+	if s.modeChanges > 0 {
+		s.publishDeferred = true
+		s.Unlock()
+		return
 	}
+	tn := s.srv.now()
+	notificationsAvailable := s.notificationsAvailable(tn, false, s.resend)
 	s.resend = false
 	switch {
 	case notificationsAvailable && s.publishingEnabled:
@@ -330,7 +380,7 @@ func (s *Subscription) publish(_ time.Time) {
 			mins := make([]ua.MonitoredItemNotification, 0, 4)
 			efls := make([]ua.EventFieldList, 0, 4)
 			for _, item := range s.items {
-				if item.monitoringMode != ua.MonitoringModeReporting && !item.triggered {
+				if !item.isReporting() {
 					continue
 				}
 				// if item.triggered {
@@ -387,7 +437,7 @@ func (s *Subscription) publish(_ time.Time) {
 			ch.Write(
 				&ua.PublishResponse{
 					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
+						Timestamp:     s.srv.now(),
 						RequestHandle: req.RequestHeader.RequestHandle,
 					},
 					SubscriptionID:           s.id,
@@ -420,7 +470,7 @@ func (s *Subscription) publish(_ time.Time) {
 			// log.Printf("Subscription '%d' expired.\n", s.id)
 			nm := ua.NotificationMessage{
 				SequenceNumber:   s.seqNum,
-				PublishTime:      time.Now(),
+				PublishTime:      s.srv.now(),
 				NotificationData: []ua.ExtensionObject{ua.StatusChangeNotification{Status: ua.BadTimeout}},
 			}
 			s.session.stateChanges <- &stateChangeOp{subscriptionId: s.id, message: nm}
@@ -453,7 +503,7 @@ func (s *Subscription) publish(_ time.Time) {
 			ch.Write(
 				&ua.PublishResponse{
 					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
+						Timestamp:     s.srv.now(),
 						RequestHandle: req.RequestHeader.RequestHandle,
 					},
 					SubscriptionID:           s.id,
@@ -461,7 +511,7 @@ func (s *Subscription) publish(_ time.Time) {
 					MoreNotifications:        false,
 					NotificationMessage: ua.NotificationMessage{
 						SequenceNumber:   s.seqNum,
-						PublishTime:      time.Now(),
+						PublishTime:      s.srv.now(),
 						NotificationData: nil,
 					},
 					Results:         results,
@@ -484,7 +534,7 @@ func (s *Subscription) publish(_ time.Time) {
 			// log.Printf("Subscription '%d' expired.\n", s.id)
 			nm := ua.NotificationMessage{
 				SequenceNumber:   s.seqNum,
-				PublishTime:      time.Now(),
+				PublishTime:      s.srv.now(),
 				NotificationData: []ua.ExtensionObject{ua.StatusChangeNotification{Status: ua.BadTimeout}},
 			}
 			s.session.stateChanges <- &stateChangeOp{subscriptionId: s.id, message: nm}
@@ -506,19 +556,33 @@ func (s *Subscription) publish(_ time.Time) {
 	}
 }
 
+// notificationsAvailable samples the items and returns true if any item has notifications to report.
+func (s *Subscription) notificationsAvailable(tn time.Time, late bool, resend bool) bool {
+	available := false
+	for _, item := range s.items {
+		if item.notificationsAvailable(tn, late, resend) {
+			available = true
+		}
+	}
+	if !available {
+		// an item may have been triggered by an item sampled after it.
+		for _, item := range s.items {
+			if item.triggeredNotificationsAvailable() {
+				return true
+			}
+		}
+	}
+	return available
+}
+
 func (s *Subscription) handleLatePublishRequest(ch *serverSecureChannel, requestid uint32, req *ua.PublishRequest, results []ua.StatusCode) bool {
 	s.Lock()
 	if !s.isLate {
 		s.Unlock()
 		return false
 	}
-	tn := time.Now()
-	notificationsAvailable := false
-	for _, item := range s.items {
-		if item.notificationsAvailable(tn, true, false) {
-			notificationsAvailable = true
-		}
-	}
+	tn := s.srv.now()
+	notificationsAvailable := s.notificationsAvailable(tn, true, false)
 	switch {
 	case notificationsAvailable && s.publishingEnabled:
 		// log.Printf("handleLatePublishRequest %d, %d\n", s.id, s.priority)
@@ -527,7 +591,7 @@ func (s *Subscription) handleLatePublishRequest(ch *serverSecureChannel, request
 		mins := make([]ua.MonitoredItemNotification, 0, 4)
 		efls := make([]ua.EventFieldList, 0, 4)
 		for _, item := range s.items {
-			if item.monitoringMode != ua.MonitoringModeReporting && !item.triggered {
+			if !item.isReporting() {
 				continue
 			}
 			// if item.triggered {
@@ -583,7 +647,7 @@ func (s *Subscription) handleLatePublishRequest(ch *serverSecureChannel, request
 		ch.Write(
 			&ua.PublishResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     s.srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 				},
 				SubscriptionID:           s.id,
@@ -619,11 +683,10 @@ func (s *Subscription) handleLatePublishRequest(ch *serverSecureChannel, request
 				avail = append(avail, nm.SequenceNumber)
 			}
 		}
-		results := make([]ua.StatusCode, len(req.SubscriptionAcknowledgements))
 		ch.Write(
 			&ua.PublishResponse{
 				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
+					Timestamp:     s.srv.now(),
 					RequestHandle: req.RequestHeader.RequestHandle,
 				},
 				SubscriptionID:           s.id,
@@ -631,7 +694,7 @@ func (s *Subscription) handleLatePublishRequest(ch *serverSecureChannel, request
 				MoreNotifications:        false,
 				NotificationMessage: ua.NotificationMessage{
 					SequenceNumber:   s.seqNum,
-					PublishTime:      time.Now(),
+					PublishTime:      s.srv.now(),
 					NotificationData: nil,
 				},
 				Results:         results,
@@ -115,7 +115,7 @@ func (m *SubscriptionManager) checkForExpiredSubscriptions() {
 				m.server.serverDiagnosticsSummary.CurrentSubscriptionCount = uint32(len(m.subscriptionsByID))
 				m.server.Unlock()
 			}
-			// log.Printf("Deleted expired subscription '%d'.\n", k)
+			m.server.Logger().Debugf("Deleted expired subscription '%d'.", k)
 			s.Delete()
 		}
 	}
@@ -142,7 +142,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		ua.NewLocalizedText("", ""),
 		nil,
 		refs,
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDSubscriptionDiagnosticsDataType,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -186,7 +186,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			MonitoringQueueOverflowCount: s.monitoringQueueOverflowCount,
 			NextSequenceNumber:           s.seqNum,
 			// EventQueueOverFlowCount:      uint32(0),
-		}, 0, time.Now(), 0, time.Now(), 0)
+		}, 0, srv.now(), 0, srv.now(), 0)
 		return dv
 	})
 	nodes = append(nodes, subscriptionDiagnosticsVariable)
@@ -200,7 +200,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDNodeID,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -210,7 +210,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.sessionId, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.sessionId, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 
@@ -224,7 +224,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -234,7 +234,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.id, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.id, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -247,7 +247,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDByte,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -257,7 +257,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.priority, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.priority, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -270,7 +270,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDDouble,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -280,7 +280,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.publishingInterval, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.publishingInterval, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -293,7 +293,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -303,7 +303,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.maxKeepAliveCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.maxKeepAliveCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -316,7 +316,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -326,7 +326,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.lifetimeCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.lifetimeCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -339,7 +339,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -349,7 +349,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.maxNotificationsPerPublish, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.maxNotificationsPerPublish, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -362,7 +362,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDBoolean,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -372,7 +372,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.publishingEnabled, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.publishingEnabled, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -385,7 +385,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -395,7 +395,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.modifyCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.modifyCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -408,7 +408,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -418,7 +418,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(0), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(0), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -431,7 +431,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -441,7 +441,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(0), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(0), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -454,7 +454,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -464,7 +464,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.republishRequestCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.republishRequestCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -477,7 +477,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -487,7 +487,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.republishMessageRequestCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.republishMessageRequestCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -500,7 +500,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -510,7 +510,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.republishMessageCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.republishMessageCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -523,7 +523,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -533,7 +533,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(0), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(0), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -546,7 +546,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -556,7 +556,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(0), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(0), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -569,7 +569,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -579,7 +579,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(0), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(0), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -592,7 +592,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -602,7 +602,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.publishRequestCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.publishRequestCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -615,7 +615,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -625,7 +625,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.dataChangeNotificationsCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.dataChangeNotificationsCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -638,7 +638,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -648,7 +648,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.eventNotificationsCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.eventNotificationsCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -661,7 +661,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -671,7 +671,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.notificationsCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.notificationsCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -684,7 +684,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -694,7 +694,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.latePublishRequestCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.latePublishRequestCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -707,7 +707,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -717,7 +717,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.keepAliveCounter, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.keepAliveCounter, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -730,7 +730,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -740,7 +740,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.lifetimeCounter, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.lifetimeCounter, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -753,7 +753,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -763,7 +763,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.unacknowledgedMessageCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.unacknowledgedMessageCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -776,7 +776,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -786,7 +786,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(0), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(0), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -799,7 +799,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -809,7 +809,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.monitoredItemCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.monitoredItemCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -822,7 +822,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -832,7 +832,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.disabledMonitoredItemCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.disabledMonitoredItemCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -845,7 +845,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -855,7 +855,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.monitoringQueueOverflowCount, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.monitoringQueueOverflowCount, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -868,7 +868,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -878,7 +878,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.seqNum, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.seqNum, 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -891,7 +891,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)),
 			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(subscriptionDiagnosticsVariable.GetNodeID())),
 		},
-		ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Now(), 0, time.Now(), 0),
+		ua.NewDataValue(nil, ua.BadWaitingForInitialData, srv.now(), 0, srv.now(), 0),
 		ua.DataTypeIDUInt32,
 		ua.ValueRankScalar,
 		[]uint32{},
@@ -901,7 +901,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(uint32(0), 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(uint32(0), 0, srv.now(), 0, srv.now(), 0)
 	})
 	nodes = append(nodes, n)
 
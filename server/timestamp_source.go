@@ -0,0 +1,46 @@
+package server
+
+import (
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// The values of the TimestampSource property of a variable.
+const (
+	// TimestampSourceDevice keeps the source timestamp of the value, or stamps it if missing.
+	TimestampSourceDevice string = "Device"
+	// TimestampSourceServer stamps the value when it is set.
+	TimestampSourceServer string = "Server"
+	// TimestampSourcePassthrough stores the value as it is set.
+	TimestampSourcePassthrough string = "Passthrough"
+)
+
+// SetTimestampSourceBehavior stamps the values set on the variable according to its TimestampSource property, in
+// the namespace of the variable. The property may be changed at any time. An unknown policy is Passthrough.
+func (m *NamespaceManager) SetTimestampSourceBehavior(node *VariableNode) error {
+	prop, ok := m.FindProperty(node, ua.NewQualifiedName(node.GetNodeID().GetNamespaceIndex(), "TimestampSource"))
+	if !ok {
+		return ua.BadNodeIDUnknown
+	}
+	node.Lock()
+	node.timestampSource = prop
+	node.clock = m.server.Clock()
+	node.Unlock()
+	return nil
+}
+
+// stampDataValue returns the value with the timestamps of the policy.
+func stampDataValue(policy string, value ua.DataValue, now time.Time) ua.DataValue {
+	switch policy {
+	case TimestampSourceDevice:
+		if value.SourceTimestamp.IsZero() {
+			value.SourceTimestamp, value.SourcePicoseconds = now, 0
+		}
+		value.ServerTimestamp, value.ServerPicoseconds = now, 0
+	case TimestampSourceServer:
+		value.SourceTimestamp, value.SourcePicoseconds = now, 0
+		value.ServerTimestamp, value.ServerPicoseconds = now, 0
+	}
+	return value
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestTimestampSource(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse|ua.PermissionTypeRead)
+	nm := srv.NamespaceManager()
+	levelID := ua.NewNodeIDString(1, "Level")
+	policy := NewVariableNode(
+		ua.NewNodeIDString(1, "Level.TimestampSource"),
+		ua.NewQualifiedName(1, "TimestampSource"),
+		ua.NewLocalizedText("TimestampSource", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(levelID))},
+		ua.NewDataValue(TimestampSourcePassthrough, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDString,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		-1,
+		false,
+		nil,
+	)
+	level := NewVariableNode(
+		levelID,
+		ua.NewQualifiedName(1, "Level"),
+		ua.NewLocalizedText("Level", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{ua.NewReference(ua.ReferenceTypeIDHasProperty, false, ua.NewExpandedNodeID(policy.NodeId))},
+		ua.NewDataValue(float64(0), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		-1,
+		false,
+		nil,
+	)
+	if err := nm.AddNodes(level, policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := nm.SetTimestampSourceBehavior(level); err != nil {
+		t.Fatal(err)
+	}
+
+	device := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, c := range []struct {
+		policy          string
+		sourceTimestamp time.Time
+		// whether the source and server timestamps are stamped with the current time.
+		stampSource, stampServer bool
+	}{
+		{TimestampSourcePassthrough, device, false, false},
+		{TimestampSourcePassthrough, time.Time{}, false, false},
+		{TimestampSourceDevice, device, false, true},
+		{TimestampSourceDevice, time.Time{}, true, true},
+		{TimestampSourceServer, device, true, true},
+	} {
+		policy.SetValue(ua.NewDataValue(c.policy, 0, time.Now(), 0, time.Now(), 0))
+		before := time.Now()
+		level.SetValue(ua.NewDataValue(float64(i), 0, c.sourceTimestamp, 0, time.Time{}, 0))
+		v := level.GetValue()
+		if stamped := !v.SourceTimestamp.Before(before); stamped != c.stampSource || !stamped && !v.SourceTimestamp.Equal(c.sourceTimestamp) {
+			t.Errorf("%s: unexpected source timestamp %v", c.policy, v.SourceTimestamp)
+		}
+		if stamped := !v.ServerTimestamp.Before(before); stamped != c.stampServer {
+			t.Errorf("%s: unexpected server timestamp %v", c.policy, v.ServerTimestamp)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package server
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/Eun/go-convert"
 	"github.com/afs/server/pkg/eris"
@@ -13,7 +14,9 @@ import (
 )
 
 var (
-	regex_InvalidName *regexp.Regexp = regexp.MustCompile(`(?P<INVALID>\.|/|\\|:)`)
+	// reservedNameChars are the characters a BrowseName can't contain. The NodeID of an ObjectNode is the path of
+	// the BrowseNames joined with the PathSeparator, so a name containing one of them would break the path resolution.
+	reservedNameChars = []string{PathSeparator, "/", "\\", ":"}
 )
 
 func ParsePluginId(value interface{}) (int16, error) {
@@ -30,20 +33,37 @@ func IsGUID(u string) bool {
 	return err == nil
 }
 
+// serverFromContext returns the server stored in the context, or the server of the project stored in the context.
+// It returns nil if the context has neither.
+func serverFromContext(ctx context.Context) *UAServer {
+	if ctx == nil {
+		return nil
+	}
+	if srv, ok := ctx.Value(CtxKeyUAServer).(*UAServer); ok {
+		return srv
+	}
+	if p, ok := ctx.Value(CtxKeyProjectManager).(*ProjectManager); ok && p.namespaceManager != nil {
+		return p.namespaceManager.server
+	}
+	return nil
+}
+
+// CheckNameLength returns an error if the value has more than max characters. Zero max is unlimited.
+func CheckNameLength(value string, max int) error {
+	if n := utf8.RuneCountInString(value); max > 0 && n > max {
+		return eris.Wrap(fmt.Errorf("the name can't be longer than %d characters (got %d)", max, n), msg.InvalidValue)
+	}
+	return nil
+}
+
+// IsValidName returns an error if the value is empty or contains one of the reservedNameChars.
 func IsValidName(value string) error {
 	if len(value) == 0 {
 		return ErrFieldRequired
 	}
-	matchIndexs := regex_InvalidName.FindAllStringSubmatchIndex(value, -1)
-	if len(matchIndexs) > 0 {
-		expNames := regex_InvalidName.SubexpNames()
-		for i, name := range expNames {
-			if len(name) > 0 {
-				if matchIndexs[0][i*2] >= 0 && matchIndexs[0][i*2+1] >= 1 {
-					invalidChar := value[matchIndexs[0][i*2]:matchIndexs[0][i*2+1]]
-					return fmt.Errorf("the name can't contains '%s'", invalidChar)
-				}
-			}
+	for _, c := range reservedNameChars {
+		if strings.Contains(value, c) {
+			return fmt.Errorf("the name can't contain '%s', it is reserved for the node paths", c)
 		}
 	}
 	return nil
@@ -72,6 +92,10 @@ func CheckBrowseName(value interface{}, target *ObjectNode, parent *ObjectNode)
 	if err != nil {
 		return true, "", err
 	}
+	err = CheckNameLength(validValue, serverFromContext(target.Context()).MaxBrowseNameLength())
+	if err != nil {
+		return true, "", err
+	}
 
 	if !target.nodeType.IsRoot() {
 		err = IsUniqueName(validValue, parent, target)
@@ -90,6 +114,10 @@ func CheckDisplayName(value interface{}, target *ObjectNode, parent *ObjectNode)
 	if err != nil {
 		return true, "", eris.Wrap(err, msg.InvalidValue)
 	}
+	err = CheckNameLength(validValue, serverFromContext(target.Context()).MaxDisplayNameLength())
+	if err != nil {
+		return true, "", err
+	}
 	return true, validValue, nil
 }
 
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+// equalDataValue returns true if the data values are deeply equal. It avoids reflection for the common value
+// types.
+func equalDataValue(a, b ua.DataValue) bool {
+	return a.StatusCode == b.StatusCode &&
+		a.SourceTimestamp == b.SourceTimestamp && a.SourcePicoseconds == b.SourcePicoseconds &&
+		a.ServerTimestamp == b.ServerTimestamp && a.ServerPicoseconds == b.ServerPicoseconds &&
+		equalVariant(a.Value, b.Value)
+}
+
+// equalVariant returns true if the values are deeply equal, as reflect.DeepEqual. It avoids reflection for the
+// scalar and slice types of the built-in data types.
+func equalVariant(a, b ua.Variant) bool {
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case bool, int8, uint8, int16, uint16, int32, uint32, int64, uint64, float32, float64, string,
+		time.Time, ua.ByteString, ua.StatusCode, ua.QualifiedName, ua.LocalizedText:
+		return a == b
+	case []bool:
+		y, ok := b.([]bool)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []int8:
+		y, ok := b.([]int8)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []uint8:
+		y, ok := b.([]uint8)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []int16:
+		y, ok := b.([]int16)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []uint16:
+		y, ok := b.([]uint16)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []int32:
+		y, ok := b.([]int32)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []uint32:
+		y, ok := b.([]uint32)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []int64:
+		y, ok := b.([]int64)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []uint64:
+		y, ok := b.([]uint64)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []float32:
+		y, ok := b.([]float32)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []float64:
+		y, ok := b.([]float64)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	case []string:
+		y, ok := b.([]string)
+		if !ok || len(x) != len(y) || (x == nil) != (y == nil) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+)
+
+func TestEqualVariant(t *testing.T) {
+	now := time.Now()
+	for _, c := range []struct {
+		a, b ua.Variant
+	}{
+		{nil, nil},
+		{nil, float64(0)},
+		{float64(1), float64(1)},
+		{float64(1), float32(1)},
+		{math.NaN(), math.NaN()},
+		{"a", "a"},
+		{now, now},
+		{now, now.Round(0)},
+		{ua.NewLocalizedText("a", "en"), ua.NewLocalizedText("a", "")},
+		{[]float64{1, 2}, []float64{1, 2}},
+		{[]float64{1, 2}, []float64{1, 3}},
+		{[]float64{1}, []float64{1, 2}},
+		{[]float64{}, []float64(nil)},
+		{[]float64{1}, []float32{1}},
+		{[]string{"a"}, []string{"a"}},
+		{[]byte{1}, ua.ByteString([]byte{1})},
+		{[][]int32{{1}}, [][]int32{{1}}},
+		{ua.NewNodeIDNumeric(1, 2), ua.NewNodeIDNumeric(1, 2)},
+	} {
+		if got, want := equalVariant(c.a, c.b), reflect.DeepEqual(c.a, c.b); got != want {
+			t.Errorf("%#v, %#v: expected %t, got %t", c.a, c.b, want, got)
+		}
+	}
+}
+
+// BenchmarkSetValue compares detecting a change of an array value with and without reflection.
+func BenchmarkSetValue(b *testing.B) {
+	values := make([]float64, 1000)
+	now := time.Now()
+	current := ua.NewDataValue(values, 0, now, 0, now, 0)
+	next := ua.NewDataValue(append([]float64(nil), values...), 0, now, 0, now, 0)
+	for _, c := range []struct {
+		name  string
+		equal func(a, b ua.DataValue) bool
+	}{
+		{"DeepEqual", func(a, b ua.DataValue) bool { return reflect.DeepEqual(a, b) }},
+		{"Typed", equalDataValue},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !c.equal(current, next) {
+					b.Fatal("expected equal values")
+				}
+			}
+		})
+	}
+	b.Run("VariableNode", func(b *testing.B) {
+		n := NewVariableNode(testVariableID, ua.NewQualifiedName(1, "Variable"), ua.NewLocalizedText("Variable", ""), ua.NewLocalizedText("", ""),
+			nil, []ua.Reference{}, current, ua.DataTypeIDDouble, ua.ValueRankOneDimension, []uint32{0}, ua.AccessLevelsCurrentRead, -1, false, nil)
+		for i := 0; i < b.N; i++ {
+			n.SetValue(next)
+		}
+	})
+}
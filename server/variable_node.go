@@ -3,9 +3,9 @@ package server
 import (
 	"bytes"
 	"context"
-	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/afs/server/config"
 	"github.com/afs/server/pkg/opcua/ua"
@@ -31,17 +31,34 @@ type VariableNode struct {
 	MinimumSamplingInterval float64                 `json:"MinimumSamplingInterval"`
 	Historizing             bool                    `json:"Historizing"`
 
-	ctx               context.Context                                                    `json:"-"`
-	parent            *ObjectNode                                                        `json:"-"`
-	propType          JsonPropertyType                                                   `json:"-"`
-	historian         HistoryReadWriter                                                  `json:"-"`
-	ReadValueHandler  func(context.Context, ua.ReadValueID) ua.DataValue                 `json:"-"`
-	WriteValueHandler func(context.Context, ua.WriteValue) (ua.DataValue, ua.StatusCode) `json:"-"`
+	ctx                 context.Context                                                    `json:"-"`
+	parent              *ObjectNode                                                        `json:"-"`
+	propType            JsonPropertyType                                                   `json:"-"`
+	historian           HistoryReadWriter                                                  `json:"-"`
+	ReadValueHandler    func(context.Context, ua.ReadValueID) ua.DataValue                 `json:"-"`
+	WriteValueHandler   func(context.Context, ua.WriteValue) (ua.DataValue, ua.StatusCode) `json:"-"`
+	ValueChangedHandler func(ua.DataValue)                                                 `json:"-"`
+	readCache           ua.DataValue                                                       `json:"-"`
+	readCacheTime       time.Time                                                          `json:"-"`
+	timestampSource     *VariableNode                                                      `json:"-"`
+	clock               Clock                                                              `json:"-"`
+	rangeCheck          RangeCheck                                                         `json:"-"`
+	listeners           map[ValueChangedListener]struct{}                                  `json:"-"`
+}
+
+// ValueChangedListener is notified of each change of the value of a variable.
+type ValueChangedListener interface {
+	OnValueChanged(*VariableNode, ua.DataValue)
 }
 
 var _ Node = (*VariableNode)(nil)
 
+// NewVariableNode returns a variable node. A nil value is replaced by the default value of the DataType and
+// ValueRank, see DefaultValueFor.
 func NewVariableNode(nodeID ua.NodeID, browseName ua.QualifiedName, displayName ua.LocalizedText, description ua.LocalizedText, rolePermissions []ua.RolePermissionType, references []ua.Reference, value ua.DataValue, dataType ua.NodeID, valueRank int32, arrayDimensions []uint32, accessLevel byte, minimumSamplingInterval float64, historizing bool, historian HistoryReadWriter) *VariableNode {
+	if value.Value == nil {
+		value.Value = DefaultValueFor(dataType, valueRank)
+	}
 	return &VariableNode{
 		NodeId:                  nodeID,
 		NodeClass:               ua.NodeClassVariable,
@@ -201,18 +218,38 @@ func (n *VariableNode) GetValue() ua.DataValue {
 func (n *VariableNode) SetValue(value ua.DataValue) bool {
 	n.Lock()
 
+	if n.timestampSource != nil {
+		policy, _ := n.timestampSource.GetValue().Value.(string)
+		value = stampDataValue(policy, value, n.clock.Now().UTC())
+	}
 	hasChanged := false
-	if !reflect.DeepEqual(n.Value, value) {
+	if !equalDataValue(n.Value, value) {
 		n.Value = value
 		hasChanged = true
 	}
+	// a Read within the MaxAge returns the value set, not the value read before.
+	n.readCacheTime = time.Time{}
 
 	if n.Historizing {
 		n.historian.WriteValue(context.Background(), n.NodeId, value)
 	}
+	changed := n.ValueChangedHandler
+	var listeners []ValueChangedListener
+	if hasChanged {
+		for l := range n.listeners {
+			listeners = append(listeners, l)
+		}
+	}
 
 	n.Unlock()
 
+	if hasChanged && changed != nil {
+		changed(value)
+	}
+	for _, l := range listeners {
+		l.OnValueChanged(n, value)
+	}
+
 	if n.propType.IsPluginProperty() {
 		if hasChanged && n.parent != nil {
 			if n.parent != nil && !n.parent.isUpdating {
@@ -318,6 +355,56 @@ func (n *VariableNode) SetHistorizing(historizing bool) {
 func (n *VariableNode) SetReadValueHandler(value func(context.Context, ua.ReadValueID) ua.DataValue) {
 	n.Lock()
 	n.ReadValueHandler = value
+	n.readCacheTime = time.Time{}
+	n.Unlock()
+}
+
+// cachedRead returns the value last returned by the ReadValueHandler, if it was read within maxAge milliseconds.
+func (n *VariableNode) cachedRead(maxAge float64) (ua.DataValue, bool) {
+	n.RLock()
+	defer n.RUnlock()
+	if n.readCacheTime.IsZero() || float64(time.Since(n.readCacheTime))/float64(time.Millisecond) > maxAge {
+		return ua.DataValue{}, false
+	}
+	return n.readCache, true
+}
+
+// cacheRead stores the value returned by the ReadValueHandler.
+func (n *VariableNode) cacheRead(value ua.DataValue) {
+	n.Lock()
+	n.readCache = value
+	n.readCacheTime = time.Now()
+	n.Unlock()
+}
+
+// invalidateReadCache discards the value last returned by the ReadValueHandler, so the next Read calls it again.
+func (n *VariableNode) invalidateReadCache() {
+	n.Lock()
+	n.readCacheTime = time.Time{}
+	n.Unlock()
+}
+
+// SetValueChangedHandler sets the ValueChangedHandler of this node, which is called after SetValue changes the value.
+func (n *VariableNode) SetValueChangedHandler(value func(ua.DataValue)) {
+	n.Lock()
+	n.ValueChangedHandler = value
+	n.Unlock()
+}
+
+// AddValueChangedListener adds a listener, which is notified after SetValue changes the value.
+func (n *VariableNode) AddValueChangedListener(listener ValueChangedListener) {
+	n.Lock()
+	if n.listeners == nil {
+		n.listeners = make(map[ValueChangedListener]struct{})
+	}
+	n.listeners[listener] = struct{}{}
+	n.Unlock()
+}
+
+// RemoveValueChangedListener removes the listener.
+func (n *VariableNode) RemoveValueChangedListener(listener ValueChangedListener) {
+	n.Lock()
+	delete(n.listeners, listener)
 	n.Unlock()
 }
 
@@ -415,8 +502,20 @@ func (n *VariableNode) GetAccessLevelString() string {
 }
 
 func (n *VariableNode) MarshalJSON() ([]byte, error) {
-	n.Lock()
-	defer n.Unlock()
+	// take a snapshot, so the lock is not held while the owner and values are marshaled
+	n.RLock()
+	nodeID := n.NodeId
+	owner := n.parent
+	browseName := n.BrowseName
+	displayName := n.DisplayName
+	description := n.Description
+	value := n.Value
+	valueRank := n.ValueRank
+	rolePermissions := n.RolePermissions
+	accessRestrictions := n.AccessRestrictions
+	references := n.References
+	n.RUnlock()
+
 	buffer := new(bytes.Buffer)
 	writer := jsonwriter.New(buffer)
 	writer.RootObject(func() {
@@ -434,17 +533,17 @@ func (n *VariableNode) MarshalJSON() ([]byte, error) {
 		// writer.KeyValue("accessRestrictions", n.AccessRestrictions)
 		// writer.ArrayValues("references", n.References)
 
-		writer.KeyValue("nodeId", n.NodeId.GetID())
-		writer.KeyValue("ownerId", n.Owner().GetInternalId().String())
-		writer.KeyValue("browseName", n.BrowseName.Name)
-		writer.KeyValue("displayName", n.DisplayName.Text)
-		writer.KeyValue("description", n.Description.Text)
-		writer.KeyValue("value", n.Value)
-		writer.KeyValue("valueRank", n.ValueRank)
-		writer.ArrayValues("rolePermissions", n.RolePermissions)
+		writer.KeyValue("nodeId", nodeID.GetID())
+		writer.KeyValue("ownerId", owner.GetInternalId().String())
+		writer.KeyValue("browseName", browseName.Name)
+		writer.KeyValue("displayName", displayName.Text)
+		writer.KeyValue("description", description.Text)
+		writer.KeyValue("value", value)
+		writer.KeyValue("valueRank", valueRank)
+		writer.ArrayValues("rolePermissions", rolePermissions)
 		writer.Separator()
-		writer.KeyValue("accessRestrictions", n.AccessRestrictions)
-		writer.ArrayValues("references", n.References)
+		writer.KeyValue("accessRestrictions", accessRestrictions)
+		writer.ArrayValues("references", references)
 	})
 	return buffer.Bytes(), nil
 }
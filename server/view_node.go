@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"github.com/afs/server/pkg/opcua/ua"
@@ -19,6 +20,7 @@ type ViewNode struct {
 	references         []ua.Reference
 	containsNoLoops    bool
 	eventNotifier      byte
+	viewVersion        uint32
 }
 
 var _ Node = (*ViewNode)(nil)
@@ -98,13 +100,82 @@ func (n *ViewNode) GetReferences() []ua.Reference {
 	return res
 }
 
-// SetReferences sets the References of the Variable.
+// SetReferences sets the References of the View. The ViewVersion is incremented if the forward references,
+// which determine the members of the view, change.
 func (n *ViewNode) SetReferences(value []ua.Reference) {
 	n.Lock()
+	if !equalForwardReferences(n.references, value) {
+		n.viewVersion++
+	}
 	n.references = value
 	n.Unlock()
 }
 
+// ViewVersion returns the version of the view, which is incremented each time the members of the view change.
+func (n *ViewNode) ViewVersion() uint32 {
+	n.RLock()
+	res := n.viewVersion
+	n.RUnlock()
+	return res
+}
+
+// equalForwardReferences returns true if the references have the same forward references. The properties of
+// the view are not members of the view, so HasProperty references are ignored.
+func equalForwardReferences(a, b []ua.Reference) bool {
+	count := map[ua.Reference]int{}
+	for _, r := range a {
+		if !r.IsInverse && r.ReferenceTypeID != ua.ReferenceTypeIDHasProperty {
+			count[r]++
+		}
+	}
+	for _, r := range b {
+		if !r.IsInverse && r.ReferenceTypeID != ua.ReferenceTypeIDHasProperty {
+			count[r]--
+		}
+	}
+	for _, c := range count {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// addViewVersionProperty adds the ViewVersion property to the view, which reads the current version of the
+// view. The namespace must be locked.
+func (m *NamespaceManager) addViewVersionProperty(view *ViewNode) error {
+	nodeID := view.GetNodeID()
+	propID := ua.NewNodeIDString(nodeID.GetNamespaceIndex(), fmt.Sprintf("%v%s%s", nodeID.GetID(), PathSeparator, "ViewVersion"))
+	if _, ok := m.nodes[propID]; ok {
+		return nil
+	}
+	now := m.server.now()
+	prop := NewVariableNode(
+		propID,
+		ua.NewQualifiedName(0, "ViewVersion"),
+		ua.NewLocalizedText("ViewVersion", ""),
+		ua.NewLocalizedText("", ""),
+		view.GetRolePermissions(),
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)),
+			ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(nodeID)),
+		},
+		ua.NewDataValue(view.ViewVersion(), 0, now, 0, now, 0),
+		ua.DataTypeIDUInt32,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	prop.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		now := m.server.now()
+		return ua.NewDataValue(view.ViewVersion(), 0, now, 0, now, 0)
+	})
+	return m.addNodes([]Node{prop})
+}
+
 // ContainsNoLoops returns the ContainsNoLoops attribute of this node.
 func (n *ViewNode) ContainsNoLoops() bool {
 	return n.containsNoLoops
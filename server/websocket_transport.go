@@ -0,0 +1,173 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/gorilla/websocket"
+)
+
+// webSocketSubprotocol is the WebSocket subprotocol for the UA binary encoding over UA secure conversation.
+const webSocketSubprotocol = "opcua+uacp"
+
+// WebSocketHandler returns a http.Handler that upgrades requests to WebSocket connections, and handles each
+// connection as a secure channel. Use it to mount the transport on an existing http.Server.
+func (srv *UAServer) WebSocketHandler() http.Handler {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  int(srv.receiveBufferSize),
+		WriteBufferSize: int(srv.sendBufferSize),
+		Subprotocols:    []string{webSocketSubprotocol},
+		// browsers connect from any origin, clients are authenticated by the secure channel and session.
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasWebSocketSubprotocol(r) {
+			http.Error(w, "expected subprotocol "+webSocketSubprotocol, http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		ch := newServerSecureChannel(srv, &webSocketConn{conn: conn}, srv.receiveBufferSize, srv.sendBufferSize, srv.maxMessageSize, srv.maxChunkCount, srv.trace)
+		ch.transportProfileURI = ua.TransportProfileURIWssUaBinaryTransport
+		srv.openChannel(ch)
+	})
+}
+
+// hasWebSocketSubprotocol returns true if the client requested the UA binary subprotocol.
+func hasWebSocketSubprotocol(r *http.Request) bool {
+	for _, p := range websocket.Subprotocols(r) {
+		if p == webSocketSubprotocol {
+			return true
+		}
+	}
+	return false
+}
+
+// listenWebSocket opens the listener of the WebSocket endpoint.
+func (srv *UAServer) listenWebSocket() (net.Listener, error) {
+	baseURL, err := url.Parse(srv.webSocketEndpointURL)
+	if err != nil {
+		return nil, ua.BadTCPEndpointURLInvalid
+	}
+	l, err := net.Listen("tcp", ":"+baseURL.Port())
+	if err != nil {
+		return nil, ua.BadResourceUnavailable
+	}
+	if srv.webSocketTLSConfig != nil {
+		l = tls.NewListener(l, srv.webSocketTLSConfig)
+	}
+	return l, nil
+}
+
+// serveWebSocket serves the WebSocket endpoint until the listener is closed.
+func (srv *UAServer) serveWebSocket(l net.Listener) {
+	hs := &http.Server{Handler: srv.WebSocketHandler()}
+	if err := hs.Serve(l); err != nil {
+		select {
+		case <-srv.closing:
+		default:
+			srv.Logger().Errorf("Error serving WebSocket endpoint '%s'. %s", srv.webSocketEndpointURL, err)
+		}
+	}
+}
+
+// buildWebSocketEndpointDescriptions appends an endpoint using the WebSocket transport for each endpoint using the tcp transport.
+func (srv *UAServer) buildWebSocketEndpointDescriptions(eds []ua.EndpointDescription) []ua.EndpointDescription {
+	if srv.webSocketEndpointURL == "" {
+		return eds
+	}
+	for _, ep := range eds {
+		if ep.TransportProfileURI != ua.TransportProfileURIUaTcpTransport {
+			continue
+		}
+		ep.EndpointURL = srv.webSocketEndpointURL
+		ep.TransportProfileURI = ua.TransportProfileURIWssUaBinaryTransport
+		eds = append(eds, ep)
+	}
+	return sortBySecurityLevel(eds)
+}
+
+// webSocketConn adapts a WebSocket connection to a net.Conn. Each chunk is sent as one binary message.
+type webSocketConn struct {
+	conn   *websocket.Conn
+	reader io.Reader
+	wlock  sync.Mutex
+}
+
+// Read reads from the current message, moving to the next message when the current one is drained.
+func (c *webSocketConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			mt, r, err := c.conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if mt != websocket.BinaryMessage {
+				return 0, ua.BadDecodingError
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Write sends p as one binary message.
+func (c *webSocketConn) Write(p []byte) (int, error) {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying connection.
+func (c *webSocketConn) Close() error {
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *webSocketConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *webSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *webSocketConn) SetDeadline(t time.Time) error {
+	if err := c.conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline.
+func (c *webSocketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline.
+func (c *webSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
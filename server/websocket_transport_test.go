@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketTransportOpenSecureChannel(t *testing.T) {
+	srv, _ := newTestServer(t, ua.PermissionTypeBrowse)
+	srv.endpointURL = "opc.tcp://127.0.0.1:46010"
+	srv.webSocketEndpointURL = "opc.wss://127.0.0.1:46011"
+	srv.allowSecurityPolicyNone = true
+	srv.receiveBufferSize = defaultBufferSize
+	srv.sendBufferSize = defaultBufferSize
+	srv.maxMessageSize = defaultMaxMessageSize
+	srv.maxChunkCount = defaultMaxChunkCount
+	srv.channelManager = NewChannelManager(srv)
+
+	if _, ok := srv.findEndpoint(ua.TransportProfileURIWssUaBinaryTransport, ua.SecurityPolicyURINone, ua.MessageSecurityModeNone); !ok {
+		t.Fatal("expected WebSocket endpoint with security policy None")
+	}
+
+	ts := httptest.NewServer(srv.WebSocketHandler())
+	defer ts.Close()
+	dialer := websocket.Dialer{Subprotocols: []string{webSocketSubprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Hello
+	var buf bytes.Buffer
+	enc := ua.NewBinaryEncoder(&buf, ua.NewEncodingContext())
+	enc.WriteUInt32(ua.MessageTypeHello)
+	enc.WriteUInt32(uint32(32 + len(srv.webSocketEndpointURL)))
+	enc.WriteUInt32(protocolVersion)
+	enc.WriteUInt32(defaultBufferSize)
+	enc.WriteUInt32(defaultBufferSize)
+	enc.WriteUInt32(defaultMaxMessageSize)
+	enc.WriteUInt32(defaultMaxChunkCount)
+	enc.WriteString(srv.webSocketEndpointURL)
+	if err := conn.WriteMessage(websocket.BinaryMessage, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.LittleEndian.Uint32(msg) != ua.MessageTypeAck {
+		t.Fatalf("expected Acknowledge, got %q", msg[:4])
+	}
+
+	// OpenSecureChannel
+	var body bytes.Buffer
+	bodyEnc := ua.NewBinaryEncoder(&body, ua.NewEncodingContext())
+	bodyEnc.WriteNodeID(ua.ObjectIDOpenSecureChannelRequestEncodingDefaultBinary)
+	if err := bodyEnc.Encode(&ua.OpenSecureChannelRequest{
+		RequestHeader:         ua.RequestHeader{Timestamp: time.Now(), RequestHandle: 1},
+		ClientProtocolVersion: protocolVersion,
+		RequestType:           ua.SecurityTokenRequestTypeIssue,
+		SecurityMode:          ua.MessageSecurityModeNone,
+		ClientNonce:           ua.ByteString(""),
+		RequestedLifetime:     60000,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	enc.WriteUInt32(ua.MessageTypeOpenFinal)
+	enc.WriteUInt32(uint32(16 + len(ua.SecurityPolicyURINone) + 8 + 8 + body.Len()))
+	enc.WriteUInt32(0)
+	enc.WriteString(ua.SecurityPolicyURINone)
+	enc.WriteByteArray(nil)
+	enc.WriteByteArray(nil)
+	enc.WriteUInt32(1) // sequence number
+	enc.WriteUInt32(1) // request id
+	buf.Write(body.Bytes())
+	if err := conn.WriteMessage(websocket.BinaryMessage, buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.LittleEndian.Uint32(msg) != ua.MessageTypeOpenFinal {
+		t.Fatalf("expected OpenSecureChannelResponse, got %q", msg[:4])
+	}
+	channelID := binary.LittleEndian.Uint32(msg[8:12])
+
+	// the channel is added once opened.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if ch, ok := srv.ChannelManager().Get(channelID); ok {
+			if uri := ch.LocalEndpoint().TransportProfileURI; uri != ua.TransportProfileURIWssUaBinaryTransport {
+				t.Errorf("expected transport profile %s, got %s", ua.TransportProfileURIWssUaBinaryTransport, uri)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected channel %d", channelID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -65,7 +65,7 @@ func (e *AcknowledgeableCondition) GetAttribute(clause SimpleAttributeOperand) V
 		return Variant(e.Message)
 	case EqualSimpleAttributeOperand(clause, AcknowledgeableConditionSelectClauses[7]):
 		return Variant(e.Severity)
-	case EqualSimpleAttributeOperand(clause, AcknowledgeableConditionSelectClauses[8]):
+	case IsConditionIDOperand(clause):
 		return Variant(e.ConditionID)
 	case EqualSimpleAttributeOperand(clause, AcknowledgeableConditionSelectClauses[9]):
 		return Variant(e.ConditionName)
@@ -67,7 +67,7 @@ func (e *AlarmCondition) GetAttribute(clause SimpleAttributeOperand) Variant {
 		return Variant(e.Message)
 	case EqualSimpleAttributeOperand(clause, AlarmConditionSelectClauses[7]):
 		return Variant(e.Severity)
-	case EqualSimpleAttributeOperand(clause, AlarmConditionSelectClauses[8]):
+	case IsConditionIDOperand(clause):
 		return Variant(e.ConditionID)
 	case EqualSimpleAttributeOperand(clause, AlarmConditionSelectClauses[9]):
 		return Variant(e.ConditionName)
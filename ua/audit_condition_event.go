@@ -0,0 +1,110 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"time"
+)
+
+// AuditConditionEvent structure, of the AuditConditionAcknowledgeEventType or AuditConditionConfirmEventType.
+type AuditConditionEvent struct {
+	EventID          ByteString
+	EventType        NodeID
+	SourceNode       NodeID
+	SourceName       string
+	Time             time.Time
+	ReceiveTime      time.Time
+	Message          LocalizedText
+	Severity         uint16
+	ActionTimeStamp  time.Time
+	Status           bool
+	ClientUserID     string
+	MethodID         NodeID
+	InputArguments   []Variant
+	ConditionEventID ByteString
+	Comment          LocalizedText
+}
+
+// UnmarshalFields ...
+func (evt *AuditConditionEvent) UnmarshalFields(eventFields []Variant) error {
+	if len(eventFields) != 15 {
+		return BadUnexpectedError
+	}
+	evt.EventID, _ = eventFields[0].(ByteString)
+	evt.EventType, _ = eventFields[1].(NodeID)
+	evt.SourceNode, _ = eventFields[2].(NodeID)
+	evt.SourceName, _ = eventFields[3].(string)
+	evt.Time, _ = eventFields[4].(time.Time)
+	evt.ReceiveTime, _ = eventFields[5].(time.Time)
+	evt.Message, _ = eventFields[6].(LocalizedText)
+	evt.Severity, _ = eventFields[7].(uint16)
+	evt.ActionTimeStamp, _ = eventFields[8].(time.Time)
+	evt.Status, _ = eventFields[9].(bool)
+	evt.ClientUserID, _ = eventFields[10].(string)
+	evt.MethodID, _ = eventFields[11].(NodeID)
+	evt.InputArguments, _ = eventFields[12].([]Variant)
+	evt.ConditionEventID, _ = eventFields[13].(ByteString)
+	evt.Comment, _ = eventFields[14].(LocalizedText)
+	return nil
+}
+
+// GetAttribute ...
+func (e *AuditConditionEvent) GetAttribute(clause SimpleAttributeOperand) Variant {
+	// the ConditionEventId and Comment fields are declared by both event types.
+	if clause.TypeDefinitionID == ObjectTypeIDAuditConditionConfirmEventType {
+		clause.TypeDefinitionID = ObjectTypeIDAuditConditionAcknowledgeEventType
+	}
+	switch {
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[0]):
+		return Variant(e.EventID)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[1]):
+		return Variant(e.EventType)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[2]):
+		return Variant(e.SourceNode)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[3]):
+		return Variant(e.SourceName)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[4]):
+		return Variant(e.Time)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[5]):
+		return Variant(e.ReceiveTime)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[6]):
+		return Variant(e.Message)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[7]):
+		return Variant(e.Severity)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[8]):
+		return Variant(e.ActionTimeStamp)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[9]):
+		return Variant(e.Status)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[10]):
+		return Variant(e.ClientUserID)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[11]):
+		return Variant(e.MethodID)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[12]):
+		return Variant(e.InputArguments)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[13]):
+		return Variant(e.ConditionEventID)
+	case EqualSimpleAttributeOperand(clause, AuditConditionEventSelectClauses[14]):
+		return Variant(e.Comment)
+	default:
+		return nil
+	}
+}
+
+// AuditConditionEventSelectClauses ...
+var AuditConditionEventSelectClauses []SimpleAttributeOperand = []SimpleAttributeOperand{
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventType"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceNode"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceName"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Time"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("ReceiveTime"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Message"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Severity"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ActionTimeStamp"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("Status"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ClientUserId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditUpdateMethodEventType, BrowsePath: ParseBrowsePath("MethodId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditUpdateMethodEventType, BrowsePath: ParseBrowsePath("InputArguments"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditConditionAcknowledgeEventType, BrowsePath: ParseBrowsePath("ConditionEventId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditConditionAcknowledgeEventType, BrowsePath: ParseBrowsePath("Comment"), AttributeID: AttributeIDValue},
+}
@@ -3,6 +3,7 @@
 package ua
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 	"math"
@@ -19,16 +20,43 @@ var (
 	typeToDecoderMap sync.Map
 )
 
+// DefaultMaxNestingDepth is the default limit of nested Variant, DataValue and ExtensionObject values.
+const DefaultMaxNestingDepth = 100
+
 // BinaryDecoder decodes the UA binary protocol.
 type BinaryDecoder struct {
-	r  io.Reader
-	ec EncodingContext
-	bs [8]byte
+	r        io.Reader
+	ec       EncodingContext
+	bs       [8]byte
+	depth    int
+	maxDepth int
+	exceeded bool
 }
 
 // NewBinaryDecoder returns a new decoder that reads from an io.Reader.
 func NewBinaryDecoder(r io.Reader, ec EncodingContext) *BinaryDecoder {
-	return &BinaryDecoder{r, ec, [8]byte{}}
+	return &BinaryDecoder{r: r, ec: ec, maxDepth: DefaultMaxNestingDepth}
+}
+
+// SetMaxNestingDepth sets the limit of nested Variant, DataValue and ExtensionObject values.
+// Decoding a value nested deeper than the limit fails with BadDecodingError.
+func (dec *BinaryDecoder) SetMaxNestingDepth(value int) {
+	dec.maxDepth = value
+}
+
+// enter increments the nesting depth, failing if the limit is exceeded.
+func (dec *BinaryDecoder) enter() error {
+	if dec.depth >= dec.maxDepth {
+		dec.exceeded = true
+		return BadDecodingError
+	}
+	dec.depth++
+	return nil
+}
+
+// leave decrements the nesting depth.
+func (dec *BinaryDecoder) leave() {
+	dec.depth--
 }
 
 type decoderFunc func(*BinaryDecoder, unsafe.Pointer) error
@@ -749,6 +777,10 @@ func (dec *BinaryDecoder) ReadLocalizedText(value *LocalizedText) error {
 
 // ReadExtensionObject reads an Extensionobject.
 func (dec *BinaryDecoder) ReadExtensionObject(value *ExtensionObject) error {
+	if err := dec.enter(); err != nil {
+		return err
+	}
+	defer dec.leave()
 	var nodeID NodeID
 	if err := dec.ReadNodeID(&nodeID); err != nil {
 		return BadDecodingError
@@ -781,6 +813,15 @@ func (dec *BinaryDecoder) ReadExtensionObject(value *ExtensionObject) error {
 		if err != nil {
 			return BadDecodingError
 		}
+		if c, ok := DefaultExtensionObjectRegistry.findID(id); ok {
+			d := &BinaryDecoder{r: bytes.NewReader(body), ec: dec.ec, depth: dec.depth, maxDepth: dec.maxDepth}
+			obj, err := c.decode(d)
+			if err != nil {
+				dec.exceeded = dec.exceeded || d.exceeded
+				return BadDecodingError
+			}
+			*value = obj
+		}
 		return nil
 	case 0x02:
 		var body XMLElement
@@ -796,6 +837,10 @@ func (dec *BinaryDecoder) ReadExtensionObject(value *ExtensionObject) error {
 
 // ReadDataValue reads a DataValue.
 func (dec *BinaryDecoder) ReadDataValue(value *DataValue) error {
+	if err := dec.enter(); err != nil {
+		return err
+	}
+	defer dec.leave()
 	var (
 		v                 Variant
 		statusCode        StatusCode
@@ -811,6 +856,9 @@ func (dec *BinaryDecoder) ReadDataValue(value *DataValue) error {
 	}
 	if (b & 1) != 0 {
 		if err := dec.ReadVariant(&v); err != nil {
+			if dec.exceeded {
+				return BadDecodingError
+			}
 			// return BadDecodingError
 			statusCode = BadDataTypeIDUnknown
 		}
@@ -846,6 +894,10 @@ func (dec *BinaryDecoder) ReadDataValue(value *DataValue) error {
 
 // ReadVariant reads a Variant.
 func (dec *BinaryDecoder) ReadVariant(value *Variant) error {
+	if err := dec.enter(); err != nil {
+		return err
+	}
+	defer dec.leave()
 	var b byte
 	if err := dec.ReadByte(&b); err != nil {
 		return BadDecodingError
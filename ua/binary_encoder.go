@@ -768,6 +768,9 @@ func (enc *BinaryEncoder) WriteExtensionObject(value ExtensionObject) error {
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
 	}
+	if c, ok := DefaultExtensionObjectRegistry.findType(typ); ok {
+		return enc.writeRegisteredExtensionObject(c, value)
+	}
 	id, ok := FindBinaryEncodingIDForType(typ)
 	if !ok {
 		return BadEncodingError
@@ -812,6 +815,26 @@ func (enc *BinaryEncoder) WriteExtensionObject(value ExtensionObject) error {
 	return nil
 }
 
+// writeRegisteredExtensionObject writes an ExtensionObject using the encoder of the ExtensionObjectRegistry.
+func (enc *BinaryEncoder) writeRegisteredExtensionObject(c *extensionObjectCodec, value ExtensionObject) error {
+	if err := enc.WriteNodeID(ToNodeID(c.id, enc.ec.NamespaceURIs())); err != nil {
+		return BadEncodingError
+	}
+	if err := enc.WriteByte(0x01); err != nil {
+		return BadEncodingError
+	}
+	buf2 := *(bytesPool.Get().(*[]byte))
+	defer bytesPool.Put(&buf2)
+	var writer = NewWriter(buf2)
+	if err := c.encode(NewBinaryEncoder(writer, enc.ec), value); err != nil {
+		return BadEncodingError
+	}
+	if err := enc.WriteByteArray(writer.Bytes()); err != nil {
+		return BadEncodingError
+	}
+	return nil
+}
+
 // WriteDataValue writes a DataValue
 func (enc *BinaryEncoder) WriteDataValue(value DataValue) error {
 	var b byte
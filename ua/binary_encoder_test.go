@@ -419,6 +419,30 @@ func TestDataValue(t *testing.T) {
 	}
 }
 
+func TestMaxNestingDepth(t *testing.T) {
+	// nested returns a DataValue holding a Variant nested in a Variant, n times.
+	nested := func(n int) []byte {
+		b := append([]byte{0x01}, bytes.Repeat([]byte{0x18}, n)...)
+		return append(b, 0x00)
+	}
+
+	// the DataValue and the innermost Variant count as two levels.
+	dec := ua.NewBinaryDecoder(bytes.NewReader(nested(ua.DefaultMaxNestingDepth-2)), ua.NewEncodingContext())
+	var out ua.DataValue
+	assert.NilError(t, dec.ReadDataValue(&out))
+
+	dec = ua.NewBinaryDecoder(bytes.NewReader(nested(ua.DefaultMaxNestingDepth-1)), ua.NewEncodingContext())
+	assert.Equal(t, dec.ReadDataValue(&out), ua.BadDecodingError)
+
+	// deep enough to overflow the stack without a limit.
+	dec = ua.NewBinaryDecoder(bytes.NewReader(nested(10000000)), ua.NewEncodingContext())
+	assert.Equal(t, dec.ReadDataValue(&out), ua.BadDecodingError)
+
+	dec = ua.NewBinaryDecoder(bytes.NewReader(nested(8)), ua.NewEncodingContext())
+	dec.SetMaxNestingDepth(8)
+	assert.Equal(t, dec.ReadDataValue(&out), ua.BadDecodingError)
+}
+
 func TestEnum(t *testing.T) {
 	cases := []struct {
 		in    ua.MessageSecurityMode
@@ -61,7 +61,7 @@ func (e *Condition) GetAttribute(clause SimpleAttributeOperand) Variant {
 		return Variant(e.Message)
 	case EqualSimpleAttributeOperand(clause, ConditionSelectClauses[7]):
 		return Variant(e.Severity)
-	case EqualSimpleAttributeOperand(clause, ConditionSelectClauses[8]):
+	case IsConditionIDOperand(clause):
 		return Variant(e.ConditionID)
 	case EqualSimpleAttributeOperand(clause, ConditionSelectClauses[9]):
 		return Variant(e.ConditionName)
@@ -22,3 +22,38 @@ func EqualSimpleAttributeOperand(a, b SimpleAttributeOperand) bool {
 	}
 	return true
 }
+
+// conditionTypes are the ConditionType and its subtypes defined by the standard.
+var conditionTypes = map[NodeID]struct{}{
+	ObjectTypeIDConditionType:                     {},
+	ObjectTypeIDDialogConditionType:               {},
+	ObjectTypeIDAcknowledgeableConditionType:      {},
+	ObjectTypeIDAlarmConditionType:                {},
+	ObjectTypeIDLimitAlarmType:                    {},
+	ObjectTypeIDExclusiveLimitAlarmType:           {},
+	ObjectTypeIDNonExclusiveLimitAlarmType:        {},
+	ObjectTypeIDExclusiveLevelAlarmType:           {},
+	ObjectTypeIDNonExclusiveLevelAlarmType:        {},
+	ObjectTypeIDExclusiveDeviationAlarmType:       {},
+	ObjectTypeIDNonExclusiveDeviationAlarmType:    {},
+	ObjectTypeIDExclusiveRateOfChangeAlarmType:    {},
+	ObjectTypeIDNonExclusiveRateOfChangeAlarmType: {},
+	ObjectTypeIDDiscreteAlarmType:                 {},
+	ObjectTypeIDOffNormalAlarmType:                {},
+	ObjectTypeIDSystemOffNormalAlarmType:          {},
+	ObjectTypeIDTripAlarmType:                     {},
+	ObjectTypeIDInstrumentDiagnosticAlarmType:     {},
+	ObjectTypeIDSystemDiagnosticAlarmType:         {},
+	ObjectTypeIDCertificateExpirationAlarmType:    {},
+	ObjectTypeIDDiscrepancyAlarmType:              {},
+}
+
+// IsConditionIDOperand returns true if the operand selects the ConditionId of an event, which is the NodeId attribute
+// of the condition itself, with an empty browse path. Clients may use the ConditionType or any of its standard
+// subtypes as the TypeDefinitionId.
+func IsConditionIDOperand(a SimpleAttributeOperand) bool {
+	if _, ok := conditionTypes[a.TypeDefinitionID]; !ok {
+		return false
+	}
+	return len(a.BrowsePath) == 0 && a.AttributeID == AttributeIDNodeID && a.IndexRange == ""
+}
@@ -141,6 +141,9 @@ func ParseExpandedNodeID(s string) ExpandedNodeID {
 		s = s[pos+1:]
 	}
 	nodeId := ParseNodeID(s)
+	if nodeId == nil {
+		return NilExpandedNodeID
+	}
 	return ExpandedNodeID{nodeId.GetIDType(), uint32(svr), nsu, nodeId}
 }
 
@@ -5,4 +5,5 @@ package ua
 // ExtensionObject stores a struct.
 // Register the struct type and id with the BinaryEncoder using
 //   func RegisterBinaryEncodingID(typ reflect.Type, id ExpandedNodeID)
+// or register the type with an encoder and decoder in the DefaultExtensionObjectRegistry.
 type ExtensionObject interface{}
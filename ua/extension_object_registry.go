@@ -0,0 +1,95 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ExtensionObjectEncoder writes the body of an ExtensionObject.
+type ExtensionObjectEncoder func(enc *BinaryEncoder, value ExtensionObject) error
+
+// ExtensionObjectDecoder reads the body of an ExtensionObject.
+type ExtensionObjectDecoder func(dec *BinaryDecoder) (ExtensionObject, error)
+
+// ExtensionObjectRegistry maps custom structures to their binary encoding id, and the functions that encode and
+// decode their body. Use it for structures whose encoding is not derived from the fields of a Go struct.
+// Without an entry, the body of an ExtensionObject with an unknown encoding id is discarded when decoded.
+type ExtensionObjectRegistry struct {
+	sync.RWMutex
+	types map[reflect.Type]*extensionObjectCodec
+	ids   map[ExpandedNodeID]*extensionObjectCodec
+}
+
+type extensionObjectCodec struct {
+	typ    reflect.Type
+	id     ExpandedNodeID
+	encode ExtensionObjectEncoder
+	decode ExtensionObjectDecoder
+}
+
+// DefaultExtensionObjectRegistry is the registry used by the BinaryEncoder and BinaryDecoder.
+var DefaultExtensionObjectRegistry = NewExtensionObjectRegistry()
+
+// NewExtensionObjectRegistry returns an empty ExtensionObjectRegistry.
+func NewExtensionObjectRegistry() *ExtensionObjectRegistry {
+	return &ExtensionObjectRegistry{
+		types: map[reflect.Type]*extensionObjectCodec{},
+		ids:   map[ExpandedNodeID]*extensionObjectCodec{},
+	}
+}
+
+// Register registers the type with its binary encoding id, encoder and decoder.
+func (r *ExtensionObjectRegistry) Register(typ reflect.Type, id ExpandedNodeID, encode ExtensionObjectEncoder, decode ExtensionObjectDecoder) error {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	id = registryKey(id)
+	r.Lock()
+	defer r.Unlock()
+	if c, ok := r.ids[id]; ok && c.typ != typ {
+		return fmt.Errorf("registering duplicate types for %q: %s != %s", id, c.typ, typ)
+	}
+	if c, ok := r.types[typ]; ok && c.id != id {
+		return fmt.Errorf("registering duplicate ids for %s: %q != %q", typ, c.id, id)
+	}
+	c := &extensionObjectCodec{typ: typ, id: id, encode: encode, decode: decode}
+	r.types[typ] = c
+	r.ids[id] = c
+	return nil
+}
+
+// Unregister removes the type with the binary encoding id.
+func (r *ExtensionObjectRegistry) Unregister(id ExpandedNodeID) {
+	id = registryKey(id)
+	r.Lock()
+	defer r.Unlock()
+	if c, ok := r.ids[id]; ok {
+		delete(r.types, c.typ)
+		delete(r.ids, id)
+	}
+}
+
+// findType returns the codec of the type.
+func (r *ExtensionObjectRegistry) findType(typ reflect.Type) (*extensionObjectCodec, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	c, ok := r.types[typ]
+	return c, ok
+}
+
+// findID returns the codec of the binary encoding id.
+func (r *ExtensionObjectRegistry) findID(id ExpandedNodeID) (*extensionObjectCodec, bool) {
+	id = registryKey(id)
+	r.RLock()
+	defer r.RUnlock()
+	c, ok := r.ids[id]
+	return c, ok
+}
+
+// registryKey returns the id without the IdType, which is not set by every constructor of ExpandedNodeID.
+func registryKey(id ExpandedNodeID) ExpandedNodeID {
+	return ExpandedNodeID{ServerIndex: id.ServerIndex, NamespaceURI: id.NamespaceURI, NodeID: id.NodeID}
+}
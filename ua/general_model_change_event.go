@@ -0,0 +1,86 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"time"
+)
+
+// GeneralModelChangeEvent structure.
+type GeneralModelChangeEvent struct {
+	EventID     ByteString
+	EventType   NodeID
+	SourceNode  NodeID
+	SourceName  string
+	Time        time.Time
+	ReceiveTime time.Time
+	Message     LocalizedText
+	Severity    uint16
+	Changes     []ModelChangeStructureDataType
+}
+
+// UnmarshalFields ...
+func (evt *GeneralModelChangeEvent) UnmarshalFields(eventFields []Variant) error {
+	if len(eventFields) != 9 {
+		return BadUnexpectedError
+	}
+	evt.EventID, _ = eventFields[0].(ByteString)
+	evt.EventType, _ = eventFields[1].(NodeID)
+	evt.SourceNode, _ = eventFields[2].(NodeID)
+	evt.SourceName, _ = eventFields[3].(string)
+	evt.Time, _ = eventFields[4].(time.Time)
+	evt.ReceiveTime, _ = eventFields[5].(time.Time)
+	evt.Message, _ = eventFields[6].(LocalizedText)
+	evt.Severity, _ = eventFields[7].(uint16)
+	evt.Changes = nil
+	changes, _ := eventFields[8].([]ExtensionObject)
+	for _, c := range changes {
+		if c1, ok := c.(ModelChangeStructureDataType); ok {
+			evt.Changes = append(evt.Changes, c1)
+		}
+	}
+	return nil
+}
+
+// GetAttribute ...
+func (e *GeneralModelChangeEvent) GetAttribute(clause SimpleAttributeOperand) Variant {
+	switch {
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[0]):
+		return Variant(e.EventID)
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[1]):
+		return Variant(e.EventType)
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[2]):
+		return Variant(e.SourceNode)
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[3]):
+		return Variant(e.SourceName)
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[4]):
+		return Variant(e.Time)
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[5]):
+		return Variant(e.ReceiveTime)
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[6]):
+		return Variant(e.Message)
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[7]):
+		return Variant(e.Severity)
+	case EqualSimpleAttributeOperand(clause, GeneralModelChangeEventSelectClauses[8]):
+		changes := make([]ExtensionObject, len(e.Changes))
+		for i, c := range e.Changes {
+			changes[i] = c
+		}
+		return Variant(changes)
+	default:
+		return nil
+	}
+}
+
+// GeneralModelChangeEventSelectClauses ...
+var GeneralModelChangeEventSelectClauses []SimpleAttributeOperand = []SimpleAttributeOperand{
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventType"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceNode"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceName"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Time"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("ReceiveTime"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Message"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Severity"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDGeneralModelChangeEventType, BrowsePath: ParseBrowsePath("Changes"), AttributeID: AttributeIDValue},
+}
@@ -270,16 +270,28 @@ func ParseNodeID(v interface{}) NodeID {
 			ns = uint16(item.(float64))
 		}
 
-		if IDType, ok := data["idType"]; ok {
-			switch IDType {
-			case float64(IDTypeNumeric):
-				return NewNodeIDNumeric(ns, uint32(id.(float64)))
-			case float64(IDTypeString):
-				return NewNodeIDString(ns, id.(string))
-			case float64(IDTypeGUID):
-				return NewNodeIDGUID(ns, uuid.MustParse(id.(string)))
-			case float64(IDTypeOpaque):
-				return NewNodeIDOpaque(ns, ByteString(id.(string)))
+		// the idType of a numeric id is omitted, see MarshalJSON.
+		idType := float64(IDTypeNumeric)
+		if v, ok := data["idType"].(float64); ok {
+			idType = v
+		}
+		switch idType {
+		case float64(IDTypeNumeric):
+			if id, ok := id.(float64); ok {
+				return NewNodeIDNumeric(ns, uint32(id))
+			}
+		case float64(IDTypeString):
+			if id, ok := id.(string); ok {
+				return NewNodeIDString(ns, id)
+			}
+		case float64(IDTypeGUID):
+			if id, err := uuid.Parse(fmt.Sprint(id)); err == nil {
+				return NewNodeIDGUID(ns, id)
+			}
+		case float64(IDTypeOpaque):
+			// opaque ids are base64 encoded, see MarshalJSON.
+			if id, err := base64.StdEncoding.DecodeString(fmt.Sprint(id)); err == nil {
+				return NewNodeIDOpaque(ns, ByteString(id))
 			}
 		}
 	}
@@ -291,6 +303,8 @@ func ParseNodeID(v interface{}) NodeID {
 //   - ParseNodeIDString("ns=2;s=Demo.Static.Scalar.Float") // string
 //   - ParseNodeIDString("ns=2;g=5ce9dbce-5d79-434c-9ac3-1cfba9a6e92c") // guid
 //   - ParseNodeIDString("ns=2;b=YWJjZA==") // opaque byte string
+//
+// It returns nil if the string is not a NodeID, and for the null NodeID "i=0".
 func ParseNodeIDString(s string) NodeID {
 	var ns uint64
 	var err error
@@ -379,10 +393,14 @@ func ParseNodeIDBytes(b []byte) (NodeID, error) {
 		if err != nil {
 			return nil, err
 		}
+		b, err := base64.StdEncoding.DecodeString(id)
+		if err != nil {
+			return nil, err
+		}
 		return NodeIDOpaque{
 			NamespaceIndex: uint16(jeNamespace.Uint()),
 			IDType:         idType,
-			ID:             ByteString(id),
+			ID:             ByteString(b),
 		}, nil
 	}
 
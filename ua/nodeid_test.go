@@ -0,0 +1,84 @@
+package ua_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/afs/server/pkg/opcua/ua"
+	"github.com/google/uuid"
+)
+
+func TestParseNodeIDString(t *testing.T) {
+	guid := uuid.MustParse("5ce9dbce-5d79-434c-9ac3-1cfba9a6e92c")
+	cases := []struct {
+		in   string
+		want ua.NodeID
+	}{
+		{"i=85", ua.NewNodeIDNumeric(0, 85)},
+		{"ns=2;i=4294967295", ua.NewNodeIDNumeric(2, 4294967295)},
+		{"ns=2;i=0", ua.NewNodeIDNumeric(2, 0)},
+		{"s=Demo", ua.NewNodeIDString(0, "Demo")},
+		{"ns=2;s=Demo.Static.Scalar.Float", ua.NewNodeIDString(2, "Demo.Static.Scalar.Float")},
+		{"ns=2;s=a;b=c", ua.NewNodeIDString(2, "a;b=c")},
+		{"ns=2;s=", ua.NewNodeIDString(2, "")},
+		{"g=5ce9dbce-5d79-434c-9ac3-1cfba9a6e92c", ua.NewNodeIDGUID(0, guid)},
+		{"ns=2;g=5CE9DBCE-5D79-434C-9AC3-1CFBA9A6E92C", ua.NewNodeIDGUID(2, guid)},
+		{"ns=2;b=YWJjZA==", ua.NewNodeIDOpaque(2, ua.ByteString("abcd"))},
+		{"ns=2;b=", ua.NewNodeIDOpaque(2, ua.ByteString(""))},
+		// the null NodeID, and strings that are not NodeIDs.
+		{"i=0", nil},
+		{"", nil},
+		{"ns=2", nil},
+		{"ns=;i=1", nil},
+		{"ns=65536;i=1", nil},
+		{"i=-1", nil},
+		{"i=4294967296", nil},
+		{"x=1", nil},
+		{"ns=2;g=not-a-guid", nil},
+		{"ns=2;b=!!", nil},
+	}
+	for _, c := range cases {
+		if got := ua.ParseNodeIDString(c.in); got != c.want {
+			t.Errorf("ParseNodeIDString(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestNodeIDRoundTrip(t *testing.T) {
+	for _, id := range []ua.NodeID{
+		ua.NewNodeIDNumeric(0, 85),
+		ua.NewNodeIDNumeric(3, 1),
+		ua.NewNodeIDString(0, "Demo"),
+		ua.NewNodeIDString(2, ""),
+		ua.NewNodeIDString(2, "ns=1;i=1"),
+		ua.NewNodeIDGUID(2, uuid.MustParse("5ce9dbce-5d79-434c-9ac3-1cfba9a6e92c")),
+		ua.NewNodeIDGUID(0, uuid.UUID{}),
+		ua.NewNodeIDOpaque(2, ua.ByteString("abcd")),
+		ua.NewNodeIDOpaque(2, ua.ByteString([]byte{0, 0xff, ';', '='})),
+		ua.NewNodeIDOpaque(0, ua.ByteString("")),
+	} {
+		if got := ua.ParseNodeIDString(id.String()); got != id {
+			t.Errorf("%s: expected %v from the string form, got %v", id, id, got)
+		}
+		b, err := json.Marshal(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ua.ParseNodeIDBytes(b); err != nil || got != id {
+			t.Errorf("%s: expected %v from the JSON form %s, got %v, %v", id, id, b, got, err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		if got := ua.ParseNodeID(m); got != id {
+			t.Errorf("%s: expected %v from the decoded JSON form, got %v", id, id, got)
+		}
+		if got := ua.ParseExpandedNodeID(id.String()).NodeID; got != id {
+			t.Errorf("%s: expected %v from the expanded string form, got %v", id, id, got)
+		}
+	}
+	if got := ua.ParseExpandedNodeID("nsu=urn:test;x=1"); got != ua.NilExpandedNodeID {
+		t.Errorf("expected the null ExpandedNodeID for an invalid string, got %v", got)
+	}
+}
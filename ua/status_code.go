@@ -106,6 +106,8 @@ const (
 	HistorianBitsMask uint32 = 0x0000001F
 	// HistorianBitsCalculated - A data value which was calculated.
 	HistorianBitsCalculated uint32 = 0x00000001
+	// HistorianBitsExtraData - A raw data value returned in addition to the requested interval, such as a bounding value.
+	HistorianBitsExtraData uint32 = 0x00000008
 	// HistorianBitsInterpolated - A data value which was interpolated.
 	HistorianBitsInterpolated uint32 = 0x00000010
 	// HistorianBitsPartial - A data value which was calculated with an incomplete interval.
@@ -8,4 +8,5 @@ const (
 	TransportProfileURIHttpsXmlOrBinaryTransport = "http://opcfoundation.org/UA-Profile/Transport/https-uasoapxml-uabinary"
 	TransportProfileURIHttpsXmlTransport         = "http://opcfoundation.org/UA-Profile/Transport/https-uasoapxml"
 	TransportProfileURIHttpsBinaryTransport      = "http://opcfoundation.org/UA-Profile/Transport/https-uabinary"
+	TransportProfileURIWssUaBinaryTransport      = "http://opcfoundation.org/UA-Profile/Transport/wss-uasc-uabinary"
 )